@@ -3,6 +3,7 @@ module github.com/pangeacyber/pangea-go/pangea-sdk/v5
 go 1.25.0
 
 require (
+	github.com/cloudflare/circl v1.6.1
 	github.com/creasty/defaults v1.8.0
 	github.com/matoous/go-nanoid/v2 v2.1.0
 	github.com/rs/zerolog v1.35.0
@@ -0,0 +1,320 @@
+// Package jose implements the subset of JSON Web Signatures and JSON Web Keys
+// needed to verify tokens locally.
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed        = errors.New("jose: malformed token")
+	ErrInvalidSignature = errors.New("jose: invalid signature")
+	ErrUnsupportedAlg   = errors.New("jose: unsupported algorithm")
+	ErrExpired          = errors.New("jose: token is expired")
+	ErrNotYetValid      = errors.New("jose: token is not valid yet")
+	ErrInvalidIssuer    = errors.New("jose: invalid issuer")
+	ErrInvalidAudience  = errors.New("jose: invalid audience")
+)
+
+type Header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// JWS is a parsed compact JWS, not verified yet.
+type JWS struct {
+	Header       Header
+	Payload      []byte
+	SigningInput []byte
+	Signature    []byte
+}
+
+// Parse parses a compact serialized JWS.
+func Parse(token string) (*JWS, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	jws := &JWS{
+		Payload:      payload,
+		SigningInput: []byte(parts[0] + "." + parts[1]),
+		Signature:    signature,
+	}
+	if err := json.Unmarshal(header, &jws.Header); err != nil {
+		return nil, ErrMalformed
+	}
+	if jws.Header.Alg == "" || jws.Header.Alg == "none" {
+		return nil, ErrUnsupportedAlg
+	}
+	return jws, nil
+}
+
+// Asymmetric reports whether alg is a signature algorithm that can be verified
+// with a public key.
+func Asymmetric(alg string) bool {
+	_, ok := algHashes[alg]
+	return ok
+}
+
+var algHashes = map[string]crypto.Hash{
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"PS256": crypto.SHA256,
+	"PS384": crypto.SHA384,
+	"PS512": crypto.SHA512,
+	"EdDSA": 0,
+}
+
+// Verify verifies the signature of the JWS with key.
+func (j *JWS) Verify(key crypto.PublicKey) error {
+	hash, ok := algHashes[j.Header.Alg]
+	if !ok {
+		return ErrUnsupportedAlg
+	}
+
+	var digest []byte
+	if hash != 0 {
+		h := hash.New()
+		h.Write(j.SigningInput)
+		digest = h.Sum(nil)
+	}
+
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(j.Header.Alg, "ES") {
+			return ErrUnsupportedAlg
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(j.Signature) != 2*size {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(j.Signature[:size])
+		s := new(big.Int).SetBytes(j.Signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return ErrInvalidSignature
+		}
+	case *rsa.PublicKey:
+		var err error
+		switch {
+		case strings.HasPrefix(j.Header.Alg, "RS"):
+			err = rsa.VerifyPKCS1v15(k, hash, digest, j.Signature)
+		case strings.HasPrefix(j.Header.Alg, "PS"):
+			err = rsa.VerifyPSS(k, hash, digest, j.Signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		default:
+			return ErrUnsupportedAlg
+		}
+		if err != nil {
+			return ErrInvalidSignature
+		}
+	case ed25519.PublicKey:
+		if j.Header.Alg != "EdDSA" {
+			return ErrUnsupportedAlg
+		}
+		if !ed25519.Verify(k, j.SigningInput, j.Signature) {
+			return ErrInvalidSignature
+		}
+	default:
+		return fmt.Errorf("jose: unsupported key type %T", key)
+	}
+	return nil
+}
+
+// JWK holds the public fields of a JSON Web Key.
+type JWK struct {
+	Kty string
+	Crv string
+	X   string
+	Y   string
+	N   string
+	E   string
+}
+
+// PublicKey decodes the public key of the JWK.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("jose: unsupported curve %q", k.Crv)
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if x.BitLen() > size*8 || y.BitLen() > size*8 {
+			return nil, errors.New("jose: invalid EC public key")
+		}
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		x.FillBytes(point[1 : 1+size])
+		y.FillBytes(point[1+size:])
+		key, err := ecdsa.ParseUncompressedPublicKey(curve, point)
+		if err != nil {
+			return nil, errors.New("jose: invalid EC public key")
+		}
+		return key, nil
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("jose: invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("jose: unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("jose: invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("jose: unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("jose: invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Audience is the aud claim, either a string or an array of strings.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = Audience{s}
+		return nil
+	}
+	var l []string
+	if err := json.Unmarshal(b, &l); err != nil {
+		return err
+	}
+	*a = l
+	return nil
+}
+
+// NumericDate is a JWT date, in seconds since the epoch.
+type NumericDate struct {
+	time.Time
+}
+
+func (d *NumericDate) UnmarshalJSON(b []byte) error {
+	var f float64
+	if err := json.Unmarshal(b, &f); err != nil {
+		return err
+	}
+	sec := int64(f)
+	d.Time = time.Unix(sec, int64((f-float64(sec))*1e9))
+	return nil
+}
+
+func (d NumericDate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Unix())
+}
+
+// Claims are the registered claims of a JWT.
+type Claims struct {
+	Issuer    string       `json:"iss,omitempty"`
+	Subject   string       `json:"sub,omitempty"`
+	Audience  Audience     `json:"aud,omitempty"`
+	ExpiresAt *NumericDate `json:"exp,omitempty"`
+	NotBefore *NumericDate `json:"nbf,omitempty"`
+	IssuedAt  *NumericDate `json:"iat,omitempty"`
+	ID        string       `json:"jti,omitempty"`
+}
+
+type Expected struct {
+	// Required issuer, if not empty.
+	Issuer string
+
+	// Audiences of which the token must have one, if not empty.
+	Audience []string
+
+	// Tolerated clock skew.
+	Leeway time.Duration
+
+	// Time to validate at. Defaults to the current time.
+	Time time.Time
+}
+
+// Validate validates the time based claims, the issuer and the audience.
+func (c *Claims) Validate(e Expected) error {
+	now := e.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if c.ExpiresAt != nil && !now.Before(c.ExpiresAt.Add(e.Leeway)) {
+		return ErrExpired
+	}
+	if c.NotBefore != nil && now.Add(e.Leeway).Before(c.NotBefore.Time) {
+		return ErrNotYetValid
+	}
+	if e.Issuer != "" && c.Issuer != e.Issuer {
+		return ErrInvalidIssuer
+	}
+	if len(e.Audience) > 0 {
+		for _, want := range e.Audience {
+			for _, got := range c.Audience {
+				if want == got {
+					return nil
+				}
+			}
+		}
+		return ErrInvalidAudience
+	}
+	return nil
+}
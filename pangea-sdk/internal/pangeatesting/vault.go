@@ -0,0 +1,305 @@
+package pangeatesting
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+// VaultRequest is a request received by a FakeVault.
+type VaultRequest struct {
+	Path string
+	Body json.RawMessage
+}
+
+// FakeVault is an in-memory Vault serving the item endpoints: list, get, get
+// bulk, update, state change, and the creation and rotation of folders, secrets and
+// keys. Other endpoints, e.g. encrypt, are added with Handle.
+type FakeVault struct {
+	// The items, in creation order.
+	Items []*vault.ItemData
+
+	// The requests received, in order.
+	Requests []VaultRequest
+
+	// The number of items per page of list results. All items are listed
+	// at once if zero.
+	ListPageSize int
+
+	t        *testing.T
+	mu       sync.Mutex
+	handlers map[string]func(body []byte) (any, error)
+	created  int
+	url      *url.URL
+}
+
+// NewFakeVault starts a FakeVault serving items.
+//
+// Handlers run with the fake locked. Their errors are returned as validation
+// errors.
+func NewFakeVault(t *testing.T, items ...*vault.ItemData) (*FakeVault, func()) {
+	mux, serverURL, teardown := SetupServer()
+	f := &FakeVault{Items: items, t: t, handlers: map[string]func(body []byte) (any, error){}, url: serverURL}
+
+	mux.HandleFunc("/v2/", f.serve)
+	f.Handle("v2/list", f.list)
+	f.Handle("v2/get", f.get)
+	f.Handle("v2/get_bulk", f.getBulk)
+	f.Handle("v2/update", f.update)
+	f.Handle("v2/state/change", f.stateChange)
+	f.Handle("v2/folder/create", f.create)
+	f.Handle("v2/secret/store", f.create)
+	f.Handle("v2/key/generate", f.create)
+	f.Handle("v2/key/store", f.create)
+	f.Handle("v2/secret/rotate", f.Rotate)
+	f.Handle("v2/key/rotate", f.Rotate)
+	return f, teardown
+}
+
+// Client returns a Vault client of the fake.
+func (f *FakeVault) Client() vault.Client {
+	return vault.New(TestConfig(f.url))
+}
+
+// Handle sets the handler of path, e.g. "v2/encrypt", replacing the default
+// one.
+func (f *FakeVault) Handle(path string, fn func(body []byte) (any, error)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[path] = fn
+}
+
+// Find returns the item id, or nil.
+func (f *FakeVault) Find(id string) *vault.ItemData {
+	for _, item := range f.Items {
+		if item.ID == id {
+			return item
+		}
+	}
+	return nil
+}
+
+// Paths returns the paths of the requests received, in order.
+func (f *FakeVault) Paths() []string {
+	paths := make([]string, len(f.Requests))
+	for i, r := range f.Requests {
+		paths[i] = r.Path
+	}
+	return paths
+}
+
+// Bodies returns the bodies of the requests received on any of paths, in
+// order.
+func (f *FakeVault) Bodies(paths ...string) []json.RawMessage {
+	var bodies []json.RawMessage
+	for _, r := range f.Requests {
+		if slices.Contains(paths, r.Path) {
+			bodies = append(bodies, r.Body)
+		}
+	}
+	return bodies
+}
+
+func (f *FakeVault) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	var body json.RawMessage
+	assert.NoError(f.t, json.NewDecoder(r.Body).Decode(&body))
+	f.Requests = append(f.Requests, VaultRequest{Path: path, Body: body})
+
+	fn, ok := f.handlers[path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	result, err := fn(body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"request_id": "some-id", "status": "ValidationError", "result": {"errors": []}, "summary": %q}`, err.Error())
+		return
+	}
+	b, _ := json.Marshal(result)
+	fmt.Fprintf(w, `{"request_id": "some-id", "status": "Success", "result": %s, "summary": "ok"}`, b)
+}
+
+func (f *FakeVault) list(body []byte) (any, error) {
+	var input vault.ListRequest
+	if err := json.Unmarshal(body, &input); err != nil {
+		return nil, err
+	}
+	start, _ := strconv.Atoi(input.Last)
+	end := len(f.Items)
+	if f.ListPageSize > 0 {
+		end = min(start+f.ListPageSize, end)
+	}
+	result := vault.ListResult{Items: []vault.ListItemData{}}
+	for _, item := range f.Items[start:end] {
+		listed := *item
+		listed.ItemVersions = nil
+		result.Items = append(result.Items, vault.ListItemData{ItemData: listed})
+	}
+	if end < len(f.Items) {
+		result.Last = strconv.Itoa(end)
+	}
+	return result, nil
+}
+
+func (f *FakeVault) get(body []byte) (any, error) {
+	var input vault.GetRequest
+	if err := json.Unmarshal(body, &input); err != nil {
+		return nil, err
+	}
+	item := f.Find(input.ID)
+	if item == nil {
+		return nil, errors.New("item not found")
+	}
+	return item, nil
+}
+
+// getBulk serves the items of the "id__in" filter, or all items, with their
+// versions.
+func (f *FakeVault) getBulk(body []byte) (any, error) {
+	var input struct {
+		Filter struct {
+			IDs []string `json:"id__in"`
+		} `json:"filter"`
+		Last string `json:"last"`
+		Size int    `json:"size"`
+	}
+	if err := json.Unmarshal(body, &input); err != nil {
+		return nil, err
+	}
+	items := f.Items
+	if input.Filter.IDs != nil {
+		items = slices.DeleteFunc(slices.Clone(items), func(item *vault.ItemData) bool {
+			return !slices.Contains(input.Filter.IDs, item.ID)
+		})
+	}
+	start, _ := strconv.Atoi(input.Last)
+	start = min(start, len(items))
+	end := len(items)
+	if input.Size > 0 {
+		end = min(start+input.Size, end)
+	}
+	result := vault.GetBulkResult{Items: []vault.ItemData{}}
+	for _, item := range items[start:end] {
+		result.Items = append(result.Items, *item)
+	}
+	if end < len(items) {
+		result.Last = strconv.Itoa(end)
+	}
+	return result, nil
+}
+
+func (f *FakeVault) create(body []byte) (any, error) {
+	var input struct {
+		vault.ItemData
+		Secret string `json:"secret"`
+	}
+	if err := json.Unmarshal(body, &input); err != nil {
+		return nil, err
+	}
+	f.created++
+	item := &input.ItemData
+	item.ID = fmt.Sprintf("pvi_new%d", f.created)
+	item.Enabled = true
+	if item.Folder == "" {
+		item.Folder = "/"
+	}
+	if item.Type == "" {
+		item.Type = string(vault.ITfolder)
+	} else {
+		item.NumVersions = 1
+		item.ItemVersions = []vault.ItemVersionData{{Version: 1, State: string(vault.IVSactive)}}
+		if input.Secret != "" {
+			item.ItemVersions[0].Secret = &input.Secret
+		}
+	}
+	f.Items = append(f.Items, item)
+	return item, nil
+}
+
+// Rotate is the default handler of the rotate endpoints. It adds an active
+// version to the item, moving the previous one to the rotation state of the
+// request.
+func (f *FakeVault) Rotate(body []byte) (any, error) {
+	var input struct {
+		vault.CommonRotateRequest
+		Secret string `json:"secret"`
+	}
+	if err := json.Unmarshal(body, &input); err != nil {
+		return nil, err
+	}
+	item := f.Find(input.ID)
+	if item == nil {
+		return nil, errors.New("item not found")
+	}
+	state := cmp.Or(string(input.RotationState), string(vault.IVSdeactivated))
+	for i := range item.ItemVersions {
+		if item.ItemVersions[i].State == string(vault.IVSactive) {
+			item.ItemVersions[i].State = state
+		}
+	}
+	item.NumVersions++
+	v := vault.ItemVersionData{Version: item.NumVersions, State: string(vault.IVSactive)}
+	if input.Secret != "" {
+		v.Secret = &input.Secret
+	}
+	item.ItemVersions = append(item.ItemVersions, v)
+	return item, nil
+}
+
+func (f *FakeVault) update(body []byte) (any, error) {
+	var input vault.UpdateRequest
+	if err := json.Unmarshal(body, &input); err != nil {
+		return nil, err
+	}
+	item := f.Find(input.ID)
+	if item == nil {
+		return nil, errors.New("item not found")
+	}
+	if input.Metadata != nil {
+		item.Metadata = input.Metadata
+	}
+	if input.Tags != nil {
+		item.Tags = input.Tags
+	}
+	item.RotationFrequency = cmp.Or(input.RotationFrequency, item.RotationFrequency)
+	item.RotationState = cmp.Or(string(input.RotationState), item.RotationState)
+	item.RotationGracePeriod = cmp.Or(input.RotationGracePeriod, item.RotationGracePeriod)
+	item.DisabledAt = cmp.Or(input.DisabledAt, item.DisabledAt)
+	if input.Enabled != nil {
+		item.Enabled = *input.Enabled
+	}
+	return item, nil
+}
+
+func (f *FakeVault) stateChange(body []byte) (any, error) {
+	var input vault.StateChangeRequest
+	if err := json.Unmarshal(body, &input); err != nil {
+		return nil, err
+	}
+	item := f.Find(input.ID)
+	if item == nil || input.Version == nil {
+		return nil, errors.New("item version not found")
+	}
+	for i := range item.ItemVersions {
+		if item.ItemVersions[i].Version == *input.Version {
+			item.ItemVersions[i].State = string(input.State)
+			return item, nil
+		}
+	}
+	return nil, errors.New("item version not found")
+}
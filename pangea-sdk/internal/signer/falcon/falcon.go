@@ -0,0 +1,167 @@
+// Package falcon verifies Falcon-1024 signatures of the round 3 submission to
+// the NIST post-quantum standardization, in the encodings of the reference
+// implementation: public keys are a header byte followed by the 14-bit
+// coefficients of h, and signatures a header byte, a 40 byte nonce and the
+// compressed coefficients of s2.
+package falcon
+
+import (
+	"crypto/sha3"
+)
+
+const (
+	logN = 10
+	n    = 1 << logN
+	q    = 12289
+
+	// PublicKeySize is the size of the public keys.
+	PublicKeySize = 1 + n*14/8
+
+	nonceSize = 40
+
+	// The bound of the squared norm of signatures.
+	normBound = 70265242
+)
+
+// PublicKey is a Falcon-1024 public key.
+type PublicKey struct {
+	h [n]int32
+}
+
+// NewPublicKey parses a public key.
+func NewPublicKey(b []byte) (*PublicKey, bool) {
+	if len(b) != PublicKeySize || b[0] != logN {
+		return nil, false
+	}
+	pk := &PublicKey{}
+	var acc uint32
+	accLen := 0
+	i := 0
+	for _, c := range b[1:] {
+		acc = acc<<8 | uint32(c)
+		accLen += 8
+		if accLen >= 14 {
+			accLen -= 14
+			v := acc >> accLen & 0x3fff
+			if v >= q {
+				return nil, false
+			}
+			pk.h[i] = int32(v)
+			i++
+		}
+	}
+	return pk, true
+}
+
+// Verify reports whether sig is a valid signature of msg by pk.
+func (pk *PublicKey) Verify(msg, sig []byte) bool {
+	if len(sig) < 1+nonceSize+1 || sig[0] != 0x30+logN {
+		return false
+	}
+	s2, ok := decompress(sig[1+nonceSize:])
+	if !ok {
+		return false
+	}
+	c := hashToPoint(sig[1:1+nonceSize], msg)
+
+	// s1 = c - s2 h mod x^n + 1, and the signature is valid if (s1, s2) is
+	// short.
+	var s2h [n]int64
+	for i, a := range s2 {
+		if a == 0 {
+			continue
+		}
+		for j, b := range pk.h {
+			if k := i + j; k < n {
+				s2h[k] += int64(a) * int64(b)
+			} else {
+				s2h[k-n] -= int64(a) * int64(b)
+			}
+		}
+	}
+	var norm int64
+	for i := range c {
+		s1 := (int64(c[i]) - s2h[i]) % q
+		if s1 < 0 {
+			s1 += q
+		}
+		if s1 > q/2 {
+			s1 -= q
+		}
+		norm += s1*s1 + int64(s2[i])*int64(s2[i])
+	}
+	return norm <= normBound
+}
+
+// hashToPoint hashes the nonce and the message to a polynomial mod q.
+func hashToPoint(nonce, msg []byte) [n]int32 {
+	h := sha3.NewSHAKE256()
+	h.Write(nonce)
+	h.Write(msg)
+	var c [n]int32
+	var buf [2]byte
+	for i := 0; i < n; {
+		h.Read(buf[:])
+		if v := uint32(buf[0])<<8 | uint32(buf[1]); v < 5*q {
+			c[i] = int32(v % q)
+			i++
+		}
+	}
+	return c
+}
+
+// decompress decodes the compressed coefficients of s2: a sign bit, the 7 low
+// bits of the absolute value, and its high bits in unary.
+func decompress(b []byte) ([n]int32, bool) {
+	var s [n]int32
+	var acc uint32
+	accLen := 0
+	next := func() (uint32, bool) {
+		if accLen == 0 {
+			if len(b) == 0 {
+				return 0, false
+			}
+			acc = acc<<8 | uint32(b[0])
+			b = b[1:]
+			accLen = 8
+		}
+		accLen--
+		return acc >> accLen & 1, true
+	}
+	for i := range s {
+		var v uint32
+		for j := 0; j < 8; j++ {
+			bit, ok := next()
+			if !ok {
+				return s, false
+			}
+			v = v<<1 | bit
+		}
+		negative, m := v&0x80 != 0, int32(v&0x7f)
+		for {
+			bit, ok := next()
+			if !ok {
+				return s, false
+			}
+			if bit == 1 {
+				break
+			}
+			if m += 128; m > 2047 {
+				return s, false
+			}
+		}
+		// Minus zero has a single encoding.
+		if negative && m == 0 {
+			return s, false
+		}
+		if negative {
+			m = -m
+		}
+		s[i] = m
+	}
+	// The padding bits and bytes are zero.
+	if acc&(1<<accLen-1) != 0 || len(b) != 0 {
+		return s, false
+	}
+	return s, true
+}
@@ -0,0 +1,165 @@
+//go:build unit
+
+package falcon
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSignature returns a public key and a signature of msg by it. Without a
+// Falcon signer, the key is chosen to fit the signature: s1 is short, s2 is
+// ±x^k and h = (c - s1) s2^-1 mod x^n + 1.
+func testSignature(t *testing.T, msg []byte) ([]byte, []byte) {
+	t.Helper()
+	nonce := make([]byte, nonceSize)
+	rand.Read(nonce)
+	c := hashToPoint(nonce, msg)
+
+	k := randomInt(t, n)
+	sign := int32(1)
+	if randomInt(t, 2) == 1 {
+		sign = -1
+	}
+	var s2 [n]int32
+	s2[k] = sign
+
+	// s2^-1 = sign x^-k, and x^-k = -x^(n-k).
+	var h [n]int32
+	for i := range c {
+		v := (c[i] - int32(randomInt(t, 201)-100)) * sign
+		j := i - k
+		if j < 0 {
+			j += n
+			v = -v
+		}
+		h[j] = (v%q + q) % q
+	}
+	return encodePublicKey(h), append(append([]byte{0x30 + logN}, nonce...), compress(s2)...)
+}
+
+func randomInt(t *testing.T, max int) int {
+	t.Helper()
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	require.NoError(t, err)
+	return int(v.Int64())
+}
+
+func encodePublicKey(h [n]int32) []byte {
+	b := []byte{logN}
+	var acc uint32
+	accLen := 0
+	for _, v := range h {
+		acc = acc<<14 | uint32(v)
+		accLen += 14
+		for accLen >= 8 {
+			accLen -= 8
+			b = append(b, byte(acc>>accLen))
+		}
+	}
+	return b
+}
+
+// compress encodes coefficients as decompress decodes them.
+func compress(s [n]int32) []byte {
+	var bits []byte
+	for _, v := range s {
+		var sign byte
+		if v < 0 {
+			sign, v = 1, -v
+		}
+		bits = append(bits, sign)
+		for j := 6; j >= 0; j-- {
+			bits = append(bits, byte(v>>j&1))
+		}
+		for j := int32(0); j < v>>7; j++ {
+			bits = append(bits, 0)
+		}
+		bits = append(bits, 1)
+	}
+	b := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		b[i/8] |= bit << (7 - i%8)
+	}
+	return b
+}
+
+func TestVerify(t *testing.T) {
+	msg := []byte("message")
+	publicKey, sig := testSignature(t, msg)
+	require.Len(t, publicKey, PublicKeySize)
+	pk, ok := NewPublicKey(publicKey)
+	require.True(t, ok)
+
+	assert.True(t, pk.Verify(msg, sig))
+	assert.False(t, pk.Verify([]byte("other message"), sig))
+
+	otherKey, _ := testSignature(t, msg)
+	other, ok := NewPublicKey(otherKey)
+	require.True(t, ok)
+	assert.False(t, other.Verify(msg, sig))
+
+	for name, tamper := range map[string]func([]byte) []byte{
+		"header":        func(b []byte) []byte { b[0] = 0x39; return b },
+		"nonce":         func(b []byte) []byte { b[1] ^= 1; return b },
+		"s2":            func(b []byte) []byte { b[len(b)-1] ^= 0x80; return b },
+		"trailing byte": func(b []byte) []byte { return append(b, 0) },
+		"truncated":     func(b []byte) []byte { return b[:len(b)-1] },
+		"without s2":    func(b []byte) []byte { return b[:1+nonceSize] },
+	} {
+		assert.False(t, pk.Verify(msg, tamper(append([]byte{}, sig...))), name)
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	var s [n]int32
+	for i := range s {
+		s[i] = int32(randomInt(t, 4095) - 2047)
+	}
+	decoded, ok := decompress(compress(s))
+	assert.True(t, ok)
+	assert.Equal(t, s, decoded)
+
+	// Minus zero.
+	var zero [n]int32
+	b := compress(zero)
+	b[0] |= 0x80
+	_, ok = decompress(b)
+	assert.False(t, ok)
+
+	// A non-zero padding bit, after the 9217 bits of the coefficients.
+	zero[0] = 128
+	b = compress(zero)
+	_, ok = decompress(b)
+	assert.True(t, ok)
+	b[len(b)-1] |= 1
+	_, ok = decompress(b)
+	assert.False(t, ok)
+
+	// Out of range.
+	s[0] = 2048
+	_, ok = decompress(compress(s))
+	assert.False(t, ok)
+}
+
+func TestNewPublicKey(t *testing.T) {
+	publicKey, _ := testSignature(t, []byte("message"))
+
+	_, ok := NewPublicKey(publicKey[:len(publicKey)-1])
+	assert.False(t, ok)
+
+	b := append([]byte{}, publicKey...)
+	b[0] = 9
+	_, ok = NewPublicKey(b)
+	assert.False(t, ok)
+
+	// The first coefficient is q.
+	b = append([]byte{}, publicKey...)
+	b[1], b[2] = q>>6, b[2]&0x03|q<<2&0xfc
+	_, ok = NewPublicKey(b)
+	assert.False(t, ok)
+}
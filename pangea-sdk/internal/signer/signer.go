@@ -12,7 +12,6 @@ import (
 	"os"
 	"strings"
 
-	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/vault"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -71,7 +70,7 @@ func (s signerEd25519) PublicKey() (string, error) {
 }
 
 func (s signerEd25519) GetAlgorithm() string {
-	return string(vault.AAed25519)
+	return "ED25519"
 }
 
 func NewVerifierFromPubKey(pkPem string) (Verifier, error) {
@@ -0,0 +1,314 @@
+// Package sphincsplus verifies SPHINCS+ signatures of the round 3 submission
+// to the NIST post-quantum standardization (version 3.0), for the fast
+// parameter sets with the SHAKE256 and SHA-256 hash functions, in their
+// simple and robust variants. Signatures are in the encoding of the reference
+// implementation: R, the FORS signature, then the hypertree signature.
+package sphincsplus
+
+import (
+	"crypto/sha256"
+	"crypto/sha3"
+	"crypto/subtle"
+	"encoding/binary"
+)
+
+// Params is a SPHINCS+ parameter set.
+type Params struct {
+	n, h, d, a, k int
+	sha2, robust  bool
+}
+
+var (
+	SHAKE256_128fSimple = &Params{n: 16, h: 66, d: 22, a: 6, k: 33}
+	SHAKE256_128fRobust = &Params{n: 16, h: 66, d: 22, a: 6, k: 33, robust: true}
+	SHAKE256_192fSimple = &Params{n: 24, h: 66, d: 22, a: 8, k: 33}
+	SHAKE256_192fRobust = &Params{n: 24, h: 66, d: 22, a: 8, k: 33, robust: true}
+	SHAKE256_256fSimple = &Params{n: 32, h: 68, d: 17, a: 9, k: 35}
+	SHAKE256_256fRobust = &Params{n: 32, h: 68, d: 17, a: 9, k: 35, robust: true}
+	SHA256_128fSimple   = &Params{n: 16, h: 66, d: 22, a: 6, k: 33, sha2: true}
+	SHA256_128fRobust   = &Params{n: 16, h: 66, d: 22, a: 6, k: 33, sha2: true, robust: true}
+	SHA256_192fSimple   = &Params{n: 24, h: 66, d: 22, a: 8, k: 33, sha2: true}
+	SHA256_192fRobust   = &Params{n: 24, h: 66, d: 22, a: 8, k: 33, sha2: true, robust: true}
+	SHA256_256fSimple   = &Params{n: 32, h: 68, d: 17, a: 9, k: 35, sha2: true}
+	SHA256_256fRobust   = &Params{n: 32, h: 68, d: 17, a: 9, k: 35, sha2: true, robust: true}
+)
+
+// The Winternitz parameter, and the number of chains of WOTS+ signatures for
+// the checksum.
+const (
+	w    = 16
+	logW = 4
+	len2 = 3
+)
+
+// Address types.
+const (
+	addrWOTS = iota
+	addrWOTSPK
+	addrTree
+	addrFORSTree
+	addrFORSPK
+)
+
+// PublicKeySize returns the size of the public keys, PK.seed || PK.root.
+func (p *Params) PublicKeySize() int {
+	return 2 * p.n
+}
+
+// SignatureSize returns the size of the signatures.
+func (p *Params) SignatureSize() int {
+	return p.n + p.forsBytes() + p.d*(p.wotsLen()+p.treeHeight())*p.n
+}
+
+func (p *Params) wotsLen() int {
+	return 2*p.n + len2
+}
+
+func (p *Params) treeHeight() int {
+	return p.h / p.d
+}
+
+func (p *Params) forsBytes() int {
+	return p.k * (p.a + 1) * p.n
+}
+
+// Verify reports whether sig is a valid signature of msg by publicKey.
+func (p *Params) Verify(publicKey, msg, sig []byte) bool {
+	if len(publicKey) != p.PublicKeySize() || len(sig) != p.SignatureSize() {
+		return false
+	}
+	n, hp := p.n, p.treeHeight()
+	seed, root := publicKey[:n], publicKey[n:]
+
+	md, tree, leaf := p.hashMessage(sig[:n], publicKey, msg)
+	sig = sig[n:]
+
+	var forsAddr address
+	forsAddr.setTree(tree)
+	forsAddr.setKeypair(leaf)
+	node := p.forsRoot(seed, sig[:p.forsBytes()], md, forsAddr)
+	sig = sig[p.forsBytes():]
+
+	wotsBytes := p.wotsLen() * n
+	for layer := 0; layer < p.d; layer++ {
+		var wotsAddr, pkAddr, treeAddr address
+		for _, a := range []*address{&wotsAddr, &pkAddr, &treeAddr} {
+			a.setLayer(layer)
+			a.setTree(tree)
+		}
+		wotsAddr.setType(addrWOTS)
+		wotsAddr.setKeypair(leaf)
+		pkAddr.setType(addrWOTSPK)
+		pkAddr.setKeypair(leaf)
+		treeAddr.setType(addrTree)
+
+		wotsPK := p.wotsPublicKey(seed, sig[:wotsBytes], node, wotsAddr)
+		sig = sig[wotsBytes:]
+		node = p.computeRoot(seed, p.thash(seed, &pkAddr, wotsPK), leaf, 0, sig[:hp*n], treeAddr)
+		sig = sig[hp*n:]
+
+		leaf = uint32(tree & (1<<hp - 1))
+		tree >>= hp
+	}
+	return subtle.ConstantTimeCompare(node, root) == 1
+}
+
+// hashMessage returns the FORS message digest, and the indexes of the tree
+// and leaf signing it.
+func (p *Params) hashMessage(r, publicKey, msg []byte) ([]byte, uint64, uint32) {
+	treeBits := p.h - p.treeHeight()
+	treeBytes := (treeBits + 7) / 8
+	leafBits := p.treeHeight()
+	leafBytes := (leafBits + 7) / 8
+	mdBytes := (p.k*p.a + 7) / 8
+
+	digest := make([]byte, mdBytes+treeBytes+leafBytes)
+	if p.sha2 {
+		h := sha256.New()
+		h.Write(r)
+		h.Write(publicKey)
+		h.Write(msg)
+		mgf1(digest, h.Sum(nil))
+	} else {
+		h := sha3.NewSHAKE256()
+		h.Write(r)
+		h.Write(publicKey)
+		h.Write(msg)
+		h.Read(digest)
+	}
+
+	md := digest[:mdBytes]
+	tree := bigEndian(digest[mdBytes : mdBytes+treeBytes])
+	if treeBits < 64 {
+		tree &= 1<<treeBits - 1
+	}
+	leaf := uint32(bigEndian(digest[mdBytes+treeBytes:])) & (1<<leafBits - 1)
+	return md, tree, leaf
+}
+
+// forsRoot returns the FORS public key of sig, with addr holding the tree and
+// keypair of the signing leaf.
+func (p *Params) forsRoot(seed, sig, md []byte, addr address) []byte {
+	n := p.n
+	treeAddr, pkAddr := addr, addr
+	treeAddr.setType(addrFORSTree)
+	pkAddr.setType(addrFORSPK)
+
+	roots := make([]byte, 0, p.k*n)
+	for i, index := range p.forsIndexes(md) {
+		indexOffset := uint32(i) << p.a
+
+		treeAddr.setTreeHeight(0)
+		treeAddr.setTreeIndex(index + indexOffset)
+		leaf := p.thash(seed, &treeAddr, sig[:n])
+		sig = sig[n:]
+		roots = append(roots, p.computeRoot(seed, leaf, index, indexOffset, sig[:p.a*n], treeAddr)...)
+		sig = sig[p.a*n:]
+	}
+	return p.thash(seed, &pkAddr, roots)
+}
+
+// forsIndexes returns the indexes of the leaves of the FORS trees signing md,
+// read least significant bit first.
+func (p *Params) forsIndexes(md []byte) []uint32 {
+	indexes := make([]uint32, p.k)
+	offset := 0
+	for i := range indexes {
+		for j := 0; j < p.a; j++ {
+			indexes[i] |= uint32(md[offset>>3]>>(offset&7)&1) << j
+			offset++
+		}
+	}
+	return indexes
+}
+
+// chainLengths returns the positions in the WOTS+ chains of the signature of
+// msg: its base 16 digits, then those of its checksum.
+func chainLengths(msg []byte) []int {
+	lengths := make([]int, 0, 2*len(msg)+len2)
+	csum := 0
+	for _, b := range msg {
+		lengths = append(lengths, int(b>>4), int(b&15))
+		csum += 2*(w-1) - int(b>>4) - int(b&15)
+	}
+	// The checksum is shifted so that its len2 digits are its high bits.
+	csum <<= (8 - len2*logW%8) % 8
+	for i := len2 - 1; i >= 0; i-- {
+		lengths = append(lengths, csum>>(4+4*i)&(w-1))
+	}
+	return lengths
+}
+
+// wotsPublicKey returns the WOTS+ public key of the signature sig of msg.
+func (p *Params) wotsPublicKey(seed, sig, msg []byte, addr address) []byte {
+	n := p.n
+	pk := make([]byte, 0, p.wotsLen()*n)
+	for i, start := range chainLengths(msg) {
+		addr.setChain(uint32(i))
+		out := sig[i*n : (i+1)*n]
+		for j := start; j < w-1; j++ {
+			addr.setHash(uint32(j))
+			out = p.thash(seed, &addr, out)
+		}
+		pk = append(pk, out...)
+	}
+	return pk
+}
+
+// computeRoot returns the root of the tree of a leaf at index, from its
+// authentication path.
+func (p *Params) computeRoot(seed, leaf []byte, index, indexOffset uint32, authPath []byte, addr address) []byte {
+	n := p.n
+	node := leaf
+	buf := make([]byte, 2*n)
+	for j := 0; j < len(authPath)/n; j++ {
+		sibling := authPath[j*n : (j+1)*n]
+		if index>>j&1 == 1 {
+			copy(buf, sibling)
+			copy(buf[n:], node)
+		} else {
+			copy(buf, node)
+			copy(buf[n:], sibling)
+		}
+		addr.setTreeHeight(uint32(j + 1))
+		addr.setTreeIndex(index>>(j+1) + indexOffset>>(j+1))
+		node = p.thash(seed, &addr, buf)
+	}
+	return node
+}
+
+// thash is the tweakable hash function of the parameter set.
+func (p *Params) thash(seed []byte, addr *address, in []byte) []byte {
+	if p.robust {
+		masked := make([]byte, len(in))
+		if p.sha2 {
+			mgf1(masked, append(append([]byte{}, seed...), addr.compressed()...))
+		} else {
+			h := sha3.NewSHAKE256()
+			h.Write(seed)
+			h.Write(addr[:])
+			h.Read(masked)
+		}
+		subtle.XORBytes(masked, masked, in)
+		in = masked
+	}
+
+	out := make([]byte, p.n)
+	if p.sha2 {
+		// PK.seed is padded to a full block.
+		h := sha256.New()
+		h.Write(seed)
+		h.Write(make([]byte, sha256.BlockSize-len(seed)))
+		h.Write(addr.compressed())
+		h.Write(in)
+		copy(out, h.Sum(nil))
+	} else {
+		h := sha3.NewSHAKE256()
+		h.Write(seed)
+		h.Write(addr[:])
+		h.Write(in)
+		h.Read(out)
+	}
+	return out
+}
+
+// mgf1 fills out with MGF1-SHA-256 of seed.
+func mgf1(out, seed []byte) {
+	var counter [4]byte
+	for i := uint32(0); len(out) > 0; i++ {
+		binary.BigEndian.PutUint32(counter[:], i)
+		h := sha256.New()
+		h.Write(seed)
+		h.Write(counter[:])
+		out = out[copy(out, h.Sum(nil)):]
+	}
+}
+
+func bigEndian(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// address is a hash function address, in its 32 byte SHAKE256 encoding.
+type address [32]byte
+
+func (a *address) setLayer(layer int)      { a[3] = byte(layer) }
+func (a *address) setTree(tree uint64)     { binary.BigEndian.PutUint64(a[8:], tree) }
+func (a *address) setType(t int)           { a[19] = byte(t) }
+func (a *address) setKeypair(kp uint32)    { binary.BigEndian.PutUint32(a[20:], kp) }
+func (a *address) setChain(chain uint32)   { binary.BigEndian.PutUint32(a[24:], chain) }
+func (a *address) setHash(hash uint32)     { binary.BigEndian.PutUint32(a[28:], hash) }
+func (a *address) setTreeHeight(h uint32)  { binary.BigEndian.PutUint32(a[24:], h) }
+func (a *address) setTreeIndex(idx uint32) { binary.BigEndian.PutUint32(a[28:], idx) }
+
+// compressed returns the 22 byte SHA-256 encoding of a.
+func (a *address) compressed() []byte {
+	c := make([]byte, 0, 22)
+	c = append(c, a[3])
+	c = append(c, a[8:16]...)
+	c = append(c, a[19])
+	return append(c, a[20:]...)
+}
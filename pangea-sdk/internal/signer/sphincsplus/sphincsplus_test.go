@@ -0,0 +1,199 @@
+//go:build unit
+
+package sphincsplus
+
+import (
+	"crypto/rand"
+	"crypto/sha3"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testKey signs messages for the tests. Its secret values are derived from
+// skSeed and their address with SHAKE256 rather than with the PRF of the
+// specification, which signatures do not depend on.
+type testKey struct {
+	p      *Params
+	skSeed []byte
+	seed   []byte
+	root   []byte
+}
+
+func newTestKey(p *Params) *testKey {
+	k := &testKey{p: p, skSeed: randomBytes(p.n), seed: randomBytes(p.n)}
+	k.root, _ = k.treeRoot(p.d-1, 0, 0)
+	return k
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
+
+func (k *testKey) publicKey() []byte {
+	return append(append([]byte{}, k.seed...), k.root...)
+}
+
+func (k *testKey) secret(addr address) []byte {
+	h := sha3.NewSHAKE256()
+	h.Write(k.skSeed)
+	h.Write(addr[:])
+	out := make([]byte, k.p.n)
+	h.Read(out)
+	return out
+}
+
+func (k *testKey) chain(x []byte, start, end int, addr address) []byte {
+	for j := start; j < end; j++ {
+		addr.setHash(uint32(j))
+		x = k.p.thash(k.seed, &addr, x)
+	}
+	return x
+}
+
+func wotsAddress(layer int, tree uint64, keypair uint32, t int) address {
+	var addr address
+	addr.setLayer(layer)
+	addr.setTree(tree)
+	addr.setType(t)
+	addr.setKeypair(keypair)
+	return addr
+}
+
+func (k *testKey) wotsSecret(layer int, tree uint64, keypair uint32, i int) []byte {
+	addr := wotsAddress(layer, tree, keypair, addrWOTS)
+	addr.setChain(uint32(i))
+	return k.secret(addr)
+}
+
+func (k *testKey) wotsLeaf(layer int, tree uint64, keypair uint32) []byte {
+	addr := wotsAddress(layer, tree, keypair, addrWOTS)
+	var pk []byte
+	for i := 0; i < k.p.wotsLen(); i++ {
+		addr.setChain(uint32(i))
+		pk = append(pk, k.chain(k.wotsSecret(layer, tree, keypair, i), 0, w-1, addr)...)
+	}
+	pkAddr := wotsAddress(layer, tree, keypair, addrWOTSPK)
+	return k.p.thash(k.seed, &pkAddr, pk)
+}
+
+func (k *testKey) wotsSign(msg []byte, layer int, tree uint64, keypair uint32) []byte {
+	addr := wotsAddress(layer, tree, keypair, addrWOTS)
+	var sig []byte
+	for i, end := range chainLengths(msg) {
+		addr.setChain(uint32(i))
+		sig = append(sig, k.chain(k.wotsSecret(layer, tree, keypair, i), 0, end, addr)...)
+	}
+	return sig
+}
+
+// merkle returns the root of the tree of leaves and the authentication path of
+// the leaf at index.
+func (k *testKey) merkle(leaves [][]byte, index, indexOffset uint32, addr address) ([]byte, []byte) {
+	var authPath []byte
+	level := leaves
+	for j := 0; len(level) > 1; j++ {
+		authPath = append(authPath, level[index>>j^1]...)
+		next := make([][]byte, 0, len(level)/2)
+		for i := 0; i < len(level); i += 2 {
+			addr.setTreeHeight(uint32(j + 1))
+			addr.setTreeIndex(uint32(i/2) + indexOffset>>(j+1))
+			next = append(next, k.p.thash(k.seed, &addr, append(append([]byte{}, level[i]...), level[i+1]...)))
+		}
+		level = next
+	}
+	return level[0], authPath
+}
+
+func (k *testKey) treeRoot(layer int, tree uint64, leaf uint32) ([]byte, []byte) {
+	leaves := make([][]byte, 1<<k.p.treeHeight())
+	for i := range leaves {
+		leaves[i] = k.wotsLeaf(layer, tree, uint32(i))
+	}
+	var addr address
+	addr.setLayer(layer)
+	addr.setTree(tree)
+	addr.setType(addrTree)
+	return k.merkle(leaves, leaf, 0, addr)
+}
+
+func (k *testKey) sign(msg []byte) []byte {
+	p := k.p
+	r := randomBytes(p.n)
+	md, tree, leaf := p.hashMessage(r, k.publicKey(), msg)
+	sig := append([]byte{}, r...)
+
+	var forsAddr address
+	forsAddr.setTree(tree)
+	forsAddr.setKeypair(leaf)
+	forsAddr.setType(addrFORSTree)
+	var roots []byte
+	for i, index := range p.forsIndexes(md) {
+		indexOffset := uint32(i) << p.a
+		leaves := make([][]byte, 1<<p.a)
+		var secret []byte
+		for j := range leaves {
+			addr := forsAddr
+			addr.setTreeHeight(0)
+			addr.setTreeIndex(indexOffset + uint32(j))
+			sk := k.secret(addr)
+			if uint32(j) == index {
+				secret = sk
+			}
+			leaves[j] = p.thash(k.seed, &addr, sk)
+		}
+		root, authPath := k.merkle(leaves, index, indexOffset, forsAddr)
+		sig = append(append(sig, secret...), authPath...)
+		roots = append(roots, root...)
+	}
+	pkAddr := forsAddr
+	pkAddr.setType(addrFORSPK)
+	node := p.thash(k.seed, &pkAddr, roots)
+
+	for layer := 0; layer < p.d; layer++ {
+		sig = append(sig, k.wotsSign(node, layer, tree, leaf)...)
+		var authPath []byte
+		node, authPath = k.treeRoot(layer, tree, leaf)
+		sig = append(sig, authPath...)
+		leaf = uint32(tree & (1<<p.treeHeight() - 1))
+		tree >>= p.treeHeight()
+	}
+	return sig
+}
+
+func TestVerify(t *testing.T) {
+	for name, p := range map[string]*Params{
+		"SHAKE256-128f-simple": SHAKE256_128fSimple,
+		"SHAKE256-128f-robust": SHAKE256_128fRobust,
+		"SHAKE256-192f-simple": SHAKE256_192fSimple,
+		"SHAKE256-192f-robust": SHAKE256_192fRobust,
+		"SHAKE256-256f-simple": SHAKE256_256fSimple,
+		"SHAKE256-256f-robust": SHAKE256_256fRobust,
+		"SHA256-128f-simple":   SHA256_128fSimple,
+		"SHA256-128f-robust":   SHA256_128fRobust,
+		"SHA256-192f-simple":   SHA256_192fSimple,
+		"SHA256-192f-robust":   SHA256_192fRobust,
+		"SHA256-256f-simple":   SHA256_256fSimple,
+		"SHA256-256f-robust":   SHA256_256fRobust,
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			k := newTestKey(p)
+			msg := []byte("message")
+			sig := k.sign(msg)
+			assert.Len(t, sig, p.SignatureSize())
+			assert.True(t, p.Verify(k.publicKey(), msg, sig))
+
+			assert.False(t, p.Verify(k.publicKey(), []byte("other message"), sig))
+			for _, i := range []int{0, p.n, p.n + p.forsBytes(), len(sig) - 1} {
+				tampered := append([]byte{}, sig...)
+				tampered[i] ^= 1
+				assert.False(t, p.Verify(k.publicKey(), msg, tampered), "byte %d", i)
+			}
+			assert.False(t, p.Verify(k.publicKey(), msg, sig[:len(sig)-1]))
+			assert.False(t, p.Verify(newTestKey(p).publicKey(), msg, sig))
+		})
+	}
+}
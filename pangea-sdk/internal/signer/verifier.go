@@ -0,0 +1,274 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/cloudflare/circl/sign"
+	"github.com/cloudflare/circl/sign/dilithium/mode2"
+	"github.com/cloudflare/circl/sign/dilithium/mode3"
+	circled25519 "github.com/cloudflare/circl/sign/ed25519"
+	"github.com/cloudflare/circl/sign/ed448"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/signer/falcon"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/signer/sphincsplus"
+)
+
+// ErrUnsupportedAlgorithm is returned when no verifier is registered for the
+// algorithm of a key.
+var ErrUnsupportedAlgorithm = errors.New("signer: no verifier registered for the algorithm")
+
+// VerifierFactory returns a verifier for a public key, in the raw encoding of
+// its algorithm, i.e. the subjectPublicKey of its PKIX encoding.
+type VerifierFactory func(publicKey []byte) (Verifier, error)
+
+var verifierRegistry = struct {
+	sync.RWMutex
+	factories map[string]VerifierFactory
+}{factories: map[string]VerifierFactory{}}
+
+// RegisterVerifier registers the verifier of a Vault signing algorithm,
+// replacing any previous one.
+func RegisterVerifier(algorithm string, factory VerifierFactory) {
+	verifierRegistry.Lock()
+	defer verifierRegistry.Unlock()
+	verifierRegistry.factories[algorithm] = factory
+}
+
+func init() {
+	RegisterVerifier("ED25519", newEd25519Verifier)
+	RegisterVerifier("ES256", ecdsaVerifierFactory(elliptic.P256(), crypto.SHA256))
+	RegisterVerifier("ES384", ecdsaVerifierFactory(elliptic.P384(), crypto.SHA384))
+	RegisterVerifier("ES512", ecdsaVerifierFactory(elliptic.P521(), crypto.SHA512))
+	RegisterVerifier("RSA-PKCS1V15-2048-SHA256", rsaVerifierFactory(crypto.SHA256, false))
+	RegisterVerifier("RSA-PSS-2048-SHA256", rsaVerifierFactory(crypto.SHA256, true))
+	RegisterVerifier("RSA-PSS-3072-SHA256", rsaVerifierFactory(crypto.SHA256, true))
+	RegisterVerifier("RSA-PSS-4096-SHA256", rsaVerifierFactory(crypto.SHA256, true))
+	RegisterVerifier("RSA-PSS-4096-SHA512", rsaVerifierFactory(crypto.SHA512, true))
+
+	// Hybrid keys and signatures are the concatenation of their Dilithium
+	// and EdDSA components, as in github.com/cloudflare/circl/sign/eddilithium2
+	// and eddilithium3.
+	RegisterVerifier("ED25519-DILITHIUM2-BETA", hybridVerifierFactory(mode2.Scheme(), circled25519.Scheme()))
+	RegisterVerifier("ED448-DILITHIUM3-BETA", hybridVerifierFactory(mode3.Scheme(), ed448.Scheme()))
+
+	for algorithm, params := range map[string]*sphincsplus.Params{
+		"SPHINCSPLUS-128F-SHAKE256-SIMPLE-BETA": sphincsplus.SHAKE256_128fSimple,
+		"SPHINCSPLUS-128F-SHAKE256-ROBUST-BETA": sphincsplus.SHAKE256_128fRobust,
+		"SPHINCSPLUS-192F-SHAKE256-SIMPLE-BETA": sphincsplus.SHAKE256_192fSimple,
+		"SPHINCSPLUS-192F-SHAKE256-ROBUST-BETA": sphincsplus.SHAKE256_192fRobust,
+		"SPHINCSPLUS-256F-SHAKE256-SIMPLE-BETA": sphincsplus.SHAKE256_256fSimple,
+		"SPHINCSPLUS-256F-SHAKE256-ROBUST-BETA": sphincsplus.SHAKE256_256fRobust,
+		"SPHINCSPLUS-128F-SHA256-SIMPLE-BETA":   sphincsplus.SHA256_128fSimple,
+		"SPHINCSPLUS-128F-SHA256-ROBUST-BETA":   sphincsplus.SHA256_128fRobust,
+		"SPHINCSPLUS-192F-SHA256-SIMPLE-BETA":   sphincsplus.SHA256_192fSimple,
+		"SPHINCSPLUS-192F-SHA256-ROBUST-BETA":   sphincsplus.SHA256_192fRobust,
+		"SPHINCSPLUS-256F-SHA256-SIMPLE-BETA":   sphincsplus.SHA256_256fSimple,
+		"SPHINCSPLUS-256F-SHA256-ROBUST-BETA":   sphincsplus.SHA256_256fRobust,
+	} {
+		RegisterVerifier(algorithm, sphincsVerifierFactory(params))
+	}
+	RegisterVerifier("FALCON-1024-BETA", newFalconVerifier)
+}
+
+// NewVerifier returns a verifier for a public key of a Vault signing
+// algorithm, in PEM format as returned by Vault.
+func NewVerifier(algorithm, publicKeyPEM string) (Verifier, error) {
+	raw, err := rawPublicKey(publicKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	verifierRegistry.RLock()
+	factory, ok := verifierRegistry.factories[algorithm]
+	verifierRegistry.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, algorithm)
+	}
+	return factory(raw)
+}
+
+// rawPublicKey returns the subjectPublicKey of a PKIX public key, or the
+// content of other PEM blocks, e.g. PKCS #1 RSA public keys.
+func rawPublicKey(publicKeyPEM string) ([]byte, error) {
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return nil, errors.New("signer: invalid public key PEM")
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if rest, err := asn1.Unmarshal(block.Bytes, &spki); err == nil && len(rest) == 0 {
+		return spki.PublicKey.RightAlign(), nil
+	}
+	return block.Bytes, nil
+}
+
+func newEd25519Verifier(publicKey []byte) (Verifier, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, errors.New("signer: invalid Ed25519 public key")
+	}
+	return ed25519Verifier{pubkey: publicKey}, nil
+}
+
+type ecdsaVerifier struct {
+	key  *ecdsa.PublicKey
+	hash crypto.Hash
+}
+
+func ecdsaVerifierFactory(curve elliptic.Curve, hash crypto.Hash) VerifierFactory {
+	return func(publicKey []byte) (Verifier, error) {
+		key, err := ecdsa.ParseUncompressedPublicKey(curve, publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("signer: invalid ECDSA public key: %w", err)
+		}
+		return ecdsaVerifier{key: key, hash: hash}, nil
+	}
+}
+
+// Verify accepts signatures in the fixed size r || s form returned by Vault,
+// and in the ASN.1 form.
+func (v ecdsaVerifier) Verify(msg, sig []byte) (bool, error) {
+	der, err := ECDSASignatureASN1(v.key, sig)
+	if err != nil {
+		return false, nil
+	}
+	h := v.hash.New()
+	h.Write(msg)
+	return ecdsa.VerifyASN1(v.key, h.Sum(nil), der), nil
+}
+
+// ECDSASignatureASN1 returns an ECDSA signature in the ASN.1 form, converting
+// it from the fixed size r || s form returned by Vault if needed.
+func ECDSASignatureASN1(key *ecdsa.PublicKey, sig []byte) ([]byte, error) {
+	var parsed struct{ R, S *big.Int }
+	if rest, err := asn1.Unmarshal(sig, &parsed); err == nil && len(rest) == 0 {
+		return sig, nil
+	}
+	size := (key.Curve.Params().BitSize + 7) / 8
+	if len(sig) != 2*size {
+		return nil, errors.New("signer: invalid ECDSA signature")
+	}
+	parsed.R = new(big.Int).SetBytes(sig[:size])
+	parsed.S = new(big.Int).SetBytes(sig[size:])
+	return asn1.Marshal(parsed)
+}
+
+type rsaVerifier struct {
+	key  *rsa.PublicKey
+	hash crypto.Hash
+	pss  bool
+}
+
+func rsaVerifierFactory(hash crypto.Hash, pss bool) VerifierFactory {
+	return func(publicKey []byte) (Verifier, error) {
+		key, err := x509.ParsePKCS1PublicKey(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("signer: invalid RSA public key: %w", err)
+		}
+		return rsaVerifier{key: key, hash: hash, pss: pss}, nil
+	}
+}
+
+func (v rsaVerifier) Verify(msg, sig []byte) (bool, error) {
+	h := v.hash.New()
+	h.Write(msg)
+	if v.pss {
+		return rsa.VerifyPSS(v.key, v.hash, h.Sum(nil), sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto}) == nil, nil
+	}
+	return rsa.VerifyPKCS1v15(v.key, v.hash, h.Sum(nil), sig) == nil, nil
+}
+
+type component struct {
+	scheme sign.Scheme
+	key    sign.PublicKey
+}
+
+// hybridVerifier verifies hybrid signatures component by component: each
+// component signature must be valid for the message.
+type hybridVerifier []component
+
+func hybridVerifierFactory(schemes ...sign.Scheme) VerifierFactory {
+	return func(publicKey []byte) (Verifier, error) {
+		size := 0
+		for _, s := range schemes {
+			size += s.PublicKeySize()
+		}
+		if len(publicKey) != size {
+			return nil, errors.New("signer: invalid hybrid public key")
+		}
+		v := make(hybridVerifier, 0, len(schemes))
+		for _, s := range schemes {
+			key, err := s.UnmarshalBinaryPublicKey(publicKey[:s.PublicKeySize()])
+			if err != nil {
+				return nil, fmt.Errorf("signer: invalid %s public key: %w", s.Name(), err)
+			}
+			v = append(v, component{scheme: s, key: key})
+			publicKey = publicKey[s.PublicKeySize():]
+		}
+		return v, nil
+	}
+}
+
+func (v hybridVerifier) Verify(msg, sig []byte) (bool, error) {
+	size := 0
+	for _, c := range v {
+		size += c.scheme.SignatureSize()
+	}
+	if len(sig) != size {
+		return false, nil
+	}
+	for _, c := range v {
+		n := c.scheme.SignatureSize()
+		if !c.scheme.Verify(c.key, msg, sig[:n], nil) {
+			return false, nil
+		}
+		sig = sig[n:]
+	}
+	return true, nil
+}
+
+type sphincsVerifier struct {
+	params *sphincsplus.Params
+	key    []byte
+}
+
+func sphincsVerifierFactory(params *sphincsplus.Params) VerifierFactory {
+	return func(publicKey []byte) (Verifier, error) {
+		if len(publicKey) != params.PublicKeySize() {
+			return nil, errors.New("signer: invalid SPHINCS+ public key")
+		}
+		return sphincsVerifier{params: params, key: publicKey}, nil
+	}
+}
+
+func (v sphincsVerifier) Verify(msg, sig []byte) (bool, error) {
+	return v.params.Verify(v.key, msg, sig), nil
+}
+
+type falconVerifier struct {
+	key *falcon.PublicKey
+}
+
+func newFalconVerifier(publicKey []byte) (Verifier, error) {
+	key, ok := falcon.NewPublicKey(publicKey)
+	if !ok {
+		return nil, errors.New("signer: invalid Falcon public key")
+	}
+	return falconVerifier{key: key}, nil
+}
+
+func (v falconVerifier) Verify(msg, sig []byte) (bool, error) {
+	return v.key.Verify(msg, sig), nil
+}
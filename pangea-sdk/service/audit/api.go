@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"time"
 
 	pu "github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeautil"
@@ -29,7 +30,7 @@ import (
 //
 //	logResponse, err := auditcli.Log(ctx, event, true)
 func (a *audit) Log(ctx context.Context, event any, verbose bool) (*pangea.PangeaResponse[LogResult], error) {
-	input, err := a.getLogRequest(event, verbose)
+	input, err := a.getLogRequest(ctx, event, verbose)
 	if err != nil {
 		return nil, err
 	}
@@ -48,6 +49,10 @@ func (a *audit) LogRequest(ctx context.Context, input LogRequest) (*pangea.Pange
 		input.Verbose = true
 	}
 
+	if input.ConfigID == "" {
+		input.ConfigID = a.tenantConfigID(a.eventTenant(ctx, input.Event))
+	}
+
 	resp, err := request.DoPost(ctx, a.Client, "v1/log", &input, &LogResult{})
 	if err != nil {
 		return nil, err
@@ -76,7 +81,7 @@ func (a *audit) LogRequest(ctx context.Context, input LogRequest) (*pangea.Pange
 //
 //	logResponse, err := auditcli.LogBulk(ctx, events, true)
 func (a *audit) LogBulk(ctx context.Context, events []any, verbose bool) (*pangea.PangeaResponse[LogBulkResult], error) {
-	input, err := a.getLogBulkRequest(events, verbose)
+	input, err := a.getLogBulkRequest(ctx, events, verbose)
 	if err != nil {
 		return nil, err
 	}
@@ -109,7 +114,7 @@ func (a *audit) LogBulk(ctx context.Context, events []any, verbose bool) (*pange
 //
 //	logResponse, err := auditcli.LogBulkAsync(ctx, events, true)
 func (a *audit) LogBulkAsync(ctx context.Context, events []any, verbose bool) (*pangea.PangeaResponse[LogBulkResult], error) {
-	input, err := a.getLogBulkRequest(events, verbose)
+	input, err := a.getLogBulkRequest(ctx, events, verbose)
 	if err != nil {
 		return nil, err
 	}
@@ -136,20 +141,29 @@ func (a *audit) LogBulkAsync(ctx context.Context, events []any, verbose bool) (*
 	return resp, nil
 }
 
-func (a *audit) getLogBulkRequest(events []any, verbose bool) (*LogBulkRequest, error) {
+func (a *audit) getLogBulkRequest(ctx context.Context, events []any, verbose bool) (*LogBulkRequest, error) {
 	var logEvents []*LogEvent
+	configID := ""
 
 	for i := range events {
-		logEvent, err := a.getLogEvent(events[i])
+		logEvent, err := a.getLogEvent(ctx, events[i])
 		if err != nil {
 			return nil, err
 		}
 		logEvents = append(logEvents, logEvent)
+
+		// All the events of a bulk request go to the same config
+		cid := a.tenantConfigID(a.eventTenant(ctx, events[i]))
+		if i > 0 && cid != configID {
+			return nil, errors.New("audit: bulk events belong to tenants with different config IDs")
+		}
+		configID = cid
 	}
 
 	input := &LogBulkRequest{
 		Events: logEvents,
 	}
+	input.ConfigID = configID
 
 	input.Verbose = verbose
 
@@ -160,15 +174,8 @@ func (a *audit) getLogBulkRequest(events []any, verbose bool) (*LogBulkRequest,
 	return input, nil
 }
 
-func (a *audit) getLogRequest(event any, verbose bool) (*LogRequest, error) {
-	// Overwrite tenant id if user set it on event
-	if st, ok := event.(Tenanter); ok {
-		if st.Tenant() == "" && a.tenantID != "" {
-			st.SetTenant(a.tenantID)
-		}
-	}
-
-	logEvent, err := a.getLogEvent(event)
+func (a *audit) getLogRequest(ctx context.Context, event any, verbose bool) (*LogRequest, error) {
+	logEvent, err := a.getLogEvent(ctx, event)
 	if err != nil {
 		return nil, err
 	}
@@ -187,11 +194,11 @@ func (a *audit) getLogRequest(event any, verbose bool) (*LogRequest, error) {
 	return input, nil
 }
 
-func (a *audit) getLogEvent(event any) (*LogEvent, error) {
+func (a *audit) getLogEvent(ctx context.Context, event any) (*LogEvent, error) {
 	// Overwrite tenant id if user set it on event
 	if st, ok := event.(Tenanter); ok {
-		if st.Tenant() == "" && a.tenantID != "" {
-			st.SetTenant(a.tenantID)
+		if tenantID := a.tenantFromContext(ctx); st.Tenant() == "" && tenantID != "" {
+			st.SetTenant(tenantID)
 		}
 	}
 
@@ -228,6 +235,12 @@ func (a *audit) Search(ctx context.Context, input *SearchInput) (*pangea.PangeaR
 		return nil, errors.New("nil input")
 	}
 
+	if cid := a.tenantConfigID(a.tenantFromContext(ctx)); cid != "" && input.ConfigID == "" {
+		in := *input
+		in.ConfigID = cid
+		input = &in
+	}
+
 	if a.verifyProofs {
 		// Need this info to verify
 		input.Verbose = pangea.Bool(true)
@@ -260,6 +273,12 @@ func (a *audit) Search(ctx context.Context, input *SearchInput) (*pangea.PangeaR
 //
 //	res, err := auditcli.SearchResults(ctx, input)
 func (a *audit) SearchResults(ctx context.Context, input *SearchResultsInput) (*pangea.PangeaResponse[SearchResultsOutput], error) {
+	if cid := a.tenantConfigID(a.tenantFromContext(ctx)); cid != "" && input != nil && input.ConfigID == "" {
+		in := *input
+		in.ConfigID = cid
+		input = &in
+	}
+
 	resp, err := request.DoPost(ctx, a.Client, "v1/results", input, &SearchResultsOutput{})
 	if err != nil {
 		return nil, err
@@ -371,8 +390,6 @@ func (a *audit) processLogResult(ctx context.Context, log *LogResult) error {
 }
 
 func (a *audit) processSearchEvents(ctx context.Context, events SearchEvents, root *Root, unpRoot *Root) error {
-	var roots map[int]Root
-
 	var err error
 	for _, event := range events {
 		event.EventEnvelope, err = a.newEventEnvelopeFromMap(event.RawEnvelope)
@@ -381,29 +398,39 @@ func (a *audit) processSearchEvents(ctx context.Context, events SearchEvents, ro
 		}
 	}
 
-	if a.verifyProofs && root != nil {
-		if a.rp == nil {
-			a.rp = NewArweaveRootsProvider(root.TreeName)
-		}
+	if a.verifyProofs && root != nil && a.rp == nil {
+		a.rp = NewArweaveRootsProvider(root.TreeName)
+	}
+	return verifySearchEvents(ctx, a, a.rp, events, root, unpRoot, !a.skipEventVerification, a.verifyProofs)
+}
+
+// verifySearchEvents verifies the hashes and signatures of events if
+// verifyEvents is set, and their membership and consistency proofs against
+// the roots of rp if verifyProofs is set.
+func verifySearchEvents(ctx context.Context, client Client, rp RootsProvider, events SearchEvents, root *Root, unpRoot *Root, verifyEvents, verifyProofs bool) error {
+	var roots map[int]Root
+	if verifyProofs && root != nil {
 		treeSizes := treeSizes(root, events)
-		roots = a.rp.UpdateRoots(ctx, treeSizes)
+		roots = rp.UpdateRoots(ctx, treeSizes)
 	}
 
 	for _, event := range events {
-		if !a.skipEventVerification {
+		if verifyEvents {
 			if VerifyHash(event.RawEnvelope, event.Hash) == Failed {
 				return fmt.Errorf("audit: cannot verify hash of record. Hash: [%s]", event.Hash)
 			}
-			event.SignatureVerification = event.EventEnvelope.VerifySignature()
+			if event.EventEnvelope != nil {
+				event.SignatureVerification = event.EventEnvelope.VerifySignature()
+			}
 		}
 
-		if a.verifyProofs {
+		if verifyProofs {
 			if event.Published != nil && *event.Published {
 				event.VerifyMembershipProof(root)
 				event.VerifyConsistencyProof(roots)
-				if event.ConsistencyVerification == Failed && event.LeafIndex != nil {
+				if event.ConsistencyVerification == Failed && event.LeafIndex != nil && rp != nil {
 					// verify again with the consistency proof fetched from Pangea
-					roots, _ = a.fixConsistencyProof(ctx, *event.LeafIndex+1)
+					roots, _ = fixConsistencyProof(ctx, client, rp, *event.LeafIndex+1)
 					event.VerifyConsistencyProof(roots)
 				}
 			} else {
@@ -414,14 +441,14 @@ func (a *audit) processSearchEvents(ctx context.Context, events SearchEvents, ro
 	return nil
 }
 
-func (a *audit) fixConsistencyProof(ctx context.Context, treeSize int) (map[int]Root, error) {
+func fixConsistencyProof(ctx context.Context, client Client, rp RootsProvider, treeSize int) (map[int]Root, error) {
 	// on very rare occasions, the consistency proof in Arweave may be wrong
 	// override it with the proof from pangea (not the root hash, just the proof)
 
-	roots := a.rp.UpdateRoots(ctx, nil)
+	roots := rp.UpdateRoots(ctx, nil)
 
 	// get the root from Pangea
-	resp, err := a.Root(ctx, &RootInput{TreeSize: treeSize})
+	resp, err := client.Root(ctx, &RootInput{TreeSize: treeSize})
 	if err != nil {
 		return roots, err
 	}
@@ -432,7 +459,7 @@ func (a *audit) fixConsistencyProof(ctx context.Context, treeSize int) (map[int]
 	}
 
 	// override root
-	roots = a.rp.OverrideRoots(map[int]Root{treeSize: resp.Result.Data})
+	roots = rp.OverrideRoots(map[int]Root{treeSize: resp.Result.Data})
 	return roots, nil
 }
 
@@ -585,6 +612,12 @@ type EventEnvelope struct {
 }
 
 func (a *audit) newEventEnvelopeFromMap(m map[string]any) (*EventEnvelope, error) {
+	return newEventEnvelope(m, a.schema)
+}
+
+// newEventEnvelope decodes a raw envelope, decoding its event into a new value
+// of the schema's type.
+func newEventEnvelope(m map[string]any, schema any) (*EventEnvelope, error) {
 	if m == nil {
 		return nil, nil
 	}
@@ -606,7 +639,7 @@ func (a *audit) newEventEnvelopeFromMap(m map[string]any) (*EventEnvelope, error
 			return nil, err
 		}
 
-		v := reflect.New(reflect.TypeOf(a.schema)).Interface()
+		v := reflect.New(reflect.TypeOf(schema)).Interface()
 
 		err = json.Unmarshal(b, &v)
 		if err != nil {
@@ -731,6 +764,9 @@ type SearchRestriction struct {
 
 	// A list of statuses to restrict the search to.
 	Status []string `json:"status,omitempty"`
+
+	// A list of tenant IDs to restrict the search to.
+	TenantID []string `json:"tenant_id,omitempty"`
 }
 
 type SearchOutput struct {
@@ -867,12 +903,14 @@ func (ee *EventEnvelope) VerifySignature() EventVerification {
 		return Failed
 	}
 
-	publicKey, err := ee.getPublicKey()
+	publicKey, algorithm, err := ee.getPublicKey()
 	if err != nil {
 		return Failed
 	}
 
-	v, err := signer.NewVerifierFromPubKey(publicKey)
+	// Keys of algorithms without a verifier fail, as the algorithm is set by
+	// the envelope itself.
+	v, err := newVerifier(algorithm, publicKey)
 	if err != nil {
 		return Failed
 	}
@@ -891,29 +929,41 @@ func (ee *EventEnvelope) VerifySignature() EventVerification {
 	return NotVerified
 }
 
-func (ee EventEnvelope) getPublicKey() (string, error) {
+// newVerifier returns a verifier for a public key of a Vault algorithm, using
+// the registered verifiers, e.g. with vault.RegisterVerifier. Keys without an
+// algorithm or in the legacy format without PEM header are Ed25519 keys.
+func newVerifier(algorithm string, publicKey string) (signer.Verifier, error) {
+	if algorithm == "" || !strings.HasPrefix(publicKey, "-----") {
+		return signer.NewVerifierFromPubKey(publicKey)
+	}
+	return signer.NewVerifier(algorithm, publicKey)
+}
+
+func (ee EventEnvelope) getPublicKey() (string, string, error) {
 	// Should never enter this case
 	if ee.PublicKey == nil {
-		return "", errors.New("public key field nil pointer")
+		return "", "", errors.New("public key field nil pointer")
 	}
 
 	pkinfo := make(map[string]any)
 	err := json.Unmarshal([]byte(*ee.PublicKey), &pkinfo)
 	if err != nil {
-		return *ee.PublicKey, nil
+		return *ee.PublicKey, "", nil
 	}
 
 	val, ok := pkinfo["key"]
 	if !ok {
-		return "", errors.New("'key' field not present in json")
+		return "", "", errors.New("'key' field not present in json")
 	}
 
 	ret, ok := val.(string)
 	if !ok {
-		return "", errors.New("value is not a string")
+		return "", "", errors.New("value is not a string")
 	}
 
-	return ret, nil
+	// Events signed before the algorithm was recorded are Ed25519 events.
+	algorithm, _ := pkinfo["algorithm"].(string)
+	return ret, algorithm, nil
 }
 
 type SearchResultsInput struct {
@@ -1037,48 +1087,23 @@ func (a *audit) DownloadResults(ctx context.Context, input *DownloadRequest) (*p
 //
 // @example
 //
-//	type LogStreamEventData struct {
-//		ClientID     string  `json:"client_id"`
-//		Connection   *string `json:"connection,omitempty"`
-//		ConnectionID *string `json:"connection_id,omitempty"`
-//		Date         string  `json:"date"`
-//		Description  string  `json:"description"`
-//		IP           string  `json:"ip"`
-//		Strategy     *string `json:"strategy,omitempty"`
-//		StrategyType *string `json:"strategy_type,omitempty"`
-//		Type         string  `json:"type"`
-//		UserAgent    string  `json:"user_agent"`
-//		UserID       string  `json:"user_id"`
-//	}
-//
-//	type LogStreamEvent struct {
-//		LogID string             `json:"log_id"`
-//		Data  LogStreamEventData `json:"data"`
-//	}
-//
-//	type LogStreamRequest struct {
-//		pangea.BaseRequest
-//
-//		Logs []LogStreamEvent `json:"logs"`
-//	}
-//
-//	logStreamEvent := LogStreamEvent{
-//		LogID: "some log ID",
-//		Data: LogStreamEventData{
-//			ClientID:    "test client ID",
-//			Date:        "2024-03-29T17:26:50.193Z",
-//			Description: "Create a log stream",
-//			IP:          "127.0.0.1",
-//			Type:        "some_type",
-//			UserAgent:   "AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.0.0",
-//			UserID:      "test user ID",
+//	input := audit.Auth0LogStreamRequest{
+//		Logs: []audit.Auth0Log{
+//			{
+//				LogID: "some log ID",
+//				Data: audit.Auth0LogData{
+//					ClientID:    "test client ID",
+//					Date:        "2024-03-29T17:26:50.193Z",
+//					Description: "Create a log stream",
+//					IP:          "127.0.0.1",
+//					Type:        "some_type",
+//					UserAgent:   "AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.0.0",
+//					UserID:      "test user ID",
+//				},
+//			},
 //		},
 //	}
 //
-//	input := LogStreamRequest{
-//		Logs: []LogStreamEvent{logStreamEvent},
-//	}
-//
 //	response, err := client.LogStream(ctx, &input)
 func (a *audit) LogStream(ctx context.Context, input pangea.ConfigIDer) (*pangea.PangeaResponse[struct{}], error) {
 	var result struct{}
@@ -0,0 +1,367 @@
+package audit
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"time"
+
+	pu "github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeautil"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+)
+
+type exportJob struct {
+	requestID     string
+	pollInterval  time.Duration
+	httpClient    *http.Client
+	returnContext *bool
+	verify        bool
+}
+
+type ExportOption func(*exportJob) error
+
+// WithExportPollInterval sets how often the export status is polled. Defaults
+// to 5 seconds.
+func WithExportPollInterval(d time.Duration) ExportOption {
+	return func(j *exportJob) error {
+		if d <= 0 {
+			return errors.New("audit: poll interval must be positive")
+		}
+		j.pollInterval = d
+		return nil
+	}
+}
+
+// WithExportHTTPClient sets the HTTP client used to download the export.
+// Defaults to http.DefaultClient.
+func WithExportHTTPClient(c *http.Client) ExportOption {
+	return func(j *exportJob) error {
+		j.httpClient = c
+		return nil
+	}
+}
+
+// WithExportResume resumes a previously started export, e.g. the one reported
+// by an ExportError, instead of starting a new one.
+func WithExportResume(requestID string) ExportOption {
+	return func(j *exportJob) error {
+		j.requestID = requestID
+		return nil
+	}
+}
+
+// WithExportReturnContext requests the context data needed to decrypt events
+// redacted with format preserving encryption.
+func WithExportReturnContext() ExportOption {
+	return func(j *exportJob) error {
+		j.returnContext = pangea.Bool(true)
+		return nil
+	}
+}
+
+// WithExportVerification verifies the hash and signature of every record
+// decoded by ExportIter.
+func WithExportVerification() ExportOption {
+	return func(j *exportJob) error {
+		j.verify = true
+		return nil
+	}
+}
+
+// ExportError is returned when an export fails after it was started. The
+// export can be resumed by passing RequestID to WithExportResume.
+type ExportError struct {
+	RequestID string
+	Err       error
+}
+
+func (e *ExportError) Error() string {
+	return fmt.Sprintf("audit: export %v failed: %v", e.RequestID, e.Err)
+}
+
+func (e *ExportError) Unwrap() error {
+	return e.Err
+}
+
+// ExportTo starts an export, waits for it to complete and streams the
+// decompressed records to w.
+//
+// @example
+//
+//	f, err := os.Create("export.json")
+//	if err != nil {
+//		return err
+//	}
+//	defer f.Close()
+//
+//	err = audit.ExportTo(ctx, auditcli, &audit.ExportRequest{
+//		Format: pangea.P(audit.DFjson),
+//	}, f)
+func ExportTo(ctx context.Context, client Client, input *ExportRequest, w io.Writer, opts ...ExportOption) error {
+	job, err := newExportJob(opts)
+	if err != nil {
+		return err
+	}
+
+	format := DFcsv
+	if input != nil && input.Format != nil {
+		format = *input.Format
+	}
+
+	body, err := job.open(ctx, client, input, format)
+	if err != nil {
+		return err
+	}
+	defer body.Close() //nolint:errcheck
+
+	if _, err := io.Copy(w, body); err != nil {
+		return &ExportError{RequestID: job.requestID, Err: err}
+	}
+	return nil
+}
+
+// ExportIter starts an export in JSON format, waits for it to complete and
+// decodes the downloaded records one at a time.
+//
+// @example
+//
+//	for event, err := range audit.ExportIter(ctx, auditcli, &audit.ExportRequest{}, audit.WithExportVerification()) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(event.Hash, event.SignatureVerification)
+//	}
+func ExportIter(ctx context.Context, client Client, input *ExportRequest, opts ...ExportOption) iter.Seq2[*SearchEvent, error] {
+	return func(yield func(*SearchEvent, error) bool) {
+		job, err := newExportJob(opts)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		if input != nil && input.Format != nil && *input.Format != DFjson {
+			yield(nil, errors.New("audit: ExportIter requires the JSON format"))
+			return
+		}
+		in := ExportRequest{}
+		if input != nil {
+			in = *input
+		}
+		in.Format = pangea.P(DFjson)
+
+		body, err := job.open(ctx, client, &in, DFjson)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer body.Close() //nolint:errcheck
+
+		schema := clientSchema(client)
+		for event, err := range decodeExportRecords(body) {
+			if err == nil {
+				err = job.processRecord(event, schema)
+			}
+			if err != nil {
+				yield(nil, &ExportError{RequestID: job.requestID, Err: err})
+				return
+			}
+			if !yield(event, nil) {
+				return
+			}
+		}
+	}
+}
+
+func newExportJob(opts []ExportOption) (*exportJob, error) {
+	job := &exportJob{
+		pollInterval: 5 * time.Second,
+		httpClient:   http.DefaultClient,
+	}
+	for _, opt := range opts {
+		if err := opt(job); err != nil {
+			return nil, err
+		}
+	}
+	return job, nil
+}
+
+// open starts or resumes the export, waits for it and opens the download.
+func (j *exportJob) open(ctx context.Context, client Client, input *ExportRequest, format DownloadFormat) (io.ReadCloser, error) {
+	if j.requestID == "" {
+		if input == nil {
+			return nil, errors.New("nil input")
+		}
+		resp, err := client.Export(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		if resp.RequestID == nil {
+			return nil, errors.New("audit: export response is missing the request ID")
+		}
+		j.requestID = *resp.RequestID
+	}
+
+	if err := j.wait(ctx, client); err != nil {
+		return nil, &ExportError{RequestID: j.requestID, Err: err}
+	}
+
+	download, err := client.DownloadResults(ctx, &DownloadRequest{
+		RequestID:     j.requestID,
+		Format:        format,
+		ReturnContext: j.returnContext,
+	})
+	if err != nil {
+		return nil, &ExportError{RequestID: j.requestID, Err: err}
+	}
+
+	body, err := j.download(ctx, download.Result.DestURL)
+	if err != nil {
+		return nil, &ExportError{RequestID: j.requestID, Err: err}
+	}
+	return body, nil
+}
+
+// wait polls the export until it is no longer accepted.
+func (j *exportJob) wait(ctx context.Context, client Client) error {
+	for {
+		var result struct{}
+		_, err := client.PollResultByID(ctx, j.requestID, &result)
+		if err == nil {
+			return nil
+		}
+		var ae *pangea.AcceptedError
+		if !errors.As(err, &ae) {
+			return err
+		}
+		if !pu.Sleep(j.pollInterval, ctx) {
+			return ctx.Err()
+		}
+	}
+}
+
+type gzipReadCloser struct {
+	*gzip.Reader
+	body io.Closer
+}
+
+func (r gzipReadCloser) Close() error {
+	r.Reader.Close() //nolint:errcheck
+	return r.body.Close()
+}
+
+type bufferedReadCloser struct {
+	*bufio.Reader
+	io.Closer
+}
+
+// download fetches the export, decompressing it if it is gzipped.
+func (j *exportJob) download(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("audit: failed GET %v: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close() //nolint:errcheck
+		return nil, fmt.Errorf("audit: GET %v with status code %v", url, resp.StatusCode)
+	}
+
+	br := bufio.NewReader(resp.Body)
+	magic, _ := br.Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			resp.Body.Close() //nolint:errcheck
+			return nil, err
+		}
+		return gzipReadCloser{Reader: gz, body: resp.Body}, nil
+	}
+	return bufferedReadCloser{Reader: br, Closer: resp.Body}, nil
+}
+
+func (j *exportJob) processRecord(event *SearchEvent, schema any) error {
+	ee, err := newEventEnvelope(event.RawEnvelope, schema)
+	if err != nil {
+		return err
+	}
+	event.EventEnvelope = ee
+
+	if j.verify {
+		if VerifyHash(event.RawEnvelope, event.Hash) == Failed {
+			return fmt.Errorf("audit: cannot verify hash of record. Hash: [%s]", event.Hash)
+		}
+		if event.EventEnvelope != nil {
+			event.SignatureVerification = event.EventEnvelope.VerifySignature()
+		}
+	}
+	return nil
+}
+
+// decodeExportRecords decodes either a JSON array or a stream of JSON values.
+func decodeExportRecords(r io.Reader) iter.Seq2[*SearchEvent, error] {
+	return func(yield func(*SearchEvent, error) bool) {
+		br := bufio.NewReader(r)
+		dec := json.NewDecoder(br)
+
+		first, err := peekNonSpace(br)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		if first == '[' {
+			if _, err := dec.Token(); err != nil {
+				yield(nil, err)
+				return
+			}
+		}
+
+		for dec.More() {
+			var event SearchEvent
+			if err := dec.Decode(&event); err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(&event, nil) {
+				return
+			}
+		}
+	}
+}
+
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			br.ReadByte() //nolint:errcheck
+		default:
+			return b[0], nil
+		}
+	}
+}
+
+// clientSchema returns the schema events of client are decoded into.
+func clientSchema(client Client) any {
+	switch c := client.(type) {
+	case *audit:
+		return c.schema
+	case *tenantScopedClient:
+		return clientSchema(c.client)
+	}
+	return StandardEvent{}
+}
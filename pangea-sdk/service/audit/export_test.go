@@ -0,0 +1,102 @@
+//go:build unit
+
+package audit_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeatesting"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea/hash"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+const acceptedResponse = `{
+	"request_id": "prq_123",
+	"request_time": "1970-01-01T00:00:00Z",
+	"response_time": "1970-01-01T00:00:10Z",
+	"status": "Accepted",
+	"result": {"ttl_mins": 5880, "retry_counter": 0, "location": "/v1/request/prq_123"},
+	"summary": "Your request is in progress."
+}`
+
+func setupExportServer(t *testing.T, records string) (audit.Client, *atomic.Int32, func()) {
+	mux, url, teardown := pangeatesting.SetupServer()
+
+	var polls atomic.Int32
+	mux.HandleFunc("/v1/export", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, acceptedResponse)
+	})
+	mux.HandleFunc("/request/prq_123", func(w http.ResponseWriter, r *http.Request) {
+		if polls.Add(1) == 1 {
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprint(w, acceptedResponse)
+			return
+		}
+		fmt.Fprint(w, `{"request_id": "prq_123", "status": "Success", "result": {}, "summary": "ok"}`)
+	})
+	mux.HandleFunc("/v1/download_results", func(w http.ResponseWriter, r *http.Request) {
+		pangeatesting.TestBody(t, r, `{"request_id":"prq_123","format":"json"}`)
+		fmt.Fprintf(w, `{"request_id": "some-id", "status": "Success", "result": {"dest_url": "%v/export"}, "summary": "ok"}`, url)
+	})
+	mux.HandleFunc("/export", func(w http.ResponseWriter, r *http.Request) {
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(records)) //nolint:errcheck
+		gz.Close()                //nolint:errcheck
+	})
+
+	client, _ := audit.New(pangeatesting.TestConfig(url))
+	return client, &polls, teardown
+}
+
+func exportRecord(message string) string {
+	envelope := fmt.Sprintf(`{"event":{"message":%q}}`, message)
+	return fmt.Sprintf(`{"envelope": %s, "hash": %q}`, envelope, hash.Encode([]byte(envelope)))
+}
+
+func TestExportTo(t *testing.T) {
+	records := "[" + exportRecord("a") + "," + exportRecord("b") + "]"
+	client, polls, teardown := setupExportServer(t, records)
+	defer teardown()
+
+	var buf bytes.Buffer
+	err := audit.ExportTo(context.Background(), client, &audit.ExportRequest{Format: pangea.P(audit.DFjson)}, &buf, audit.WithExportPollInterval(time.Millisecond))
+	assert.NoError(t, err)
+	assert.Equal(t, records, buf.String())
+	assert.Equal(t, int32(2), polls.Load())
+}
+
+func TestExportIter(t *testing.T) {
+	records := exportRecord("a") + "\n" + exportRecord("b") + "\n"
+	client, _, teardown := setupExportServer(t, records)
+	defer teardown()
+
+	messages := []string{}
+	for event, err := range audit.ExportIter(context.Background(), client, &audit.ExportRequest{}, audit.WithExportPollInterval(time.Millisecond), audit.WithExportVerification()) {
+		assert.NoError(t, err)
+		messages = append(messages, event.EventEnvelope.Event.(*audit.StandardEvent).Message)
+	}
+	assert.Equal(t, []string{"a", "b"}, messages)
+
+	// A tampered record fails verification.
+	records = `{"envelope": {"event": {"message": "a"}}, "hash": "` + hash.Encode([]byte("b")).String() + `"}`
+	client, _, teardown = setupExportServer(t, records)
+	defer teardown()
+
+	var lastErr error
+	for _, err := range audit.ExportIter(context.Background(), client, &audit.ExportRequest{}, audit.WithExportPollInterval(time.Millisecond), audit.WithExportVerification()) {
+		lastErr = err
+	}
+	var exportErr *audit.ExportError
+	assert.ErrorAs(t, lastErr, &exportErr)
+	assert.Equal(t, "prq_123", exportErr.RequestID)
+}
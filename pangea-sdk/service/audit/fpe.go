@@ -0,0 +1,225 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/redact"
+)
+
+// FPEUnredacter restores values redacted with format preserving encryption,
+// given the FPE context returned with them. The context is opaque: it is only
+// meaningful to Redact.
+type FPEUnredacter interface {
+	UnredactFPE(ctx context.Context, fpeContext string, values map[string]any) (map[string]any, error)
+}
+
+// FPEUnredacterFunc adapts a function to an FPEUnredacter.
+type FPEUnredacterFunc func(ctx context.Context, fpeContext string, values map[string]any) (map[string]any, error)
+
+func (f FPEUnredacterFunc) UnredactFPE(ctx context.Context, fpeContext string, values map[string]any) (map[string]any, error) {
+	return f(ctx, fpeContext, values)
+}
+
+// RedactFPEUnredacter restores values with Redact's Unredact.
+type RedactFPEUnredacter struct {
+	Client redact.Client
+}
+
+func (d RedactFPEUnredacter) UnredactFPE(ctx context.Context, fpeContext string, values map[string]any) (map[string]any, error) {
+	resp, err := d.Client.Unredact(ctx, &redact.UnredactRequest{
+		RedactedData: values,
+		FPEContext:   fpeContext,
+	})
+	if err != nil {
+		return nil, err
+	}
+	data, ok := resp.Result.Data.(map[string]any)
+	if !ok {
+		return nil, errors.New("audit: unexpected unredacted data")
+	}
+	return data, nil
+}
+
+// FPEDecryptRecord describes a decryption, for the audit trail of decrypted
+// events.
+type FPEDecryptRecord struct {
+	Actor     string
+	EventHash string
+	Fields    []string
+}
+
+type FPEDecryptorOption func(*FPEDecryptor) error
+
+// WithFPEDecryptAuditLog logs every decryption to the audit log of client.
+func WithFPEDecryptAuditLog(client Client) FPEDecryptorOption {
+	return func(d *FPEDecryptor) error {
+		if client == nil {
+			return errors.New("audit: nil audit client")
+		}
+		d.recorders = append(d.recorders, func(ctx context.Context, r FPEDecryptRecord) error {
+			_, err := client.Log(ctx, &StandardEvent{
+				Actor:   r.Actor,
+				Action:  "fpe_decrypt",
+				Target:  r.EventHash,
+				Status:  "success",
+				Message: fmt.Sprintf("Decrypted fields %v of audit event %v", strings.Join(r.Fields, ", "), r.EventHash),
+			}, false)
+			return err
+		})
+		return nil
+	}
+}
+
+// WithFPEDecryptRecorder calls recorder with every decryption. Decryption
+// fails if recorder returns an error.
+func WithFPEDecryptRecorder(recorder func(ctx context.Context, r FPEDecryptRecord) error) FPEDecryptorOption {
+	return func(d *FPEDecryptor) error {
+		if recorder == nil {
+			return errors.New("audit: nil FPE decrypt recorder")
+		}
+		d.recorders = append(d.recorders, recorder)
+		return nil
+	}
+}
+
+// FPEDecryptor restores the values of events redacted with format preserving
+// encryption. Decryption is never done implicitly: events are only decrypted
+// by passing a decryptor to SearchEvent.DecryptFPE, and every decryption is
+// recorded before the values are restored.
+type FPEDecryptor struct {
+	unredacter FPEUnredacter
+	actor      string
+	recorders  []func(ctx context.Context, r FPEDecryptRecord) error
+}
+
+// NewFPEDecryptor creates a decryptor on behalf of actor. At least one of
+// WithFPEDecryptAuditLog and WithFPEDecryptRecorder is required.
+//
+// @example
+//
+//	decryptor, err := audit.NewFPEDecryptor(
+//		audit.RedactFPEUnredacter{Client: redactcli},
+//		"admin@example.com",
+//		audit.WithFPEDecryptAuditLog(auditcli),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//
+//	for _, event := range searchResponse.Result.Events {
+//		err = event.DecryptFPE(ctx, decryptor, "actor", "target")
+//	}
+func NewFPEDecryptor(unredacter FPEUnredacter, actor string, opts ...FPEDecryptorOption) (*FPEDecryptor, error) {
+	if unredacter == nil {
+		return nil, errors.New("audit: nil FPE unredacter")
+	}
+	if actor == "" {
+		return nil, errors.New("audit: FPE decryption requires an actor")
+	}
+	d := &FPEDecryptor{unredacter: unredacter, actor: actor}
+	for _, opt := range opts {
+		if err := opt(d); err != nil {
+			return nil, err
+		}
+	}
+	if len(d.recorders) == 0 {
+		return nil, errors.New("audit: FPE decryption requires an audit log or recorder")
+	}
+	return d, nil
+}
+
+// DecryptFPE restores in place the given fields of the event, which were
+// redacted with format preserving encryption. Only EventEnvelope.Event is
+// updated: RawEnvelope is left as is, so that the membership of the event can
+// still be verified. The signature of the envelope covers the redacted
+// values, so it is verified before decrypting, and DecryptFPE fails if it is
+// invalid; EventEnvelope.VerifySignature fails once the event is decrypted.
+func (event *SearchEvent) DecryptFPE(ctx context.Context, d *FPEDecryptor, fields ...string) error {
+	if d == nil {
+		return errors.New("audit: nil FPE decryptor")
+	}
+	if event.FPEContext == nil || *event.FPEContext == "" {
+		return errors.New("audit: event has no FPE context, search with ReturnContext set")
+	}
+	if event.EventEnvelope == nil || event.EventEnvelope.Event == nil {
+		return errors.New("audit: event envelope is not decoded")
+	}
+	if len(fields) == 0 {
+		return errors.New("audit: no fields to decrypt")
+	}
+	if event.EventEnvelope.VerifySignature() == Failed {
+		return errors.New("audit: event signature verification failed")
+	}
+
+	b, err := json.Marshal(event.EventEnvelope.Event)
+	if err != nil {
+		return err
+	}
+	values := map[string]any{}
+	if err := json.Unmarshal(b, &values); err != nil {
+		return err
+	}
+
+	redacted := map[string]any{}
+	decrypted := []string{}
+	for _, field := range fields {
+		v, ok := values[field]
+		if !ok || v == nil {
+			continue
+		}
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("audit: field %q is not a string", field)
+		}
+		redacted[field] = v
+		decrypted = append(decrypted, field)
+	}
+	if len(decrypted) == 0 {
+		return nil
+	}
+
+	plain, err := d.unredacter.UnredactFPE(ctx, *event.FPEContext, redacted)
+	if err != nil {
+		return fmt.Errorf("audit: failed to decrypt fields: %w", err)
+	}
+	for _, field := range decrypted {
+		v, ok := plain[field].(string)
+		if !ok {
+			return fmt.Errorf("audit: field %q was not decrypted", field)
+		}
+		values[field] = v
+	}
+
+	record := FPEDecryptRecord{
+		Actor:     d.actor,
+		EventHash: event.Hash,
+		Fields:    decrypted,
+	}
+	for _, recorder := range d.recorders {
+		if err := recorder(ctx, record); err != nil {
+			return fmt.Errorf("audit: failed to record FPE decryption: %w", err)
+		}
+	}
+
+	if b, err = json.Marshal(values); err != nil {
+		return err
+	}
+	t := reflect.TypeOf(event.EventEnvelope.Event)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	v := reflect.New(t)
+	if err := json.Unmarshal(b, v.Interface()); err != nil {
+		return err
+	}
+	if reflect.TypeOf(event.EventEnvelope.Event).Kind() == reflect.Pointer {
+		event.EventEnvelope.Event = v.Interface()
+	} else {
+		event.EventEnvelope.Event = v.Elem().Interface()
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+//go:build unit
+
+package audit_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeatesting"
+	pu "github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeautil"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/audit"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/redact"
+	"github.com/stretchr/testify/assert"
+)
+
+// FPE contexts are opaque, as returned by Redact.
+const fpeContext = "gAyHpblmIoUXKTiYY8xKiQ=="
+
+func fpeSearchEvent() *audit.SearchEvent {
+	return &audit.SearchEvent{
+		EventEnvelope: &audit.EventEnvelope{
+			Event: &audit.StandardEvent{Actor: "xyz", Target: "abc", Message: "hello"},
+		},
+		RawEnvelope: map[string]any{"event": map[string]any{"actor": "xyz", "target": "abc", "message": "hello"}},
+		Hash:        "somehash",
+		FPEContext:  pangea.String(fpeContext),
+	}
+}
+
+func TestSearchEvent_DecryptFPE(t *testing.T) {
+	reverse := audit.FPEUnredacterFunc(func(ctx context.Context, fpeContext string, values map[string]any) (map[string]any, error) {
+		assert.Equal(t, "gAyHpblmIoUXKTiYY8xKiQ==", fpeContext)
+		plain := map[string]any{}
+		for k, v := range values {
+			r := []rune(v.(string))
+			for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+				r[i], r[j] = r[j], r[i]
+			}
+			plain[k] = string(r)
+		}
+		return plain, nil
+	})
+
+	_, err := audit.NewFPEDecryptor(reverse, "admin")
+	assert.Error(t, err)
+
+	records := []audit.FPEDecryptRecord{}
+	decryptor, err := audit.NewFPEDecryptor(reverse, "admin", audit.WithFPEDecryptRecorder(func(ctx context.Context, r audit.FPEDecryptRecord) error {
+		records = append(records, r)
+		return nil
+	}))
+	assert.NoError(t, err)
+
+	event := fpeSearchEvent()
+	assert.NoError(t, event.DecryptFPE(context.Background(), decryptor, "actor", "target", "source"))
+	assert.Equal(t, &audit.StandardEvent{Actor: "zyx", Target: "cba", Message: "hello"}, event.EventEnvelope.Event)
+	assert.Equal(t, "xyz", event.RawEnvelope["event"].(map[string]any)["actor"])
+	assert.Equal(t, []audit.FPEDecryptRecord{{
+		Actor:     "admin",
+		EventHash: "somehash",
+		Fields:    []string{"actor", "target"},
+	}}, records)
+
+	// Nothing is restored if the decryption cannot be recorded.
+	failing, _ := audit.NewFPEDecryptor(reverse, "admin", audit.WithFPEDecryptRecorder(func(ctx context.Context, r audit.FPEDecryptRecord) error {
+		return errors.New("unavailable")
+	}))
+	event = fpeSearchEvent()
+	assert.Error(t, event.DecryptFPE(context.Background(), failing, "actor"))
+	assert.Equal(t, "xyz", event.EventEnvelope.Event.(*audit.StandardEvent).Actor)
+
+	event.FPEContext = nil
+	assert.Error(t, event.DecryptFPE(context.Background(), decryptor, "actor"))
+}
+
+func TestSearchEvent_DecryptFPESignature(t *testing.T) {
+	upper := audit.FPEUnredacterFunc(func(ctx context.Context, fpeContext string, values map[string]any) (map[string]any, error) {
+		return map[string]any{"actor": "XYZ"}, nil
+	})
+	decryptor, _ := audit.NewFPEDecryptor(upper, "admin", audit.WithFPEDecryptRecorder(func(ctx context.Context, r audit.FPEDecryptRecord) error {
+		return nil
+	}))
+
+	pub, key, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	pki, _ := json.Marshal(map[string]string{
+		"algorithm": "ED25519",
+		"key":       string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	})
+	event := fpeSearchEvent()
+	msg, _ := pu.CanonicalizeStruct(event.EventEnvelope.Event)
+	event.EventEnvelope.Signature = pangea.String(base64.StdEncoding.EncodeToString(ed25519.Sign(key, msg)))
+	event.EventEnvelope.PublicKey = pangea.String(string(pki))
+
+	// The signature covers the redacted values: it is verified before
+	// decrypting, and no longer verifies afterwards.
+	assert.Equal(t, audit.Success, event.EventEnvelope.VerifySignature())
+	assert.NoError(t, event.DecryptFPE(context.Background(), decryptor, "actor"))
+	assert.Equal(t, "XYZ", event.EventEnvelope.Event.(*audit.StandardEvent).Actor)
+	assert.Equal(t, audit.Failed, event.EventEnvelope.VerifySignature())
+
+	// Events whose signature is invalid are not decrypted.
+	tampered := fpeSearchEvent()
+	tampered.EventEnvelope.Signature = event.EventEnvelope.Signature
+	tampered.EventEnvelope.PublicKey = event.EventEnvelope.PublicKey
+	tampered.EventEnvelope.Event.(*audit.StandardEvent).Message = "tampered"
+	assert.Error(t, tampered.DecryptFPE(context.Background(), decryptor, "actor"))
+	assert.Equal(t, "xyz", tampered.EventEnvelope.Event.(*audit.StandardEvent).Actor)
+}
+
+func TestSearchEvent_DecryptFPEWithRedact(t *testing.T) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	defer teardown()
+
+	mux.HandleFunc("/v1/unredact", func(w http.ResponseWriter, r *http.Request) {
+		pangeatesting.TestBody(t, r, `{"redacted_data":{"actor":"xyz"},"fpe_context":"gAyHpblmIoUXKTiYY8xKiQ=="}`)
+		fmt.Fprint(w, `{"request_id": "some-id", "status": "Success", "result": {"data": {"actor": "bob"}}, "summary": "ok"}`)
+	})
+	mux.HandleFunc("/v1/log", func(w http.ResponseWriter, r *http.Request) {
+		pangeatesting.TestBody(t, r, `{"event":{"actor":"admin","action":"fpe_decrypt","message":"Decrypted fields actor of audit event somehash","status":"success","target":"somehash"},"verbose":false}`)
+		fmt.Fprint(w, tenantLogResponse)
+	})
+
+	auditcli, _ := audit.New(pangeatesting.TestConfig(url), audit.DisableEventVerification())
+	decryptor, err := audit.NewFPEDecryptor(
+		audit.RedactFPEUnredacter{Client: redact.New(pangeatesting.TestConfig(url))},
+		"admin",
+		audit.WithFPEDecryptAuditLog(auditcli),
+	)
+	assert.NoError(t, err)
+
+	event := fpeSearchEvent()
+	assert.NoError(t, event.DecryptFPE(context.Background(), decryptor, "actor"))
+	assert.Equal(t, "bob", event.EventEnvelope.Event.(*audit.StandardEvent).Actor)
+}
@@ -0,0 +1,430 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+)
+
+type Auth0LogData struct {
+	ClientID     string         `json:"client_id,omitempty"`
+	ClientName   string         `json:"client_name,omitempty"`
+	Connection   *string        `json:"connection,omitempty"`
+	ConnectionID *string        `json:"connection_id,omitempty"`
+	Date         string         `json:"date"`
+	Description  string         `json:"description,omitempty"`
+	Details      map[string]any `json:"details,omitempty"`
+	Hostname     string         `json:"hostname,omitempty"`
+	IP           string         `json:"ip,omitempty"`
+	Strategy     *string        `json:"strategy,omitempty"`
+	StrategyType *string        `json:"strategy_type,omitempty"`
+	Type         string         `json:"type"`
+	UserAgent    string         `json:"user_agent,omitempty"`
+	UserID       string         `json:"user_id,omitempty"`
+	UserName     string         `json:"user_name,omitempty"`
+}
+
+// Auth0Log is a log event as sent by an Auth0 custom webhook log stream.
+type Auth0Log struct {
+	LogID string       `json:"log_id"`
+	Data  Auth0LogData `json:"data"`
+}
+
+type Auth0LogStreamRequest struct {
+	pangea.BaseRequest
+
+	Logs []Auth0Log `json:"logs"`
+}
+
+// WebhookLog is a log event of a generic JSON webhook.
+type WebhookLog map[string]any
+
+type WebhookLogStreamRequest struct {
+	pangea.BaseRequest
+
+	Logs []WebhookLog `json:"logs"`
+}
+
+// LogStreamVendor decodes the webhook bodies of a log stream vendor and builds
+// LogStream requests from them.
+type LogStreamVendor[L any] interface {
+	// Decode parses the logs of a webhook body.
+	Decode(body []byte) ([]L, error)
+
+	// NewRequest builds the LogStream request for a batch of logs.
+	NewRequest(logs []L) pangea.ConfigIDer
+}
+
+// Auth0LogStream is the vendor of Auth0 custom webhook log streams, accepting
+// any of the JSON array, JSON lines and JSON object payload formats.
+type Auth0LogStream struct{}
+
+func (Auth0LogStream) Decode(body []byte) ([]Auth0Log, error) {
+	return decodeJSONValues[Auth0Log](body)
+}
+
+func (Auth0LogStream) NewRequest(logs []Auth0Log) pangea.ConfigIDer {
+	return &Auth0LogStreamRequest{Logs: logs}
+}
+
+// WebhookLogStream is the vendor of generic webhooks posting a JSON object, an
+// array of objects or newline delimited objects.
+type WebhookLogStream struct{}
+
+func (WebhookLogStream) Decode(body []byte) ([]WebhookLog, error) {
+	return decodeJSONValues[WebhookLog](body)
+}
+
+func (WebhookLogStream) NewRequest(logs []WebhookLog) pangea.ConfigIDer {
+	return &WebhookLogStreamRequest{Logs: logs}
+}
+
+// decodeJSONValues decodes either a JSON array or a stream of JSON values.
+func decodeJSONValues[L any](body []byte) ([]L, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return nil, errors.New("audit: empty log stream body")
+	}
+	if trimmed[0] == '[' {
+		var logs []L
+		if err := json.Unmarshal(trimmed, &logs); err != nil {
+			return nil, fmt.Errorf("audit: invalid log stream body: %w", err)
+		}
+		return logs, nil
+	}
+
+	logs := []L{}
+	dec := json.NewDecoder(bytes.NewReader(trimmed))
+	for dec.More() {
+		var l L
+		if err := dec.Decode(&l); err != nil {
+			return nil, fmt.Errorf("audit: invalid log stream body: %w", err)
+		}
+		logs = append(logs, l)
+	}
+	return logs, nil
+}
+
+// LogStreamAuthenticator authenticates an inbound webhook, given its already
+// read body.
+type LogStreamAuthenticator func(r *http.Request, body []byte) error
+
+// ErrLogStreamUnauthorized is returned by the authenticators of this package
+// when a webhook is not authenticated.
+var ErrLogStreamUnauthorized = errors.New("audit: unauthorized log stream request")
+
+// LogStreamTokenAuth authenticates webhooks carrying token in the
+// Authorization header, either as is or as a bearer token. This is the scheme
+// of Auth0 log streams.
+func LogStreamTokenAuth(token string) LogStreamAuthenticator {
+	return func(r *http.Request, body []byte) error {
+		got := r.Header.Get("Authorization")
+		got = strings.TrimSpace(strings.TrimPrefix(got, "Bearer "))
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			return ErrLogStreamUnauthorized
+		}
+		return nil
+	}
+}
+
+// LogStreamHMACAuth authenticates webhooks whose header holds the hex encoded
+// HMAC-SHA256 of the body, optionally prefixed with "sha256=".
+func LogStreamHMACAuth(header string, secret []byte) LogStreamAuthenticator {
+	return func(r *http.Request, body []byte) error {
+		got, err := hex.DecodeString(strings.TrimPrefix(r.Header.Get(header), "sha256="))
+		if err != nil || len(secret) == 0 {
+			return ErrLogStreamUnauthorized
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(body)
+		if !hmac.Equal(got, mac.Sum(nil)) {
+			return ErrLogStreamUnauthorized
+		}
+		return nil
+	}
+}
+
+type LogStreamReceiverOptions struct {
+	// Authenticates inbound webhooks. Required.
+	Authenticator LogStreamAuthenticator
+
+	// Config ID of the LogStream requests. Optional.
+	ConfigID string
+
+	// Maximum number of logs per LogStream request. Defaults to 100.
+	BatchSize int
+
+	// Maximum time a log waits in a partial batch. Defaults to 1 second.
+	FlushInterval time.Duration
+
+	// Maximum number of logs waiting to be forwarded. Webhooks are rejected
+	// with 503 Service Unavailable when the queue is full. Defaults to 1000.
+	QueueSize int
+
+	// Maximum size of a webhook body. Defaults to 1 MiB.
+	MaxBodySize int64
+
+	// Called with the errors of forwarding batches, including those of the
+	// attempts that are retried. Optional.
+	OnError func(err error)
+}
+
+// maxLogStreamRetryInterval bounds the backoff between two attempts to
+// forward a failed batch.
+const maxLogStreamRetryInterval = time.Minute
+
+// LogStreamReceiver is an http.Handler receiving log stream webhooks. Once a
+// webhook is authenticated and decoded its logs are acknowledged, then
+// forwarded through LogStream in batches by a background goroutine. Batches
+// that fail are kept at the head of the queue and retried with exponential
+// backoff, up to one minute apart, so that webhooks are rejected once the
+// queue is full and the sender retries them; only batches rejected by Pangea
+// as invalid are dropped. Call Close to forward pending logs.
+type LogStreamReceiver[L any] struct {
+	client Client
+	vendor LogStreamVendor[L]
+	opts   LogStreamReceiverOptions
+
+	// ctx is cancelled when Close gives up on the pending logs.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	pending []L
+	closed  bool
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewLogStreamReceiver creates a receiver forwarding the logs of vendor
+// through client.
+//
+// @example
+//
+//	receiver, err := audit.NewLogStreamReceiver(auditcli, audit.Auth0LogStream{}, &audit.LogStreamReceiverOptions{
+//		Authenticator: audit.LogStreamTokenAuth(os.Getenv("AUTH0_LOG_STREAM_TOKEN")),
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer receiver.Close(ctx)
+//
+//	http.Handle("/auth0/logs", receiver)
+func NewLogStreamReceiver[L any](client Client, vendor LogStreamVendor[L], opts *LogStreamReceiverOptions) (*LogStreamReceiver[L], error) {
+	if client == nil || vendor == nil {
+		return nil, errors.New("audit: log stream receiver requires a client and a vendor")
+	}
+	if opts == nil || opts.Authenticator == nil {
+		return nil, errors.New("audit: log stream receiver requires an authenticator")
+	}
+
+	o := *opts
+	if o.BatchSize <= 0 {
+		o.BatchSize = 100
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = time.Second
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = 1000
+	}
+	if o.MaxBodySize <= 0 {
+		o.MaxBodySize = 1 << 20
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &LogStreamReceiver[L]{
+		client: client,
+		vendor: vendor,
+		opts:   o,
+		ctx:    ctx,
+		cancel: cancel,
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go r.run()
+	return r, nil
+}
+
+func (r *LogStreamReceiver[L]) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, r.opts.MaxBodySize))
+	if err != nil {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := r.opts.Authenticator(req, body); err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	logs, err := r.vendor.Decode(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.mu.Lock()
+	if r.closed || len(r.pending)+len(logs) > r.opts.QueueSize {
+		r.mu.Unlock()
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "log stream queue is full", http.StatusServiceUnavailable)
+		return
+	}
+	r.pending = append(r.pending, logs...)
+	full := len(r.pending) >= r.opts.BatchSize
+	r.mu.Unlock()
+
+	if full {
+		select {
+		case r.wake <- struct{}{}:
+		default:
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Close stops accepting webhooks and forwards the pending logs, retrying
+// failed batches until ctx is done. The logs that could not be forwarded by
+// then are dropped and reported in the returned error.
+func (r *LogStreamReceiver[L]) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return errors.New("audit: log stream receiver is closed")
+	}
+	r.closed = true
+	close(r.stop)
+	r.mu.Unlock()
+
+	defer r.cancel()
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+	}
+	r.cancel()
+	<-r.done
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) == 0 {
+		return nil
+	}
+	return fmt.Errorf("audit: %d logs were not forwarded: %w", len(r.pending), ctx.Err())
+}
+
+func (r *LogStreamReceiver[L]) run() {
+	defer close(r.done)
+
+	timer := time.NewTimer(r.opts.FlushInterval)
+	defer timer.Stop()
+
+	var backoff time.Duration
+	for {
+		all := true
+		select {
+		case <-r.wake:
+			if backoff > 0 {
+				// Wait for the retry.
+				continue
+			}
+			all = false
+		case <-timer.C:
+		case <-r.stop:
+			r.drain(backoff)
+			return
+		}
+
+		err := r.flush(all)
+		switch {
+		case err != nil:
+			backoff = min(max(2*backoff, r.opts.FlushInterval), maxLogStreamRetryInterval)
+			timer.Reset(backoff)
+		case all:
+			backoff = 0
+			timer.Reset(r.opts.FlushInterval)
+		}
+	}
+}
+
+// drain forwards all the pending logs, retrying with backoff until the
+// receiver's context is cancelled.
+func (r *LogStreamReceiver[L]) drain(backoff time.Duration) {
+	for {
+		if backoff > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-r.ctx.Done():
+				return
+			}
+		}
+		if r.flush(true) == nil {
+			return
+		}
+		backoff = min(max(2*backoff, r.opts.FlushInterval), maxLogStreamRetryInterval)
+	}
+}
+
+// flush forwards full batches, and the last partial one if all is set. A
+// batch that fails with an error that may not recur is put back at the head
+// of the queue, and the error returned.
+func (r *LogStreamReceiver[L]) flush(all bool) error {
+	for {
+		r.mu.Lock()
+		n := min(len(r.pending), r.opts.BatchSize)
+		if n == 0 || (n < r.opts.BatchSize && !all) {
+			r.mu.Unlock()
+			return nil
+		}
+		batch := r.pending[:n:n]
+		r.mu.Unlock()
+
+		input := r.vendor.NewRequest(batch)
+		if r.opts.ConfigID != "" {
+			input.SetConfigID(r.opts.ConfigID)
+		}
+		_, err := r.client.LogStream(r.ctx, input)
+		if err != nil && r.opts.OnError != nil {
+			r.opts.OnError(err)
+		}
+		if err != nil && retryableLogStreamError(err) {
+			return err
+		}
+
+		// Only flush removes logs, and ServeHTTP appends them.
+		r.mu.Lock()
+		r.pending = r.pending[n:]
+		r.mu.Unlock()
+	}
+}
+
+// retryableLogStreamError reports whether forwarding a batch failing with err
+// may succeed later. Batches rejected by Pangea as invalid are not retried.
+func retryableLogStreamError(err error) bool {
+	var apiErr *pangea.APIError
+	if errors.As(err, &apiErr) && apiErr.HTTPResponse != nil {
+		code := apiErr.HTTPResponse.StatusCode
+		return code == http.StatusTooManyRequests || code >= 500
+	}
+	return true
+}
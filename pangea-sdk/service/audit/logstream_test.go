@@ -0,0 +1,215 @@
+//go:build unit
+
+package audit_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeatesting"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupLogStreamServer(t *testing.T) (audit.Client, func() []string, func()) {
+	mux, url, teardown := pangeatesting.SetupServer()
+
+	var mu sync.Mutex
+	bodies := []string{}
+	mux.HandleFunc("/v1/log_stream", func(w http.ResponseWriter, r *http.Request) {
+		pangeatesting.TestMethod(t, r, "POST")
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		fmt.Fprint(w, `{"request_id": "some-id", "status": "Success", "result": {}, "summary": "ok"}`)
+	})
+
+	client, _ := audit.New(pangeatesting.TestConfig(url))
+	return client, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return bodies
+	}, teardown
+}
+
+func TestLogStreamReceiver_Auth0(t *testing.T) {
+	client, bodies, teardown := setupLogStreamServer(t)
+	defer teardown()
+
+	receiver, err := audit.NewLogStreamReceiver(client, audit.Auth0LogStream{}, &audit.LogStreamReceiverOptions{
+		Authenticator: audit.LogStreamTokenAuth("secret"),
+		ConfigID:      "pci_123",
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+	})
+	assert.NoError(t, err)
+
+	post := func(token, body string) int {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		req.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		receiver.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	log := `{"log_id": "%v", "data": {"date": "2024-03-29T17:26:50.193Z", "type": "s", "user_id": "u1"}}`
+	assert.Equal(t, http.StatusUnauthorized, post("wrong", fmt.Sprintf(log, "1")))
+	assert.Equal(t, http.StatusBadRequest, post("Bearer secret", "{"))
+	assert.Equal(t, http.StatusOK, post("Bearer secret", "["+fmt.Sprintf(log, "1")+","+fmt.Sprintf(log, "2")+"]"))
+	assert.Equal(t, http.StatusOK, post("secret", fmt.Sprintf(log, "3")))
+
+	assert.NoError(t, receiver.Close(context.Background()))
+	assert.Equal(t, http.StatusServiceUnavailable, post("secret", fmt.Sprintf(log, "4")))
+
+	got := bodies()
+	assert.Len(t, got, 2)
+	ids := []string{}
+	for _, body := range got {
+		var input audit.Auth0LogStreamRequest
+		assert.NoError(t, json.Unmarshal([]byte(body), &input))
+		assert.Equal(t, "pci_123", input.ConfigID)
+		for _, l := range input.Logs {
+			assert.Equal(t, "u1", l.Data.UserID)
+			ids = append(ids, l.LogID)
+		}
+	}
+	assert.Equal(t, []string{"1", "2", "3"}, ids)
+}
+
+func TestLogStreamReceiver_WebhookHMAC(t *testing.T) {
+	client, bodies, teardown := setupLogStreamServer(t)
+	defer teardown()
+
+	secret := []byte("secret")
+	receiver, err := audit.NewLogStreamReceiver(client, audit.WebhookLogStream{}, &audit.LogStreamReceiverOptions{
+		Authenticator: audit.LogStreamHMACAuth("X-Signature", secret),
+	})
+	assert.NoError(t, err)
+
+	body := `{"event": "login"}` + "\n" + `{"event": "logout"}`
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(body))
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	w := httptest.NewRecorder()
+	receiver.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req = httptest.NewRequest("POST", "/", strings.NewReader(body+" "))
+	req.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+	w = httptest.NewRecorder()
+	receiver.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	assert.NoError(t, receiver.Close(context.Background()))
+	assert.Equal(t, []string{`{"logs":[{"event":"login"},{"event":"logout"}]}` + "\n"}, bodies())
+
+	_, err = audit.NewLogStreamReceiver(client, audit.WebhookLogStream{}, nil)
+	assert.Error(t, err)
+}
+
+func TestLogStreamReceiver_Retry(t *testing.T) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	defer teardown()
+
+	// The first two attempts are rate limited, and the "invalid" logs are
+	// rejected.
+	var mu sync.Mutex
+	attempts := 0
+	forwarded := []string{}
+	mux.HandleFunc("/v1/log_stream", func(w http.ResponseWriter, r *http.Request) {
+		var input audit.WebhookLogStreamRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		event := fmt.Sprint(input.Logs[0]["event"])
+		switch {
+		case attempts <= 2:
+			w.WriteHeader(http.StatusTooManyRequests)
+		case event == "invalid":
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			forwarded = append(forwarded, event)
+			fmt.Fprint(w, `{"request_id": "some-id", "status": "Success", "result": {}, "summary": "ok"}`)
+			return
+		}
+		fmt.Fprint(w, `{"request_id": "some-id", "status": "Error", "result": {}, "summary": "failed"}`)
+	})
+
+	var errs []error
+	client, _ := audit.New(pangeatesting.TestConfig(url))
+	receiver, err := audit.NewLogStreamReceiver(client, audit.WebhookLogStream{}, &audit.LogStreamReceiverOptions{
+		Authenticator: func(*http.Request, []byte) error { return nil },
+		BatchSize:     1,
+		FlushInterval: 20 * time.Millisecond,
+		QueueSize:     2,
+		OnError: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+	})
+	assert.NoError(t, err)
+
+	post := func(body string) int {
+		w := httptest.NewRecorder()
+		receiver.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(body)))
+		return w.Code
+	}
+
+	// The first batch is retried until it is forwarded, the second one is
+	// invalid and dropped.
+	assert.Equal(t, http.StatusOK, post(`{"event": "login"}`))
+	assert.Equal(t, http.StatusOK, post(`{"event": "invalid"}`))
+	assert.Equal(t, http.StatusServiceUnavailable, post(`{"event": "logout"}`))
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(errs) == 3
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, http.StatusOK, post(`{"event": "logout"}`))
+
+	assert.NoError(t, receiver.Close(context.Background()))
+	assert.Equal(t, []string{"login", "logout"}, forwarded)
+}
+
+func TestLogStreamReceiver_CloseDropsFailedLogs(t *testing.T) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	defer teardown()
+
+	mux.HandleFunc("/v1/log_stream", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"request_id": "some-id", "status": "Error", "result": {}, "summary": "failed"}`)
+	})
+
+	client, _ := audit.New(pangeatesting.TestConfig(url))
+	receiver, err := audit.NewLogStreamReceiver(client, audit.WebhookLogStream{}, &audit.LogStreamReceiverOptions{
+		Authenticator: func(*http.Request, []byte) error { return nil },
+		FlushInterval: time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	receiver.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"event": "login"}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = receiver.Close(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "1 logs were not forwarded")
+}
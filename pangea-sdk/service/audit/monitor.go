@@ -0,0 +1,518 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MonitorState is the last tree state that a Monitor successfully verified.
+type MonitorState struct {
+	// The name of the Merkle Tree
+	TreeName string `json:"tree_name"`
+
+	// The size of the tree at the last check
+	TreeSize int `json:"tree_size"`
+
+	// The root hash at the last check
+	RootHash string `json:"root_hash"`
+
+	// The time of the last check
+	CheckedAt time.Time `json:"checked_at"`
+
+	// The published roots that were verified but not found in Arweave yet
+	PendingPublications []MonitorPendingPublication `json:"pending_publications,omitempty"`
+}
+
+func (s *MonitorState) root() Root {
+	return Root{TreeName: s.TreeName, Size: s.TreeSize, RootHash: s.RootHash}
+}
+
+// MonitorPendingPublication is a published root that a Monitor verified
+// against the tree, and checks against Arweave until it shows up or its
+// publication grace period is over.
+type MonitorPendingPublication struct {
+	TreeSize    int       `json:"tree_size"`
+	RootHash    string    `json:"root_hash"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// MonitorStateStore persists the state of a Monitor so that it survives
+// restarts.
+type MonitorStateStore interface {
+	// Load returns the persisted state, or nil if there is none yet.
+	Load(ctx context.Context) (*MonitorState, error)
+
+	// Save persists the given state.
+	Save(ctx context.Context, state MonitorState) error
+}
+
+// FileMonitorStateStore is a MonitorStateStore backed by a JSON file.
+type FileMonitorStateStore struct {
+	Path string
+}
+
+func NewFileMonitorStateStore(path string) *FileMonitorStateStore {
+	return &FileMonitorStateStore{Path: path}
+}
+
+func (s *FileMonitorStateStore) Load(ctx context.Context) (*MonitorState, error) {
+	b, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("audit: cannot read monitor state %v: %w", s.Path, err)
+	}
+
+	var state MonitorState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("audit: invalid monitor state %v: %w", s.Path, err)
+	}
+	return &state, nil
+}
+
+func (s *FileMonitorStateStore) Save(ctx context.Context, state MonitorState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that a crash never leaves a
+	// truncated state behind.
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".*")
+	if err != nil {
+		return fmt.Errorf("audit: cannot write monitor state %v: %w", s.Path, err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close() //nolint:errcheck
+		return fmt.Errorf("audit: cannot write monitor state %v: %w", s.Path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("audit: cannot write monitor state %v: %w", s.Path, err)
+	}
+	if err := os.Rename(tmp.Name(), s.Path); err != nil {
+		return fmt.Errorf("audit: cannot write monitor state %v: %w", s.Path, err)
+	}
+	return nil
+}
+
+type memoryMonitorStateStore struct {
+	state *MonitorState
+}
+
+func (s *memoryMonitorStateStore) Load(ctx context.Context) (*MonitorState, error) {
+	return s.state, nil
+}
+
+func (s *memoryMonitorStateStore) Save(ctx context.Context, state MonitorState) error {
+	s.state = &state
+	return nil
+}
+
+type MonitorAlertType string
+
+const (
+	// The tree is not a continuation of the last checked tree.
+	MonitorAlertFork MonitorAlertType = "fork"
+
+	// The tree is smaller than the last checked tree.
+	MonitorAlertRollback MonitorAlertType = "rollback"
+
+	// A published root could not be found in Arweave.
+	MonitorAlertMissingPublication MonitorAlertType = "missing_publication"
+)
+
+type MonitorAlert struct {
+	Type MonitorAlertType
+
+	// A human readable description of the problem.
+	Message string
+
+	// The last verified state, nil on the very first check.
+	Previous *MonitorState
+
+	// The root returned by Pangea.
+	Root *Root
+
+	// The root published in Arweave, if any.
+	PublishedRoot *Root
+}
+
+type MonitorAlertHandler func(ctx context.Context, alert MonitorAlert)
+
+// Monitor periodically fetches the current root of an audit log and verifies
+// that it is a continuation of the last root it checked. Alerts are raised
+// when a fork, a rollback or a missing Arweave publication is detected.
+type Monitor struct {
+	client           Client
+	rp               RootsProvider
+	store            MonitorStateStore
+	interval         time.Duration
+	maxSteps         int
+	publicationGrace time.Duration
+	onAlert          MonitorAlertHandler
+	onError          func(ctx context.Context, err error)
+
+	// checkMu serializes the checks and guards the fields below it, while mu
+	// only guards the state, so that State does not wait for a check.
+	checkMu sync.Mutex
+	loaded  bool
+	alerts  []MonitorAlert
+
+	mu    sync.Mutex
+	state *MonitorState
+}
+
+type MonitorOption func(*Monitor) error
+
+func NewMonitor(client Client, opts ...MonitorOption) (*Monitor, error) {
+	if client == nil {
+		return nil, errors.New("audit: nil client")
+	}
+
+	m := &Monitor{
+		client:           client,
+		store:            &memoryMonitorStateStore{},
+		interval:         time.Minute,
+		maxSteps:         1000,
+		publicationGrace: time.Hour,
+	}
+
+	for _, opt := range opts {
+		err := opt(m)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// WithMonitorInterval sets how often Run checks the tree. Defaults to one minute.
+func WithMonitorInterval(d time.Duration) MonitorOption {
+	return func(m *Monitor) error {
+		if d <= 0 {
+			return errors.New("audit: monitor interval must be positive")
+		}
+		m.interval = d
+		return nil
+	}
+}
+
+// WithMonitorStateStore sets where the last checked state is persisted.
+// Defaults to an in-memory store.
+func WithMonitorStateStore(s MonitorStateStore) MonitorOption {
+	return func(m *Monitor) error {
+		m.store = s
+		return nil
+	}
+}
+
+// WithMonitorAlertHandler sets the callback invoked when an alert is raised.
+func WithMonitorAlertHandler(h MonitorAlertHandler) MonitorOption {
+	return func(m *Monitor) error {
+		m.onAlert = h
+		return nil
+	}
+}
+
+// WithMonitorErrorHandler sets the callback invoked by Run when a check fails
+// for reasons other than a detected inconsistency, e.g. network errors.
+func WithMonitorErrorHandler(h func(ctx context.Context, err error)) MonitorOption {
+	return func(m *Monitor) error {
+		m.onError = h
+		return nil
+	}
+}
+
+// WithMonitorRootsProvider sets the provider of published roots. Defaults to
+// an ArweaveRootsProvider for the monitored tree.
+func WithMonitorRootsProvider(rp RootsProvider) MonitorOption {
+	return func(m *Monitor) error {
+		m.rp = rp
+		return nil
+	}
+}
+
+// WithMonitorMaxStepsPerCheck limits how many tree sizes are walked in a
+// single check. Remaining sizes are walked in the following checks.
+// Defaults to 1000.
+func WithMonitorMaxStepsPerCheck(n int) MonitorOption {
+	return func(m *Monitor) error {
+		if n <= 0 {
+			return errors.New("audit: monitor max steps must be positive")
+		}
+		m.maxSteps = n
+		return nil
+	}
+}
+
+// WithMonitorPublicationGrace sets how long after its publication time a root
+// may be missing from Arweave before an alert is raised. Defaults to one hour.
+func WithMonitorPublicationGrace(d time.Duration) MonitorOption {
+	return func(m *Monitor) error {
+		m.publicationGrace = d
+		return nil
+	}
+}
+
+// State returns the last verified state, or nil if nothing was verified yet.
+func (m *Monitor) State() *MonitorState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state == nil {
+		return nil
+	}
+	s := *m.state
+	s.PendingPublications = slices.Clone(m.state.PendingPublications)
+	return &s
+}
+
+// Run checks the tree every interval until ctx is cancelled.
+func (m *Monitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		err := m.Check(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if m.onError != nil {
+				m.onError(ctx, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check fetches the current root and verifies it against the last checked
+// state. Detected inconsistencies are reported through the alert handler, once
+// the check is over, and leave the persisted state untouched. The returned
+// error is only set when the check itself could not be completed.
+func (m *Monitor) Check(ctx context.Context) error {
+	m.checkMu.Lock()
+	err := m.check(ctx)
+	alerts := m.alerts
+	m.alerts = nil
+	m.checkMu.Unlock()
+
+	if m.onAlert != nil {
+		for _, alert := range alerts {
+			m.onAlert(ctx, alert)
+		}
+	}
+	return err
+}
+
+func (m *Monitor) check(ctx context.Context) error {
+	if !m.loaded {
+		state, err := m.store.Load(ctx)
+		if err != nil {
+			return err
+		}
+		m.mu.Lock()
+		m.state = state
+		m.mu.Unlock()
+		m.loaded = true
+	}
+
+	resp, err := m.client.Root(ctx, &RootInput{})
+	if err != nil {
+		return err
+	}
+	latest := resp.Result.Data
+	prev := m.state
+
+	if m.rp == nil {
+		m.rp = NewArweaveRootsProvider(latest.TreeName)
+	}
+
+	if prev == nil {
+		// The first check trusts the current root.
+		return m.advance(ctx, nil, latest, nil)
+	}
+
+	pending := m.crossCheckPending(ctx, prev)
+	current := prev.root()
+	target, err := m.verify(ctx, prev, latest)
+	if err != nil {
+		// Keep the progress of the walk.
+		if target.Size > current.Size {
+			if err := m.save(ctx, target, pending); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+	if target.Size == current.Size && target.RootHash == current.RootHash {
+		if !slices.Equal(pending, prev.PendingPublications) {
+			return m.save(ctx, current, pending)
+		}
+		return nil
+	}
+	return m.advance(ctx, prev, target, pending)
+}
+
+// verify verifies latest against the last checked state, walking at most
+// maxSteps tree sizes. It returns the root up to which the tree was verified.
+func (m *Monitor) verify(ctx context.Context, prev *MonitorState, latest Root) (Root, error) {
+	current := prev.root()
+	if prev.TreeName != "" && prev.TreeName != latest.TreeName {
+		m.alert(MonitorAlertFork, fmt.Sprintf("tree name changed from %v to %v", prev.TreeName, latest.TreeName), prev, &latest, nil)
+		return current, nil
+	}
+	if latest.Size < prev.TreeSize {
+		m.alert(MonitorAlertRollback, fmt.Sprintf("tree size went back from %v to %v", prev.TreeSize, latest.Size), prev, &latest, nil)
+		return current, nil
+	}
+	if latest.Size == prev.TreeSize {
+		if latest.RootHash != prev.RootHash {
+			m.alert(MonitorAlertFork, fmt.Sprintf("root hash changed at tree size %v", latest.Size), prev, &latest, nil)
+		}
+		return current, nil
+	}
+
+	target := latest
+	if latest.Size-prev.TreeSize > m.maxSteps {
+		r, err := m.client.Root(ctx, &RootInput{TreeSize: prev.TreeSize + m.maxSteps})
+		if err != nil {
+			return current, err
+		}
+		target = r.Result.Data
+	}
+	return m.walk(ctx, prev, target)
+}
+
+// walk verifies the consistency proof of every tree size between the last
+// checked one and target. It returns the last root verified: target, or the
+// root before a failure.
+func (m *Monitor) walk(ctx context.Context, prev *MonitorState, target Root) (Root, error) {
+	current := prev.root()
+	for size := prev.TreeSize + 1; size <= target.Size; size++ {
+		next := target
+		if size != target.Size {
+			r, err := m.client.Root(ctx, &RootInput{TreeSize: size})
+			if err != nil {
+				return current, err
+			}
+			next = r.Result.Data
+		}
+
+		if next.ConsistencyProof == nil {
+			m.alert(MonitorAlertFork, fmt.Sprintf("missing consistency proof at tree size %v", size), prev, &next, nil)
+			return prev.root(), nil
+		}
+		ok, err := verifyConsistencyProof(current.RootHash, next.RootHash, *next.ConsistencyProof)
+		if err != nil || !ok {
+			m.alert(MonitorAlertFork, fmt.Sprintf("failed consistency proof between tree sizes %v and %v", current.Size, size), prev, &next, nil)
+			return prev.root(), nil
+		}
+		current = next
+	}
+	return current, nil
+}
+
+// advance moves the state to a verified root, once it is cross-checked
+// against Arweave.
+func (m *Monitor) advance(ctx context.Context, prev *MonitorState, root Root, pending []MonitorPendingPublication) error {
+	// Only published roots are expected to be in Arweave.
+	if root.PublishedAt != nil {
+		roots := m.rp.UpdateRoots(ctx, []string{strconv.Itoa(root.Size)})
+		published, ok := roots[root.Size]
+		switch {
+		case !ok && time.Since(*root.PublishedAt) < m.publicationGrace:
+			// Give the publication some time to show up.
+			pending = append(pending, MonitorPendingPublication{TreeSize: root.Size, RootHash: root.RootHash, PublishedAt: *root.PublishedAt})
+		case !ok:
+			m.alert(MonitorAlertMissingPublication, fmt.Sprintf("root for tree size %v is not published", root.Size), prev, &root, nil)
+		case published.RootHash != root.RootHash:
+			m.alert(MonitorAlertFork, fmt.Sprintf("published root hash differs at tree size %v", root.Size), prev, &root, &published)
+			if prev == nil {
+				return nil
+			}
+			if !slices.Equal(pending, prev.PendingPublications) {
+				return m.save(ctx, prev.root(), pending)
+			}
+			return nil
+		}
+	}
+	return m.save(ctx, root, pending)
+}
+
+// crossCheckPending compares the pending publications of prev against
+// Arweave, and returns those that are still within their grace period.
+func (m *Monitor) crossCheckPending(ctx context.Context, prev *MonitorState) []MonitorPendingPublication {
+	if len(prev.PendingPublications) == 0 {
+		return nil
+	}
+
+	sizes := make([]string, 0, len(prev.PendingPublications))
+	for _, p := range prev.PendingPublications {
+		sizes = append(sizes, strconv.Itoa(p.TreeSize))
+	}
+	roots := m.rp.UpdateRoots(ctx, sizes)
+
+	var pending []MonitorPendingPublication
+	for _, p := range prev.PendingPublications {
+		root := Root{TreeName: prev.TreeName, Size: p.TreeSize, RootHash: p.RootHash, PublishedAt: &p.PublishedAt}
+		published, ok := roots[p.TreeSize]
+		switch {
+		case !ok && time.Since(p.PublishedAt) < m.publicationGrace:
+			pending = append(pending, p)
+		case !ok:
+			m.alert(MonitorAlertMissingPublication, fmt.Sprintf("root for tree size %v is not published", p.TreeSize), prev, &root, nil)
+		case published.RootHash != p.RootHash:
+			m.alert(MonitorAlertFork, fmt.Sprintf("published root hash differs at tree size %v", p.TreeSize), prev, &root, &published)
+		}
+	}
+	return pending
+}
+
+func (m *Monitor) save(ctx context.Context, root Root, pending []MonitorPendingPublication) error {
+	state := MonitorState{
+		TreeName:            root.TreeName,
+		TreeSize:            root.Size,
+		RootHash:            root.RootHash,
+		CheckedAt:           time.Now().UTC(),
+		PendingPublications: pending,
+	}
+	if err := m.store.Save(ctx, state); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.state = &state
+	m.mu.Unlock()
+	return nil
+}
+
+// alert queues an alert, raised at the end of the check.
+func (m *Monitor) alert(t MonitorAlertType, msg string, prev *MonitorState, root *Root, published *Root) {
+	if prev != nil {
+		p := *prev
+		p.PendingPublications = slices.Clone(prev.PendingPublications)
+		prev = &p
+	}
+	m.alerts = append(m.alerts, MonitorAlert{
+		Type:          t,
+		Message:       msg,
+		Previous:      prev,
+		Root:          root,
+		PublishedRoot: published,
+	})
+}
@@ -0,0 +1,257 @@
+//go:build unit
+
+package audit_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeatesting"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea/hash"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+type staticRootsProvider struct {
+	roots map[int]audit.Root
+}
+
+func (rp *staticRootsProvider) UpdateRoots(ctx context.Context, treeSizes []string) map[int]audit.Root {
+	return rp.roots
+}
+
+func (rp *staticRootsProvider) OverrideRoots(roots map[int]audit.Root) map[int]audit.Root {
+	for k, v := range roots {
+		rp.roots[k] = v
+	}
+	return rp.roots
+}
+
+func rootResponse(root audit.Root) string {
+	proof := "null"
+	if root.ConsistencyProof != nil {
+		proof = fmt.Sprintf(`[%q]`, (*root.ConsistencyProof)[0])
+	}
+	publishedAt := "null"
+	if root.PublishedAt != nil {
+		publishedAt = fmt.Sprintf(`%q`, root.PublishedAt.Format(time.RFC3339))
+	}
+	return fmt.Sprintf(`{
+		"request_id": "some-id",
+		"request_time": "1970-01-01T00:00:00Z",
+		"response_time": "1970-01-01T00:00:10Z",
+		"status": "Success",
+		"result": {
+			"data": {
+				"tree_name": "some-tree",
+				"size": %d,
+				"root_hash": %q,
+				"published_at": %s,
+				"consistency_proof": %s
+			}
+		},
+		"summary": "success"
+	}`, root.Size, root.RootHash, publishedAt, proof)
+}
+
+func TestMonitor(t *testing.T) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	defer teardown()
+
+	leafA := hash.Encode([]byte("a"))
+	leafB := hash.Encode([]byte("b"))
+	root2 := hash.Pair(leafA).With(leafB)
+	proof := []string{fmt.Sprintf("x:%v,r:%v", leafA, leafB)}
+	badProof := []string{fmt.Sprintf("x:%v,r:%v", leafB, leafA)}
+
+	var current audit.Root
+	mux.HandleFunc("/v1/root", func(w http.ResponseWriter, r *http.Request) {
+		pangeatesting.TestMethod(t, r, "POST")
+		fmt.Fprint(w, rootResponse(current))
+	})
+
+	var alerts []audit.MonitorAlert
+	store := audit.NewFileMonitorStateStore(filepath.Join(t.TempDir(), "state.json"))
+	client, _ := audit.New(pangeatesting.TestConfig(url))
+	monitor, err := audit.NewMonitor(client,
+		audit.WithMonitorStateStore(store),
+		audit.WithMonitorRootsProvider(&staticRootsProvider{roots: map[int]audit.Root{}}),
+		audit.WithMonitorAlertHandler(func(ctx context.Context, alert audit.MonitorAlert) {
+			alerts = append(alerts, alert)
+		}),
+	)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	// First check trusts the current root.
+	current = audit.Root{Size: 1, RootHash: leafA.String()}
+	assert.NoError(t, monitor.Check(ctx))
+	assert.Empty(t, alerts)
+	assert.Equal(t, 1, monitor.State().TreeSize)
+
+	// A consistent new root advances the state.
+	current = audit.Root{Size: 2, RootHash: root2.String(), ConsistencyProof: &proof}
+	assert.NoError(t, monitor.Check(ctx))
+	assert.Empty(t, alerts)
+	assert.Equal(t, 2, monitor.State().TreeSize)
+
+	// State survives a restart.
+	restarted, err := audit.NewMonitor(client, audit.WithMonitorStateStore(store))
+	assert.NoError(t, err)
+	state, err := store.Load(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, root2.String(), state.RootHash)
+	assert.Nil(t, restarted.State())
+
+	// A smaller tree is a rollback.
+	current = audit.Root{Size: 1, RootHash: leafA.String()}
+	assert.NoError(t, monitor.Check(ctx))
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, audit.MonitorAlertRollback, alerts[0].Type)
+	assert.Equal(t, 2, monitor.State().TreeSize)
+
+	// A different hash for the same size is a fork.
+	current = audit.Root{Size: 2, RootHash: leafB.String()}
+	assert.NoError(t, monitor.Check(ctx))
+	assert.Len(t, alerts, 2)
+	assert.Equal(t, audit.MonitorAlertFork, alerts[1].Type)
+	assert.Equal(t, root2.String(), monitor.State().RootHash)
+
+	// A root that is not a continuation is a fork.
+	current = audit.Root{Size: 3, RootHash: leafB.String(), ConsistencyProof: &badProof}
+	assert.NoError(t, monitor.Check(ctx))
+	assert.Len(t, alerts, 3)
+	assert.Equal(t, audit.MonitorAlertFork, alerts[2].Type)
+	assert.Equal(t, 2, monitor.State().TreeSize)
+}
+
+func TestMonitor_MissingPublication(t *testing.T) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	defer teardown()
+
+	publishedAt := time.Now().Add(-2 * time.Hour)
+	root := audit.Root{Size: 1, RootHash: hash.Encode([]byte("a")).String(), PublishedAt: &publishedAt}
+	mux.HandleFunc("/v1/root", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, rootResponse(root))
+	})
+
+	var alerts []audit.MonitorAlert
+	rp := &staticRootsProvider{roots: map[int]audit.Root{}}
+	client, _ := audit.New(pangeatesting.TestConfig(url))
+	monitor, err := audit.NewMonitor(client,
+		audit.WithMonitorRootsProvider(rp),
+		audit.WithMonitorAlertHandler(func(ctx context.Context, alert audit.MonitorAlert) {
+			alerts = append(alerts, alert)
+		}),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, monitor.Check(context.Background()))
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, audit.MonitorAlertMissingPublication, alerts[0].Type)
+
+	// A published root with a different hash is a fork.
+	rp.roots[1] = audit.Root{Size: 1, RootHash: hash.Encode([]byte("b")).String()}
+	monitor, _ = audit.NewMonitor(client,
+		audit.WithMonitorRootsProvider(rp),
+		audit.WithMonitorAlertHandler(func(ctx context.Context, alert audit.MonitorAlert) {
+			alerts = append(alerts, alert)
+		}),
+	)
+	assert.NoError(t, monitor.Check(context.Background()))
+	assert.Len(t, alerts, 2)
+	assert.Equal(t, audit.MonitorAlertFork, alerts[1].Type)
+	assert.Nil(t, monitor.State())
+}
+
+func TestMonitor_AlertHandlerCallsMonitor(t *testing.T) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	defer teardown()
+
+	current := audit.Root{Size: 1, RootHash: hash.Encode([]byte("a")).String()}
+	mux.HandleFunc("/v1/root", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, rootResponse(current))
+	})
+
+	var monitor *audit.Monitor
+	var states []*audit.MonitorState
+	client, _ := audit.New(pangeatesting.TestConfig(url))
+	monitor, err := audit.NewMonitor(client,
+		audit.WithMonitorRootsProvider(&staticRootsProvider{roots: map[int]audit.Root{}}),
+		audit.WithMonitorAlertHandler(func(ctx context.Context, alert audit.MonitorAlert) {
+			// The handler runs once the check is over.
+			states = append(states, monitor.State())
+		}),
+	)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	assert.NoError(t, monitor.Check(ctx))
+	current = audit.Root{Size: 1, RootHash: hash.Encode([]byte("b")).String()}
+	assert.NoError(t, monitor.Check(ctx))
+	assert.Len(t, states, 1)
+	assert.Equal(t, 1, states[0].TreeSize)
+}
+
+func TestMonitor_PendingPublication(t *testing.T) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	defer teardown()
+
+	leafA := hash.Encode([]byte("a"))
+	leafB := hash.Encode([]byte("b"))
+	root2 := hash.Pair(leafA).With(leafB)
+	proof := []string{fmt.Sprintf("x:%v,r:%v", leafA, leafB)}
+
+	publishedAt := time.Now().Add(-10 * time.Minute)
+	current := audit.Root{Size: 1, RootHash: leafA.String()}
+	rootCalls := 0
+	mux.HandleFunc("/v1/root", func(w http.ResponseWriter, r *http.Request) {
+		rootCalls++
+		fmt.Fprint(w, rootResponse(current))
+	})
+
+	var alerts []audit.MonitorAlert
+	rp := &staticRootsProvider{roots: map[int]audit.Root{}}
+	store := audit.NewFileMonitorStateStore(filepath.Join(t.TempDir(), "state.json"))
+	client, _ := audit.New(pangeatesting.TestConfig(url))
+	monitor, err := audit.NewMonitor(client,
+		audit.WithMonitorStateStore(store),
+		audit.WithMonitorRootsProvider(rp),
+		audit.WithMonitorAlertHandler(func(ctx context.Context, alert audit.MonitorAlert) {
+			alerts = append(alerts, alert)
+		}),
+	)
+	assert.NoError(t, err)
+	ctx := context.Background()
+	assert.NoError(t, monitor.Check(ctx))
+
+	// A verified root awaiting its publication advances the state, and is
+	// not walked again by the following checks.
+	current = audit.Root{Size: 2, RootHash: root2.String(), ConsistencyProof: &proof, PublishedAt: &publishedAt}
+	assert.NoError(t, monitor.Check(ctx))
+	state, err := store.Load(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, state.TreeSize)
+	assert.Len(t, state.PendingPublications, 1)
+
+	rootCalls = 0
+	assert.NoError(t, monitor.Check(ctx))
+	assert.Equal(t, 1, rootCalls)
+	assert.Len(t, monitor.State().PendingPublications, 1)
+	assert.Empty(t, alerts)
+
+	// Once published, the root is cross-checked.
+	rp.roots[2] = audit.Root{Size: 2, RootHash: leafB.String()}
+	assert.NoError(t, monitor.Check(ctx))
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, audit.MonitorAlertFork, alerts[0].Type)
+	assert.Empty(t, monitor.State().PendingPublications)
+	assert.Equal(t, 2, monitor.State().TreeSize)
+
+	assert.NoError(t, monitor.Check(ctx))
+	assert.Len(t, alerts, 1)
+}
@@ -0,0 +1,286 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type queryOp int
+
+const (
+	qField queryOp = iota
+	qKeyword
+	qAnd
+	qOr
+	qNot
+)
+
+// QueryExpr is an expression of the audit search grammar. Build expressions
+// with Field, Keyword, And, Or and Not.
+type QueryExpr struct {
+	op       queryOp
+	field    string
+	value    string
+	children []QueryExpr
+}
+
+// Field matches events whose field has the given value.
+func Field(name, value string) QueryExpr {
+	return QueryExpr{op: qField, field: name, value: value}
+}
+
+// Keyword matches events containing the given value in any field.
+func Keyword(value string) QueryExpr {
+	return QueryExpr{op: qKeyword, value: value}
+}
+
+// And matches events matching all of the expressions.
+func And(exprs ...QueryExpr) QueryExpr {
+	return QueryExpr{op: qAnd, children: exprs}
+}
+
+// Or matches events matching any of the expressions.
+func Or(exprs ...QueryExpr) QueryExpr {
+	return QueryExpr{op: qOr, children: exprs}
+}
+
+// Not matches events not matching the expression.
+func Not(expr QueryExpr) QueryExpr {
+	return QueryExpr{op: qNot, children: []QueryExpr{expr}}
+}
+
+// String renders the expression without validating its fields.
+func (e QueryExpr) String() string {
+	switch e.op {
+	case qField:
+		return e.field + ":" + quoteQueryValue(e.value)
+	case qKeyword:
+		return quoteQueryValue(e.value)
+	case qNot:
+		return "NOT " + e.children[0].group()
+	case qAnd, qOr:
+		sep := " AND "
+		if e.op == qOr {
+			sep = " OR "
+		}
+		parts := make([]string, 0, len(e.children))
+		for _, c := range e.children {
+			parts = append(parts, c.group())
+		}
+		return strings.Join(parts, sep)
+	}
+	return ""
+}
+
+// group renders the expression, in parentheses if it is compound.
+func (e QueryExpr) group() string {
+	if (e.op == qAnd || e.op == qOr) && len(e.children) > 1 {
+		return "(" + e.String() + ")"
+	}
+	return e.String()
+}
+
+func (e QueryExpr) validate(fields map[string]struct{}) error {
+	switch e.op {
+	case qField:
+		if !queryFieldRe.MatchString(e.field) {
+			return fmt.Errorf("audit: invalid query field name %q", e.field)
+		}
+		if _, ok := fields[e.field]; !ok && fields != nil {
+			return fmt.Errorf("audit: query field %q is not in the schema", e.field)
+		}
+	case qAnd, qOr:
+		if len(e.children) == 0 {
+			return errors.New("audit: empty query expression")
+		}
+	}
+	for _, c := range e.children {
+		if err := c.validate(fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var queryFieldRe = regexp.MustCompile(`^[A-Za-z0-9_.]+$`)
+
+var queryOperators = map[string]struct{}{"AND": {}, "OR": {}, "NOT": {}}
+
+// quoteQueryValue quotes a value if it contains anything that the search
+// grammar would interpret, escaping backslashes and double quotes.
+func quoteQueryValue(v string) string {
+	_, isOperator := queryOperators[strings.ToUpper(v)]
+	if v != "" && !isOperator && !strings.ContainsAny(v, " \t\r\n:\"\\()") {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return `"` + v + `"`
+}
+
+// QueryBuilder builds a SearchInput from query expressions, a time range and
+// search restrictions, validating fields against an audit schema.
+//
+// @example
+//
+//	input, err := audit.NewQueryBuilder(audit.StandardEvent{}).
+//		Where(audit.Field("actor", "root"), audit.Or(
+//			audit.Field("target", "/etc/shadow"),
+//			audit.Field("target", "/etc/passwd"),
+//		)).
+//		Since(24 * time.Hour).
+//		RestrictStatus("failure").
+//		SearchInput()
+type QueryBuilder struct {
+	fields      map[string]struct{}
+	exprs       []QueryExpr
+	start       *time.Time
+	end         *time.Time
+	restriction SearchRestriction
+	err         error
+}
+
+// NewQueryBuilder creates a builder for the given schema, usually
+// StandardEvent{} or the value passed to WithCustomSchema. A nil schema
+// defaults to StandardEvent.
+func NewQueryBuilder(schema any) *QueryBuilder {
+	if schema == nil {
+		schema = StandardEvent{}
+	}
+	return &QueryBuilder{
+		fields: jsonFieldNames(reflect.TypeOf(schema)),
+	}
+}
+
+// Where adds expressions that must all match.
+func (b *QueryBuilder) Where(exprs ...QueryExpr) *QueryBuilder {
+	b.exprs = append(b.exprs, exprs...)
+	return b
+}
+
+// Between restricts the search to events between start and end.
+func (b *QueryBuilder) Between(start, end time.Time) *QueryBuilder {
+	if end.Before(start) {
+		b.err = errors.New("audit: query end is before start")
+	}
+	b.start = &start
+	b.end = &end
+	return b
+}
+
+// After restricts the search to events after t.
+func (b *QueryBuilder) After(t time.Time) *QueryBuilder {
+	b.start = &t
+	return b
+}
+
+// Before restricts the search to events before t.
+func (b *QueryBuilder) Before(t time.Time) *QueryBuilder {
+	b.end = &t
+	return b
+}
+
+// Since restricts the search to events in the last d.
+func (b *QueryBuilder) Since(d time.Duration) *QueryBuilder {
+	return b.After(time.Now().Add(-d))
+}
+
+func (b *QueryBuilder) RestrictActor(values ...string) *QueryBuilder {
+	b.restriction.Actor = append(b.restriction.Actor, values...)
+	return b
+}
+
+func (b *QueryBuilder) RestrictSource(values ...string) *QueryBuilder {
+	b.restriction.Source = append(b.restriction.Source, values...)
+	return b
+}
+
+func (b *QueryBuilder) RestrictTarget(values ...string) *QueryBuilder {
+	b.restriction.Target = append(b.restriction.Target, values...)
+	return b
+}
+
+func (b *QueryBuilder) RestrictAction(values ...string) *QueryBuilder {
+	b.restriction.Action = append(b.restriction.Action, values...)
+	return b
+}
+
+func (b *QueryBuilder) RestrictStatus(values ...string) *QueryBuilder {
+	b.restriction.Status = append(b.restriction.Status, values...)
+	return b
+}
+
+func (b *QueryBuilder) RestrictTenantID(values ...string) *QueryBuilder {
+	b.restriction.TenantID = append(b.restriction.TenantID, values...)
+	return b
+}
+
+// Query validates and renders the query string.
+func (b *QueryBuilder) Query() (string, error) {
+	if b.err != nil {
+		return "", b.err
+	}
+	if len(b.exprs) == 0 {
+		return "", nil
+	}
+
+	expr := b.exprs[0]
+	if len(b.exprs) > 1 {
+		expr = And(b.exprs...)
+	}
+	if err := expr.validate(b.fields); err != nil {
+		return "", err
+	}
+	return expr.String(), nil
+}
+
+// SearchRestriction validates and returns the search restriction, or nil if
+// none was set.
+func (b *QueryBuilder) SearchRestriction() (*SearchRestriction, error) {
+	r := b.restriction
+	restricted := map[string][]string{
+		"actor":     r.Actor,
+		"source":    r.Source,
+		"target":    r.Target,
+		"action":    r.Action,
+		"status":    r.Status,
+		"tenant_id": r.TenantID,
+	}
+	empty := true
+	for name, values := range restricted {
+		if len(values) == 0 {
+			continue
+		}
+		empty = false
+		if _, ok := b.fields[name]; !ok && b.fields != nil {
+			return nil, fmt.Errorf("audit: search restriction field %q is not in the schema", name)
+		}
+	}
+	if empty {
+		return nil, nil
+	}
+	return &r, nil
+}
+
+// SearchInput validates and returns a SearchInput with the query, time range
+// and search restriction set.
+func (b *QueryBuilder) SearchInput() (*SearchInput, error) {
+	query, err := b.Query()
+	if err != nil {
+		return nil, err
+	}
+	restriction, err := b.SearchRestriction()
+	if err != nil {
+		return nil, err
+	}
+	return &SearchInput{
+		Query:             query,
+		Start:             b.start,
+		End:               b.end,
+		SearchRestriction: restriction,
+	}, nil
+}
@@ -0,0 +1,59 @@
+//go:build unit
+
+package audit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeatesting"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryExpr(t *testing.T) {
+	assert.Equal(t, "actor:root", audit.Field("actor", "root").String())
+	assert.Equal(t, `target:"/etc/shadow file"`, audit.Field("target", "/etc/shadow file").String())
+	assert.Equal(t, `message:"say \"hi\" C:\\"`, audit.Field("message", `say "hi" C:\`).String())
+	assert.Equal(t, `"or"`, audit.Keyword("or").String())
+	assert.Equal(t, `status:""`, audit.Field("status", "").String())
+
+	expr := audit.And(
+		audit.Field("actor", "root"),
+		audit.Or(audit.Field("target", "a"), audit.Field("target", "b")),
+		audit.Not(audit.Field("status", "success")),
+	)
+	assert.Equal(t, "actor:root AND (target:a OR target:b) AND NOT status:success", expr.String())
+}
+
+func TestQueryBuilder(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	input, err := audit.NewQueryBuilder(nil).
+		Where(audit.Field("actor", "root"), audit.Not(audit.Field("status", "success"))).
+		Between(start, end).
+		RestrictTarget("/etc/shadow").
+		SearchInput()
+	assert.NoError(t, err)
+	assert.Equal(t, "actor:root AND NOT status:success", input.Query)
+	assert.Equal(t, &start, input.Start)
+	assert.Equal(t, &end, input.End)
+	assert.Equal(t, &audit.SearchRestriction{Target: []string{"/etc/shadow"}}, input.SearchRestriction)
+
+	_, err = audit.NewQueryBuilder(audit.StandardEvent{}).Where(audit.Field("field_int", "1")).Query()
+	assert.Error(t, err)
+
+	query, err := audit.NewQueryBuilder(pangeatesting.CustomSchemaEvent{}).Where(audit.Field("field_int", "1")).Query()
+	assert.NoError(t, err)
+	assert.Equal(t, "field_int:1", query)
+
+	_, err = audit.NewQueryBuilder(pangeatesting.CustomSchemaEvent{}).RestrictActor("root").SearchInput()
+	assert.Error(t, err)
+
+	_, err = audit.NewQueryBuilder(nil).Where(audit.Field("bad field", "1")).Query()
+	assert.Error(t, err)
+
+	_, err = audit.NewQueryBuilder(nil).Between(end, start).Query()
+	assert.Error(t, err)
+}
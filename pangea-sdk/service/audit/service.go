@@ -54,7 +54,9 @@ type audit struct {
 	rp                    RootsProvider
 	lastUnpRootHash       *string
 	tenantID              string
+	tenantConfigIDs       map[string]string
 	schema                any
+	customSchema          bool
 }
 
 func New(cfg *pangea.Config, opts ...Option) (Client, error) {
@@ -114,6 +116,7 @@ func WithTenantID(tenantID string) Option {
 func WithCustomSchema(schema any) Option {
 	return func(a *audit) error {
 		a.schema = schema
+		a.customSchema = true
 		return nil
 	}
 }
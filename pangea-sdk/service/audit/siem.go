@@ -0,0 +1,486 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"strings"
+	"time"
+
+	pu "github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeautil"
+)
+
+type SIEMFormat string
+
+const (
+	SIEMFormatOCSF SIEMFormat = "ocsf" // OCSF API Activity, as JSON lines.
+	SIEMFormatECS  SIEMFormat = "ecs"  // Elastic Common Schema, as JSON lines.
+	SIEMFormatCEF  SIEMFormat = "cef"  // ArcSight Common Event Format lines.
+)
+
+// SIEMFieldMap names the event fields holding each of the values mapped to
+// SIEM formats. Empty names default to the StandardEvent fields.
+type SIEMFieldMap struct {
+	Actor     string
+	Action    string
+	Message   string
+	New       string
+	Old       string
+	Source    string
+	Status    string
+	Target    string
+	Timestamp string
+	TenantID  string
+}
+
+type SIEMOptions struct {
+	// Event fields to map, for custom schemas.
+	Fields SIEMFieldMap
+
+	// Product reported by the converted events. Default to "Pangea", "Secure
+	// Audit Log" and "1.0".
+	Vendor  string
+	Product string
+	Version string
+}
+
+// siemEvent is an audit event reduced to the values mapped to SIEM formats.
+type siemEvent struct {
+	actor, action, message, new, old, source, status, target, tenantID string
+
+	time       time.Time
+	receivedAt time.Time
+	hash       string
+	leafIndex  *int
+	published  *bool
+
+	membership, consistency, signature EventVerification
+}
+
+func (o *SIEMOptions) withDefaults() SIEMOptions {
+	opts := SIEMOptions{}
+	if o != nil {
+		opts = *o
+	}
+	f := &opts.Fields
+	for _, d := range []struct {
+		field *string
+		name  string
+	}{
+		{&f.Actor, "actor"},
+		{&f.Action, "action"},
+		{&f.Message, "message"},
+		{&f.New, "new"},
+		{&f.Old, "old"},
+		{&f.Source, "source"},
+		{&f.Status, "status"},
+		{&f.Target, "target"},
+		{&f.Timestamp, "timestamp"},
+		{&f.TenantID, "tenant_id"},
+	} {
+		if *d.field == "" {
+			*d.field = d.name
+		}
+	}
+	if opts.Vendor == "" {
+		opts.Vendor = "Pangea"
+	}
+	if opts.Product == "" {
+		opts.Product = "Secure Audit Log"
+	}
+	if opts.Version == "" {
+		opts.Version = "1.0"
+	}
+	return opts
+}
+
+func newSIEMEvent(event *SearchEvent, opts *SIEMOptions) (*siemEvent, error) {
+	if event == nil {
+		return nil, errors.New("audit: nil event")
+	}
+
+	var raw any
+	if event.EventEnvelope != nil {
+		raw = event.EventEnvelope.Event
+	} else if event.RawEnvelope != nil {
+		raw = event.RawEnvelope["event"]
+	}
+	fields := map[string]any{}
+	if raw != nil {
+		b, err := json.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &fields); err != nil {
+			return nil, fmt.Errorf("audit: event is not a JSON object: %w", err)
+		}
+	}
+	str := func(name string) string {
+		switch v := fields[name].(type) {
+		case nil:
+			return ""
+		case string:
+			return v
+		default:
+			b, _ := json.Marshal(v)
+			return string(b)
+		}
+	}
+
+	f := opts.Fields
+	e := &siemEvent{
+		actor:       str(f.Actor),
+		action:      str(f.Action),
+		message:     str(f.Message),
+		new:         str(f.New),
+		old:         str(f.Old),
+		source:      str(f.Source),
+		status:      str(f.Status),
+		target:      str(f.Target),
+		tenantID:    str(f.TenantID),
+		time:        parseSIEMTime(str(f.Timestamp)),
+		hash:        event.Hash,
+		leafIndex:   event.LeafIndex,
+		published:   event.Published,
+		membership:  event.MembershipVerification,
+		consistency: event.ConsistencyVerification,
+		signature:   event.SignatureVerification,
+	}
+	if event.EventEnvelope != nil && event.EventEnvelope.ReceivedAt != nil {
+		e.receivedAt = time.Time(*event.EventEnvelope.ReceivedAt)
+	} else if event.RawEnvelope != nil {
+		s, _ := event.RawEnvelope["received_at"].(string)
+		e.receivedAt = parseSIEMTime(s)
+	}
+	if e.time.IsZero() {
+		e.time = e.receivedAt
+	}
+	return e, nil
+}
+
+func parseSIEMTime(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t
+	}
+	var pt pu.PangeaTimestamp
+	if err := pt.UnmarshalJSON([]byte(s)); err == nil {
+		return time.Time(pt)
+	}
+	return time.Time{}
+}
+
+// failed reports whether any of the verifications failed.
+func (e *siemEvent) failed() bool {
+	return e.membership == Failed || e.consistency == Failed || e.signature == Failed
+}
+
+func (e *siemEvent) verification() map[string]any {
+	v := map[string]any{
+		"membership":  e.membership.String(),
+		"consistency": e.consistency.String(),
+		"signature":   e.signature.String(),
+	}
+	if e.published != nil {
+		v["published"] = *e.published
+	}
+	return v
+}
+
+func putNonEmpty(m map[string]any, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
+
+// OCSF activity IDs of the API Activity class.
+var ocsfActivities = map[string]int{
+	"create":  1,
+	"created": 1,
+	"read":    2,
+	"update":  3,
+	"updated": 3,
+	"delete":  4,
+	"deleted": 4,
+}
+
+// ToOCSF converts a search or export result into an OCSF API Activity event.
+// Values without an OCSF attribute, including the verification status, are
+// reported under unmapped.pangea.
+func ToOCSF(event *SearchEvent, opts *SIEMOptions) (map[string]any, error) {
+	o := opts.withDefaults()
+	e, err := newSIEMEvent(event, &o)
+	if err != nil {
+		return nil, err
+	}
+
+	activityID, ok := ocsfActivities[strings.ToLower(e.action)]
+	if !ok {
+		activityID = 99
+	}
+	statusID := 99
+	switch strings.ToLower(e.status) {
+	case "success":
+		statusID = 1
+	case "failure":
+		statusID = 2
+	case "":
+		statusID = 0
+	}
+	severityID := 1
+	if e.failed() {
+		severityID = 4
+	}
+
+	metadata := map[string]any{
+		"version": "1.1.0",
+		"product": map[string]any{
+			"name":        o.Product,
+			"vendor_name": o.Vendor,
+			"version":     o.Version,
+		},
+	}
+	putNonEmpty(metadata, "uid", e.hash)
+	putNonEmpty(metadata, "tenant_uid", e.tenantID)
+
+	out := map[string]any{
+		"class_uid":    6003,
+		"category_uid": 6,
+		"activity_id":  activityID,
+		"type_uid":     6003*100 + activityID,
+		"severity_id":  severityID,
+		"status_id":    statusID,
+		"metadata":     metadata,
+		"actor":        map[string]any{"user": map[string]any{"name": e.actor}},
+		"api":          map[string]any{"operation": e.action},
+	}
+	if !e.time.IsZero() {
+		out["time"] = e.time.UnixMilli()
+	}
+	putNonEmpty(out, "message", e.message)
+	putNonEmpty(out, "status", e.status)
+	if e.target != "" {
+		out["resources"] = []map[string]any{{"name": e.target}}
+	}
+	if e.source != "" {
+		out["src_endpoint"] = map[string]any{"name": e.source}
+	}
+
+	pangea := map[string]any{"verification": e.verification()}
+	putNonEmpty(pangea, "old", e.old)
+	putNonEmpty(pangea, "new", e.new)
+	if e.leafIndex != nil {
+		pangea["leaf_index"] = *e.leafIndex
+	}
+	out["unmapped"] = map[string]any{"pangea": pangea}
+	return out, nil
+}
+
+// ToECS converts a search or export result into an Elastic Common Schema
+// document. Values without an ECS field, including the verification status,
+// are reported under pangea.audit.
+func ToECS(event *SearchEvent, opts *SIEMOptions) (map[string]any, error) {
+	o := opts.withDefaults()
+	e, err := newSIEMEvent(event, &o)
+	if err != nil {
+		return nil, err
+	}
+
+	outcome := "unknown"
+	switch strings.ToLower(e.status) {
+	case "success":
+		outcome = "success"
+	case "failure":
+		outcome = "failure"
+	}
+
+	ecsEvent := map[string]any{
+		"kind":    "event",
+		"dataset": "pangea.audit",
+		"outcome": outcome,
+	}
+	putNonEmpty(ecsEvent, "action", e.action)
+	putNonEmpty(ecsEvent, "id", e.hash)
+	if !e.receivedAt.IsZero() {
+		ecsEvent["ingested"] = e.receivedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	out := map[string]any{
+		"ecs":      map[string]any{"version": "8.11.0"},
+		"event":    ecsEvent,
+		"observer": map[string]any{"vendor": o.Vendor, "product": o.Product, "version": o.Version},
+	}
+	if !e.time.IsZero() {
+		out["@timestamp"] = e.time.UTC().Format(time.RFC3339Nano)
+	}
+	putNonEmpty(out, "message", e.message)
+	if e.actor != "" {
+		out["user"] = map[string]any{"name": e.actor}
+	}
+	if e.source != "" {
+		out["source"] = map[string]any{"address": e.source}
+	}
+
+	audit := map[string]any{"verification": e.verification()}
+	putNonEmpty(audit, "target", e.target)
+	putNonEmpty(audit, "old", e.old)
+	putNonEmpty(audit, "new", e.new)
+	putNonEmpty(audit, "status", e.status)
+	putNonEmpty(audit, "tenant_id", e.tenantID)
+	if e.leafIndex != nil {
+		audit["leaf_index"] = *e.leafIndex
+	}
+	out["pangea"] = map[string]any{"audit": audit}
+	return out, nil
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r\n", `\n`, "\r", `\n`, "\n", `\n`)
+)
+
+// ToCEF converts a search or export result into a Common Event Format line,
+// without a trailing newline. Failed verifications raise the severity to 8.
+func ToCEF(event *SearchEvent, opts *SIEMOptions) (string, error) {
+	o := opts.withDefaults()
+	e, err := newSIEMEvent(event, &o)
+	if err != nil {
+		return "", err
+	}
+
+	signatureID := e.action
+	if signatureID == "" {
+		signatureID = "audit"
+	}
+	name := e.message
+	if name == "" {
+		name = signatureID
+	}
+	if len(name) > 512 {
+		name = name[:512]
+	}
+	severity := 3
+	if e.failed() {
+		severity = 8
+	}
+
+	ext := []string{}
+	add := func(key, value string) {
+		if value != "" {
+			ext = append(ext, key+"="+cefExtensionEscaper.Replace(value))
+		}
+	}
+	if !e.time.IsZero() {
+		add("rt", fmt.Sprint(e.time.UnixMilli()))
+	}
+	add("suser", e.actor)
+	add("act", e.action)
+	add("outcome", e.status)
+	add("msg", e.message)
+	add("externalId", e.hash)
+	for i, cs := range []struct{ label, value string }{
+		{"target", e.target},
+		{"old", e.old},
+		{"new", e.new},
+		{"source", e.source},
+		{"tenantId", e.tenantID},
+		{"verification", fmt.Sprintf("membership:%v consistency:%v signature:%v", e.membership, e.consistency, e.signature)},
+	} {
+		if cs.value != "" {
+			add(fmt.Sprintf("cs%dLabel", i+1), cs.label)
+			add(fmt.Sprintf("cs%d", i+1), cs.value)
+		}
+	}
+
+	header := []string{"CEF:0", o.Vendor, o.Product, o.Version, signatureID, name, fmt.Sprint(severity)}
+	for i := 1; i < len(header)-1; i++ {
+		header[i] = cefHeaderEscaper.Replace(header[i])
+	}
+	return strings.Join(header, "|") + "|" + strings.Join(ext, " "), nil
+}
+
+// SIEMWriter writes search or export results to w in a SIEM format, one event
+// per line.
+//
+// @example
+//
+//	w, err := audit.NewSIEMWriter(os.Stdout, audit.SIEMFormatOCSF, nil)
+//	if err != nil {
+//		return err
+//	}
+//	n, err := w.WriteAll(audit.SearchStream(ctx, auditcli, &audit.SearchInput{
+//		Query: "message:log-123",
+//	}, audit.WithStreamVerification()))
+type SIEMWriter struct {
+	w      io.Writer
+	format SIEMFormat
+	opts   *SIEMOptions
+}
+
+func NewSIEMWriter(w io.Writer, format SIEMFormat, opts *SIEMOptions) (*SIEMWriter, error) {
+	switch format {
+	case SIEMFormatOCSF, SIEMFormatECS, SIEMFormatCEF:
+	default:
+		return nil, fmt.Errorf("audit: unknown SIEM format %q", format)
+	}
+	return &SIEMWriter{w: w, format: format, opts: opts}, nil
+}
+
+// Write converts and writes a single event.
+func (w *SIEMWriter) Write(event *SearchEvent) error {
+	var line []byte
+	switch w.format {
+	case SIEMFormatCEF:
+		s, err := ToCEF(event, w.opts)
+		if err != nil {
+			return err
+		}
+		line = []byte(s)
+	default:
+		convert := ToOCSF
+		if w.format == SIEMFormatECS {
+			convert = ToECS
+		}
+		m, err := convert(event, w.opts)
+		if err != nil {
+			return err
+		}
+		if line, err = json.Marshal(m); err != nil {
+			return err
+		}
+	}
+	_, err := w.w.Write(append(line, '\n'))
+	return err
+}
+
+// WriteEvents writes events, such as those returned by SearchAll, stopping at
+// the first error. It returns the number of events written.
+func (w *SIEMWriter) WriteEvents(events SearchEvents) (int, error) {
+	for i, event := range events {
+		if err := w.Write(event); err != nil {
+			return i, err
+		}
+	}
+	return len(events), nil
+}
+
+// WriteAll writes every event of events, such as those of SearchStream or
+// ExportIter, stopping at the first error. It returns the number of events
+// written.
+func (w *SIEMWriter) WriteAll(events iter.Seq2[*SearchEvent, error]) (int, error) {
+	n := 0
+	for event, err := range events {
+		if err != nil {
+			return n, err
+		}
+		if err := w.Write(event); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,129 @@
+//go:build unit
+
+package audit_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	pu "github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeautil"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+func siemSearchEvent() *audit.SearchEvent {
+	ts := pu.PangeaTimestamp(time.Date(2024, 3, 29, 17, 26, 50, 0, time.UTC))
+	return &audit.SearchEvent{
+		EventEnvelope: &audit.EventEnvelope{
+			Event: &audit.StandardEvent{
+				Actor:     "root",
+				Action:    "deleted",
+				Message:   "a=b|c",
+				Target:    "user-1",
+				Status:    "success",
+				Timestamp: &ts,
+				TenantID:  "t1",
+			},
+		},
+		Hash:                   "somehash",
+		LeafIndex:              pangea.Int(3),
+		MembershipVerification: audit.Success,
+		SignatureVerification:  audit.Failed,
+	}
+}
+
+func TestToOCSF(t *testing.T) {
+	out, err := audit.ToOCSF(siemSearchEvent(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 6003, out["class_uid"])
+	assert.Equal(t, 4, out["activity_id"])
+	assert.Equal(t, 600304, out["type_uid"])
+	assert.Equal(t, 1, out["status_id"])
+	assert.Equal(t, 4, out["severity_id"])
+	assert.Equal(t, int64(1711733210000), out["time"])
+	assert.Equal(t, map[string]any{"user": map[string]any{"name": "root"}}, out["actor"])
+	assert.Equal(t, []map[string]any{{"name": "user-1"}}, out["resources"])
+	assert.Equal(t, "t1", out["metadata"].(map[string]any)["tenant_uid"])
+
+	pangeaData := out["unmapped"].(map[string]any)["pangea"].(map[string]any)
+	assert.Equal(t, 3, pangeaData["leaf_index"])
+	assert.Equal(t, map[string]any{
+		"membership":  "Success",
+		"consistency": "NotVerified",
+		"signature":   "Failed",
+	}, pangeaData["verification"])
+}
+
+func TestToECS(t *testing.T) {
+	out, err := audit.ToECS(siemSearchEvent(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-03-29T17:26:50Z", out["@timestamp"])
+	assert.Equal(t, map[string]any{"name": "root"}, out["user"])
+	assert.Equal(t, "success", out["event"].(map[string]any)["outcome"])
+	assert.Equal(t, "somehash", out["event"].(map[string]any)["id"])
+	assert.Equal(t, "user-1", out["pangea"].(map[string]any)["audit"].(map[string]any)["target"])
+}
+
+func TestToCEF(t *testing.T) {
+	out, err := audit.ToCEF(siemSearchEvent(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `CEF:0|Pangea|Secure Audit Log|1.0|deleted|a=b\|c|8|rt=1711733210000 suser=root act=deleted outcome=success msg=a\=b|c externalId=somehash `+
+		`cs1Label=target cs1=user-1 cs5Label=tenantId cs5=t1 cs6Label=verification cs6=membership:Success consistency:NotVerified signature:Failed`, out)
+}
+
+func TestSIEM_CustomSchema(t *testing.T) {
+	event := &audit.SearchEvent{
+		RawEnvelope: map[string]any{
+			"event":       map[string]any{"who": "alice", "what": "login", "count": 2},
+			"received_at": "2024-03-29T17:26:50.193000Z",
+		},
+	}
+	out, err := audit.ToECS(event, &audit.SIEMOptions{
+		Fields:  audit.SIEMFieldMap{Actor: "who", Action: "what", Message: "count"},
+		Product: "My App",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"name": "alice"}, out["user"])
+	assert.Equal(t, "login", out["event"].(map[string]any)["action"])
+	assert.Equal(t, "2", out["message"])
+	assert.Equal(t, "2024-03-29T17:26:50.193Z", out["@timestamp"])
+	assert.Equal(t, "My App", out["observer"].(map[string]any)["product"])
+}
+
+func TestSIEMWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := audit.NewSIEMWriter(&buf, audit.SIEMFormatOCSF, nil)
+	assert.NoError(t, err)
+
+	n, err := w.WriteEvents(audit.SearchEvents{siemSearchEvent(), siemSearchEvent()})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+	var out map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &out))
+	assert.Equal(t, float64(6003), out["class_uid"])
+
+	buf.Reset()
+	w, _ = audit.NewSIEMWriter(&buf, audit.SIEMFormatCEF, nil)
+	events := func(yield func(*audit.SearchEvent, error) bool) {
+		for e := range slices.Values([]*audit.SearchEvent{siemSearchEvent()}) {
+			if !yield(e, nil) {
+				return
+			}
+		}
+	}
+	n, err = w.WriteAll(events)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.True(t, strings.HasPrefix(buf.String(), "CEF:0|"))
+
+	_, err = audit.NewSIEMWriter(&buf, "xml", nil)
+	assert.Error(t, err)
+}
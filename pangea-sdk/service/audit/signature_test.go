@@ -0,0 +1,85 @@
+//go:build unit
+
+package audit_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+
+	"github.com/cloudflare/circl/sign/eddilithium2"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifySignature_ECDSA(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	pki, _ := json.Marshal(map[string]string{
+		"algorithm": "ES256",
+		"key":       string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	})
+
+	digest := sha256.Sum256([]byte(`{"message":"test"}`))
+	sig, _ := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	envelope := &audit.EventEnvelope{
+		Event:     map[string]any{"message": "test"},
+		Signature: pangea.String(base64.StdEncoding.EncodeToString(sig)),
+		PublicKey: pangea.String(string(pki)),
+	}
+	assert.Equal(t, audit.Success, envelope.VerifySignature())
+
+	envelope.Event = map[string]any{"message": "tampered"}
+	assert.Equal(t, audit.Failed, envelope.VerifySignature())
+}
+
+func TestVerifySignature_Hybrid(t *testing.T) {
+	pub, key, _ := eddilithium2.GenerateKey(rand.Reader)
+	der, _ := asn1.Marshal(struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 44363, 45, 9}},
+		PublicKey: asn1.BitString{Bytes: pub.Bytes(), BitLength: 8 * eddilithium2.PublicKeySize},
+	})
+	pki, _ := json.Marshal(map[string]string{
+		"algorithm": "ED25519-DILITHIUM2-BETA",
+		"key":       string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	})
+
+	sig := make([]byte, eddilithium2.SignatureSize)
+	eddilithium2.SignTo(key, []byte(`{"message":"test"}`), sig)
+	envelope := &audit.EventEnvelope{
+		Event:     map[string]any{"message": "test"},
+		Signature: pangea.String(base64.StdEncoding.EncodeToString(sig)),
+		PublicKey: pangea.String(string(pki)),
+	}
+	assert.Equal(t, audit.Success, envelope.VerifySignature())
+
+	envelope.Event = map[string]any{"message": "tampered"}
+	assert.Equal(t, audit.Failed, envelope.VerifySignature())
+}
+
+func TestVerifySignature_UnknownAlgorithm(t *testing.T) {
+	// The algorithm is set by the envelope, so naming an unknown one must not
+	// turn a signature that cannot be verified into NotVerified.
+	pki, _ := json.Marshal(map[string]string{
+		"algorithm": "UNKNOWN",
+		"key":       "-----BEGIN PUBLIC KEY-----\nMBEwCwYJKwYBBAGCN1wBAwIAAQ==\n-----END PUBLIC KEY-----\n",
+	})
+	envelope := &audit.EventEnvelope{
+		Event:     map[string]any{"message": "test"},
+		Signature: pangea.String(base64.StdEncoding.EncodeToString([]byte("signature"))),
+		PublicKey: pangea.String(string(pki)),
+	}
+	assert.Equal(t, audit.Failed, envelope.VerifySignature())
+}
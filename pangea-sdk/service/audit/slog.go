@@ -0,0 +1,363 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pu "github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeautil"
+)
+
+// ErrSlogQueueFull is reported to SlogHandlerOptions.OnError when a record is
+// dropped because the delivery queue is full.
+var ErrSlogQueueFull = errors.New("audit: slog handler queue is full")
+
+// ErrSlogHandlerClosed is returned by SlogHandler.Close when called twice.
+var ErrSlogHandlerClosed = errors.New("audit: slog handler is closed")
+
+type SlogHandlerOptions struct {
+	// Minimum level of the records to log. Defaults to slog.LevelInfo.
+	Level slog.Leveler
+
+	// Filter reports whether a record should be logged, e.g. only records with
+	// a given attribute. All records above Level are logged if nil.
+	Filter func(ctx context.Context, r slog.Record) bool
+
+	// Maps attribute keys to event fields. Keys of grouped attributes are
+	// joined with ".". Unmapped attributes are dropped. Defaults to mapping
+	// actor, action, target, status, source, old and new onto the
+	// StandardEvent fields of the same name.
+	FieldMap map[string]string
+
+	// Event field that receives the record message. Defaults to "message".
+	MessageField string
+
+	// Event field that receives the record time. Defaults to "timestamp", set
+	// to "-" to leave the time to the server.
+	TimestampField string
+
+	// Maximum number of events per bulk request. Defaults to 100.
+	BatchSize int
+
+	// Maximum time an event waits in a partial batch. Defaults to 1 second.
+	FlushInterval time.Duration
+
+	// Maximum number of events waiting to be delivered. Records are dropped
+	// when the queue is full. Defaults to 1000.
+	QueueSize int
+
+	// Called with delivery errors and dropped records. Optional.
+	OnError func(err error)
+}
+
+// SlogHandler is a slog.Handler that writes records to the Secure Audit Log.
+// Records are delivered in batches by a background goroutine, so logging never
+// blocks on the network. Call Close to flush pending records.
+type SlogHandler struct {
+	sink   *slogSink
+	opts   *SlogHandlerOptions
+	attrs  []slog.Attr
+	groups []string
+}
+
+type slogSink struct {
+	client Client
+	opts   *SlogHandlerOptions
+	// Whether events follow StandardEvent, whose fields are all strings.
+	standard bool
+	events   chan map[string]any
+	stop     chan struct{}
+	done     chan struct{}
+	dropped  atomic.Int64
+
+	// mu orders the sends on events before Close: events is never closed,
+	// and the records queued before stop is closed are all delivered.
+	mu     sync.RWMutex
+	closed bool
+}
+
+var defaultSlogFieldMap = map[string]string{
+	"actor":  "actor",
+	"action": "action",
+	"target": "target",
+	"status": "status",
+	"source": "source",
+	"old":    "old",
+	"new":    "new",
+}
+
+// NewSlogHandler creates a handler writing records through client.
+//
+// @example
+//
+//	handler := audit.NewSlogHandler(auditcli, &audit.SlogHandlerOptions{
+//		Level: slog.LevelWarn,
+//	})
+//	defer handler.Close(ctx)
+//
+//	logger := slog.New(handler)
+//	logger.Warn("user deleted", "actor", "admin", "action", "deleted", "target", "user-123")
+func NewSlogHandler(client Client, opts *SlogHandlerOptions) *SlogHandler {
+	o := SlogHandlerOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Level == nil {
+		o.Level = slog.LevelInfo
+	}
+	if o.FieldMap == nil {
+		o.FieldMap = defaultSlogFieldMap
+	}
+	if o.MessageField == "" {
+		o.MessageField = "message"
+	}
+	if o.TimestampField == "" {
+		o.TimestampField = "timestamp"
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 100
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = time.Second
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = 1000
+	}
+
+	sink := &slogSink{
+		client:   client,
+		opts:     &o,
+		standard: isStandardSchema(clientSchema(client)),
+		events:   make(chan map[string]any, o.QueueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go sink.run()
+
+	return &SlogHandler{sink: sink, opts: &o}
+}
+
+func (h *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.opts.Level.Level()
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if h.opts.Filter != nil && !h.opts.Filter(ctx, r) {
+		return nil
+	}
+	event := map[string]any{
+		h.opts.MessageField: r.Message,
+	}
+	if !r.Time.IsZero() && h.opts.TimestampField != "-" {
+		event[h.opts.TimestampField] = pu.PangeaTimestamp(r.Time)
+	}
+
+	prefix := ""
+	for _, g := range h.groups {
+		prefix += g + "."
+	}
+	for _, a := range h.attrs {
+		h.addAttr(event, "", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		h.addAttr(event, prefix, a)
+		return true
+	})
+
+	if tenantID, ok := TenantIDFromContext(ctx); ok && h.sink.standard {
+		if _, ok := event["tenant_id"]; !ok {
+			event["tenant_id"] = tenantID
+		}
+	}
+
+	h.sink.mu.RLock()
+	defer h.sink.mu.RUnlock()
+	if h.sink.closed {
+		return ErrSlogHandlerClosed
+	}
+	select {
+	case h.sink.events <- event:
+	default:
+		h.sink.dropped.Add(1)
+		h.sink.reportError(ErrSlogQueueFull)
+	}
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	prefix := ""
+	for _, g := range h.groups {
+		prefix += g + "."
+	}
+	// Qualify the attributes now, as groups added later do not apply to them.
+	qualified := make([]slog.Attr, 0, len(h.attrs)+len(attrs))
+	qualified = append(qualified, h.attrs...)
+	for _, a := range attrs {
+		qualified = append(qualified, slog.Attr{Key: prefix + a.Key, Value: a.Value})
+	}
+	return &SlogHandler{sink: h.sink, opts: h.opts, attrs: qualified, groups: h.groups}
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	groups := append(append([]string{}, h.groups...), name)
+	return &SlogHandler{sink: h.sink, opts: h.opts, attrs: h.attrs, groups: groups}
+}
+
+// Dropped returns the number of records dropped because the queue was full.
+func (h *SlogHandler) Dropped() int64 {
+	return h.sink.dropped.Load()
+}
+
+// Close flushes the pending records and stops the delivery goroutine. It is
+// shared by all the handlers derived with WithAttrs and WithGroup.
+func (h *SlogHandler) Close(ctx context.Context) error {
+	h.sink.mu.Lock()
+	if h.sink.closed {
+		h.sink.mu.Unlock()
+		return ErrSlogHandlerClosed
+	}
+	h.sink.closed = true
+	close(h.sink.stop)
+	h.sink.mu.Unlock()
+
+	select {
+	case <-h.sink.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *SlogHandler) addAttr(event map[string]any, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		p := prefix
+		if a.Key != "" {
+			p += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			h.addAttr(event, p, ga)
+		}
+		return
+	}
+
+	field, ok := h.opts.FieldMap[prefix+a.Key]
+	if !ok {
+		return
+	}
+	v := slogValue(a.Value)
+	if _, isString := v.(string); h.sink.standard && !isString {
+		v = slogString(v)
+	}
+	event[field] = v
+}
+
+// slogValue converts a value to one that marshals to sensible JSON.
+func slogValue(v slog.Value) any {
+	switch v.Kind() {
+	case slog.KindString:
+		return v.String()
+	case slog.KindInt64:
+		return v.Int64()
+	case slog.KindUint64:
+		return v.Uint64()
+	case slog.KindFloat64:
+		return v.Float64()
+	case slog.KindBool:
+		return v.Bool()
+	case slog.KindTime:
+		return pu.PangeaTimestamp(v.Time())
+	case slog.KindDuration:
+		return v.Duration().String()
+	}
+	if err, ok := v.Any().(error); ok {
+		return err.Error()
+	}
+	if s, ok := v.Any().(fmt.Stringer); ok {
+		return s.String()
+	}
+	return v.Any()
+}
+
+func (s *slogSink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]any, 0, s.opts.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		_, err := s.client.LogBulkAsync(context.Background(), batch, false)
+		if err != nil {
+			s.reportError(err)
+		}
+		batch = make([]any, 0, s.opts.BatchSize)
+	}
+	add := func(event map[string]any) {
+		batch = append(batch, event)
+		if len(batch) >= s.opts.BatchSize {
+			flush()
+		}
+	}
+
+	for {
+		select {
+		case event := <-s.events:
+			add(event)
+		case <-ticker.C:
+			flush()
+		case <-s.stop:
+			// No record is queued after stop is closed.
+			for {
+				select {
+				case event := <-s.events:
+					add(event)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// slogString renders a value as a string field, using its JSON encoding.
+func slogString(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		return s
+	}
+	return string(b)
+}
+
+func isStandardSchema(schema any) bool {
+	switch schema.(type) {
+	case StandardEvent, *StandardEvent:
+		return true
+	}
+	return false
+}
+
+func (s *slogSink) reportError(err error) {
+	if s.opts.OnError != nil {
+		s.opts.OnError(err)
+	}
+}
@@ -0,0 +1,128 @@
+//go:build unit
+
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeatesting"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogHandler(t *testing.T) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	defer teardown()
+
+	var mu sync.Mutex
+	batches := [][]map[string]any{}
+	mux.HandleFunc("/v2/log_async", func(w http.ResponseWriter, r *http.Request) {
+		pangeatesting.TestMethod(t, r, "POST")
+		body, _ := io.ReadAll(r.Body)
+		var input struct {
+			Events []struct {
+				Event map[string]any `json:"event"`
+			} `json:"events"`
+		}
+		assert.NoError(t, json.Unmarshal(body, &input))
+
+		batch := []map[string]any{}
+		for _, e := range input.Events {
+			batch = append(batch, e.Event)
+		}
+		mu.Lock()
+		batches = append(batches, batch)
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, acceptedResponse)
+	})
+
+	client, _ := audit.New(pangeatesting.TestConfig(url), audit.DisableEventVerification())
+	handler := audit.NewSlogHandler(client, &audit.SlogHandlerOptions{
+		Level:          slog.LevelWarn,
+		TimestampField: "-",
+		BatchSize:      2,
+		FlushInterval:  time.Hour,
+		Filter: func(ctx context.Context, r slog.Record) bool {
+			return r.Message != "ignored"
+		},
+	})
+
+	logger := slog.New(handler).With("actor", "admin")
+	logger.Info("too low", "action", "read")
+	logger.Warn("ignored", "action", "read")
+	logger.Warn("deleted", "action", "delete", "target", "user-1", "status", 404, "extra", "dropped")
+	logger.WithGroup("req").Error("grouped", "action", "update")
+	logger.Error("last", slog.Group("", slog.String("new", "v2")))
+
+	assert.NoError(t, handler.Close(context.Background()))
+	assert.ErrorIs(t, handler.Close(context.Background()), audit.ErrSlogHandlerClosed)
+
+	assert.Equal(t, [][]map[string]any{
+		{
+			{"message": "deleted", "actor": "admin", "action": "delete", "target": "user-1", "status": "404"},
+			{"message": "grouped", "actor": "admin"},
+		},
+		{
+			{"message": "last", "actor": "admin", "new": "v2"},
+		},
+	}, batches)
+	assert.Equal(t, int64(0), handler.Dropped())
+}
+
+func TestSlogHandler_ConcurrentClose(t *testing.T) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	defer teardown()
+
+	var mu sync.Mutex
+	delivered := 0
+	mux.HandleFunc("/v2/log_async", func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			Events []any `json:"events"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+		mu.Lock()
+		delivered += len(input.Events)
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, acceptedResponse)
+	})
+
+	client, _ := audit.New(pangeatesting.TestConfig(url), audit.DisableEventVerification())
+	handler := audit.NewSlogHandler(client, &audit.SlogHandlerOptions{QueueSize: 10000})
+
+	// Records logged while the handler closes are either delivered or
+	// rejected, without panicking.
+	var wg sync.WaitGroup
+	var accepted sync.Map
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				r := slog.NewRecord(time.Now(), slog.LevelInfo, "event", 0)
+				if handler.Handle(context.Background(), r) == nil {
+					accepted.Store(i*100+j, true)
+				}
+			}
+		}()
+	}
+	assert.NoError(t, handler.Close(context.Background()))
+	wg.Wait()
+
+	n := 0
+	accepted.Range(func(_, _ any) bool {
+		n++
+		return true
+	})
+	assert.Equal(t, n, delivered)
+}
@@ -0,0 +1,182 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"maps"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+)
+
+const defaultStreamPageSize = 1000
+
+type searchStream struct {
+	pageSize int
+	verify   bool
+	rp       RootsProvider
+}
+
+type SearchStreamOption func(*searchStream) error
+
+// WithStreamPageSize sets the number of events fetched per page. Defaults to
+// 1000.
+func WithStreamPageSize(n int) SearchStreamOption {
+	return func(s *searchStream) error {
+		if n <= 0 {
+			return errors.New("audit: page size must be positive")
+		}
+		s.pageSize = n
+		return nil
+	}
+}
+
+// WithStreamVerification enables hash, signature, membership and consistency
+// verification of every event, regardless of the client's own options. What
+// the client already verifies is not verified again.
+func WithStreamVerification() SearchStreamOption {
+	return func(s *searchStream) error {
+		s.verify = true
+		return nil
+	}
+}
+
+// WithStreamRootsProvider sets the provider of published roots used for
+// consistency verification. Defaults to an ArweaveRootsProvider. The roots of
+// an ArweaveRootsProvider are copied, and the provider left untouched.
+func WithStreamRootsProvider(rp RootsProvider) SearchStreamOption {
+	return func(s *searchStream) error {
+		s.rp = rp
+		return nil
+	}
+}
+
+// SearchStream lazily pages through all the results of a search. Unlike
+// SearchAll it never holds more than one page in memory, so it is suitable for
+// searches over millions of events. The verification status of each event is
+// set on the yielded SearchEvent. Iteration stops on the first error, when ctx
+// is cancelled or when the caller breaks out of the loop.
+//
+// @example
+//
+//	input := &audit.SearchInput{
+//		Query: "message:log-123",
+//	}
+//
+//	for event, err := range audit.SearchStream(ctx, auditcli, input, audit.WithStreamVerification()) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(event.Hash, event.MembershipVerification)
+//	}
+func SearchStream(ctx context.Context, client Client, input *SearchInput, opts ...SearchStreamOption) iter.Seq2[*SearchEvent, error] {
+	return func(yield func(*SearchEvent, error) bool) {
+		if input == nil {
+			yield(nil, errors.New("nil input"))
+			return
+		}
+
+		s := &searchStream{pageSize: defaultStreamPageSize}
+		for _, opt := range opts {
+			if err := opt(s); err != nil {
+				yield(nil, err)
+				return
+			}
+		}
+
+		// Do not modify the caller's input.
+		in := *input
+		if in.Limit == 0 {
+			in.Limit = s.pageSize
+		}
+		if s.verify {
+			in.Verbose = pangea.Bool(true)
+		}
+
+		resp, err := client.Search(ctx, &in)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		total := resp.Result.Count
+		if in.MaxResults > 0 && in.MaxResults < total {
+			total = in.MaxResults
+		}
+		events := resp.Result.Events
+		root, unpRoot := resp.Result.Root, resp.Result.UnpublishedRoot
+		offset := 0
+
+		for {
+			if s.verify {
+				if err := s.verifyPage(ctx, client, events, root, unpRoot); err != nil {
+					yield(nil, err)
+					return
+				}
+			}
+			for _, event := range events {
+				if !yield(event, nil) {
+					return
+				}
+			}
+
+			offset += len(events)
+			if len(events) == 0 || offset >= total {
+				return
+			}
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+
+			o := offset
+			page, err := client.SearchResults(ctx, &SearchResultsInput{
+				BaseRequest:             in.BaseRequest,
+				ID:                      resp.Result.ID,
+				Limit:                   s.pageSize,
+				Offset:                  &o,
+				AssertSearchRestriction: in.SearchRestriction,
+				ReturnContext:           in.ReturnContext,
+			})
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			events = page.Result.Events
+			if page.Result.Root != nil {
+				root = page.Result.Root
+			}
+			if page.Result.UnpublishedRoot != nil {
+				unpRoot = page.Result.UnpublishedRoot
+			}
+		}
+	}
+}
+
+// verifyPage verifies a page of events like Search does, fetching the
+// published roots for all of its tree sizes at once.
+func (s *searchStream) verifyPage(ctx context.Context, client Client, events SearchEvents, root, unpRoot *Root) error {
+	// Skip what the client verified itself.
+	verifyEvents, verifyProofs := true, true
+	if a, ok := client.(*audit); ok {
+		verifyEvents, verifyProofs = a.skipEventVerification, !a.verifyProofs
+	}
+	if !verifyEvents && !verifyProofs {
+		return nil
+	}
+
+	rp := s.rp
+	if root != nil {
+		switch p := s.rp.(type) {
+		case nil:
+			// Only keep the roots of the current page in memory.
+			rp = NewArweaveRootsProvider(root.TreeName)
+		case *ArweaveRootsProvider:
+			// Do not modify the caller's roots.
+			copied := &ArweaveRootsProvider{TreeName: p.TreeName, Client: p.Client, Roots: make(map[int]Root)}
+			maps.Copy(copied.Roots, p.Roots)
+			rp = copied
+		}
+	}
+	return verifySearchEvents(ctx, client, rp, events, root, unpRoot, verifyEvents, verifyProofs)
+}
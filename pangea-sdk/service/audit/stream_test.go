@@ -0,0 +1,143 @@
+//go:build unit
+
+package audit_test
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"testing"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeatesting"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+const streamPage = `{
+	"request_id": "some-id",
+	"request_time": "1970-01-01T00:00:00Z",
+	"response_time": "1970-01-01T00:00:10Z",
+	"status": "Success",
+	"result": {
+		"count": 3,
+		"events": [%s],
+		"id": "some-id"
+	},
+	"summary": "Found 3 event(s)"
+}`
+
+const streamEvent = `{"envelope": {"event": {"message": %q}}}`
+
+func TestSearchStream(t *testing.T) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	defer teardown()
+
+	mux.HandleFunc("/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		pangeatesting.TestBody(t, r, `{"query":"message:test","limit":2}`)
+		fmt.Fprintf(w, streamPage, fmt.Sprintf(streamEvent, "1")+","+fmt.Sprintf(streamEvent, "2"))
+	})
+	mux.HandleFunc("/v1/results", func(w http.ResponseWriter, r *http.Request) {
+		pangeatesting.TestBody(t, r, `{"id":"some-id","limit":2,"offset":2}`)
+		fmt.Fprintf(w, streamPage, fmt.Sprintf(streamEvent, "3"))
+	})
+
+	client, _ := audit.New(pangeatesting.TestConfig(url))
+	input := &audit.SearchInput{Query: "message:test"}
+
+	messages := []string{}
+	for event, err := range audit.SearchStream(context.Background(), client, input, audit.WithStreamPageSize(2)) {
+		assert.NoError(t, err)
+		messages = append(messages, event.EventEnvelope.Event.(*audit.StandardEvent).Message)
+	}
+	assert.Equal(t, []string{"1", "2", "3"}, messages)
+	assert.Equal(t, 0, input.Limit)
+
+	// Breaking out of the loop stops paging.
+	count := 0
+	for range audit.SearchStream(context.Background(), client, input, audit.WithStreamPageSize(2)) {
+		count++
+		break
+	}
+	assert.Equal(t, 1, count)
+}
+
+func TestSearchStream_Cancelled(t *testing.T) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	defer teardown()
+
+	mux.HandleFunc("/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, streamPage, fmt.Sprintf(streamEvent, "1"))
+	})
+
+	client, _ := audit.New(pangeatesting.TestConfig(url))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var lastErr error
+	for _, err := range audit.SearchStream(ctx, client, &audit.SearchInput{Query: "message:test"}) {
+		cancel()
+		lastErr = err
+	}
+	assert.ErrorIs(t, lastErr, context.Canceled)
+}
+
+func TestSearchStream_Verification(t *testing.T) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	defer teardown()
+
+	mux.HandleFunc("/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{
+			"request_id": "some-id",
+			"request_time": "1970-01-01T00:00:00Z",
+			"response_time": "1970-01-01T00:00:10Z",
+			"status": "Success",
+			"result": {
+				"count": 1,
+				"events": [{"envelope": {"event": {"message": "1"}}, "leaf_index": 1, "published": true}],
+				"id": "some-id",
+				"root": {"tree_name": "some-tree", "size": 3, "root_hash": "00"}
+			},
+			"summary": "Found 1 event(s)"
+		}`)
+	})
+	rootRequests := 0
+	mux.HandleFunc("/v1/root", func(w http.ResponseWriter, r *http.Request) {
+		rootRequests++
+		pangeatesting.TestBody(t, r, `{"tree_size":2}`)
+		fmt.Fprint(w, `{
+			"request_id": "some-id",
+			"request_time": "1970-01-01T00:00:00Z",
+			"response_time": "1970-01-01T00:00:10Z",
+			"status": "Success",
+			"result": {"data": {"size": 2, "root_hash": "00", "consistency_proof": ["x:00"]}},
+			"summary": "success"
+		}`)
+	})
+
+	invalidProof := []string{"x:invalid"}
+	roots := map[int]audit.Root{
+		1: {Size: 1, RootHash: "00"},
+		2: {Size: 2, RootHash: "00", ConsistencyProof: &invalidProof},
+		3: {Size: 3, RootHash: "00"},
+	}
+	rp := &audit.ArweaveRootsProvider{TreeName: "some-tree", Roots: maps.Clone(roots)}
+
+	// A failed consistency proof is verified again with the proof from
+	// Pangea, and the caller's roots are left untouched.
+	client, _ := audit.New(pangeatesting.TestConfig(url), audit.DisableEventVerification())
+	for event, err := range audit.SearchStream(context.Background(), client, &audit.SearchInput{Query: "message:test"}, audit.WithStreamVerification(), audit.WithStreamRootsProvider(rp)) {
+		assert.NoError(t, err)
+		assert.Equal(t, audit.Failed, event.ConsistencyVerification)
+	}
+	assert.Equal(t, 1, rootRequests)
+	assert.Equal(t, roots, rp.Roots)
+
+	// What the client verified is not verified again.
+	rootRequests = 0
+	client, _ = audit.New(pangeatesting.TestConfig(url), audit.WithLogProofVerificationEnabled())
+	for _, err := range audit.SearchStream(context.Background(), client, &audit.SearchInput{Query: "message:test"}, audit.WithStreamVerification(), audit.WithStreamRootsProvider(rp)) {
+		assert.NoError(t, err)
+	}
+	assert.Zero(t, rootRequests)
+}
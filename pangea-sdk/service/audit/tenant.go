@@ -0,0 +1,324 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+)
+
+var ErrMissingTenantID = errors.New("audit: missing tenant ID in context")
+
+type tenantIDKey struct{}
+
+// ContextWithTenantID returns a copy of ctx carrying tenantID. Events logged
+// with the returned context are tagged with tenantID, taking precedence over
+// WithTenantID but not over a tenant already set on the event.
+func ContextWithTenantID(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantIDKey{}, tenantID)
+}
+
+// TenantIDFromContext returns the tenant ID carried by ctx, if any.
+func TenantIDFromContext(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(tenantIDKey{}).(string)
+	return tenantID, ok && tenantID != ""
+}
+
+// WithTenantConfigIDs maps tenant IDs to audit config IDs, so that each
+// tenant's events are logged to, and searched in, its own configuration.
+// Requests with an explicit config ID are left untouched.
+func WithTenantConfigIDs(configIDs map[string]string) Option {
+	return func(a *audit) error {
+		a.tenantConfigIDs = configIDs
+		return nil
+	}
+}
+
+// tenantFromContext returns the tenant of ctx, or the client's default tenant.
+func (a *audit) tenantFromContext(ctx context.Context) string {
+	if tenantID, ok := TenantIDFromContext(ctx); ok {
+		return tenantID
+	}
+	return a.tenantID
+}
+
+// eventTenant returns the tenant an event will be logged for.
+func (a *audit) eventTenant(ctx context.Context, event any) string {
+	if st, ok := event.(Tenanter); ok && st.Tenant() != "" {
+		return st.Tenant()
+	}
+	return a.tenantFromContext(ctx)
+}
+
+func (a *audit) tenantConfigID(tenantID string) string {
+	if tenantID == "" {
+		return ""
+	}
+	return a.tenantConfigIDs[tenantID]
+}
+
+// tenantScopedClient does not embed its client, so that every method of
+// Client is scoped explicitly.
+type tenantScopedClient struct {
+	client Client
+
+	mu sync.Mutex
+	// The tenants of the requests accepted for asynchronous processing, by
+	// request ID, and of the download URLs.
+	grants map[string]string
+}
+
+// NewTenantScopedClient wraps client so that every call is scoped to the
+// tenant carried by its context (see ContextWithTenantID). Searches are
+// restricted to the tenant's events, search results can only be downloaded
+// for searches restricted to the tenant, and only the tenant's asynchronous
+// requests can be polled. Calls without a tenant in their context fail with
+// ErrMissingTenantID. Exports and log streams, which cannot be restricted to a
+// tenant, are not supported. Roots, which carry no events, are not scoped.
+//
+// @example
+//
+//	tenantcli := audit.NewTenantScopedClient(auditcli)
+//
+//	ctx = audit.ContextWithTenantID(ctx, "tenant-123")
+//	searchResponse, err := tenantcli.Search(ctx, &audit.SearchInput{
+//		Query: "message:log-123",
+//	})
+func NewTenantScopedClient(client Client) Client {
+	return &tenantScopedClient{client: client, grants: map[string]string{}}
+}
+
+// grant records that key, a request ID or a URL, belongs to tenantID.
+func (c *tenantScopedClient) grant(tenantID string, key *string) {
+	if key == nil || *key == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.grants[*key] = tenantID
+}
+
+// grantAccepted records the request accepted for asynchronous processing by
+// a call failing with err, if any.
+func (c *tenantScopedClient) grantAccepted(tenantID string, err error) {
+	var ae *pangea.AcceptedError
+	if errors.As(err, &ae) {
+		c.grant(tenantID, ae.RequestID)
+	}
+}
+
+// checkGrant checks that ctx carries the tenant key was granted to.
+func (c *tenantScopedClient) checkGrant(ctx context.Context, key string) error {
+	tenantID, ok := TenantIDFromContext(ctx)
+	if !ok {
+		return ErrMissingTenantID
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if granted, ok := c.grants[key]; !ok || granted != tenantID {
+		return fmt.Errorf("audit: %s does not belong to tenant %q", key, tenantID)
+	}
+	return nil
+}
+
+func (c *tenantScopedClient) Log(ctx context.Context, event any, verbose bool) (*pangea.PangeaResponse[LogResult], error) {
+	tenantID, err := checkEventTenants(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Log(ctx, event, verbose)
+	c.grantAccepted(tenantID, err)
+	return resp, err
+}
+
+func (c *tenantScopedClient) LogRequest(ctx context.Context, input LogRequest) (*pangea.PangeaResponse[LogResult], error) {
+	tenantID, err := checkEventTenants(ctx, input.Event)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.LogRequest(ctx, input)
+	c.grantAccepted(tenantID, err)
+	return resp, err
+}
+
+func (c *tenantScopedClient) LogBulk(ctx context.Context, events []any, verbose bool) (*pangea.PangeaResponse[LogBulkResult], error) {
+	tenantID, err := checkEventTenants(ctx, events...)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.LogBulk(ctx, events, verbose)
+	c.grantAccepted(tenantID, err)
+	return resp, err
+}
+
+func (c *tenantScopedClient) LogBulkAsync(ctx context.Context, events []any, verbose bool) (*pangea.PangeaResponse[LogBulkResult], error) {
+	tenantID, err := checkEventTenants(ctx, events...)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.LogBulkAsync(ctx, events, verbose)
+	if resp != nil && resp.AcceptedResult != nil {
+		c.grant(tenantID, resp.RequestID)
+	}
+	return resp, err
+}
+
+// checkEventTenants checks that ctx carries a tenant, and that none of the
+// events is set to another tenant. It returns the tenant.
+func checkEventTenants(ctx context.Context, events ...any) (string, error) {
+	tenantID, ok := TenantIDFromContext(ctx)
+	if !ok {
+		return "", ErrMissingTenantID
+	}
+	for _, event := range events {
+		if st, ok := event.(Tenanter); ok && st.Tenant() != "" && st.Tenant() != tenantID {
+			return "", fmt.Errorf("audit: event tenant %q does not match %q", st.Tenant(), tenantID)
+		}
+	}
+	return tenantID, nil
+}
+
+func (c *tenantScopedClient) Search(ctx context.Context, input *SearchInput) (*pangea.PangeaResponse[SearchOutput], error) {
+	if input == nil {
+		return nil, errors.New("nil input")
+	}
+	restriction, err := tenantRestriction(ctx, input.SearchRestriction)
+	if err != nil {
+		return nil, err
+	}
+	in := *input
+	in.SearchRestriction = restriction
+	resp, err := c.client.Search(ctx, &in)
+	c.grantAccepted(restriction.TenantID[0], err)
+	return resp, err
+}
+
+func (c *tenantScopedClient) SearchResults(ctx context.Context, input *SearchResultsInput) (*pangea.PangeaResponse[SearchResultsOutput], error) {
+	if input == nil {
+		return nil, errors.New("nil input")
+	}
+	restriction, err := tenantRestriction(ctx, input.AssertSearchRestriction)
+	if err != nil {
+		return nil, err
+	}
+	in := *input
+	in.AssertSearchRestriction = restriction
+	resp, err := c.client.SearchResults(ctx, &in)
+	c.grantAccepted(restriction.TenantID[0], err)
+	return resp, err
+}
+
+// Root is not scoped: roots carry no events.
+func (c *tenantScopedClient) Root(ctx context.Context, input *RootInput) (*pangea.PangeaResponse[RootOutput], error) {
+	return c.client.Root(ctx, input)
+}
+
+// DownloadResults first has Pangea check that the search was restricted to
+// the tenant, by asserting the restriction on the first of its results.
+func (c *tenantScopedClient) DownloadResults(ctx context.Context, input *DownloadRequest) (*pangea.PangeaResponse[DownloadResult], error) {
+	if input == nil {
+		return nil, errors.New("nil input")
+	}
+	if input.ResultID == "" {
+		// Exports cannot be restricted to a tenant.
+		return nil, errors.New("audit: only search results can be downloaded by a tenant scoped client")
+	}
+	if _, err := c.SearchResults(ctx, &SearchResultsInput{ID: input.ResultID, Limit: 1}); err != nil {
+		return nil, err
+	}
+	resp, err := c.client.DownloadResults(ctx, input)
+	if resp != nil && resp.Result != nil {
+		tenantID, _ := TenantIDFromContext(ctx)
+		c.grant(tenantID, &resp.Result.DestURL)
+	}
+	return resp, err
+}
+
+func (c *tenantScopedClient) LogStream(ctx context.Context, input pangea.ConfigIDer) (*pangea.PangeaResponse[struct{}], error) {
+	// The events of log streams cannot be checked against a tenant.
+	return nil, errors.New("audit: log stream is not supported by a tenant scoped client")
+}
+
+func (c *tenantScopedClient) Export(ctx context.Context, input *ExportRequest) (*pangea.PangeaResponse[struct{}], error) {
+	// Exports cannot be restricted to a tenant.
+	return nil, errors.New("audit: export is not supported by a tenant scoped client")
+}
+
+// GetPendingRequestID returns the IDs of the requests accepted for
+// asynchronous processing through c, of any tenant.
+func (c *tenantScopedClient) GetPendingRequestID() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ids := []string{}
+	for _, id := range c.client.GetPendingRequestID() {
+		if _, ok := c.grants[id]; ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (c *tenantScopedClient) PollResultByError(ctx context.Context, e pangea.AcceptedError) (*pangea.PangeaResponse[any], error) {
+	if e.RequestID == nil {
+		return nil, errors.New("request ID is empty")
+	}
+	return c.PollResultByID(ctx, *e.RequestID, e.ResultField)
+}
+
+func (c *tenantScopedClient) PollResultByID(ctx context.Context, rid string, v any) (*pangea.PangeaResponse[any], error) {
+	if err := c.checkGrant(ctx, rid); err != nil {
+		return nil, err
+	}
+	resp, err := c.client.PollResultByID(ctx, rid, v)
+	c.polled(rid, err)
+	return resp, err
+}
+
+func (c *tenantScopedClient) PollResultRaw(ctx context.Context, requestID string) (*pangea.PangeaResponse[map[string]any], error) {
+	if err := c.checkGrant(ctx, requestID); err != nil {
+		return nil, err
+	}
+	resp, err := c.client.PollResultRaw(ctx, requestID)
+	c.polled(requestID, err)
+	return resp, err
+}
+
+// polled forgets a request once its result is returned.
+func (c *tenantScopedClient) polled(requestID string, err error) {
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.grants, requestID)
+}
+
+// DownloadFile only downloads the URLs returned by DownloadResults for the
+// tenant.
+func (c *tenantScopedClient) DownloadFile(ctx context.Context, url string) (*pangea.AttachedFile, error) {
+	if err := c.checkGrant(ctx, url); err != nil {
+		return nil, err
+	}
+	return c.client.DownloadFile(ctx, url)
+}
+
+// tenantRestriction returns a copy of r restricted to the tenant of ctx.
+func tenantRestriction(ctx context.Context, r *SearchRestriction) (*SearchRestriction, error) {
+	tenantID, ok := TenantIDFromContext(ctx)
+	if !ok {
+		return nil, ErrMissingTenantID
+	}
+
+	restriction := SearchRestriction{}
+	if r != nil {
+		restriction = *r
+	}
+	if len(restriction.TenantID) > 0 && !slices.Equal(restriction.TenantID, []string{tenantID}) {
+		return nil, fmt.Errorf("audit: search restriction does not match tenant %q", tenantID)
+	}
+	restriction.TenantID = []string{tenantID}
+	return &restriction, nil
+}
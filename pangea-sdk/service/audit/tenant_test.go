@@ -0,0 +1,212 @@
+//go:build unit
+
+package audit_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeatesting"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+const tenantLogResponse = `{
+	"request_id": "some-id",
+	"request_time": "1970-01-01T00:00:00Z",
+	"response_time": "1970-01-01T00:00:10Z",
+	"status": "Success",
+	"result": {
+		"envelope": {"event": {"message": "test"}},
+		"hash": "somehash"
+	},
+	"summary": "Logged 1 record(s)"
+}`
+
+const tenantSearchResponse = `{
+	"request_id": "some-id",
+	"request_time": "1970-01-01T00:00:00Z",
+	"response_time": "1970-01-01T00:00:10Z",
+	"status": "Success",
+	"result": {"count": 0, "events": [], "id": "some-id"},
+	"summary": "Found 0 event(s)"
+}`
+
+func TestLog_TenantFromContext(t *testing.T) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	defer teardown()
+
+	var body string
+	mux.HandleFunc("/v1/log", func(w http.ResponseWriter, r *http.Request) {
+		pangeatesting.TestBody(t, r, body)
+		fmt.Fprint(w, tenantLogResponse)
+	})
+
+	client, _ := audit.New(pangeatesting.TestConfig(url),
+		audit.DisableEventVerification(),
+		audit.WithTenantID("default"),
+		audit.WithTenantConfigIDs(map[string]string{"t1": "pci_1"}),
+	)
+
+	body = `{"config_id":"pci_1","event":{"message":"test","tenant_id":"t1"},"verbose":false}`
+	ctx := audit.ContextWithTenantID(context.Background(), "t1")
+	_, err := client.Log(ctx, &audit.StandardEvent{Message: "test"}, false)
+	assert.NoError(t, err)
+
+	// The event's own tenant wins over the context's.
+	body = `{"event":{"message":"test","tenant_id":"t2"},"verbose":false}`
+	_, err = client.Log(ctx, &audit.StandardEvent{Message: "test", TenantID: "t2"}, false)
+	assert.NoError(t, err)
+
+	body = `{"event":{"message":"test","tenant_id":"default"},"verbose":false}`
+	_, err = client.Log(context.Background(), &audit.StandardEvent{Message: "test"}, false)
+	assert.NoError(t, err)
+
+	_, err = client.LogBulk(ctx, []any{
+		&audit.StandardEvent{Message: "test"},
+		&audit.StandardEvent{Message: "test", TenantID: "t2"},
+	}, false)
+	assert.Error(t, err)
+}
+
+func TestTenantScopedClient(t *testing.T) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	defer teardown()
+
+	mux.HandleFunc("/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		pangeatesting.TestBody(t, r, `{"query":"message:test","search_restriction":{"actor":["root"],"tenant_id":["t1"]}}`)
+		fmt.Fprint(w, tenantSearchResponse)
+	})
+
+	client, _ := audit.New(pangeatesting.TestConfig(url))
+	scoped := audit.NewTenantScopedClient(client)
+	input := &audit.SearchInput{
+		Query:             "message:test",
+		SearchRestriction: &audit.SearchRestriction{Actor: []string{"root"}},
+	}
+
+	_, err := scoped.Search(context.Background(), input)
+	assert.ErrorIs(t, err, audit.ErrMissingTenantID)
+
+	ctx := audit.ContextWithTenantID(context.Background(), "t1")
+	_, err = scoped.Search(ctx, input)
+	assert.NoError(t, err)
+	assert.Nil(t, input.SearchRestriction.TenantID)
+
+	input.SearchRestriction.TenantID = []string{"t2"}
+	_, err = scoped.Search(ctx, input)
+	assert.Error(t, err)
+
+	_, err = scoped.Log(context.Background(), &audit.StandardEvent{Message: "test"}, false)
+	assert.ErrorIs(t, err, audit.ErrMissingTenantID)
+
+	// Events of other tenants are rejected before being sent.
+	other := &audit.StandardEvent{Message: "test", TenantID: "t2"}
+	_, err = scoped.Log(ctx, other, false)
+	assert.ErrorContains(t, err, `event tenant "t2" does not match "t1"`)
+	events := []any{&audit.StandardEvent{Message: "test", TenantID: "t1"}, other}
+	_, err = scoped.LogBulk(ctx, events, false)
+	assert.ErrorContains(t, err, `event tenant "t2" does not match "t1"`)
+	_, err = scoped.LogBulkAsync(ctx, events, false)
+	assert.ErrorContains(t, err, `event tenant "t2" does not match "t1"`)
+
+	_, err = scoped.Export(ctx, &audit.ExportRequest{})
+	assert.Error(t, err)
+}
+
+func TestTenantScopedClient_AllMethods(t *testing.T) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	defer teardown()
+
+	requests := 0
+	for _, path := range []string{"/v1/", "/v2/", "/request/"} {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(http.StatusBadRequest)
+		})
+	}
+	client, _ := audit.New(pangeatesting.TestConfig(url))
+	scoped := audit.NewTenantScopedClient(client)
+
+	// Methods that carry no tenant data.
+	unscoped := map[string]bool{"GetPendingRequestID": true, "Root": true}
+
+	// Every other method of the interface fails without a tenant, before
+	// sending any request.
+	v := reflect.ValueOf(scoped)
+	clientType := reflect.TypeFor[audit.Client]()
+	for i := range clientType.NumMethod() {
+		method := clientType.Method(i)
+		if unscoped[method.Name] {
+			continue
+		}
+		in := []reflect.Value{reflect.ValueOf(context.Background())}
+		for j := 1; j < method.Type.NumIn(); j++ {
+			switch arg := method.Type.In(j); arg.Kind() {
+			case reflect.Pointer:
+				in = append(in, reflect.New(arg.Elem()))
+			case reflect.String:
+				in = append(in, reflect.ValueOf("some-id"))
+			default:
+				in = append(in, reflect.Zero(arg))
+			}
+		}
+		out := v.MethodByName(method.Name).Call(in)
+		assert.Error(t, out[len(out)-1].Interface().(error), method.Name)
+	}
+	assert.Zero(t, requests)
+
+	// Other tenants' requests and URLs, exports and log streams are rejected
+	// with a tenant too.
+	ctx := audit.ContextWithTenantID(context.Background(), "t1")
+	_, err := scoped.PollResultByID(ctx, "other-id", nil)
+	assert.ErrorContains(t, err, `does not belong to tenant "t1"`)
+	_, err = scoped.PollResultRaw(ctx, "other-id")
+	assert.ErrorContains(t, err, `does not belong to tenant "t1"`)
+	_, err = scoped.PollResultByError(ctx, pangea.AcceptedError{ResponseHeader: pangea.ResponseHeader{RequestID: pangea.String("other-id")}})
+	assert.ErrorContains(t, err, `does not belong to tenant "t1"`)
+	_, err = scoped.DownloadFile(ctx, url.String()+"/other-file")
+	assert.ErrorContains(t, err, `does not belong to tenant "t1"`)
+	_, err = scoped.DownloadResults(ctx, &audit.DownloadRequest{RequestID: "export-id"})
+	assert.Error(t, err)
+	_, err = scoped.Export(ctx, &audit.ExportRequest{})
+	assert.Error(t, err)
+	_, err = scoped.LogStream(ctx, &audit.WebhookLogStreamRequest{})
+	assert.Error(t, err)
+	assert.Zero(t, requests)
+}
+
+func TestTenantScopedClient_DownloadResults(t *testing.T) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	defer teardown()
+
+	mux.HandleFunc("/v1/results", func(w http.ResponseWriter, r *http.Request) {
+		pangeatesting.TestBody(t, r, `{"id":"some-id","limit":1,"assert_search_restriction":{"tenant_id":["t1"]}}`)
+		fmt.Fprint(w, tenantSearchResponse)
+	})
+	mux.HandleFunc("/v1/download_results", func(w http.ResponseWriter, r *http.Request) {
+		pangeatesting.TestBody(t, r, `{"result_id":"some-id"}`)
+		fmt.Fprintf(w, `{"request_id": "some-id", "status": "Success", "result": {"dest_url": "%s/file"}, "summary": "ok"}`, url.String())
+	})
+	mux.HandleFunc("/file", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "results")
+	})
+
+	client, _ := audit.New(pangeatesting.TestConfig(url))
+	scoped := audit.NewTenantScopedClient(client)
+	ctx := audit.ContextWithTenantID(context.Background(), "t1")
+
+	resp, err := scoped.DownloadResults(ctx, &audit.DownloadRequest{ResultID: "some-id"})
+	assert.NoError(t, err)
+
+	// The URL is only downloaded for the tenant.
+	_, err = scoped.DownloadFile(audit.ContextWithTenantID(context.Background(), "t2"), resp.Result.DestURL)
+	assert.Error(t, err)
+	file, err := scoped.DownloadFile(ctx, resp.Result.DestURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "results", string(file.File))
+}
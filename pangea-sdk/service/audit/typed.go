@@ -0,0 +1,241 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+)
+
+// TypedClient is an audit client bound to the event type E. Events are
+// validated against the custom schema on Log and decoded into E on Search,
+// while hashing and signature verification are still done on the raw
+// envelope.
+type TypedClient[E any] struct {
+	audit  *audit
+	fields map[string]struct{}
+}
+
+type TypedSearchEvent[E any] struct {
+	*SearchEvent
+
+	// The decoded event
+	Event E
+}
+
+type TypedSearchOutput[E any] struct {
+	// Identifier to supply to search_results API to fetch/paginate through search results.
+	ID string
+
+	// The total number of results that were returned by the search.
+	Count int
+
+	// A list of matching audit records.
+	Events []TypedSearchEvent[E]
+
+	// A root of a Merkle Tree
+	Root *Root
+
+	// A unpublished root of a Merkle Tree
+	UnpublishedRoot *Root
+}
+
+// NewTyped creates an audit client for events of type E. If a custom schema is
+// set with WithCustomSchema, E's JSON field names must be part of it, and
+// logged events are validated against it. E may leave out fields of the
+// events: signatures are verified on the raw events.
+func NewTyped[E any](cfg *pangea.Config, opts ...Option) (*TypedClient[E], error) {
+	cli, err := New(cfg, opts...)
+	if err != nil {
+		return nil, err
+	}
+	a := cli.(*audit)
+
+	eventType := reflect.TypeOf((*E)(nil)).Elem()
+
+	var fields map[string]struct{}
+	if a.customSchema {
+		fields = jsonFieldNames(reflect.TypeOf(a.schema))
+		for name := range jsonFieldNames(eventType) {
+			if _, ok := fields[name]; len(fields) > 0 && !ok {
+				return nil, fmt.Errorf("audit: field %q of %v is not in the schema", name, eventType)
+			}
+		}
+	}
+
+	// Keep the events as they were signed, and decode them into E only for
+	// the results.
+	a.schema = map[string]any{}
+
+	return &TypedClient[E]{
+		audit:  a,
+		fields: fields,
+	}, nil
+}
+
+// Client returns the untyped client for the remaining endpoints.
+func (c *TypedClient[E]) Client() Client {
+	return c.audit
+}
+
+// Log validates and logs a single event.
+func (c *TypedClient[E]) Log(ctx context.Context, event E, verbose bool) (*pangea.PangeaResponse[LogResult], error) {
+	if err := c.validate(event); err != nil {
+		return nil, err
+	}
+	return c.audit.Log(ctx, &event, verbose)
+}
+
+// LogBulk validates and logs multiple events.
+func (c *TypedClient[E]) LogBulk(ctx context.Context, events []E, verbose bool) (*pangea.PangeaResponse[LogBulkResult], error) {
+	evs := make([]any, 0, len(events))
+	for i := range events {
+		if err := c.validate(events[i]); err != nil {
+			return nil, err
+		}
+		evs = append(evs, &events[i])
+	}
+	return c.audit.LogBulk(ctx, evs, verbose)
+}
+
+// Search for events and decode them into E.
+func (c *TypedClient[E]) Search(ctx context.Context, input *SearchInput) (*pangea.PangeaResponse[TypedSearchOutput[E]], error) {
+	resp, err := c.audit.Search(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	events, err := typedEvents[E](resp.Result.Events)
+	if err != nil {
+		return nil, err
+	}
+	return &pangea.PangeaResponse[TypedSearchOutput[E]]{
+		Response: resp.Response,
+		Result: &TypedSearchOutput[E]{
+			ID:              resp.Result.ID,
+			Count:           resp.Result.Count,
+			Events:          events,
+			Root:            resp.Result.Root,
+			UnpublishedRoot: resp.Result.UnpublishedRoot,
+		},
+	}, nil
+}
+
+// SearchResults pages through a previous search and decodes the events into E.
+func (c *TypedClient[E]) SearchResults(ctx context.Context, input *SearchResultsInput) (*pangea.PangeaResponse[TypedSearchOutput[E]], error) {
+	resp, err := c.audit.SearchResults(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	events, err := typedEvents[E](resp.Result.Events)
+	if err != nil {
+		return nil, err
+	}
+	return &pangea.PangeaResponse[TypedSearchOutput[E]]{
+		Response: resp.Response,
+		Result: &TypedSearchOutput[E]{
+			ID:              input.ID,
+			Count:           resp.Result.Count,
+			Events:          events,
+			Root:            resp.Result.Root,
+			UnpublishedRoot: resp.Result.UnpublishedRoot,
+		},
+	}, nil
+}
+
+// SearchAll returns all the search results for a search with pages.
+func (c *TypedClient[E]) SearchAll(ctx context.Context, input *SearchInput) (*Root, []TypedSearchEvent[E], error) {
+	root, events, err := SearchAll(ctx, c.audit, input)
+	if err != nil {
+		return nil, nil, err
+	}
+	typed, err := typedEvents[E](events)
+	if err != nil {
+		return nil, nil, err
+	}
+	return root, typed, nil
+}
+
+func (c *TypedClient[E]) validate(event E) error {
+	if len(c.fields) == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return fmt.Errorf("audit: event is not a JSON object: %w", err)
+	}
+	for name := range m {
+		if _, ok := c.fields[name]; !ok {
+			return fmt.Errorf("audit: field %q is not in the schema", name)
+		}
+	}
+	return nil
+}
+
+func typedEvents[E any](events SearchEvents) ([]TypedSearchEvent[E], error) {
+	typed := make([]TypedSearchEvent[E], 0, len(events))
+	for _, event := range events {
+		te := TypedSearchEvent[E]{SearchEvent: event}
+		if event.EventEnvelope != nil && event.EventEnvelope.Event != nil {
+			switch v := event.EventEnvelope.Event.(type) {
+			case *E:
+				te.Event = *v
+			case E:
+				te.Event = v
+			default:
+				// Fall back to a JSON round trip, e.g. for interface types.
+				b, err := json.Marshal(v)
+				if err != nil {
+					return nil, err
+				}
+				if err := json.Unmarshal(b, &te.Event); err != nil {
+					return nil, err
+				}
+			}
+		}
+		typed = append(typed, te)
+	}
+	return typed, nil
+}
+
+// jsonFieldNames returns the JSON names of the exported fields of a struct
+// type, following embedded structs. It returns nil for non-struct types.
+func jsonFieldNames(t reflect.Type) map[string]struct{} {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields := make(map[string]struct{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			for n := range jsonFieldNames(field.Type) {
+				fields[n] = struct{}{}
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = struct{}{}
+	}
+	return fields
+}
@@ -0,0 +1,146 @@
+//go:build unit
+
+package audit_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeatesting"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+type typedEvent struct {
+	Message  string `json:"message"`
+	FieldInt int    `json:"field_int,omitempty"`
+}
+
+func TestNewTyped_SchemaValidation(t *testing.T) {
+	cfg := pangeatesting.TestConfig(&url.URL{Host: "url"})
+
+	// Without a custom schema, E is its own schema.
+	_, err := audit.NewTyped[typedEvent](cfg)
+	assert.NoError(t, err)
+
+	// E must fit in the custom schema.
+	_, err = audit.NewTyped[typedEvent](cfg, audit.WithCustomSchema(audit.StandardEvent{}))
+	assert.Error(t, err)
+
+	_, err = audit.NewTyped[audit.StandardEvent](cfg, audit.WithCustomSchema(pangeatesting.CustomSchemaEvent{}))
+	assert.Error(t, err)
+
+	_, err = audit.NewTyped[typedEvent](cfg, audit.WithCustomSchema(pangeatesting.CustomSchemaEvent{}))
+	assert.NoError(t, err)
+}
+
+func TestTypedLog_FailValidation(t *testing.T) {
+	client, err := audit.NewTyped[map[string]any](pangeatesting.TestConfig(&url.URL{Host: "url"}), audit.WithCustomSchema(audit.StandardEvent{}))
+	assert.NoError(t, err)
+
+	got, err := client.Log(context.Background(), map[string]any{"message": "test", "unknown": 1}, false)
+	assert.Error(t, err)
+	assert.Nil(t, got)
+}
+
+func TestTypedSearch(t *testing.T) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	defer teardown()
+
+	mux.HandleFunc("/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		pangeatesting.TestMethod(t, r, "POST")
+		fmt.Fprint(w,
+			`{
+				"request_id": "some-id",
+				"request_time": "1970-01-01T00:00:00Z",
+				"response_time": "1970-01-01T00:00:10Z",
+				"status": "Success",
+				"result": {
+					"count": 1,
+					"events": [
+						{
+							"envelope": {
+								"event": {
+									"message": "test",
+									"field_int": 2
+								}
+							},
+							"hash": "7f28a5c0b0a8d6a6bcc9b4ba1a1d1fbf1b76c3bd1e4e7a6a52d4a0dc94a2fe7e"
+						}
+					],
+					"id": "some-id"
+				},
+				"summary": "Found 1 event(s)"
+			}`)
+	})
+
+	client, err := audit.NewTyped[typedEvent](pangeatesting.TestConfig(url), audit.DisableEventVerification())
+	assert.NoError(t, err)
+
+	got, err := client.Search(context.Background(), &audit.SearchInput{Query: "message:test"})
+	assert.NoError(t, err)
+	assert.Equal(t, "some-id", got.Result.ID)
+	assert.Len(t, got.Result.Events, 1)
+	assert.Equal(t, typedEvent{Message: "test", FieldInt: 2}, got.Result.Events[0].Event)
+	assert.NotNil(t, got.Result.Events[0].RawEnvelope)
+}
+
+func TestTypedSearch_VerifiesRawEvent(t *testing.T) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	defer teardown()
+
+	pub, key, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	pki, _ := json.Marshal(map[string]string{
+		"algorithm": "ED25519",
+		"key":       string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	})
+	// typedEvent leaves out "source", which is signed.
+	event := map[string]any{"message": "test", "field_int": 2, "source": "monitor"}
+	canon, _ := json.Marshal(event)
+	envelope := map[string]any{
+		"event":       event,
+		"signature":   base64.StdEncoding.EncodeToString(ed25519.Sign(key, canon)),
+		"public_key":  string(pki),
+		"received_at": "2023-01-01T00:00:00.000000Z",
+	}
+	canon, _ = json.Marshal(envelope)
+	hash := sha256.Sum256(canon)
+
+	mux.HandleFunc("/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		pangeatesting.TestMethod(t, r, "POST")
+		b, _ := json.Marshal(map[string]any{
+			"request_id":    "some-id",
+			"request_time":  "1970-01-01T00:00:00Z",
+			"response_time": "1970-01-01T00:00:10Z",
+			"status":        "Success",
+			"result": map[string]any{
+				"count":  1,
+				"events": []any{map[string]any{"envelope": envelope, "hash": hex.EncodeToString(hash[:])}},
+				"id":     "some-id",
+			},
+			"summary": "Found 1 event(s)",
+		})
+		w.Write(b)
+	})
+
+	client, err := audit.NewTyped[typedEvent](pangeatesting.TestConfig(url))
+	assert.NoError(t, err)
+
+	got, err := client.Search(context.Background(), &audit.SearchInput{Query: "message:test"})
+	assert.NoError(t, err)
+	assert.Len(t, got.Result.Events, 1)
+	assert.Equal(t, typedEvent{Message: "test", FieldInt: 2}, got.Result.Events[0].Event)
+	assert.Equal(t, audit.Success, got.Result.Events[0].SignatureVerification)
+}
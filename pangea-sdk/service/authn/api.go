@@ -21,6 +21,9 @@ type ClientUserinfoRequest struct {
 	pangea.BaseRequest
 
 	Code string `json:"code"`
+
+	// The PKCE code verifier of the login request, if any.
+	CodeVerifier string `json:"code_verifier,omitempty"`
 }
 
 // @summary Get User (client token)
@@ -921,8 +924,16 @@ func (a *Flow) Update(ctx context.Context, input FlowUpdateRequest) (*pangea.Pan
 	return request.DoPost(ctx, a.Client, "v2/flow/update", &input, &FlowUpdateResult{})
 }
 
+type FlowRestarterData interface {
+	IsFlowRestarterData() bool
+}
+
 type FlowRestartData struct{}
 
+func (frd FlowRestartData) IsFlowRestarterData() bool {
+	return true
+}
+
 type FlowRestartDataSMSOTP struct {
 	FlowRestartData
 	Phone string `json:"phone"`
@@ -930,9 +941,9 @@ type FlowRestartDataSMSOTP struct {
 
 type FlowRestartRequest struct {
 	pangea.BaseRequest
-	FlowID string          `json:"flow_id"`
-	Choice FlowChoice      `json:"choice"`
-	Data   FlowRestartData `json:"data"`
+	FlowID string            `json:"flow_id"`
+	Choice FlowChoice        `json:"choice"`
+	Data   FlowRestarterData `json:"data"`
 }
 
 type FlowRestartResult struct {
@@ -955,6 +966,10 @@ type FlowRestartResult struct {
 //
 //	resp, err := authncli.Flow.Restart(ctx, input)
 func (a *Flow) Restart(ctx context.Context, input FlowRestartRequest) (*pangea.PangeaResponse[FlowRestartResult], error) {
+	// A nil Data is sent as an empty object, as when Data was a struct.
+	if input.Data == nil {
+		input.Data = FlowRestartData{}
+	}
 	return request.DoPost(ctx, a.Client, "v2/flow/restart", &input, &FlowRestartResult{})
 }
 
@@ -0,0 +1,164 @@
+package flow
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/authn"
+)
+
+// The parameters of the choices, decoded from the data of the flow choices.
+// The fields that are not modeled are available in Choice.Data.
+
+type Password struct {
+	// Whether the user sets their password, rather than entering it.
+	Enrollment     bool            `json:"enrollment"`
+	PasswordPolicy *PasswordPolicy `json:"password_policy,omitempty"`
+}
+
+type PasswordPolicy struct {
+	CharsMin  int `json:"chars_min"`
+	CharsMax  int `json:"chars_max"`
+	LowerMin  int `json:"lower_min"`
+	UpperMin  int `json:"upper_min"`
+	PunctMin  int `json:"punct_min"`
+	NumberMin int `json:"number_min"`
+}
+
+type SetPassword struct {
+	PasswordPolicy *PasswordPolicy `json:"password_policy,omitempty"`
+}
+
+type EmailOTP struct {
+	// Whether the email address is being enrolled.
+	Enrollment bool `json:"enrollment"`
+	// Whether the code was sent.
+	Sent bool `json:"sent"`
+}
+
+type SMSOTP struct {
+	// Whether the phone number is being enrolled.
+	Enrollment bool   `json:"enrollment"`
+	Sent       bool   `json:"sent"`
+	Phone      string `json:"phone"`
+}
+
+type TOTP struct {
+	// Whether the authenticator is being enrolled, with QRImage.
+	Enrollment bool   `json:"enrollment"`
+	QRImage    string `json:"qr_image"`
+}
+
+type Magiclink struct {
+	Sent bool `json:"sent"`
+}
+
+type Captcha struct {
+	SiteKey string `json:"site_key"`
+}
+
+type Agreements struct {
+	Agreements []Agreement `json:"agreements"`
+}
+
+type Agreement struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	Text string `json:"text"`
+}
+
+type Profile struct {
+	Fields []ProfileField `json:"fields"`
+}
+
+type ProfileField struct {
+	ID       string `json:"id"`
+	Label    string `json:"label"`
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+}
+
+type Social struct {
+	Provider    string `json:"provider"`
+	RedirectURI string `json:"redirect_uri"`
+}
+
+type SetEmail struct{}
+
+type VerifyEmail struct {
+	Sent bool `json:"sent"`
+}
+
+type ResetPassword struct {
+	Sent bool `json:"sent"`
+}
+
+type ProvisionalEnrollment struct{}
+
+var params = map[authn.FlowChoice]func() any{
+	authn.FCAgreements:            func() any { return &Agreements{} },
+	authn.FCCaptcha:               func() any { return &Captcha{} },
+	authn.FCEmailOTP:              func() any { return &EmailOTP{} },
+	authn.FCMagiclink:             func() any { return &Magiclink{} },
+	authn.FCPassword:              func() any { return &Password{} },
+	authn.FCProfile:               func() any { return &Profile{} },
+	authn.FCProvisionalEnrollment: func() any { return &ProvisionalEnrollment{} },
+	authn.FCResetPassword:         func() any { return &ResetPassword{} },
+	authn.FCSetEmail:              func() any { return &SetEmail{} },
+	authn.FCSetPassword:           func() any { return &SetPassword{} },
+	authn.FCSMSOTP:                func() any { return &SMSOTP{} },
+	authn.FCSocial:                func() any { return &Social{} },
+	authn.FCTOTP:                  func() any { return &TOTP{} },
+	authn.FCVerifyEmail:           func() any { return &VerifyEmail{} },
+}
+
+// decodeParams decodes the data of a choice into its parameters, or returns
+// nil for unknown choices.
+func decodeParams(choice authn.FlowChoice, data map[string]any) any {
+	newParams, ok := params[choice]
+	if !ok {
+		return nil
+	}
+	p := newParams()
+	if b, err := json.Marshal(data); err == nil {
+		// Fields of unexpected types are left zero.
+		_ = json.Unmarshal(b, p)
+	}
+	return p
+}
+
+// The choices answered by the update data.
+var updateChoices = map[reflect.Type]authn.FlowChoice{
+	reflect.TypeFor[authn.FlowUpdateDataAgreements]():            authn.FCAgreements,
+	reflect.TypeFor[authn.FlowUpdateDataCaptcha]():               authn.FCCaptcha,
+	reflect.TypeFor[authn.FlowUpdateDataEmailOTP]():              authn.FCEmailOTP,
+	reflect.TypeFor[authn.FlowUpdateDataMagiclink]():             authn.FCMagiclink,
+	reflect.TypeFor[authn.FlowUpdateDataPassword]():              authn.FCPassword,
+	reflect.TypeFor[authn.FlowUpdateDataProfile]():               authn.FCProfile,
+	reflect.TypeFor[authn.FlowUpdateDataProvisionalEnrollment](): authn.FCProvisionalEnrollment,
+	reflect.TypeFor[authn.FlowUpdateDataResetPassword]():         authn.FCResetPassword,
+	reflect.TypeFor[authn.FlowUpdateDataSetEmail]():              authn.FCSetEmail,
+	reflect.TypeFor[authn.FlowUpdateDataSetPassword]():           authn.FCSetPassword,
+	reflect.TypeFor[authn.FlowUpdateDataSMSOTP]():                authn.FCSMSOTP,
+	reflect.TypeFor[authn.FlowUpdateDataSocialProvider]():        authn.FCSocial,
+	reflect.TypeFor[authn.FlowUpdateDataTOTP]():                  authn.FCTOTP,
+	reflect.TypeFor[authn.FlowUpdateDataVerifyEmail]():           authn.FCVerifyEmail,
+}
+
+// ChoiceOf returns the choice answered by data, e.g. authn.FCPassword for
+// authn.FlowUpdateDataPassword.
+func ChoiceOf(data authn.FlowUpdaterData) (authn.FlowChoice, bool) {
+	if data == nil {
+		return "", false
+	}
+	t := reflect.TypeOf(data)
+	if t.Kind() == reflect.Pointer {
+		if reflect.ValueOf(data).IsNil() {
+			return "", false
+		}
+		t = t.Elem()
+	}
+	choice, ok := updateChoices[t]
+	return choice, ok
+}
@@ -0,0 +1,301 @@
+// Package flow drives AuthN sign-up and sign-in flows.
+//
+// A flow goes through phases in which the user answers one of the choices
+// offered by AuthN, e.g. entering a password or an email OTP, until it is
+// completed. Driver models a flow as a state machine: State exposes the phase
+// and the choices with their typed parameters, and Update, Restart and
+// Complete validate the transitions before calling the Flow endpoints. Run
+// drives a flow to completion with a UI answering the choices.
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/authn"
+)
+
+var (
+	// ErrChoiceUnavailable is returned when a choice is not offered in the
+	// current phase of the flow.
+	ErrChoiceUnavailable = errors.New("flow: choice not available")
+
+	// ErrNotCompleted is returned by Complete before the flow reaches
+	// PhaseCompleted.
+	ErrNotCompleted = errors.New("flow: flow is not completed")
+
+	// ErrFinished is returned by the transitions of a flow that was
+	// completed with Complete.
+	ErrFinished = errors.New("flow: flow is finished")
+)
+
+// Phase is the phase of a flow.
+type Phase string
+
+const (
+	PhaseOneTime   Phase = "phase_one_time"
+	PhasePrimary   Phase = "phase_primary"
+	PhaseSecondary Phase = "phase_secondary"
+	PhaseCompleted Phase = "phase_completed"
+)
+
+// Choice is a choice offered by a flow.
+type Choice struct {
+	Choice authn.FlowChoice `json:"choice"`
+
+	// The data of the choice, as returned by AuthN.
+	Data map[string]any `json:"data,omitempty"`
+
+	// The parameters of the choice, decoded from Data: a *Password for
+	// authn.FCPassword, an *EmailOTP for authn.FCEmailOTP, etc. Nil for
+	// choices unknown to this package.
+	Params any `json:"-"`
+}
+
+// State is the state of a flow. It can be stored, e.g. in a session between
+// the requests of a login service, and resumed with Resume.
+type State struct {
+	FlowID     string   `json:"flow_id"`
+	FlowTypes  []string `json:"flow_types,omitempty"`
+	Email      string   `json:"email,omitempty"`
+	Disclaimer string   `json:"disclaimer,omitempty"`
+	Phase      Phase    `json:"phase"`
+	Choices    []Choice `json:"choices,omitempty"`
+}
+
+func newState(r *authn.CommonFlowResult) *State {
+	s := &State{
+		FlowID:     r.FlowID,
+		FlowTypes:  r.FlowType,
+		Email:      r.Email,
+		Disclaimer: r.Disclaimer,
+		Phase:      Phase(r.FlowPhase),
+	}
+	for _, item := range r.FlowChoices {
+		s.Choices = append(s.Choices, Choice{Choice: authn.FlowChoice(item.Choice), Data: item.Data})
+	}
+	s.decode()
+	return s
+}
+
+// clone returns a copy of s that does not share its choices.
+func (s *State) clone() *State {
+	c := *s
+	c.FlowTypes = slices.Clone(s.FlowTypes)
+	c.Choices = slices.Clone(s.Choices)
+	for i := range c.Choices {
+		c.Choices[i].Data = maps.Clone(c.Choices[i].Data)
+	}
+	c.decode()
+	return &c
+}
+
+func (s *State) decode() {
+	for i := range s.Choices {
+		s.Choices[i].Params = decodeParams(s.Choices[i].Choice, s.Choices[i].Data)
+	}
+}
+
+// Completed reports whether the flow can be completed with Complete.
+func (s *State) Completed() bool {
+	return s.Phase == PhaseCompleted
+}
+
+// Choice returns the first offered choice of kind.
+func (s *State) Choice(kind authn.FlowChoice) (*Choice, bool) {
+	for i := range s.Choices {
+		if s.Choices[i].Choice == kind {
+			return &s.Choices[i], true
+		}
+	}
+	return nil, false
+}
+
+// SocialProviders returns the offered social providers.
+func (s *State) SocialProviders() []*Social {
+	var providers []*Social
+	for _, c := range s.Choices {
+		if p, ok := c.Params.(*Social); ok {
+			providers = append(providers, p)
+		}
+	}
+	return providers
+}
+
+// Driver drives a flow. It is safe for concurrent use, transitions being
+// serialized.
+type Driver struct {
+	client *authn.AuthN
+
+	mu       sync.Mutex
+	state    *State
+	finished bool
+}
+
+// Start starts a flow.
+//
+// @example
+//
+//	d, err := flow.Start(ctx, authncli, authn.FlowStartRequest{
+//		Email:     "joe.user@email.com",
+//		FlowTypes: []authn.FlowType{authn.FTsignin, authn.FTsignup},
+//		CBURI:     "https://www.myserver.com/callback",
+//	})
+//	if err != nil {
+//		return err
+//	}
+//
+//	if _, ok := d.State().Choice(authn.FCPassword); ok {
+//		_, err = d.Update(ctx, authn.FlowUpdateDataPassword{Password: password})
+//	}
+func Start(ctx context.Context, client *authn.AuthN, input authn.FlowStartRequest) (*Driver, error) {
+	if client == nil {
+		return nil, errors.New("flow: nil client")
+	}
+	resp, err := client.Flow.Start(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return &Driver{client: client, state: newState(&resp.Result.CommonFlowResult)}, nil
+}
+
+// Resume resumes a flow from its state, e.g. after the user followed a magic
+// link or a social provider redirected to the callback URI.
+func Resume(client *authn.AuthN, state *State) (*Driver, error) {
+	if client == nil {
+		return nil, errors.New("flow: nil client")
+	}
+	if state == nil || state.FlowID == "" {
+		return nil, errors.New("flow: missing flow ID")
+	}
+	return &Driver{client: client, state: state.clone()}, nil
+}
+
+// State returns a copy of the current state of the flow.
+func (d *Driver) State() *State {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.state.clone()
+}
+
+// Update answers one of the offered choices with data, e.g.
+// authn.FlowUpdateDataPassword for authn.FCPassword, and returns the next
+// state.
+func (d *Driver) Update(ctx context.Context, data authn.FlowUpdaterData) (*State, error) {
+	choice, ok := ChoiceOf(data)
+	if !ok {
+		return nil, fmt.Errorf("flow: unsupported update data %T", data)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.validate(choice); err != nil {
+		return nil, err
+	}
+	if err := d.validateData(data); err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Flow.Update(ctx, authn.FlowUpdateRequest{
+		FlowID: d.state.FlowID,
+		Choice: choice,
+		Data:   data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.state = newState(&resp.Result.CommonFlowResult)
+	return d.state.clone(), nil
+}
+
+// Restart restarts one of the offered choices, e.g. to send a new email OTP,
+// or an SMS OTP to another phone number with authn.FlowRestartDataSMSOTP. data
+// may be nil.
+func (d *Driver) Restart(ctx context.Context, choice authn.FlowChoice, data authn.FlowRestarterData) (*State, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.validate(choice); err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Flow.Restart(ctx, authn.FlowRestartRequest{
+		FlowID: d.state.FlowID,
+		Choice: choice,
+		Data:   data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.state = newState(&resp.Result.CommonFlowResult)
+	return d.state.clone(), nil
+}
+
+// Complete completes a flow in PhaseCompleted and returns the tokens of the
+// user.
+func (d *Driver) Complete(ctx context.Context) (*authn.FlowCompleteResult, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.finished {
+		return nil, ErrFinished
+	}
+	if !d.state.Completed() {
+		return nil, ErrNotCompleted
+	}
+	resp, err := d.client.Flow.Complete(ctx, authn.FlowCompleteRequest{FlowID: d.state.FlowID})
+	if err != nil {
+		return nil, err
+	}
+	d.finished = true
+	return resp.Result, nil
+}
+
+// validate checks that choice is offered in the current state.
+func (d *Driver) validate(choice authn.FlowChoice) error {
+	if d.finished {
+		return ErrFinished
+	}
+	if _, ok := d.state.Choice(choice); !ok {
+		return fmt.Errorf("%w: %s in %s", ErrChoiceUnavailable, choice, d.state.Phase)
+	}
+	return nil
+}
+
+// validateData checks the data of the choices whose parameters restrict the
+// answers.
+func (d *Driver) validateData(data authn.FlowUpdaterData) error {
+	switch data := deref(data).(type) {
+	case authn.FlowUpdateDataSocialProvider:
+		for _, p := range d.state.SocialProviders() {
+			if p.Provider == data.SocialProvider {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: social provider %q", ErrChoiceUnavailable, data.SocialProvider)
+
+	case authn.FlowUpdateDataAgreements:
+		c, _ := d.state.Choice(authn.FCAgreements)
+		p, ok := c.Params.(*Agreements)
+		if !ok || len(p.Agreements) == 0 {
+			return nil
+		}
+		for _, id := range data.Agreed {
+			if !slices.ContainsFunc(p.Agreements, func(a Agreement) bool { return a.ID == id }) {
+				return fmt.Errorf("%w: agreement %q", ErrChoiceUnavailable, id)
+			}
+		}
+	}
+	return nil
+}
+
+// deref returns the value pointed to by the pointers to update data.
+func deref(data authn.FlowUpdaterData) authn.FlowUpdaterData {
+	switch data := data.(type) {
+	case *authn.FlowUpdateDataSocialProvider:
+		return *data
+	case *authn.FlowUpdateDataAgreements:
+		return *data
+	}
+	return data
+}
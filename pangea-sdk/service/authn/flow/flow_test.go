@@ -0,0 +1,198 @@
+//go:build unit
+
+package flow_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeatesting"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/authn"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/authn/flow"
+	"github.com/stretchr/testify/assert"
+)
+
+const primary = `{"flow_id": "pfl_1", "flow_type": ["signin"], "email": "joe@example.com", "flow_phase": "phase_primary", "flow_choices": [
+	{"choice": "password", "data": {"enrollment": false, "password_policy": {"chars_min": 8}}},
+	{"choice": "sms_otp", "data": {"sent": true, "phone": "+1555"}},
+	{"choice": "social", "data": {"provider": "google", "redirect_uri": "https://accounts.google.com/auth"}},
+	{"choice": "agreements", "data": {"agreements": [{"id": "pas_eula", "type": "eula", "name": "EULA", "text": "..."}]}},
+	{"choice": "future_choice", "data": {"foo": "bar"}}
+]}`
+
+const completed = `{"flow_id": "pfl_1", "flow_type": ["signin"], "flow_phase": "phase_completed", "flow_choices": []}`
+
+type request struct {
+	FlowID string          `json:"flow_id"`
+	Choice string          `json:"choice"`
+	Data   json.RawMessage `json:"data"`
+}
+
+func setupFlow(t *testing.T) (*authn.AuthN, *[]string, func()) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	calls := &[]string{}
+
+	respond := func(w http.ResponseWriter, result string) {
+		fmt.Fprintf(w, `{"request_id": "some-id", "status": "Success", "result": %s, "summary": "ok"}`, result)
+	}
+	mux.HandleFunc("/v2/flow/start", func(w http.ResponseWriter, r *http.Request) {
+		*calls = append(*calls, "start")
+		respond(w, primary)
+	})
+	mux.HandleFunc("/v2/flow/update", func(w http.ResponseWriter, r *http.Request) {
+		var input request
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+		*calls = append(*calls, "update "+input.Choice+" "+string(input.Data))
+		if string(input.Data) != `{"password":"correct"}` {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"request_id": "some-id", "status": "InvalidPassword", "result": null, "summary": "wrong password"}`)
+			return
+		}
+		respond(w, completed)
+	})
+	mux.HandleFunc("/v2/flow/restart", func(w http.ResponseWriter, r *http.Request) {
+		var input request
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+		*calls = append(*calls, "restart "+input.Choice+" "+string(input.Data))
+		respond(w, primary)
+	})
+	mux.HandleFunc("/v2/flow/complete", func(w http.ResponseWriter, r *http.Request) {
+		*calls = append(*calls, "complete")
+		respond(w, `{"active_token": {"token": "pts_active"}, "refresh_token": {"token": "ptr_refresh"}}`)
+	})
+
+	return authn.New(pangeatesting.TestConfig(url)), calls, teardown
+}
+
+func TestDriver(t *testing.T) {
+	client, calls, teardown := setupFlow(t)
+	defer teardown()
+	ctx := context.Background()
+
+	d, err := flow.Start(ctx, client, authn.FlowStartRequest{Email: "joe@example.com", FlowTypes: []authn.FlowType{authn.FTsignin}})
+	assert.NoError(t, err)
+
+	state := d.State()
+	assert.Equal(t, flow.PhasePrimary, state.Phase)
+	c, ok := state.Choice(authn.FCPassword)
+	assert.True(t, ok)
+	assert.Equal(t, 8, c.Params.(*flow.Password).PasswordPolicy.CharsMin)
+	c, _ = state.Choice(authn.FCSMSOTP)
+	assert.Equal(t, &flow.SMSOTP{Sent: true, Phone: "+1555"}, c.Params)
+	assert.Equal(t, []*flow.Social{{Provider: "google", RedirectURI: "https://accounts.google.com/auth"}}, state.SocialProviders())
+	c, _ = state.Choice("future_choice")
+	assert.Nil(t, c.Params)
+	assert.Equal(t, map[string]any{"foo": "bar"}, c.Data)
+
+	// The state is a copy.
+	state.Choices[0].Choice = authn.FCEmailOTP
+	c.Data["foo"] = "baz"
+	_, ok = d.State().Choice(authn.FCPassword)
+	assert.True(t, ok)
+	c, _ = d.State().Choice("future_choice")
+	assert.Equal(t, map[string]any{"foo": "bar"}, c.Data)
+
+	// Transitions are validated before calling AuthN.
+	_, err = d.Update(ctx, authn.FlowUpdateDataEmailOTP{Code: "123456"})
+	assert.ErrorIs(t, err, flow.ErrChoiceUnavailable)
+	_, err = d.Update(ctx, authn.FlowUpdateDataSocialProvider{SocialProvider: "github"})
+	assert.ErrorIs(t, err, flow.ErrChoiceUnavailable)
+	_, err = d.Update(ctx, &authn.FlowUpdateDataAgreements{Agreed: []string{"pas_other"}})
+	assert.ErrorIs(t, err, flow.ErrChoiceUnavailable)
+	_, err = d.Complete(ctx)
+	assert.ErrorIs(t, err, flow.ErrNotCompleted)
+	assert.Equal(t, []string{"start"}, *calls)
+
+	_, err = d.Restart(ctx, authn.FCSMSOTP, authn.FlowRestartDataSMSOTP{Phone: "+1666"})
+	assert.NoError(t, err)
+
+	state, err = d.Update(ctx, authn.FlowUpdateDataPassword{Password: "correct"})
+	assert.NoError(t, err)
+	assert.True(t, state.Completed())
+
+	tokens, err := d.Complete(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "pts_active", tokens.ActiveToken.Token)
+	_, err = d.Update(ctx, authn.FlowUpdateDataPassword{Password: "correct"})
+	assert.ErrorIs(t, err, flow.ErrFinished)
+
+	assert.Equal(t, []string{
+		"start",
+		`restart sms_otp {"phone":"+1666"}`,
+		`update password {"password":"correct"}`,
+		"complete",
+	}, *calls)
+}
+
+func TestRun(t *testing.T) {
+	client, calls, teardown := setupFlow(t)
+	defer teardown()
+	ctx := context.Background()
+
+	d, err := flow.Start(ctx, client, authn.FlowStartRequest{Email: "joe@example.com"})
+	assert.NoError(t, err)
+
+	var errs []error
+	passwords := []string{"wrong", "correct"}
+	tokens, err := flow.Run(ctx, d, flow.UIFunc(func(ctx context.Context, s *flow.State, err error) (flow.Action, error) {
+		errs = append(errs, err)
+		password := passwords[0]
+		passwords = passwords[1:]
+		return flow.Submit{Data: authn.FlowUpdateDataPassword{Password: password}}, nil
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "ptr_refresh", tokens.RefreshToken.Token)
+
+	// The wrong password was reported to the UI.
+	assert.Len(t, errs, 2)
+	assert.Nil(t, errs[0])
+	var apiErr *pangea.APIError
+	assert.ErrorAs(t, errs[1], &apiErr)
+	assert.Len(t, *calls, 4)
+}
+
+func TestResume(t *testing.T) {
+	client, _, teardown := setupFlow(t)
+	defer teardown()
+	ctx := context.Background()
+
+	d, err := flow.Start(ctx, client, authn.FlowStartRequest{})
+	assert.NoError(t, err)
+
+	// The state is stored between requests.
+	b, err := json.Marshal(d.State())
+	assert.NoError(t, err)
+	var state flow.State
+	assert.NoError(t, json.Unmarshal(b, &state))
+
+	d, err = flow.Resume(client, &state)
+	assert.NoError(t, err)
+	c, ok := d.State().Choice(authn.FCAgreements)
+	assert.True(t, ok)
+	assert.Equal(t, "pas_eula", c.Params.(*flow.Agreements).Agreements[0].ID)
+
+	next, err := d.Update(ctx, authn.FlowUpdateDataPassword{Password: "correct"})
+	assert.NoError(t, err)
+	assert.True(t, next.Completed())
+}
+
+func TestRestart_NilData(t *testing.T) {
+	client, calls, teardown := setupFlow(t)
+	defer teardown()
+	ctx := context.Background()
+
+	// A nil Data is sent as an empty object.
+	_, err := client.Flow.Restart(ctx, authn.FlowRestartRequest{FlowID: "pfl_1", Choice: authn.FCEmailOTP})
+	assert.NoError(t, err)
+
+	d, err := flow.Start(ctx, client, authn.FlowStartRequest{})
+	assert.NoError(t, err)
+	_, err = d.Restart(ctx, authn.FCSMSOTP, nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"restart email_otp {}", "start", "restart sms_otp {}"}, *calls)
+}
@@ -0,0 +1,101 @@
+package flow
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/authn"
+)
+
+// Action is the answer of a UI to a state: either Submit or Resend.
+type Action interface {
+	apply(ctx context.Context, d *Driver) error
+}
+
+// Submit answers one of the offered choices with Data.
+type Submit struct {
+	Data authn.FlowUpdaterData
+}
+
+func (a Submit) apply(ctx context.Context, d *Driver) error {
+	_, err := d.Update(ctx, a.Data)
+	return err
+}
+
+// Resend restarts one of the offered choices, e.g. to send a new code.
+type Resend struct {
+	Choice authn.FlowChoice
+	Data   authn.FlowRestarterData
+}
+
+func (a Resend) apply(ctx context.Context, d *Driver) error {
+	_, err := d.Restart(ctx, a.Choice, a.Data)
+	return err
+}
+
+// UI interacts with the user of a flow.
+type UI interface {
+	// Prompt presents the choices of state to the user and returns their
+	// answer. err is the error of the previous action, e.g. a wrong code or an
+	// unavailable choice, in which case state is unchanged; nil otherwise. An
+	// error returned by Prompt aborts the flow.
+	Prompt(ctx context.Context, state *State, err error) (Action, error)
+}
+
+// UIFunc adapts a function to the UI interface.
+type UIFunc func(ctx context.Context, state *State, err error) (Action, error)
+
+func (f UIFunc) Prompt(ctx context.Context, state *State, err error) (Action, error) {
+	return f(ctx, state, err)
+}
+
+// Run drives the flow of d with ui until it is completed, and completes it.
+// The errors of the actions the user can recover from, i.e. validation errors
+// and AuthN API errors, are passed to ui with the unchanged state; other
+// errors abort the flow.
+//
+// @example
+//
+//	d, err := flow.Start(ctx, authncli, authn.FlowStartRequest{
+//		Email:     email,
+//		FlowTypes: []authn.FlowType{authn.FTsignin},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//
+//	tokens, err := flow.Run(ctx, d, flow.UIFunc(func(ctx context.Context, s *flow.State, err error) (flow.Action, error) {
+//		if _, ok := s.Choice(authn.FCPassword); ok {
+//			return flow.Submit{Data: authn.FlowUpdateDataPassword{Password: readPassword()}}, nil
+//		}
+//		return nil, fmt.Errorf("unsupported choices: %v", s.Choices)
+//	}))
+func Run(ctx context.Context, d *Driver, ui UI) (*authn.FlowCompleteResult, error) {
+	if d == nil || ui == nil {
+		return nil, errors.New("flow: nil driver or UI")
+	}
+
+	var last error
+	for state := d.State(); !state.Completed(); state = d.State() {
+		action, err := ui.Prompt(ctx, state, last)
+		if err != nil {
+			return nil, err
+		}
+		if action == nil {
+			return nil, errors.New("flow: nil action")
+		}
+		last = action.apply(ctx, d)
+		if last != nil && !recoverable(last) {
+			return nil, last
+		}
+	}
+	return d.Complete(ctx)
+}
+
+// recoverable reports whether the user can recover from the error of an
+// action, by answering again.
+func recoverable(err error) bool {
+	var apiErr *pangea.APIError
+	return errors.Is(err, ErrChoiceUnavailable) || errors.As(err, &apiErr)
+}
@@ -0,0 +1,284 @@
+// Package hostedlogin integrates an application, as an OAuth2 relying party,
+// with the AuthN hosted login.
+//
+// RelyingParty builds the login and sign-up URLs of the hosted login, with a
+// state and a PKCE challenge, and exchanges the code of the callback for the
+// user's tokens with Client.Userinfo, after checking the state. The tokens are
+// refreshed with Client.Session.Refresh by a TokenSource, shaped after the
+// golang.org/x/oauth2 one.
+package hostedlogin
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/authn"
+)
+
+var (
+	// ErrStateMismatch is returned when the state of a callback is not the
+	// one of the login request.
+	ErrStateMismatch = errors.New("hostedlogin: state mismatch")
+
+	// ErrMissingCode is returned when a callback carries no code.
+	ErrMissingCode = errors.New("hostedlogin: missing code")
+)
+
+// CallbackError is returned when the hosted login redirects with an error.
+type CallbackError struct {
+	Code        string
+	Description string
+}
+
+func (e *CallbackError) Error() string {
+	if e.Description == "" {
+		return "hostedlogin: " + e.Code
+	}
+	return fmt.Sprintf("hostedlogin: %s: %s", e.Code, e.Description)
+}
+
+// AuthRequest is a login or sign-up request. Its State and CodeVerifier must
+// be kept, e.g. in a cookie, until the callback.
+type AuthRequest struct {
+	// The URL of the hosted login the user is redirected to.
+	URL          string
+	State        string
+	CodeVerifier string
+}
+
+// RelyingParty logs users in with the hosted login of an AuthN project.
+type RelyingParty struct {
+	client      *authn.AuthN
+	loginURL    string
+	signupURL   string
+	redirectURI string
+	pkce        bool
+	cookie      string
+	onRefresh   func(*Token)
+}
+
+type Option func(*RelyingParty) error
+
+// WithSignupURL sets the URL of the sign-up page. Defaults to the /signup page
+// of the hosted login.
+func WithSignupURL(u string) Option {
+	return func(rp *RelyingParty) error {
+		if _, err := url.Parse(u); err != nil {
+			return fmt.Errorf("hostedlogin: invalid sign-up URL: %w", err)
+		}
+		rp.signupURL = u
+		return nil
+	}
+}
+
+// WithoutPKCE disables PKCE.
+func WithoutPKCE() Option {
+	return func(rp *RelyingParty) error {
+		rp.pkce = false
+		return nil
+	}
+}
+
+// WithStateCookie sets the name of the cookie keeping the state of the
+// requests of Redirect. Defaults to "pangea-login-state".
+func WithStateCookie(name string) Option {
+	return func(rp *RelyingParty) error {
+		if name == "" {
+			return errors.New("hostedlogin: empty state cookie name")
+		}
+		rp.cookie = name
+		return nil
+	}
+}
+
+// WithRefreshCallback sets a function called with the new tokens after every
+// refresh of a TokenSource, e.g. to store them.
+func WithRefreshCallback(f func(*Token)) Option {
+	return func(rp *RelyingParty) error {
+		rp.onRefresh = f
+		return nil
+	}
+}
+
+// New creates a relying party of the hosted login at loginURL, as shown in
+// the AuthN settings of the project, redirecting users to redirectURI after
+// they logged in. redirectURI must be an allowed redirect of the project.
+//
+// @example
+//
+//	rp, err := hostedlogin.New(authncli,
+//		"https://pdn-xxx.login.aws.us.pangea.cloud",
+//		"https://www.myserver.com/callback",
+//	)
+//	if err != nil {
+//		return err
+//	}
+//
+//	http.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+//		rp.Redirect(w, r, false)
+//	})
+//	http.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+//		token, err := rp.Callback(w, r)
+//		if err != nil {
+//			http.Error(w, err.Error(), http.StatusUnauthorized)
+//			return
+//		}
+//		// Store token.
+//	})
+func New(client *authn.AuthN, loginURL, redirectURI string, opts ...Option) (*RelyingParty, error) {
+	if client == nil {
+		return nil, errors.New("hostedlogin: nil client")
+	}
+	if _, err := url.Parse(loginURL); err != nil || loginURL == "" {
+		return nil, errors.New("hostedlogin: invalid login URL")
+	}
+	if _, err := url.Parse(redirectURI); err != nil || redirectURI == "" {
+		return nil, errors.New("hostedlogin: invalid redirect URI")
+	}
+	base := strings.TrimSuffix(loginURL, "/")
+	rp := &RelyingParty{
+		client:      client,
+		loginURL:    base + "/authorize",
+		signupURL:   base + "/signup",
+		redirectURI: redirectURI,
+		pkce:        true,
+		cookie:      "pangea-login-state",
+	}
+	for _, opt := range opts {
+		if err := opt(rp); err != nil {
+			return nil, err
+		}
+	}
+	return rp, nil
+}
+
+// LoginURL returns a login request with a new state and PKCE code verifier.
+func (rp *RelyingParty) LoginURL() (*AuthRequest, error) {
+	return rp.authRequest(rp.loginURL)
+}
+
+// SignupURL returns a sign-up request with a new state and PKCE code verifier.
+func (rp *RelyingParty) SignupURL() (*AuthRequest, error) {
+	return rp.authRequest(rp.signupURL)
+}
+
+func (rp *RelyingParty) authRequest(page string) (*AuthRequest, error) {
+	u, err := url.Parse(page)
+	if err != nil {
+		return nil, err
+	}
+	state, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	req := &AuthRequest{State: state}
+
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("redirect_uri", rp.redirectURI)
+	q.Set("state", state)
+	if rp.pkce {
+		if req.CodeVerifier, err = randomString(); err != nil {
+			return nil, err
+		}
+		challenge := sha256.Sum256([]byte(req.CodeVerifier))
+		q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+		q.Set("code_challenge_method", "S256")
+	}
+	u.RawQuery = q.Encode()
+	req.URL = u.String()
+	return req, nil
+}
+
+// randomString returns 256 random bits, base64url encoded, as PKCE code
+// verifiers and states.
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Exchange checks the state of the query of a callback against the one of
+// req, and exchanges its code for the user's tokens.
+func (rp *RelyingParty) Exchange(ctx context.Context, req *AuthRequest, query url.Values) (*Token, error) {
+	if code := query.Get("error"); code != "" {
+		return nil, &CallbackError{Code: code, Description: query.Get("error_description")}
+	}
+	state := query.Get("state")
+	if req == nil || req.State == "" || subtle.ConstantTimeCompare([]byte(state), []byte(req.State)) != 1 {
+		return nil, ErrStateMismatch
+	}
+	code := query.Get("code")
+	if code == "" {
+		return nil, ErrMissingCode
+	}
+
+	resp, err := rp.client.Client.Userinfo(ctx, authn.ClientUserinfoRequest{Code: code, CodeVerifier: req.CodeVerifier})
+	if err != nil {
+		return nil, err
+	}
+	return newToken(resp.Result.ActiveToken, &resp.Result.RefreshToken), nil
+}
+
+// Redirect redirects the user to the login page, or to the sign-up page if
+// signup, keeping the state of the request in a cookie for Callback.
+func (rp *RelyingParty) Redirect(w http.ResponseWriter, r *http.Request, signup bool) {
+	page := rp.loginURL
+	if signup {
+		page = rp.signupURL
+	}
+	req, err := rp.authRequest(page)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	rp.setCookie(w, req.State+"."+req.CodeVerifier, 600)
+	http.Redirect(w, r, req.URL, http.StatusFound)
+}
+
+// Callback handles the redirect of the hosted login to the redirect URI of a
+// request of Redirect, and returns the user's tokens.
+func (rp *RelyingParty) Callback(w http.ResponseWriter, r *http.Request) (*Token, error) {
+	c, err := r.Cookie(rp.cookie)
+	if err != nil {
+		return nil, ErrStateMismatch
+	}
+	rp.setCookie(w, "", -1)
+	state, verifier, _ := strings.Cut(c.Value, ".")
+	return rp.Exchange(r.Context(), &AuthRequest{State: state, CodeVerifier: verifier}, r.URL.Query())
+}
+
+func (rp *RelyingParty) setCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     rp.cookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: true,
+		// The cookie is sent on the redirect of the hosted login.
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Logout ends the session of a token.
+func (rp *RelyingParty) Logout(ctx context.Context, t *Token) error {
+	_, err := rp.client.Client.Session.Logout(ctx, authn.ClientSessionLogoutRequest{Token: t.AccessToken})
+	return err
+}
+
+func parseExpiry(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
@@ -0,0 +1,165 @@
+//go:build unit
+
+package hostedlogin_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeatesting"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/authn"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/authn/hostedlogin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupRelyingParty(t *testing.T, opts ...hostedlogin.Option) (*hostedlogin.RelyingParty, *int, func()) {
+	mux, u, teardown := pangeatesting.SetupServer()
+	refreshes := new(int)
+
+	mux.HandleFunc("/v2/client/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		var input authn.ClientUserinfoRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+		if input.Code != "pmc_code" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"request_id": "some-id", "status": "InvalidCode", "result": null, "summary": "invalid code"}`)
+			return
+		}
+		// The active token has expired.
+		fmt.Fprintf(w, `{"request_id": "some-id", "status": "Success", "result": {"active_token": {"token": "pts_active", "expire": %q, "email": "joe@example.com"}, "refresh_token": {"token": "ptr_refresh", "expire": "2030-01-01T00:00:00Z"}}, "summary": "ok"}`,
+			time.Now().Add(-time.Minute).Format(time.RFC3339))
+	})
+	mux.HandleFunc("/v2/client/session/refresh", func(w http.ResponseWriter, r *http.Request) {
+		*refreshes++
+		var input authn.ClientSessionRefreshRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+		assert.Equal(t, "ptr_refresh", input.RefreshToken)
+		assert.Equal(t, "pts_active", input.UserToken)
+		fmt.Fprint(w, `{"request_id": "some-id", "status": "Success", "result": {"active_token": {"token": "pts_refreshed", "expire": "2030-01-01T00:00:00Z"}, "refresh_token": {"token": "ptr_rotated", "expire": "2030-01-02T00:00:00Z"}}, "summary": "ok"}`)
+	})
+
+	rp, err := hostedlogin.New(authn.New(pangeatesting.TestConfig(u)), "https://pdn-test.login.pangea.cloud/", "https://app.example.com/callback", opts...)
+	assert.NoError(t, err)
+	return rp, refreshes, teardown
+}
+
+func TestLoginURL(t *testing.T) {
+	rp, _, teardown := setupRelyingParty(t)
+	defer teardown()
+
+	req, err := rp.LoginURL()
+	assert.NoError(t, err)
+	u, err := url.Parse(req.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "pdn-test.login.pangea.cloud", u.Host)
+	assert.Equal(t, "/authorize", u.Path)
+
+	q := u.Query()
+	assert.Equal(t, "code", q.Get("response_type"))
+	assert.Equal(t, "https://app.example.com/callback", q.Get("redirect_uri"))
+	assert.Equal(t, req.State, q.Get("state"))
+	challenge := sha256.Sum256([]byte(req.CodeVerifier))
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(challenge[:]), q.Get("code_challenge"))
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+
+	other, err := rp.SignupURL()
+	assert.NoError(t, err)
+	assert.Contains(t, other.URL, "https://pdn-test.login.pangea.cloud/signup?")
+	assert.NotEqual(t, req.State, other.State)
+
+	rp, _, teardown = setupRelyingParty(t, hostedlogin.WithoutPKCE())
+	defer teardown()
+	req, err = rp.LoginURL()
+	assert.NoError(t, err)
+	assert.Empty(t, req.CodeVerifier)
+	assert.NotContains(t, req.URL, "code_challenge")
+}
+
+func TestExchange(t *testing.T) {
+	var refreshed *hostedlogin.Token
+	rp, refreshes, teardown := setupRelyingParty(t, hostedlogin.WithRefreshCallback(func(t *hostedlogin.Token) {
+		refreshed = t
+	}))
+	defer teardown()
+	ctx := context.Background()
+
+	req, err := rp.LoginURL()
+	assert.NoError(t, err)
+
+	_, err = rp.Exchange(ctx, req, url.Values{"state": {"forged"}, "code": {"pmc_code"}})
+	assert.ErrorIs(t, err, hostedlogin.ErrStateMismatch)
+	_, err = rp.Exchange(ctx, req, url.Values{"error": {"access_denied"}})
+	var callbackErr *hostedlogin.CallbackError
+	assert.ErrorAs(t, err, &callbackErr)
+	assert.Equal(t, "access_denied", callbackErr.Code)
+	_, err = rp.Exchange(ctx, req, url.Values{"state": {req.State}})
+	assert.ErrorIs(t, err, hostedlogin.ErrMissingCode)
+
+	token, err := rp.Exchange(ctx, req, url.Values{"state": {req.State}, "code": {"pmc_code"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "pts_active", token.AccessToken)
+	assert.Equal(t, "joe@example.com", token.Active.Email)
+	assert.False(t, token.Valid())
+
+	// The expired active token is refreshed once.
+	ts := rp.TokenSource(ctx, token)
+	for range 2 {
+		token, err = ts.Token()
+		assert.NoError(t, err)
+		assert.Equal(t, "pts_refreshed", token.AccessToken)
+		assert.Equal(t, "ptr_rotated", token.RefreshToken)
+	}
+	assert.Equal(t, 1, *refreshes)
+	assert.Equal(t, token, refreshed)
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	}))
+	defer api.Close()
+	resp, err := hostedlogin.NewClient(ts).Get(api.URL)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	var body [64]byte
+	n, _ := resp.Body.Read(body[:])
+	assert.Equal(t, "Bearer pts_refreshed", string(body[:n]))
+
+	// A session whose refresh token expired cannot be refreshed.
+	_, err = rp.TokenSource(ctx, &hostedlogin.Token{
+		RefreshToken: "ptr_refresh",
+		Refresh:      authn.LoginToken{Token: "ptr_refresh", SessionToken: authn.SessionToken{Expire: "2020-01-01T00:00:00Z"}},
+	}).Token()
+	assert.ErrorIs(t, err, hostedlogin.ErrSessionExpired)
+}
+
+func TestRedirectCallback(t *testing.T) {
+	rp, _, teardown := setupRelyingParty(t)
+	defer teardown()
+
+	w := httptest.NewRecorder()
+	rp.Redirect(w, httptest.NewRequest(http.MethodGet, "/login", nil), false)
+	assert.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	assert.NoError(t, err)
+	cookies := w.Result().Cookies()
+	assert.Len(t, cookies, 1)
+
+	r := httptest.NewRequest(http.MethodGet, "/callback?code=pmc_code&state="+location.Query().Get("state"), nil)
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	token, err := rp.Callback(w, r)
+	assert.NoError(t, err)
+	assert.Equal(t, "ptr_refresh", token.RefreshToken)
+	// The state cookie is cleared.
+	assert.Equal(t, -1, w.Result().Cookies()[0].MaxAge)
+
+	// Callbacks without the state cookie are rejected.
+	_, err = rp.Callback(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/callback?code=pmc_code&state=x", nil))
+	assert.ErrorIs(t, err, hostedlogin.ErrStateMismatch)
+}
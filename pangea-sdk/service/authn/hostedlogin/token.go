@@ -0,0 +1,149 @@
+package hostedlogin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/authn"
+)
+
+// ErrSessionExpired is returned by a TokenSource whose refresh token expired.
+// The user must log in again.
+var ErrSessionExpired = errors.New("hostedlogin: session expired")
+
+// The time before their expiry when tokens are refreshed.
+const expiryDelta = 10 * time.Second
+
+// Token holds the tokens of a user's session. Its first fields are those of
+// golang.org/x/oauth2.Token.
+type Token struct {
+	// The active token, used as a bearer token.
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type,omitempty"`
+	RefreshToken string    `json:"refresh_token"`
+	Expiry       time.Time `json:"expiry"`
+
+	// The tokens as returned by AuthN.
+	Active  *authn.LoginToken `json:"active,omitempty"`
+	Refresh authn.LoginToken  `json:"refresh"`
+}
+
+func newToken(active, refresh *authn.LoginToken) *Token {
+	t := &Token{
+		TokenType:    "Bearer",
+		RefreshToken: refresh.Token,
+		Active:       active,
+		Refresh:      *refresh,
+	}
+	if active != nil {
+		t.AccessToken = active.Token
+		t.Expiry = parseExpiry(active.Expire)
+	}
+	return t
+}
+
+// Valid reports whether the active token is set and not about to expire.
+func (t *Token) Valid() bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	return t.Expiry.IsZero() || time.Now().Add(expiryDelta).Before(t.Expiry)
+}
+
+// SetAuthHeader sets the Authorization header of r to the active token.
+func (t *Token) SetAuthHeader(r *http.Request) {
+	r.Header.Set("Authorization", "Bearer "+t.AccessToken)
+}
+
+// TokenSource returns tokens, with the method set of
+// golang.org/x/oauth2.TokenSource, so that an adapter is a one-liner:
+//
+//	type oauth2Source struct{ ts hostedlogin.TokenSource }
+//
+//	func (s oauth2Source) Token() (*oauth2.Token, error) {
+//		t, err := s.ts.Token()
+//		if err != nil {
+//			return nil, err
+//		}
+//		return &oauth2.Token{AccessToken: t.AccessToken, TokenType: t.TokenType, RefreshToken: t.RefreshToken, Expiry: t.Expiry}, nil
+//	}
+type TokenSource interface {
+	Token() (*Token, error)
+}
+
+type refreshingSource struct {
+	ctx context.Context
+	rp  *RelyingParty
+
+	mu sync.Mutex
+	t  *Token
+}
+
+// TokenSource returns a TokenSource returning t until it expires, and then
+// the tokens of the refreshed session. ctx is used by the refreshes.
+func (rp *RelyingParty) TokenSource(ctx context.Context, t *Token) TokenSource {
+	return &refreshingSource{ctx: ctx, rp: rp, t: t}
+}
+
+func (s *refreshingSource) Token() (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.t.Valid() {
+		return s.t, nil
+	}
+	if s.t == nil || s.t.RefreshToken == "" {
+		return nil, ErrSessionExpired
+	}
+	if exp := parseExpiry(s.t.Refresh.Expire); !exp.IsZero() && !time.Now().Before(exp) {
+		return nil, ErrSessionExpired
+	}
+
+	resp, err := s.rp.client.Client.Session.Refresh(s.ctx, authn.ClientSessionRefreshRequest{
+		RefreshToken: s.t.RefreshToken,
+		UserToken:    s.t.AccessToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.t = newToken(&resp.Result.ActiveToken, &resp.Result.RefreshToken)
+	if s.rp.onRefresh != nil {
+		s.rp.onRefresh(s.t)
+	}
+	return s.t, nil
+}
+
+// Transport is an http.RoundTripper authenticating requests with the tokens
+// of Source.
+type Transport struct {
+	Source TokenSource
+
+	// The transport of the requests. Defaults to http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	token, err := t.Source.Token()
+	if err != nil {
+		if r.Body != nil {
+			r.Body.Close()
+		}
+		return nil, err
+	}
+	r = r.Clone(r.Context())
+	token.SetAuthHeader(r)
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(r)
+}
+
+// NewClient returns an HTTP client authenticating its requests with the
+// tokens of ts.
+func NewClient(ts TokenSource) *http.Client {
+	return &http.Client{Transport: &Transport{Source: ts}}
+}
@@ -0,0 +1,239 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrMissingToken is passed to the error handler of the middleware when a
+	// request carries no token.
+	ErrMissingToken = errors.New("authn: missing token")
+
+	// ErrMissingScopes is passed to the error handler of the middleware when
+	// an identity lacks a required scope.
+	ErrMissingScopes = errors.New("authn: missing required scopes")
+)
+
+// MiddlewareErrorHandler writes the response of a request that is not
+// authorized, with status either http.StatusUnauthorized or
+// http.StatusForbidden.
+type MiddlewareErrorHandler func(w http.ResponseWriter, r *http.Request, status int, err error)
+
+type middleware struct {
+	verifier      *TokenVerifier
+	scopes        []string
+	tokenCookie   string
+	refreshCookie string
+	errorHandler  MiddlewareErrorHandler
+
+	mu         sync.Mutex
+	refreshing map[string]*refreshCall
+}
+
+// refreshCall is a session refresh shared by the concurrent requests carrying
+// the same refresh token.
+type refreshCall struct {
+	done   chan struct{}
+	result *ClientSessionRefreshResult
+	err    error
+}
+
+type MiddlewareOption func(*middleware) error
+
+// WithRequiredScopes rejects with 403 Forbidden the identities that lack one
+// of scopes.
+func WithRequiredScopes(scopes ...string) MiddlewareOption {
+	return func(m *middleware) error {
+		m.scopes = scopes
+		return nil
+	}
+}
+
+// WithSessionCookies reads the user token of requests without an
+// Authorization header from the tokenCookie cookie. When it is missing or no
+// longer valid, the session is refreshed with the refreshCookie cookie, and
+// both cookies are set to the new tokens. refreshCookie may be empty to
+// disable refreshes.
+func WithSessionCookies(tokenCookie, refreshCookie string) MiddlewareOption {
+	return func(m *middleware) error {
+		if tokenCookie == "" {
+			return errors.New("authn: empty token cookie name")
+		}
+		m.tokenCookie = tokenCookie
+		m.refreshCookie = refreshCookie
+		return nil
+	}
+}
+
+// WithMiddlewareErrorHandler sets the handler writing the responses of
+// requests that are not authorized. Defaults to a plain text response, with a
+// WWW-Authenticate header for 401 Unauthorized.
+func WithMiddlewareErrorHandler(h MiddlewareErrorHandler) MiddlewareOption {
+	return func(m *middleware) error {
+		if h == nil {
+			return errors.New("authn: nil error handler")
+		}
+		m.errorHandler = h
+		return nil
+	}
+}
+
+func defaultErrorHandler(w http.ResponseWriter, _ *http.Request, status int, _ error) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="authn"`)
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+// NewMiddleware creates net/http middleware authenticating requests with
+// verifier. The user token is read from the Authorization header as a bearer
+// token, or from a session cookie (see WithSessionCookies). The identity of
+// the token is available to the next handler with IdentityFromContext.
+//
+// @example
+//
+//	verifier, err := authn.NewTokenVerifier(authncli)
+//	if err != nil {
+//		return err
+//	}
+//	mw, err := authn.NewMiddleware(verifier,
+//		authn.WithRequiredScopes("admin"),
+//		authn.WithSessionCookies("pangea-token", "pangea-refresh-token"),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//
+//	http.Handle("/admin", mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//		identity, _ := authn.IdentityFromContext(r.Context())
+//		fmt.Fprintf(w, "Hello, %s", identity.Email)
+//	})))
+func NewMiddleware(verifier *TokenVerifier, opts ...MiddlewareOption) (func(http.Handler) http.Handler, error) {
+	if verifier == nil {
+		return nil, errors.New("authn: nil token verifier")
+	}
+	m := &middleware{
+		verifier:     verifier,
+		errorHandler: defaultErrorHandler,
+		refreshing:   map[string]*refreshCall{},
+	}
+	for _, opt := range opts {
+		if err := opt(m); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, err := m.authenticate(w, r)
+			if err != nil {
+				m.errorHandler(w, r, http.StatusUnauthorized, err)
+				return
+			}
+			if !identity.HasScopes(m.scopes...) {
+				m.errorHandler(w, r, http.StatusForbidden, ErrMissingScopes)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ContextWithIdentity(r.Context(), identity)))
+		})
+	}, nil
+}
+
+// authenticate returns the identity of the request, refreshing its session if
+// needed.
+func (m *middleware) authenticate(w http.ResponseWriter, r *http.Request) (*Identity, error) {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		scheme, token, ok := strings.Cut(auth, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return nil, ErrMissingToken
+		}
+		return m.verifier.Verify(r.Context(), strings.TrimSpace(token))
+	}
+	if m.tokenCookie == "" {
+		return nil, ErrMissingToken
+	}
+
+	token := ""
+	if c, err := r.Cookie(m.tokenCookie); err == nil {
+		token = c.Value
+	}
+	err := ErrMissingToken
+	if token != "" {
+		var identity *Identity
+		if identity, err = m.verifier.Verify(r.Context(), token); err == nil {
+			return identity, nil
+		}
+	}
+
+	if m.refreshCookie == "" {
+		return nil, err
+	}
+	c, cerr := r.Cookie(m.refreshCookie)
+	if cerr != nil || c.Value == "" {
+		return nil, err
+	}
+	result, err := m.refresh(r.Context(), c.Value, token)
+	if err != nil {
+		return nil, fmt.Errorf("authn: refreshing session: %w", err)
+	}
+	m.setCookie(w, m.tokenCookie, &result.ActiveToken)
+	m.setCookie(w, m.refreshCookie, &result.RefreshToken)
+	return m.verifier.Verify(r.Context(), result.ActiveToken.Token)
+}
+
+// refresh refreshes a session once for the concurrent requests carrying the
+// same refresh token.
+func (m *middleware) refresh(ctx context.Context, refreshToken, userToken string) (*ClientSessionRefreshResult, error) {
+	m.mu.Lock()
+	call, ok := m.refreshing[refreshToken]
+	if !ok {
+		call = &refreshCall{done: make(chan struct{})}
+		m.refreshing[refreshToken] = call
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		resp, err := m.verifier.client.Client.Session.Refresh(ctx, ClientSessionRefreshRequest{
+			RefreshToken: refreshToken,
+			UserToken:    userToken,
+		})
+		if err != nil {
+			call.err = err
+		} else {
+			call.result = resp.Result
+		}
+		close(call.done)
+
+		m.mu.Lock()
+		delete(m.refreshing, refreshToken)
+		m.mu.Unlock()
+	}
+
+	select {
+	case <-call.done:
+		return call.result, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (m *middleware) setCookie(w http.ResponseWriter, name string, token *LoginToken) {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    token.Token,
+		Path:     "/",
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if t, err := time.Parse(time.RFC3339, token.Expire); err == nil {
+		c.Expires = t
+	}
+	http.SetCookie(w, c)
+}
@@ -0,0 +1,212 @@
+//go:build unit
+
+package authn_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeatesting"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/authn"
+	"github.com/stretchr/testify/assert"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signES256(t *testing.T, kid string, key *ecdsa.PrivateKey, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := b64(header) + "." + b64(payload)
+
+	digest := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	assert.NoError(t, err)
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return input + "." + b64(sig)
+}
+
+type fakeAuthN struct {
+	key      *ecdsa.PrivateKey
+	jwks     atomic.Int32
+	checks   atomic.Int32
+	refreshs atomic.Int32
+}
+
+func setupAuthN(t *testing.T) (*fakeAuthN, *authn.AuthN, func()) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	f := &fakeAuthN{key: key}
+
+	mux.HandleFunc("/v2/client/jwks", func(w http.ResponseWriter, r *http.Request) {
+		f.jwks.Add(1)
+		pub, _ := key.PublicKey.Bytes()
+		fmt.Fprintf(w, `{"request_id": "some-id", "status": "Success", "result": {"keys": [{"alg": "ES256", "kid": "authn-1", "kty": "EC", "crv": "P-256", "x": %q, "y": %q}]}, "summary": "ok"}`, b64(pub[1:33]), b64(pub[33:]))
+	})
+	mux.HandleFunc("/v2/client/token/check", func(w http.ResponseWriter, r *http.Request) {
+		f.checks.Add(1)
+		var input authn.ClientTokenCheckRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+		if input.Token != "pts_opaque" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"request_id": "some-id", "status": "InvalidToken", "result": null, "summary": "invalid token"}`)
+			return
+		}
+		fmt.Fprint(w, `{"request_id": "some-id", "status": "Success", "result": {"id": "pmt_1", "type": "user", "identity": "pui_opaque", "email": "opaque@example.com", "scopes": ["read"], "profile": {"first_name": "Opaque"}, "expire": "2030-01-01T00:00:00Z"}, "summary": "ok"}`)
+	})
+	mux.HandleFunc("/v2/client/session/refresh", func(w http.ResponseWriter, r *http.Request) {
+		f.refreshs.Add(1)
+		var input authn.ClientSessionRefreshRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+		if input.RefreshToken != "ptr_valid" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"request_id": "some-id", "status": "InvalidToken", "result": null, "summary": "invalid token"}`)
+			return
+		}
+		active := signES256(t, "authn-1", key, map[string]any{
+			"sub": "pui_refreshed", "exp": time.Now().Add(time.Hour).Unix(), "scopes": []string{"read"},
+		})
+		fmt.Fprintf(w, `{"request_id": "some-id", "status": "Success", "result": {"active_token": {"token": %q, "expire": "2030-01-01T00:00:00Z"}, "refresh_token": {"token": "ptr_rotated", "expire": "2030-01-02T00:00:00Z"}}, "summary": "ok"}`, active)
+	})
+
+	return f, authn.New(pangeatesting.TestConfig(url)), teardown
+}
+
+func TestTokenVerifier(t *testing.T) {
+	f, client, teardown := setupAuthN(t)
+	defer teardown()
+	ctx := context.Background()
+
+	verifier, err := authn.NewTokenVerifier(client)
+	assert.NoError(t, err)
+
+	token := signES256(t, "authn-1", f.key, map[string]any{
+		"sub":     "pui_1",
+		"email":   "joe@example.com",
+		"scopes":  []string{"read", "write"},
+		"profile": map[string]any{"first_name": "Joe", "age": 42},
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	})
+	for range 2 {
+		identity, err := verifier.Verify(ctx, token)
+		assert.NoError(t, err)
+		assert.Equal(t, "pui_1", identity.UserID)
+		assert.Equal(t, "joe@example.com", identity.Email)
+		assert.True(t, identity.HasScopes("read", "write"))
+		assert.Equal(t, authn.ProfileData{"first_name": "Joe", "age": "42"}, identity.Profile)
+		assert.True(t, identity.VerifiedLocally)
+	}
+	assert.Equal(t, int32(1), f.jwks.Load())
+	assert.Equal(t, int32(0), f.checks.Load())
+
+	// Opaque tokens are checked remotely.
+	identity, err := verifier.Verify(ctx, "pts_opaque")
+	assert.NoError(t, err)
+	assert.Equal(t, "pui_opaque", identity.UserID)
+	assert.Equal(t, authn.Scopes{"read"}, identity.Scopes)
+	assert.False(t, identity.VerifiedLocally)
+	assert.Equal(t, 2030, identity.ExpiresAt.Year())
+
+	expired := signES256(t, "authn-1", f.key, map[string]any{"sub": "pui_1", "exp": time.Now().Add(-time.Hour).Unix()})
+	_, err = verifier.Verify(ctx, expired)
+	assert.ErrorIs(t, err, authn.ErrTokenExpired)
+
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, err = verifier.Verify(ctx, signES256(t, "authn-1", other, map[string]any{"sub": "pui_1"}))
+	assert.ErrorIs(t, err, authn.ErrTokenInvalidSignature)
+}
+
+func TestTokenVerifier_UnknownKey(t *testing.T) {
+	f, client, teardown := setupAuthN(t)
+	defer teardown()
+	ctx := context.Background()
+
+	verifier, err := authn.NewTokenVerifier(client, authn.WithoutTokenCheckFallback())
+	assert.NoError(t, err)
+
+	// The JWKS is fetched again for unknown kids, at most once per refresh
+	// interval.
+	token := signES256(t, "authn-2", f.key, map[string]any{"sub": "pui_1"})
+	for range 2 {
+		_, err = verifier.Verify(ctx, token)
+		assert.ErrorIs(t, err, authn.ErrTokenUnknownKey)
+	}
+	assert.Equal(t, int32(1), f.jwks.Load())
+
+	_, err = verifier.Verify(ctx, "pts_opaque")
+	assert.ErrorIs(t, err, authn.ErrOpaqueToken)
+	assert.Equal(t, int32(0), f.checks.Load())
+}
+
+func TestMiddleware(t *testing.T) {
+	f, client, teardown := setupAuthN(t)
+	defer teardown()
+
+	verifier, err := authn.NewTokenVerifier(client)
+	assert.NoError(t, err)
+	mw, err := authn.NewMiddleware(verifier,
+		authn.WithRequiredScopes("read"),
+		authn.WithSessionCookies("token", "refresh"),
+	)
+	assert.NoError(t, err)
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := authn.IdentityFromContext(r.Context())
+		assert.True(t, ok)
+		fmt.Fprint(w, identity.UserID)
+	}))
+
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer pts_opaque")
+	w := serve(r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "pui_opaque", w.Body.String())
+
+	w = serve(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+signES256(t, "authn-1", f.key, map[string]any{"sub": "pui_1", "scopes": []string{"write"}}))
+	assert.Equal(t, http.StatusForbidden, serve(r).Code)
+
+	// An expired session cookie is refreshed.
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "token", Value: signES256(t, "authn-1", f.key, map[string]any{"sub": "pui_1", "exp": time.Now().Add(-time.Hour).Unix()})})
+	r.AddCookie(&http.Cookie{Name: "refresh", Value: "ptr_valid"})
+	w = serve(r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "pui_refreshed", w.Body.String())
+	cookies := map[string]*http.Cookie{}
+	for _, c := range w.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+	assert.Equal(t, "ptr_rotated", cookies["refresh"].Value)
+	assert.NotEmpty(t, cookies["token"].Value)
+	assert.True(t, cookies["token"].HttpOnly)
+	assert.Equal(t, int32(1), f.refreshs.Load())
+
+	// A session that cannot be refreshed is not authorized.
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "refresh", Value: "ptr_revoked"})
+	assert.Equal(t, http.StatusUnauthorized, serve(r).Code)
+}
@@ -0,0 +1,366 @@
+package authn
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/jose"
+)
+
+var (
+	ErrTokenMalformed        = jose.ErrMalformed
+	ErrTokenInvalidSignature = jose.ErrInvalidSignature
+	ErrTokenUnsupportedAlg   = jose.ErrUnsupportedAlg
+	ErrTokenExpired          = jose.ErrExpired
+	ErrTokenNotYetValid      = jose.ErrNotYetValid
+	ErrTokenInvalidIssuer    = jose.ErrInvalidIssuer
+	ErrTokenInvalidAudience  = jose.ErrInvalidAudience
+
+	// ErrTokenUnknownKey is returned when the key of a token is not in the
+	// JWKS and the Token.Check fallback is disabled.
+	ErrTokenUnknownKey = errors.New("authn: unknown token key")
+
+	// ErrOpaqueToken is returned for tokens that are not JWTs when the
+	// Token.Check fallback is disabled.
+	ErrOpaqueToken = errors.New("authn: opaque token")
+)
+
+// Identity is the identity of a verified token.
+type Identity struct {
+	// The identity of the user or service.
+	UserID  string
+	Email   string
+	Scopes  Scopes
+	Profile ProfileData
+
+	// Zero if the expiration of the token is unknown.
+	ExpiresAt time.Time
+
+	// The verified token.
+	Token string
+
+	// The claims of JWTs, nil for opaque tokens.
+	Claims map[string]any
+
+	// Whether the token was verified locally, rather than by Token.Check.
+	VerifiedLocally bool
+}
+
+// HasScopes reports whether the identity has all of scopes.
+func (i *Identity) HasScopes(scopes ...string) bool {
+	for _, s := range scopes {
+		if !slices.Contains(i.Scopes, s) {
+			return false
+		}
+	}
+	return true
+}
+
+type identityKey struct{}
+
+// ContextWithIdentity returns a copy of ctx carrying identity.
+func ContextWithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the identity carried by ctx, if any, e.g. the
+// one set by the middleware of NewMiddleware.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok && identity != nil
+}
+
+type TokenVerifierOption func(*TokenVerifier) error
+
+// WithTokenIssuer requires JWTs to be issued by iss.
+func WithTokenIssuer(iss string) TokenVerifierOption {
+	return func(v *TokenVerifier) error {
+		v.expected.Issuer = iss
+		return nil
+	}
+}
+
+// WithTokenAudience requires JWTs to be intended for one of aud.
+func WithTokenAudience(aud ...string) TokenVerifierOption {
+	return func(v *TokenVerifier) error {
+		v.expected.Audience = aud
+		return nil
+	}
+}
+
+// WithTokenLeeway sets the clock skew tolerated when validating the exp and
+// nbf claims of JWTs. Defaults to 1 minute.
+func WithTokenLeeway(d time.Duration) TokenVerifierOption {
+	return func(v *TokenVerifier) error {
+		if d < 0 {
+			return errors.New("authn: negative token leeway")
+		}
+		v.expected.Leeway = d
+		return nil
+	}
+}
+
+// WithJWKSMaxAge sets the age after which the JWKS is fetched again, so that
+// rotated keys are picked up. Defaults to 1 hour.
+func WithJWKSMaxAge(d time.Duration) TokenVerifierOption {
+	return func(v *TokenVerifier) error {
+		if d <= 0 {
+			return errors.New("authn: JWKS max age must be positive")
+		}
+		v.maxAge = d
+		return nil
+	}
+}
+
+// WithJWKSRefreshInterval sets the minimum time between two fetches of the
+// JWKS, which bounds the calls made for tokens with unknown kids. Defaults to
+// 1 minute.
+func WithJWKSRefreshInterval(d time.Duration) TokenVerifierOption {
+	return func(v *TokenVerifier) error {
+		v.refreshInterval = d
+		return nil
+	}
+}
+
+// WithoutTokenCheckFallback disables verifying with Token.Check the opaque
+// tokens and the JWTs whose key is not in the JWKS.
+func WithoutTokenCheckFallback() TokenVerifierOption {
+	return func(v *TokenVerifier) error {
+		v.checkFallback = false
+		return nil
+	}
+}
+
+type cachedJWK struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// TokenVerifier verifies AuthN tokens. JWTs are verified locally with the
+// keys of Client.JWKS, cached and fetched again when stale or when a token is
+// signed with an unknown key. Opaque tokens are verified with Client.Token.Check.
+type TokenVerifier struct {
+	client          *AuthN
+	expected        jose.Expected
+	maxAge          time.Duration
+	refreshInterval time.Duration
+	checkFallback   bool
+
+	mu        sync.RWMutex
+	keys      map[string]cachedJWK
+	fetchedAt time.Time
+	refreshed time.Time
+}
+
+// NewTokenVerifier creates a verifier calling AuthN through client.
+//
+// @example
+//
+//	verifier, err := authn.NewTokenVerifier(authncli)
+//	if err != nil {
+//		return err
+//	}
+//
+//	identity, err := verifier.Verify(ctx, token)
+func NewTokenVerifier(client *AuthN, opts ...TokenVerifierOption) (*TokenVerifier, error) {
+	if client == nil {
+		return nil, errors.New("authn: nil client")
+	}
+	v := &TokenVerifier{
+		client:          client,
+		expected:        jose.Expected{Leeway: time.Minute},
+		maxAge:          time.Hour,
+		refreshInterval: time.Minute,
+		checkFallback:   true,
+		keys:            map[string]cachedJWK{},
+	}
+	for _, opt := range opts {
+		if err := opt(v); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// Verify verifies a token and returns its identity.
+func (v *TokenVerifier) Verify(ctx context.Context, token string) (*Identity, error) {
+	jws, err := jose.Parse(token)
+	if errors.Is(err, jose.ErrMalformed) {
+		if !v.checkFallback {
+			return nil, ErrOpaqueToken
+		}
+		return v.check(ctx, token)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := v.resolve(ctx, jws.Header)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		if !v.checkFallback {
+			return nil, ErrTokenUnknownKey
+		}
+		return v.check(ctx, token)
+	}
+	if key.alg != "" && key.alg != jws.Header.Alg {
+		return nil, ErrTokenUnsupportedAlg
+	}
+	if err := jws.Verify(key.key); err != nil {
+		return nil, err
+	}
+
+	registered := &jose.Claims{}
+	if err := json.Unmarshal(jws.Payload, registered); err != nil {
+		return nil, fmt.Errorf("%w: invalid claims", ErrTokenMalformed)
+	}
+	if err := registered.Validate(v.expected); err != nil {
+		return nil, err
+	}
+	identity, err := parseIdentity(jws.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if registered.ExpiresAt != nil {
+		identity.ExpiresAt = registered.ExpiresAt.Time
+	}
+	identity.Token = token
+	identity.VerifiedLocally = true
+	return identity, nil
+}
+
+// check verifies a token with Token.Check.
+func (v *TokenVerifier) check(ctx context.Context, token string) (*Identity, error) {
+	resp, err := v.client.Client.Token.Check(ctx, ClientTokenCheckRequest{Token: token})
+	if err != nil {
+		return nil, err
+	}
+	r := resp.Result
+	identity := &Identity{
+		UserID:  r.Identity,
+		Email:   r.Email,
+		Scopes:  r.Scopes,
+		Profile: r.Profile,
+		Token:   token,
+	}
+	if t, err := time.Parse(time.RFC3339, r.Expire); err == nil {
+		identity.ExpiresAt = t
+	}
+	return identity, nil
+}
+
+// resolve returns the key of the token, or nil if it is not in the JWKS.
+func (v *TokenVerifier) resolve(ctx context.Context, h jose.Header) (*cachedJWK, error) {
+	if !jose.Asymmetric(h.Alg) || h.Kid == "" {
+		return nil, nil
+	}
+
+	v.mu.RLock()
+	key, ok := v.keys[h.Kid]
+	stale := time.Since(v.fetchedAt) >= v.maxAge
+	v.mu.RUnlock()
+
+	if !ok || stale {
+		if err := v.refresh(ctx); err != nil && !ok {
+			return nil, err
+		}
+		// A stale key is kept when the JWKS cannot be fetched.
+		v.mu.RLock()
+		if fresh, found := v.keys[h.Kid]; found {
+			key, ok = fresh, true
+		}
+		v.mu.RUnlock()
+	}
+	if !ok {
+		return nil, nil
+	}
+	return &key, nil
+}
+
+// refresh fetches the JWKS into the cache, unless it was fetched less than the
+// refresh interval ago.
+func (v *TokenVerifier) refresh(ctx context.Context) error {
+	v.mu.Lock()
+	if !v.refreshed.IsZero() && time.Since(v.refreshed) < v.refreshInterval {
+		v.mu.Unlock()
+		return nil
+	}
+	v.refreshed = time.Now()
+	v.mu.Unlock()
+
+	resp, err := v.client.Client.JWKS(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := map[string]cachedJWK{}
+	for _, jwk := range resp.Result.Keys {
+		if jwk.Kid == nil {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[*jwk.Kid] = cachedJWK{alg: jwk.Alg, key: key}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	return nil
+}
+
+// parseIdentity reads the identity of the claims of a JWT: sub, email,
+// scopes (or a space-separated scope) and profile.
+func parseIdentity(payload []byte) (*Identity, error) {
+	raw := map[string]any{}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, fmt.Errorf("%w: invalid claims", ErrTokenMalformed)
+	}
+	var claims struct {
+		Subject string          `json:"sub"`
+		Email   string          `json:"email"`
+		Scopes  Scopes          `json:"scopes"`
+		Scope   string          `json:"scope"`
+		Profile json.RawMessage `json:"profile"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%w: invalid claims", ErrTokenMalformed)
+	}
+
+	identity := &Identity{
+		UserID: claims.Subject,
+		Email:  claims.Email,
+		Scopes: claims.Scopes,
+		Claims: raw,
+	}
+	if identity.Scopes == nil && claims.Scope != "" {
+		identity.Scopes = strings.Fields(claims.Scope)
+	}
+	if len(claims.Profile) > 0 {
+		// Profile values that are not strings are kept as JSON.
+		var profile map[string]any
+		if err := json.Unmarshal(claims.Profile, &profile); err == nil && profile != nil {
+			identity.Profile = ProfileData{}
+			for k, val := range profile {
+				if s, ok := val.(string); ok {
+					identity.Profile[k] = s
+				} else if b, err := json.Marshal(val); err == nil {
+					identity.Profile[k] = string(b)
+				}
+			}
+		}
+	}
+	return identity, nil
+}
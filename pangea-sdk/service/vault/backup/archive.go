@@ -0,0 +1,120 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// ErrIntegrity is returned by Read when an archive was modified, or when the
+// password is wrong.
+var ErrIntegrity = errors.New("backup: archive corrupted or wrong password")
+
+// An archive is a header followed by the gzipped JSON of the Archive, sealed
+// with AES-256-GCM under a key derived from the password with PBKDF2-SHA512.
+// The header is authenticated with the archive.
+//
+//	magic (8) | format (1) | iterations (4) | salt (32) | nonce (12)
+const (
+	magic         = "PVBACKUP"
+	format        = 1
+	iterations    = 210_000
+	saltSize      = 32
+	nonceSize     = 12
+	headerSize    = len(magic) + 1 + 4 + saltSize + nonceSize
+	maxIterations = 10_000_000
+)
+
+func archiveCipher(password string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key := pbkdf2.Key([]byte(password), salt, iterations, 32, sha512.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Write encrypts an archive with password and writes it to w.
+func Write(w io.Writer, a *Archive, password string) error {
+	if password == "" {
+		return errors.New("backup: empty password")
+	}
+
+	var plain bytes.Buffer
+	zw := gzip.NewWriter(&plain)
+	if err := json.NewEncoder(zw).Encode(a); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = append(header, format)
+	header = binary.BigEndian.AppendUint32(header, iterations)
+	random := make([]byte, saltSize+nonceSize)
+	if _, err := rand.Read(random); err != nil {
+		return err
+	}
+	header = append(header, random...)
+	salt, nonce := header[headerSize-nonceSize-saltSize:headerSize-nonceSize], header[headerSize-nonceSize:]
+
+	aead, err := archiveCipher(password, salt, iterations)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err = w.Write(aead.Seal(nil, nonce, plain.Bytes(), header))
+	return err
+}
+
+// Read decrypts an archive written by Write, and checks its integrity.
+func Read(r io.Reader, password string) (*Archive, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < headerSize || string(b[:len(magic)]) != magic {
+		return nil, errors.New("backup: not a Vault backup archive")
+	}
+	if b[len(magic)] != format {
+		return nil, errors.New("backup: unsupported archive format")
+	}
+	n := binary.BigEndian.Uint32(b[len(magic)+1:])
+	if n == 0 || n > maxIterations {
+		return nil, ErrIntegrity
+	}
+	header := b[:headerSize]
+	salt, nonce := header[headerSize-nonceSize-saltSize:headerSize-nonceSize], header[headerSize-nonceSize:]
+
+	aead, err := archiveCipher(password, salt, int(n))
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, nonce, b[headerSize:], header)
+	if err != nil {
+		return nil, ErrIntegrity
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(plain))
+	if err != nil {
+		return nil, err
+	}
+	var a Archive
+	if err := json.NewDecoder(zr).Decode(&a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
@@ -0,0 +1,407 @@
+// Package backup snapshots Vault folder trees and restores them, in the same
+// or another project or region.
+//
+// Snapshot enumerates the items of a folder tree with vault.List, reads their
+// versions with vault.GetBulk and the key material of keys with vault.Export,
+// encrypted with KEM. Write seals a snapshot with a password into an archive
+// whose integrity is checked by Read. Restore recreates the folders with
+// vault.FolderCreate and the items, with their versions, metadata and tags,
+// with the store and rotate endpoints, and maps the IDs of the archived items
+// to the new ones.
+package backup
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+	pangearsa "github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea/rsa"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/vault"
+)
+
+const (
+	listPageSize = 1000
+
+	// The number of items read by a GetBulk request.
+	getBulkSize = 100
+)
+
+// Archive is a snapshot of a Vault folder tree.
+type Archive struct {
+	CreatedAt time.Time `json:"created_at"`
+
+	// The root folder of the snapshot.
+	Folder string `json:"folder"`
+
+	// The folders, parents first, then the other items.
+	Items []Item `json:"items"`
+
+	// The items that could not be archived, e.g. keys that are not
+	// exportable, by ID, with the reason.
+	Skipped map[string]string `json:"skipped,omitempty"`
+}
+
+// Item is an archived Vault item.
+type Item struct {
+	ID                  string         `json:"id"`
+	Type                vault.ItemType `json:"type"`
+	Name                string         `json:"name"`
+	Folder              string         `json:"folder"`
+	Enabled             bool           `json:"enabled"`
+	Metadata            vault.Metadata `json:"metadata,omitempty"`
+	Tags                vault.Tags     `json:"tags,omitempty"`
+	RotationFrequency   string         `json:"rotation_frequency,omitempty"`
+	RotationState       string         `json:"rotation_state,omitempty"`
+	RotationGracePeriod string         `json:"rotation_grace_period,omitempty"`
+	DisabledAt          string         `json:"disabled_at,omitempty"`
+	Algorithm           string         `json:"algorithm,omitempty"`
+	Purpose             string         `json:"purpose,omitempty"`
+	Exportable          *bool          `json:"exportable,omitempty"`
+	ClientID            string         `json:"client_id,omitempty"`
+
+	// The versions with their material, oldest first. Destroyed versions are
+	// not archived, so the versions of restored items are renumbered (see
+	// Report.Versions).
+	Versions []Version `json:"versions,omitempty"`
+}
+
+// Path returns the folder and the name of the item.
+func (i *Item) Path() string {
+	return joinPath(i.Folder, i.Name)
+}
+
+// Version is an archived version of an item.
+type Version struct {
+	Version   int    `json:"version"`
+	State     string `json:"state"`
+	CreatedAt string `json:"created_at,omitempty"`
+
+	// The values of secrets, Pangea tokens and client secrets.
+	Secret         string `json:"secret,omitempty"`
+	Token          string `json:"token,omitempty"`
+	ClientSecret   string `json:"client_secret,omitempty"`
+	ClientSecretID string `json:"client_secret_id,omitempty"`
+
+	// The key pair of an asymmetric key, in PEM format.
+	PublicKey  string `json:"public_key,omitempty"`
+	PrivateKey string `json:"private_key,omitempty"`
+
+	// The key material of a symmetric key.
+	Key []byte `json:"key,omitempty"`
+}
+
+func cleanFolder(folder string) string {
+	return "/" + strings.Trim(folder, "/")
+}
+
+func joinPath(folder, name string) string {
+	return strings.TrimSuffix(cleanFolder(folder), "/") + "/" + name
+}
+
+// inTree reports whether folder is root or one of its subfolders.
+func inTree(folder, root string) bool {
+	folder, root = cleanFolder(folder), cleanFolder(root)
+	return root == "/" || folder == root || strings.HasPrefix(folder, root+"/")
+}
+
+type snapshotter struct {
+	folder    string
+	exportKey *rsa.PrivateKey
+}
+
+type SnapshotOption func(*snapshotter) error
+
+// WithFolder sets the root folder of the snapshot. Defaults to the root of the
+// project.
+func WithFolder(folder string) SnapshotOption {
+	return func(s *snapshotter) error {
+		s.folder = cleanFolder(folder)
+		return nil
+	}
+}
+
+// WithExportKey sets the 4096-bit RSA key pair wrapping the exported keys.
+// Defaults to a key pair generated for the snapshot.
+func WithExportKey(key *rsa.PrivateKey) SnapshotOption {
+	return func(s *snapshotter) error {
+		if key == nil || key.N.BitLen() != 4096 {
+			return errors.New("backup: the export key must be a 4096-bit RSA key")
+		}
+		s.exportKey = key
+		return nil
+	}
+}
+
+// Snapshot reads the items of a folder tree with their versions and material.
+// Keys must be exportable; the ones that are not are reported in
+// Archive.Skipped.
+//
+// @example
+//
+//	archive, err := backup.Snapshot(ctx, vaultcli, backup.WithFolder("/payments"))
+//	if err != nil {
+//		return err
+//	}
+//
+//	err = backup.Write(f, archive, password)
+func Snapshot(ctx context.Context, client vault.Client, opts ...SnapshotOption) (*Archive, error) {
+	if client == nil {
+		return nil, errors.New("backup: nil client")
+	}
+	s := &snapshotter{folder: "/"}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+
+	listed, err := s.list(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Archive{CreatedAt: time.Now().UTC(), Folder: s.folder, Skipped: map[string]string{}}
+	var ids []string
+	for _, item := range listed {
+		if vault.ItemType(item.Type) == vault.ITfolder {
+			a.Items = append(a.Items, newItem(item))
+		} else {
+			ids = append(ids, item.ID)
+		}
+	}
+
+	for chunk := range slices.Chunk(ids, getBulkSize) {
+		items, err := s.get(ctx, client, chunk)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			archived, err := s.archive(ctx, client, item)
+			if err != nil {
+				a.Skipped[item.ID] = err.Error()
+				continue
+			}
+			a.Items = append(a.Items, *archived)
+		}
+	}
+
+	slices.SortStableFunc(a.Items, func(x, y Item) int {
+		return cmp.Or(cmp.Compare(depth(&x), depth(&y)), cmp.Compare(x.Path(), y.Path()))
+	})
+	return a, nil
+}
+
+// depth orders folders by depth, before the other items.
+func depth(i *Item) int {
+	if i.Type != vault.ITfolder {
+		return 1 << 30
+	}
+	return strings.Count(i.Path(), "/")
+}
+
+// get reads the items ids with GetBulk, in the order of ids. Items returned
+// without all their versions or values are read again with Get.
+func (s *snapshotter) get(ctx context.Context, client vault.Client, ids []string) ([]*vault.ItemData, error) {
+	found := map[string]*vault.ItemData{}
+	last := ""
+	for {
+		resp, err := client.GetBulk(ctx, &vault.GetBulkRequest{
+			Filter: pangea.Filter{"id__in": ids},
+			Last:   last,
+			Size:   len(ids),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("backup: getting items: %w", err)
+		}
+		for i := range resp.Result.Items {
+			item := &resp.Result.Items[i]
+			found[item.ID] = item
+		}
+		if resp.Result.Last == "" || len(resp.Result.Items) == 0 {
+			break
+		}
+		last = resp.Result.Last
+	}
+
+	items := make([]*vault.ItemData, 0, len(ids))
+	for _, id := range ids {
+		item, ok := found[id]
+		if !ok || !complete(item) {
+			resp, err := client.Get(ctx, &vault.GetRequest{ID: id, Version: "all"})
+			if err != nil {
+				return nil, fmt.Errorf("backup: getting item %s: %w", id, err)
+			}
+			item = &resp.Result.ItemData
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// complete reports whether item has all its versions and, unless it is a key
+// whose material is exported, their values.
+func complete(item *vault.ItemData) bool {
+	if len(item.ItemVersions) == 0 || len(item.ItemVersions) < item.NumVersions {
+		return false
+	}
+	switch vault.ItemType(item.Type) {
+	case vault.ITsymmetricKey, vault.ITasymmetricKey:
+		return true
+	}
+	for _, iv := range item.ItemVersions {
+		if iv.State != string(vault.IVSdestroyed) && iv.Secret == nil && iv.Token == nil && iv.ClientSecret == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *snapshotter) list(ctx context.Context, client vault.Client) ([]*vault.ItemData, error) {
+	var filter pangea.Filter
+	if s.folder != "/" {
+		filter = pangea.Filter{"folder__contains": []string{s.folder}}
+	}
+
+	var items []*vault.ItemData
+	last := ""
+	for {
+		resp, err := client.List(ctx, &vault.ListRequest{Filter: filter, Last: last, Size: listPageSize})
+		if err != nil {
+			return nil, fmt.Errorf("backup: listing items: %w", err)
+		}
+		for i := range resp.Result.Items {
+			item := &resp.Result.Items[i].ItemData
+			if inTree(item.Folder, s.folder) {
+				items = append(items, item)
+			}
+		}
+		if resp.Result.Last == "" || len(resp.Result.Items) == 0 {
+			return items, nil
+		}
+		last = resp.Result.Last
+	}
+}
+
+func newItem(item *vault.ItemData) Item {
+	return Item{
+		ID:                  item.ID,
+		Type:                vault.ItemType(item.Type),
+		Name:                item.Name,
+		Folder:              cleanFolder(item.Folder),
+		Enabled:             item.Enabled,
+		Metadata:            item.Metadata,
+		Tags:                item.Tags,
+		RotationFrequency:   item.RotationFrequency,
+		RotationState:       item.RotationState,
+		RotationGracePeriod: item.RotationGracePeriod,
+		DisabledAt:          item.DisabledAt,
+		Algorithm:           item.Algorithm,
+		Purpose:             item.Purpose,
+		Exportable:          item.Exportable,
+		ClientID:            item.ClientID,
+	}
+}
+
+// archive reads the material of the versions of an item.
+func (s *snapshotter) archive(ctx context.Context, client vault.Client, item *vault.ItemData) (*Item, error) {
+	archived := newItem(item)
+	versions := slices.Clone(item.ItemVersions)
+	slices.SortFunc(versions, func(x, y vault.ItemVersionData) int {
+		return cmp.Compare(x.Version, y.Version)
+	})
+
+	for _, iv := range versions {
+		if iv.State == string(vault.IVSdestroyed) {
+			continue
+		}
+		v := Version{Version: iv.Version, State: iv.State, CreatedAt: iv.CreatedAt}
+		switch archived.Type {
+		case vault.ITsymmetricKey, vault.ITasymmetricKey:
+			if err := s.export(ctx, client, item.ID, &v); err != nil {
+				return nil, err
+			}
+			if v.PublicKey == "" && iv.PublicKey != nil {
+				v.PublicKey = string(*iv.PublicKey)
+			}
+		default:
+			v.Secret = deref(iv.Secret)
+			v.Token = deref(iv.Token)
+			v.ClientSecret = deref(iv.ClientSecret)
+			v.ClientSecretID = deref(iv.ClientSecretID)
+		}
+		archived.Versions = append(archived.Versions, v)
+	}
+	if len(archived.Versions) == 0 {
+		return nil, errors.New("backup: no version to archive")
+	}
+	return &archived, nil
+}
+
+// export reads the key material of a key version, encrypted with KEM.
+func (s *snapshotter) export(ctx context.Context, client vault.Client, id string, v *Version) error {
+	if s.exportKey == nil {
+		key, err := rsa.GenerateKey(rand.Reader, 4096)
+		if err != nil {
+			return err
+		}
+		s.exportKey = key
+	}
+	publicKey, err := pangearsa.EncodePEMPublicKey(&s.exportKey.PublicKey)
+	if err != nil {
+		return err
+	}
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return err
+	}
+	kemPassword := base64.StdEncoding.EncodeToString(password)
+
+	alg := vault.EEArsa4096_no_padding_kem
+	resp, err := client.Export(ctx, &vault.ExportRequest{
+		ID:                  id,
+		Version:             pangea.Int(v.Version),
+		AsymmetricPublicKey: pangea.String(string(publicKey)),
+		AsymmetricAlgorithm: &alg,
+		KEMPassword:         pangea.String(kemPassword),
+	})
+	if err != nil {
+		return fmt.Errorf("backup: exporting version %d: %w", v.Version, err)
+	}
+	key, err := vault.ExportDecrypt(*resp.Result, vault.ExportDecryptOptions{PrivateKey: s.exportKey, KEMPassword: kemPassword})
+	if err != nil {
+		return fmt.Errorf("backup: exporting version %d: %w", v.Version, err)
+	}
+	v.Key = key.Key
+	v.PrivateKey = string(key.PrivateKeyPEM)
+	v.PublicKey = deref(resp.Result.PublicKey)
+	return nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// Backup takes a snapshot and writes it to w as an archive encrypted with
+// password.
+func Backup(ctx context.Context, client vault.Client, w io.Writer, password string, opts ...SnapshotOption) (*Archive, error) {
+	a, err := Snapshot(ctx, client, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := Write(w, a, password); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
@@ -0,0 +1,349 @@
+package backup
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/vault"
+)
+
+// Report is the result of Restore.
+type Report struct {
+	// The IDs of the restored items by archived ID. Archived folders that
+	// already exist are mapped to the existing ones.
+	IDs map[string]string
+
+	// The versions of the restored items by archived version, by archived ID.
+	// Versions are renumbered from 1, as destroyed versions are not archived
+	// and Pangea tokens and client secrets are restored with their last
+	// version only.
+	Versions map[string]map[int]int
+
+	// The errors of the items that could not be restored, by archived ID.
+	Errors map[string]error
+}
+
+type restorer struct {
+	client vault.Client
+	target string
+
+	// The IDs of the folders of the project, by path.
+	folders map[string]string
+}
+
+type RestoreOption func(*restorer) error
+
+// WithTargetFolder restores the root folder of the archive to folder. Defaults
+// to the root folder of the archive.
+func WithTargetFolder(folder string) RestoreOption {
+	return func(r *restorer) error {
+		r.target = cleanFolder(folder)
+		return nil
+	}
+}
+
+// Restore recreates the items of an archive with the client, e.g. of another
+// project or region, with their names, folders, metadata and tags. Missing
+// folders are created. Items are restored with all their archived versions
+// and their states, except Pangea tokens and client secrets, restored with
+// their last version only. An item that cannot be restored is reported in
+// Report.Errors, and does not stop the restore.
+//
+// @example
+//
+//	archive, err := backup.Read(f, password)
+//	if err != nil {
+//		return err
+//	}
+//
+//	report, err := backup.Restore(ctx, othercli, archive, backup.WithTargetFolder("/restored"))
+//	if err != nil {
+//		return err
+//	}
+//	newID := report.IDs["pvi_..."]
+func Restore(ctx context.Context, client vault.Client, a *Archive, opts ...RestoreOption) (*Report, error) {
+	if client == nil {
+		return nil, errors.New("backup: nil client")
+	}
+	if a == nil {
+		return nil, errors.New("backup: nil archive")
+	}
+	r := &restorer{client: client}
+	for _, opt := range opts {
+		if err := opt(r); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := r.listFolders(ctx); err != nil {
+		return nil, err
+	}
+
+	report := &Report{IDs: map[string]string{}, Versions: map[string]map[int]int{}, Errors: map[string]error{}}
+	for i := range a.Items {
+		item := &a.Items[i]
+		folder := r.mapFolder(a.Folder, item.Folder)
+		if err := r.ensureFolder(ctx, folder); err != nil {
+			report.Errors[item.ID] = err
+			continue
+		}
+
+		var id string
+		var err error
+		if item.Type == vault.ITfolder {
+			id, err = r.restoreFolder(ctx, item, folder)
+		} else {
+			versions := map[int]int{}
+			id, err = r.restoreItem(ctx, item, folder, versions)
+			if len(versions) > 0 {
+				report.Versions[item.ID] = versions
+			}
+		}
+		// Items whose versions are partially restored are reported with
+		// their ID and the error.
+		if id != "" {
+			report.IDs[item.ID] = id
+		}
+		if err != nil {
+			report.Errors[item.ID] = err
+		}
+	}
+	return report, nil
+}
+
+func (r *restorer) listFolders(ctx context.Context) error {
+	r.folders = map[string]string{}
+	last := ""
+	for {
+		resp, err := r.client.List(ctx, &vault.ListRequest{
+			Filter: pangea.Filter{"type": string(vault.ITfolder)},
+			Last:   last,
+			Size:   listPageSize,
+		})
+		if err != nil {
+			return fmt.Errorf("backup: listing folders: %w", err)
+		}
+		for _, item := range resp.Result.Items {
+			if vault.ItemType(item.Type) == vault.ITfolder {
+				r.folders[joinPath(item.Folder, item.Name)] = item.ID
+			}
+		}
+		if resp.Result.Last == "" || len(resp.Result.Items) == 0 {
+			return nil
+		}
+		last = resp.Result.Last
+	}
+}
+
+// mapFolder returns the folder an item of folder is restored to.
+func (r *restorer) mapFolder(root, folder string) string {
+	folder = cleanFolder(folder)
+	if r.target == "" {
+		return folder
+	}
+	rel := strings.TrimPrefix(folder, cleanFolder(root))
+	return cleanFolder(path.Join(r.target, rel))
+}
+
+// ensureFolder creates folder and its parents if they do not exist.
+func (r *restorer) ensureFolder(ctx context.Context, folder string) error {
+	if folder == "/" {
+		return nil
+	}
+	if _, ok := r.folders[folder]; ok {
+		return nil
+	}
+	parent, name := path.Split(folder)
+	parent = cleanFolder(parent)
+	if err := r.ensureFolder(ctx, parent); err != nil {
+		return err
+	}
+	resp, err := r.client.FolderCreate(ctx, &vault.FolderCreateRequest{Name: name, Folder: parent})
+	if err != nil {
+		return fmt.Errorf("backup: creating folder %s: %w", folder, err)
+	}
+	r.folders[folder] = resp.Result.ID
+	return nil
+}
+
+func (r *restorer) restoreFolder(ctx context.Context, item *Item, folder string) (string, error) {
+	p := joinPath(folder, item.Name)
+	if id, ok := r.folders[p]; ok {
+		return id, nil
+	}
+	resp, err := r.client.FolderCreate(ctx, &vault.FolderCreateRequest{
+		Name:                item.Name,
+		Folder:              folder,
+		Metadata:            item.Metadata,
+		Tags:                item.Tags,
+		RotationFrequency:   item.RotationFrequency,
+		RotationState:       vault.ItemVersionState(item.RotationState),
+		RotationGracePeriod: item.RotationGracePeriod,
+	})
+	if err != nil {
+		return "", err
+	}
+	r.folders[p] = resp.Result.ID
+	return resp.Result.ID, nil
+}
+
+// restoreItem restores item, recording the new number of every restored
+// version in versions.
+func (r *restorer) restoreItem(ctx context.Context, item *Item, folder string, versions map[int]int) (string, error) {
+	if len(item.Versions) == 0 {
+		return "", errors.New("backup: no archived version")
+	}
+	common := vault.CommonStoreRequest{
+		Type:              item.Type,
+		Name:              item.Name,
+		Folder:            folder,
+		Metadata:          item.Metadata,
+		Tags:              item.Tags,
+		RotationFrequency: item.RotationFrequency,
+		RotationState:     vault.ItemVersionState(item.RotationState),
+		DisabledAt:        item.DisabledAt,
+	}
+	first, rest := item.Versions[0], item.Versions[1:]
+
+	var id string
+	switch item.Type {
+	case vault.ITsecret:
+		resp, err := r.client.SecretStore(ctx, &vault.SecretStoreRequest{
+			CommonStoreRequest:  common,
+			Secret:              first.Secret,
+			RotationGracePeriod: item.RotationGracePeriod,
+		})
+		if err != nil {
+			return "", err
+		}
+		id = resp.Result.ID
+		versions[first.Version] = 1
+		for i, v := range rest {
+			_, err := r.client.SecretRotate(ctx, &vault.SecretRotateRequest{
+				CommonRotateRequest: vault.CommonRotateRequest{ID: id, RotationState: rotationState(item.Versions[i].State)},
+				Secret:              v.Secret,
+			})
+			if err != nil {
+				return id, fmt.Errorf("backup: restoring version %d: %w", v.Version, err)
+			}
+			versions[v.Version] = i + 2
+		}
+
+	case vault.ITpangeaToken, vault.ITpangeaClientSecret, vault.ITpangeaPlatformClientSecret:
+		last := item.Versions[len(item.Versions)-1]
+		resp, err := r.client.SecretStore(ctx, &vault.SecretStoreRequest{
+			CommonStoreRequest:  common,
+			Token:               last.Token,
+			ClientSecret:        last.ClientSecret,
+			ClientID:            item.ClientID,
+			ClientSecretID:      last.ClientSecretID,
+			RotationGracePeriod: item.RotationGracePeriod,
+		})
+		if err != nil {
+			return "", err
+		}
+		id = resp.Result.ID
+		versions[last.Version] = 1
+
+	case vault.ITsymmetricKey:
+		resp, err := r.client.SymmetricStore(ctx, &vault.SymmetricStoreRequest{
+			CommonStoreRequest: common,
+			Key:                vault.EncodedSymmetricKey(base64.StdEncoding.EncodeToString(first.Key)),
+			Algorithm:          vault.SymmetricAlgorithm(item.Algorithm),
+			Purpose:            vault.KeyPurpose(item.Purpose),
+			Exportable:         item.Exportable,
+		})
+		if err != nil {
+			return "", err
+		}
+		id = resp.Result.ID
+		versions[first.Version] = 1
+		for i, v := range rest {
+			key := vault.EncodedSymmetricKey(base64.StdEncoding.EncodeToString(v.Key))
+			if err := r.rotateKey(ctx, id, item.Versions[i].State, &vault.KeyRotateRequest{Key: &key}); err != nil {
+				return id, fmt.Errorf("backup: restoring version %d: %w", v.Version, err)
+			}
+			versions[v.Version] = i + 2
+		}
+
+	case vault.ITasymmetricKey:
+		resp, err := r.client.AsymmetricStore(ctx, &vault.AsymmetricStoreRequest{
+			CommonStoreRequest: common,
+			Algorithm:          vault.AsymmetricAlgorithm(item.Algorithm),
+			PublicKey:          vault.EncodedPublicKey(first.PublicKey),
+			PrivateKey:         vault.EncodedPrivateKey(first.PrivateKey),
+			Purpose:            vault.KeyPurpose(item.Purpose),
+			Exportable:         item.Exportable,
+		})
+		if err != nil {
+			return "", err
+		}
+		id = resp.Result.ID
+		versions[first.Version] = 1
+		for i, v := range rest {
+			publicKey, privateKey := vault.EncodedPublicKey(v.PublicKey), vault.EncodedPrivateKey(v.PrivateKey)
+			if err := r.rotateKey(ctx, id, item.Versions[i].State, &vault.KeyRotateRequest{PublicKey: &publicKey, PrivateKey: &privateKey}); err != nil {
+				return id, fmt.Errorf("backup: restoring version %d: %w", v.Version, err)
+			}
+			versions[v.Version] = i + 2
+		}
+
+	default:
+		return "", fmt.Errorf("backup: unsupported item type %q", item.Type)
+	}
+
+	if err := r.restoreStates(ctx, id, item, versions); err != nil {
+		return id, err
+	}
+	if !item.Enabled {
+		if _, err := r.client.Update(ctx, &vault.UpdateRequest{ID: id, Enabled: pangea.Bool(false)}); err != nil {
+			return id, fmt.Errorf("backup: disabling item: %w", err)
+		}
+	}
+	return id, nil
+}
+
+func (r *restorer) rotateKey(ctx context.Context, id, previousState string, input *vault.KeyRotateRequest) error {
+	input.CommonRotateRequest = vault.CommonRotateRequest{ID: id, RotationState: rotationState(previousState)}
+	_, err := r.client.KeyRotate(ctx, input)
+	return err
+}
+
+// restoreStates changes the state of the restored versions left by the store
+// and rotate endpoints in another state than their archived one, e.g. the
+// last version if it is not active.
+func (r *restorer) restoreStates(ctx context.Context, id string, item *Item, versions map[int]int) error {
+	last := item.Versions[len(item.Versions)-1].Version
+	for _, v := range item.Versions {
+		restored, ok := versions[v.Version]
+		if !ok || v.State == "" {
+			continue
+		}
+		state := rotationState(v.State)
+		if v.Version == last {
+			state = vault.IVSactive
+		}
+		if vault.ItemVersionState(v.State) == state {
+			continue
+		}
+		_, err := r.client.StateChange(ctx, &vault.StateChangeRequest{ID: id, Version: pangea.Int(restored), State: vault.ItemVersionState(v.State)})
+		if err != nil {
+			return fmt.Errorf("backup: restoring the state of version %d: %w", v.Version, err)
+		}
+	}
+	return nil
+}
+
+// rotationState returns the state to which a restored version transitions
+// when the next one is restored.
+func rotationState(archived string) vault.ItemVersionState {
+	if archived == string(vault.IVSsuspended) {
+		return vault.IVSsuspended
+	}
+	return vault.IVSdeactivated
+}
@@ -0,0 +1,430 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+)
+
+const (
+	defaultBatchConcurrency  = 4
+	defaultBatchMaxItems     = 1000
+	defaultBatchMaxBytes     = 1 << 20
+	defaultBatchRetries      = 2
+	defaultBatchRetryBackoff = 500 * time.Millisecond
+
+	// batchOverhead is an estimate of the size of a structured request besides
+	// its items.
+	batchOverhead = 512
+)
+
+// The filter of the structured data packed by a Batcher.
+const batchFilter = "$.items[*]"
+
+// BatchOperation is the operation a Batcher applies to every item.
+type BatchOperation string
+
+const (
+	BatchEncrypt          BatchOperation = "encrypt"           // EncryptStructured.
+	BatchDecrypt          BatchOperation = "decrypt"           // DecryptStructured.
+	BatchEncryptTransform BatchOperation = "encrypt_transform" // EncryptTransformStructured.
+	BatchDecryptTransform BatchOperation = "decrypt_transform" // DecryptTransformStructured.
+)
+
+// BatchResult is the result of a Batcher for one item.
+type BatchResult struct {
+	// Position of the item in the input.
+	Index int
+
+	// The item, as read from the input.
+	Input string
+
+	// The encrypted or decrypted item. Empty if Err is set.
+	Output string
+
+	// The version of the key used for the item.
+	Version int
+
+	// The tweak of the transform operations. Items encrypted without a
+	// WithBatchTweak option get the tweak of their batch, generated by Vault.
+	Tweak string
+
+	// The error of the item, if any.
+	Err error
+}
+
+// Batcher encrypts or decrypts large numbers of strings with a Vault key. It
+// packs items into structured requests, runs them concurrently and retries
+// them with a backoff when Vault is unavailable. The items of a batch rejected
+// as invalid are retried one by one, so that an invalid item does not fail its
+// whole batch.
+type Batcher struct {
+	client         Client
+	op             BatchOperation
+	id             string
+	concurrency    int
+	maxItems       int
+	maxBytes       int
+	retries        int
+	retryBackoff   time.Duration
+	version        *int
+	additionalData *string
+	tweak          *string
+	alphabet       TransformAlphabet
+}
+
+type BatcherOption func(*Batcher) error
+
+// WithBatchConcurrency sets the maximum number of concurrent requests.
+// Defaults to 4.
+func WithBatchConcurrency(n int) BatcherOption {
+	return func(b *Batcher) error {
+		if n <= 0 {
+			return errors.New("vault: batch concurrency must be positive")
+		}
+		b.concurrency = n
+		return nil
+	}
+}
+
+// WithBatchMaxItems sets the maximum number of items per request. Defaults to
+// 1000.
+func WithBatchMaxItems(n int) BatcherOption {
+	return func(b *Batcher) error {
+		if n <= 0 {
+			return errors.New("vault: batch max items must be positive")
+		}
+		b.maxItems = n
+		return nil
+	}
+}
+
+// WithBatchMaxBytes sets the maximum size of the body of a request. Items
+// larger than the limit are sent alone. Defaults to 1 MiB.
+func WithBatchMaxBytes(n int) BatcherOption {
+	return func(b *Batcher) error {
+		if n <= batchOverhead {
+			return fmt.Errorf("vault: batch max bytes must be greater than %d", batchOverhead)
+		}
+		b.maxBytes = n
+		return nil
+	}
+}
+
+// WithBatchRetries sets the number of retries of a request failing with a 429
+// or 5xx status, and the delay before the first retry, doubled on every retry.
+// Defaults to 2 retries after 500ms.
+func WithBatchRetries(n int, backoff time.Duration) BatcherOption {
+	return func(b *Batcher) error {
+		if n < 0 || backoff < 0 {
+			return errors.New("vault: batch retries and backoff must not be negative")
+		}
+		b.retries = n
+		b.retryBackoff = backoff
+		return nil
+	}
+}
+
+// WithBatchVersion sets the version of the key. Defaults to the current
+// version.
+func WithBatchVersion(version int) BatcherOption {
+	return func(b *Batcher) error {
+		b.version = pangea.Int(version)
+		return nil
+	}
+}
+
+// WithBatchAdditionalData sets the authentication data of all the items.
+func WithBatchAdditionalData(data string) BatcherOption {
+	return func(b *Batcher) error {
+		b.additionalData = pangea.String(data)
+		return nil
+	}
+}
+
+// WithBatchTweak sets the tweak of the transform operations. Required to
+// decrypt.
+func WithBatchTweak(tweak string) BatcherOption {
+	return func(b *Batcher) error {
+		b.tweak = pangea.String(tweak)
+		return nil
+	}
+}
+
+// WithBatchAlphabet sets the alphabet of the transform operations. Defaults to
+// TAalphanumeric.
+func WithBatchAlphabet(alphabet TransformAlphabet) BatcherOption {
+	return func(b *Batcher) error {
+		b.alphabet = alphabet
+		return nil
+	}
+}
+
+// NewBatcher returns a Batcher applying op to items with the key id.
+//
+// @example
+//
+//	batcher, err := vault.NewBatcher(vaultcli, vault.BatchEncrypt, "pvi_...",
+//		vault.WithBatchConcurrency(8))
+//
+//	for r := range batcher.Run(ctx, slices.Values(ssns)) {
+//		if r.Err != nil {
+//			log.Printf("item %d: %v", r.Index, r.Err)
+//			continue
+//		}
+//		encrypted[r.Index] = r.Output
+//	}
+func NewBatcher(client Client, op BatchOperation, id string, opts ...BatcherOption) (*Batcher, error) {
+	b := &Batcher{
+		client:       client,
+		op:           op,
+		id:           id,
+		concurrency:  defaultBatchConcurrency,
+		maxItems:     defaultBatchMaxItems,
+		maxBytes:     defaultBatchMaxBytes,
+		retries:      defaultBatchRetries,
+		retryBackoff: defaultBatchRetryBackoff,
+		alphabet:     TAalphanumeric,
+	}
+	for _, opt := range opts {
+		if err := opt(b); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op {
+	case BatchEncrypt, BatchDecrypt, BatchEncryptTransform:
+	case BatchDecryptTransform:
+		if b.tweak == nil {
+			return nil, errors.New("vault: a tweak is required to decrypt transformed items")
+		}
+	default:
+		return nil, fmt.Errorf("vault: unsupported batch operation %q", op)
+	}
+	return b, nil
+}
+
+// batch is a set of consecutive items processed by a single request.
+type batch struct {
+	results []BatchResult
+	size    int
+	done    chan struct{}
+}
+
+// Run applies the operation of the Batcher to items and yields a result for
+// every item, in the input order. items is read from another goroutine, ahead
+// of the results. Iteration stops when ctx is cancelled or when the caller
+// breaks out of the loop, in which case the remaining items are not read.
+func (b *Batcher) Run(ctx context.Context, items iter.Seq[string]) iter.Seq[BatchResult] {
+	return func(yield func(BatchResult) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// Batches are queued in the input order and processed concurrently.
+		// Up to concurrency batches wait in the queue for the caller, on top
+		// of the ones being processed.
+		queue := make(chan *batch, b.concurrency)
+		go b.produce(ctx, items, queue)
+
+		for bt := range queue {
+			<-bt.done
+			for _, r := range bt.results {
+				if !yield(r) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// produce packs items into batches, starts their processing and queues them.
+func (b *Batcher) produce(ctx context.Context, items iter.Seq[string], queue chan<- *batch) {
+	defer close(queue)
+	sem := make(chan struct{}, b.concurrency)
+
+	var cur *batch
+	flush := func() bool {
+		bt := cur
+		cur = nil
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return false
+		}
+		select {
+		case queue <- bt:
+		case <-ctx.Done():
+			<-sem
+			return false
+		}
+		go func() {
+			defer func() { <-sem }()
+			b.process(ctx, bt)
+			close(bt.done)
+		}()
+		return true
+	}
+
+	index := 0
+	for item := range items {
+		if ctx.Err() != nil {
+			return
+		}
+		encoded, _ := json.Marshal(item)
+		size := len(encoded) + 1
+		if cur != nil && (len(cur.results) >= b.maxItems || cur.size+size > b.maxBytes) {
+			if !flush() {
+				return
+			}
+		}
+		if cur == nil {
+			cur = &batch{size: batchOverhead, done: make(chan struct{})}
+		}
+		cur.results = append(cur.results, BatchResult{Index: index, Input: item})
+		cur.size += size
+		index++
+	}
+	if cur != nil {
+		flush()
+	}
+}
+
+// process runs a batch and, if Vault rejects it as invalid, each of its items
+// alone.
+func (b *Batcher) process(ctx context.Context, bt *batch) {
+	inputs := make([]string, len(bt.results))
+	for i, r := range bt.results {
+		inputs[i] = r.Input
+	}
+	outputs, version, tweak, err := b.retry(ctx, inputs)
+	if err == nil {
+		for i := range bt.results {
+			bt.results[i].Output = outputs[i]
+			bt.results[i].Version = version
+			bt.results[i].Tweak = tweak
+		}
+		return
+	}
+	// Splitting a batch that failed for another reason would only multiply
+	// the requests.
+	if len(bt.results) == 1 || retryable(err) || ctx.Err() != nil {
+		for i := range bt.results {
+			bt.results[i].Err = err
+		}
+		return
+	}
+
+	for i := range bt.results {
+		r := &bt.results[i]
+		outputs, version, tweak, err := b.retry(ctx, []string{r.Input})
+		if err == nil {
+			r.Output, r.Version, r.Tweak = outputs[0], version, tweak
+			continue
+		}
+		r.Err = err
+		if ctx.Err() != nil {
+			for j := i + 1; j < len(bt.results); j++ {
+				bt.results[j].Err = ctx.Err()
+			}
+			return
+		}
+	}
+}
+
+// retry sends a structured request for inputs, and sends it again while it
+// fails with a retryable error, up to the retries of the Batcher.
+func (b *Batcher) retry(ctx context.Context, inputs []string) ([]string, int, string, error) {
+	backoff := b.retryBackoff
+	for attempt := 0; ; attempt++ {
+		outputs, version, tweak, err := b.do(ctx, inputs)
+		if err == nil || attempt >= b.retries || !retryable(err) {
+			return outputs, version, tweak, err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, 0, "", ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// retryable reports whether a request failing with err may succeed later.
+// Requests rejected by Vault as invalid are not retried.
+func retryable(err error) bool {
+	var apiErr *pangea.APIError
+	if errors.As(err, &apiErr) && apiErr.HTTPResponse != nil {
+		code := apiErr.HTTPResponse.StatusCode
+		return code == http.StatusTooManyRequests || code >= 500
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// do sends a structured request for inputs and returns the outputs, in the
+// same order.
+func (b *Batcher) do(ctx context.Context, inputs []string) ([]string, int, string, error) {
+	data := map[string]interface{}{"items": inputs}
+
+	var out map[string]interface{}
+	var version int
+	var tweak string
+	switch b.op {
+	case BatchEncrypt, BatchDecrypt:
+		input := &EncryptStructuredRequest{
+			ID:             b.id,
+			StructuredData: data,
+			Filter:         batchFilter,
+			Version:        b.version,
+			AdditionalData: b.additionalData,
+		}
+		call := b.client.EncryptStructured
+		if b.op == BatchDecrypt {
+			call = b.client.DecryptStructured
+		}
+		resp, err := call(ctx, input)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		out, version = resp.Result.StructuredData, resp.Result.Version
+	default:
+		input := &EncryptTransformStructuredRequest{
+			ID:             b.id,
+			Alphabet:       b.alphabet,
+			StructuredData: data,
+			Filter:         batchFilter,
+			Version:        b.version,
+			AdditionalData: b.additionalData,
+			Tweak:          b.tweak,
+		}
+		call := b.client.EncryptTransformStructured
+		if b.op == BatchDecryptTransform {
+			call = b.client.DecryptTransformStructured
+		}
+		resp, err := call(ctx, input)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		out, version, tweak = resp.Result.StructuredData, resp.Result.Version, resp.Result.Tweak
+		if tweak == "" && b.tweak != nil {
+			tweak = *b.tweak
+		}
+	}
+
+	items, ok := out["items"].([]interface{})
+	if !ok || len(items) != len(inputs) {
+		return nil, 0, "", errors.New("vault: unexpected structured data in batch response")
+	}
+	outputs := make([]string, len(items))
+	for i, item := range items {
+		if outputs[i], ok = item.(string); !ok {
+			return nil, 0, "", errors.New("vault: unexpected structured data in batch response")
+		}
+	}
+	return outputs, version, tweak, nil
+}
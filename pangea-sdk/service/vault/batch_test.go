@@ -0,0 +1,271 @@
+//go:build unit
+
+package vault_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeatesting"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+type batchVault struct {
+	mu       sync.Mutex
+	requests [][]string
+	bodies   []int
+	active   atomic.Int32
+	peak     atomic.Int32
+	failures map[string]int // Items throttled a number of times.
+}
+
+// setupBatchVault mocks the structured endpoints, encrypting items as
+// "enc(item)". Items containing "bad" are rejected.
+func setupBatchVault(t *testing.T) (*batchVault, vault.Client, func()) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	bv := &batchVault{failures: map[string]int{}}
+
+	handle := func(encrypt bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			n := bv.active.Add(1)
+			defer bv.active.Add(-1)
+			for p := bv.peak.Load(); n > p && !bv.peak.CompareAndSwap(p, n); p = bv.peak.Load() {
+			}
+			time.Sleep(5 * time.Millisecond)
+
+			body, _ := io.ReadAll(r.Body)
+			var input struct {
+				StructuredData struct {
+					Items []string `json:"items"`
+				} `json:"structured_data"`
+				Filter string  `json:"filter"`
+				Tweak  *string `json:"tweak"`
+			}
+			assert.NoError(t, json.Unmarshal(body, &input))
+			assert.Equal(t, "$.items[*]", input.Filter)
+			items := input.StructuredData.Items
+
+			bv.mu.Lock()
+			bv.requests = append(bv.requests, items)
+			bv.bodies = append(bv.bodies, len(body))
+			fail := false
+			for _, item := range items {
+				if bv.failures[item] > 0 {
+					bv.failures[item]--
+					fail = true
+				}
+			}
+			bv.mu.Unlock()
+
+			if fail {
+				w.WriteHeader(http.StatusTooManyRequests)
+				fmt.Fprint(w, `{"request_id": "some-id", "status": "TooManyRequests", "result": null, "summary": "too many requests"}`)
+				return
+			}
+			out := make([]string, len(items))
+			for i, item := range items {
+				if strings.Contains(item, "bad") {
+					w.WriteHeader(http.StatusBadRequest)
+					fmt.Fprint(w, `{"request_id": "some-id", "status": "ValidationError", "result": {"errors": []}, "summary": "invalid"}`)
+					return
+				}
+				if encrypt {
+					out[i] = "enc(" + item + ")"
+				} else {
+					out[i] = strings.TrimSuffix(strings.TrimPrefix(item, "enc("), ")")
+				}
+			}
+			tweak := "generated"
+			if input.Tweak != nil {
+				tweak = *input.Tweak
+			}
+			b, _ := json.Marshal(map[string]interface{}{
+				"request_id": "some-id",
+				"status":     "Success",
+				"summary":    "ok",
+				"result": map[string]interface{}{
+					"id":              "pvi_123",
+					"version":         3,
+					"structured_data": map[string]interface{}{"items": out},
+					"tweak":           tweak,
+				},
+			})
+			w.Write(b) //nolint:errcheck
+		}
+	}
+	mux.HandleFunc("/v2/encrypt_structured", handle(true))
+	mux.HandleFunc("/v2/decrypt_structured", handle(false))
+	mux.HandleFunc("/v2/encrypt_transform_structured", handle(true))
+	mux.HandleFunc("/v2/decrypt_transform_structured", handle(false))
+
+	return bv, vault.New(pangeatesting.TestConfig(url)), teardown
+}
+
+func TestBatcher(t *testing.T) {
+	bv, client, teardown := setupBatchVault(t)
+	defer teardown()
+
+	items := make([]string, 95)
+	for i := range items {
+		items[i] = fmt.Sprintf("item-%d", i)
+	}
+	b, err := vault.NewBatcher(client, vault.BatchEncrypt, "pvi_123", vault.WithBatchMaxItems(10), vault.WithBatchConcurrency(3))
+	assert.NoError(t, err)
+
+	var encrypted []string
+	for r := range b.Run(context.Background(), slices.Values(items)) {
+		assert.NoError(t, r.Err)
+		assert.Equal(t, len(encrypted), r.Index)
+		assert.Equal(t, items[r.Index], r.Input)
+		assert.Equal(t, 3, r.Version)
+		encrypted = append(encrypted, r.Output)
+	}
+	assert.Len(t, encrypted, len(items))
+	assert.Equal(t, "enc(item-42)", encrypted[42])
+	assert.Len(t, bv.requests, 10)
+	assert.LessOrEqual(t, bv.peak.Load(), int32(3))
+	assert.Greater(t, bv.peak.Load(), int32(1))
+
+	d, err := vault.NewBatcher(client, vault.BatchDecrypt, "pvi_123")
+	assert.NoError(t, err)
+	var decrypted []string
+	for r := range d.Run(context.Background(), slices.Values(encrypted)) {
+		assert.NoError(t, r.Err)
+		decrypted = append(decrypted, r.Output)
+	}
+	assert.Equal(t, items, decrypted)
+}
+
+func TestBatcher_MaxBytes(t *testing.T) {
+	bv, client, teardown := setupBatchVault(t)
+	defer teardown()
+
+	items := []string{strings.Repeat("a", 400), strings.Repeat("b", 400), strings.Repeat("c", 2000), "d"}
+	b, err := vault.NewBatcher(client, vault.BatchEncrypt, "pvi_123", vault.WithBatchMaxBytes(1024), vault.WithBatchConcurrency(1))
+	assert.NoError(t, err)
+
+	n := 0
+	for r := range b.Run(context.Background(), slices.Values(items)) {
+		assert.NoError(t, r.Err)
+		n++
+	}
+	assert.Equal(t, len(items), n)
+	assert.Equal(t, [][]string{items[:1], items[1:2], items[2:3], items[3:]}, bv.requests)
+	for i, size := range bv.bodies {
+		if i != 2 {
+			assert.LessOrEqual(t, size, 1024)
+		}
+	}
+}
+
+func TestBatcher_ItemErrors(t *testing.T) {
+	bv, client, teardown := setupBatchVault(t)
+	defer teardown()
+
+	// The batch is throttled twice, then rejected as invalid.
+	bv.failures["flaky"] = 2
+	items := []string{"a", "bad", "b", "flaky", "c"}
+	b, err := vault.NewBatcher(client, vault.BatchEncrypt, "pvi_123", vault.WithBatchRetries(2, time.Millisecond))
+	assert.NoError(t, err)
+
+	var results []vault.BatchResult
+	for r := range b.Run(context.Background(), slices.Values(items)) {
+		results = append(results, r)
+	}
+	assert.Len(t, results, len(items))
+	for i, r := range results {
+		assert.Equal(t, i, r.Index)
+		if items[i] == "bad" {
+			assert.Error(t, r.Err)
+			assert.Empty(t, r.Output)
+			continue
+		}
+		assert.NoError(t, r.Err, items[i])
+		assert.Equal(t, "enc("+items[i]+")", r.Output)
+	}
+
+	// Throttled batches are retried as a whole, and only the invalid one is
+	// split. Invalid items are not retried.
+	var sizes []int
+	for _, req := range bv.requests {
+		sizes = append(sizes, len(req))
+	}
+	assert.Equal(t, []int{5, 5, 5, 1, 1, 1, 1, 1}, sizes)
+
+	// Batches keep failing as a whole once retries are exhausted.
+	bv.requests = nil
+	bv.failures["flaky"] = 10
+	b, _ = vault.NewBatcher(client, vault.BatchEncrypt, "pvi_123", vault.WithBatchRetries(1, time.Millisecond))
+	for r := range b.Run(context.Background(), slices.Values([]string{"a", "flaky"})) {
+		assert.Error(t, r.Err)
+	}
+	assert.Equal(t, [][]string{{"a", "flaky"}, {"a", "flaky"}}, bv.requests)
+}
+
+func TestBatcher_Transform(t *testing.T) {
+	bv, client, teardown := setupBatchVault(t)
+	defer teardown()
+
+	b, err := vault.NewBatcher(client, vault.BatchEncryptTransform, "pvi_123", vault.WithBatchAlphabet(vault.TAnumeric))
+	assert.NoError(t, err)
+	for r := range b.Run(context.Background(), slices.Values([]string{"123-456"})) {
+		assert.NoError(t, r.Err)
+		assert.Equal(t, "generated", r.Tweak)
+	}
+
+	_, err = vault.NewBatcher(client, vault.BatchDecryptTransform, "pvi_123")
+	assert.Error(t, err)
+	d, err := vault.NewBatcher(client, vault.BatchDecryptTransform, "pvi_123", vault.WithBatchTweak("MTIzMTIzMT=="))
+	assert.NoError(t, err)
+	for r := range d.Run(context.Background(), slices.Values([]string{"enc(123-456)"})) {
+		assert.NoError(t, r.Err)
+		assert.Equal(t, "123-456", r.Output)
+		assert.Equal(t, "MTIzMTIzMT==", r.Tweak)
+	}
+	assert.Len(t, bv.requests, 2)
+}
+
+func TestBatcher_Break(t *testing.T) {
+	bv, client, teardown := setupBatchVault(t)
+	defer teardown()
+
+	read := atomic.Int32{}
+	items := func(yield func(string) bool) {
+		for i := 0; ; i++ {
+			read.Add(1)
+			if !yield(fmt.Sprintf("item-%d", i)) {
+				return
+			}
+		}
+	}
+	b, err := vault.NewBatcher(client, vault.BatchEncrypt, "pvi_123", vault.WithBatchMaxItems(5), vault.WithBatchConcurrency(2))
+	assert.NoError(t, err)
+
+	n := 0
+	for range b.Run(context.Background(), items) {
+		if n++; n == 12 {
+			break
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	bv.mu.Lock()
+	defer bv.mu.Unlock()
+	// Reading stops after a bounded number of batches.
+	assert.Less(t, len(bv.requests), 10)
+	assert.Less(t, read.Load(), int32(60))
+
+	_, err = vault.NewBatcher(client, vault.BatchOperation("sign"), "pvi_123")
+	assert.Error(t, err)
+	_, err = vault.NewBatcher(client, vault.BatchEncrypt, "pvi_123", vault.WithBatchConcurrency(0))
+	assert.Error(t, err)
+}
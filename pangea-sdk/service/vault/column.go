@@ -0,0 +1,614 @@
+package vault
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefixes of the values stored by EncryptedString and TransformedString.
+// They are followed by the key ID, the key version, the tweak for transformed
+// values, and the cipher text, separated by colons. Stored values are thus not
+// in the format of their plain text, transformed ones included.
+const (
+	encryptedColumnPrefix   = "pvc1"
+	transformedColumnPrefix = "pvt1"
+)
+
+const defaultColumnVersionTTL = 5 * time.Minute
+
+// columnKey is a Vault key registered with RegisterColumnKey.
+type columnKey struct {
+	client     Client
+	id         string
+	alphabet   TransformAlphabet
+	tweak      *string
+	versionTTL time.Duration
+
+	mu        sync.Mutex
+	version   int
+	versionAt time.Time
+}
+
+type ColumnKeyOption func(*columnKey) error
+
+// WithColumnAlphabet sets the alphabet of TransformedString values. Defaults to
+// TAalphanumeric.
+func WithColumnAlphabet(alphabet TransformAlphabet) ColumnKeyOption {
+	return func(k *columnKey) error {
+		k.alphabet = alphabet
+		return nil
+	}
+}
+
+// WithColumnTweak sets the tweak of TransformedString values. Defaults to a
+// tweak generated by Vault for each value.
+func WithColumnTweak(tweak string) ColumnKeyOption {
+	return func(k *columnKey) error {
+		k.tweak = &tweak
+		return nil
+	}
+}
+
+// WithColumnVersionTTL sets how long the current version of the key is cached
+// to detect values encrypted with older versions. Defaults to 5 minutes.
+func WithColumnVersionTTL(d time.Duration) ColumnKeyOption {
+	return func(k *columnKey) error {
+		if d <= 0 {
+			return errors.New("vault: column version TTL must be positive")
+		}
+		k.versionTTL = d
+		return nil
+	}
+}
+
+var columnKeys = struct {
+	sync.RWMutex
+	keys    map[string]*columnKey
+	current *columnKey
+}{keys: map[string]*columnKey{}}
+
+// RegisterColumnKey registers the Vault key keyID, and the client to use it,
+// for EncryptedString and TransformedString values. The most recently
+// registered key encrypts new values. Stored values are decrypted with the key
+// recorded in them, which must be registered too.
+//
+// @example
+//
+//	err := vault.RegisterColumnKey(vaultcli, "pvi_...")
+//
+//	_, err = db.ExecContext(ctx, "INSERT INTO users (id, ssn) VALUES ($1, $2)",
+//		id, vault.NewEncryptedString(ssn))
+func RegisterColumnKey(client Client, keyID string, opts ...ColumnKeyOption) error {
+	if client == nil {
+		return errors.New("vault: nil client")
+	}
+	k := &columnKey{
+		client:     client,
+		id:         keyID,
+		alphabet:   TAalphanumeric,
+		versionTTL: defaultColumnVersionTTL,
+	}
+	for _, opt := range opts {
+		if err := opt(k); err != nil {
+			return err
+		}
+	}
+
+	columnKeys.Lock()
+	defer columnKeys.Unlock()
+	columnKeys.keys[keyID] = k
+	columnKeys.current = k
+	return nil
+}
+
+func lookupColumnKey(keyID string) (*columnKey, error) {
+	columnKeys.RLock()
+	defer columnKeys.RUnlock()
+	if keyID == "" {
+		if columnKeys.current == nil {
+			return nil, errors.New("vault: no column key registered")
+		}
+		return columnKeys.current, nil
+	}
+	k, ok := columnKeys.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("vault: column key %s is not registered", keyID)
+	}
+	return k, nil
+}
+
+// latestVersion returns the current version of the key, cached for the
+// version TTL.
+func (k *columnKey) latestVersion(ctx context.Context) (int, error) {
+	k.mu.Lock()
+	if !k.versionAt.IsZero() && time.Since(k.versionAt) < k.versionTTL {
+		defer k.mu.Unlock()
+		return k.version, nil
+	}
+	k.mu.Unlock()
+
+	_, iv, err := fetchKeyVersion(ctx, k.client, k.id, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.version = max(k.version, iv.Version)
+	k.versionAt = time.Now()
+	return k.version, nil
+}
+
+func (k *columnKey) encrypt(ctx context.Context, transform bool, plainText string) (*columnValue, error) {
+	op, opts := BatchEncrypt, []BatcherOption{}
+	if transform {
+		op = BatchEncryptTransform
+		opts = append(opts, WithBatchAlphabet(k.alphabet))
+		if k.tweak != nil {
+			opts = append(opts, WithBatchTweak(*k.tweak))
+		}
+	}
+	b, err := NewBatcher(k.client, op, k.id, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	var r *BatchResult
+	for res := range b.Run(ctx, slices.Values([]string{plainText})) {
+		r = &res
+	}
+	if r == nil {
+		// Run yields no result only if ctx is done.
+		return nil, ctx.Err()
+	}
+	if r.Err != nil {
+		return nil, r.Err
+	}
+
+	k.mu.Lock()
+	k.version = max(k.version, r.Version)
+	k.mu.Unlock()
+
+	return &columnValue{
+		transform:  transform,
+		keyID:      k.id,
+		version:    r.Version,
+		tweak:      r.Tweak,
+		cipherText: r.Output,
+		plainText:  plainText,
+		decrypted:  true,
+	}, nil
+}
+
+// ColumnBatch decrypts together the EncryptedString and TransformedString
+// values scanned from the rows of a query, on the first read of any of them.
+// Values scanned with their own Scan method are decrypted one by one.
+//
+// @example
+//
+//	batch := vault.NewColumnBatch()
+//	for rows.Next() {
+//		var u user
+//		err := rows.Scan(&u.ID, batch.EncryptedString(&u.SSN))
+//		...
+//	}
+type ColumnBatch struct {
+	mu sync.Mutex
+	// Scanned values waiting to be decrypted.
+	pending []*columnValue
+
+	// Serializes the decryption of the pending values.
+	flushMu sync.Mutex
+}
+
+// NewColumnBatch returns an empty batch, for the values of one query.
+func NewColumnBatch() *ColumnBatch {
+	return &ColumnBatch{}
+}
+
+// EncryptedString returns a sql.Scanner scanning into s, whose value is
+// decrypted with the other values of the batch.
+func (b *ColumnBatch) EncryptedString(s *EncryptedString) sql.Scanner {
+	return columnScanner{batch: b, dst: &s.v}
+}
+
+// TransformedString returns a sql.Scanner scanning into s, whose value is
+// decrypted with the other values of the batch.
+func (b *ColumnBatch) TransformedString(s *TransformedString) sql.Scanner {
+	return columnScanner{batch: b, transform: true, dst: &s.v}
+}
+
+type columnScanner struct {
+	batch     *ColumnBatch
+	transform bool
+	dst       **columnValue
+}
+
+func (s columnScanner) Scan(src any) error {
+	v, err := scanColumn(src, s.transform, s.batch)
+	if err != nil {
+		return err
+	}
+	*s.dst = v
+	return nil
+}
+
+func (b *ColumnBatch) enqueue(v *columnValue) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = append(b.pending, v)
+}
+
+// columnGroup is a set of values decrypted by the same requests.
+type columnGroup struct {
+	keyID     string
+	transform bool
+	version   int
+	tweak     string
+}
+
+// flush decrypts target with all the values of the batch waiting to be
+// decrypted.
+func (b *ColumnBatch) flush(ctx context.Context, target *columnValue) error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	if done, err := target.result(); done {
+		return err
+	}
+
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	groups := map[columnGroup][]*columnValue{}
+	cipherTexts := map[columnGroup][]string{}
+	add := func(v *columnValue) {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		if v.decrypted {
+			return
+		}
+		v.err = nil
+		g := columnGroup{keyID: v.keyID, transform: v.transform, version: v.version, tweak: v.tweak}
+		groups[g] = append(groups[g], v)
+		cipherTexts[g] = append(cipherTexts[g], v.cipherText)
+	}
+	add(target)
+	for _, v := range pending {
+		if v != target {
+			add(v)
+		}
+	}
+
+	for g, values := range groups {
+		k, err := lookupColumnKey(g.keyID)
+		if err != nil {
+			setColumnError(values, err)
+			continue
+		}
+		k.decrypt(ctx, g, values, cipherTexts[g])
+	}
+
+	// The values left encrypted because ctx is done, including the ones
+	// read by other callers, are decrypted by a later flush.
+	for _, values := range groups {
+		for _, v := range values {
+			if done, err := v.result(); !done && err == nil {
+				b.enqueue(v)
+			}
+		}
+	}
+
+	done, err := target.result()
+	if !done && err == nil {
+		if err = ctx.Err(); err == nil {
+			err = errors.New("vault: column value not decrypted")
+		}
+	}
+	return err
+}
+
+func setColumnError(values []*columnValue, err error) {
+	for _, v := range values {
+		v.mu.Lock()
+		v.err = err
+		v.mu.Unlock()
+	}
+}
+
+func (k *columnKey) decrypt(ctx context.Context, g columnGroup, values []*columnValue, cipherTexts []string) {
+	op, opts := BatchDecrypt, []BatcherOption{WithBatchVersion(g.version)}
+	if g.transform {
+		op = BatchDecryptTransform
+		opts = append(opts, WithBatchAlphabet(k.alphabet), WithBatchTweak(g.tweak))
+	}
+
+	b, err := NewBatcher(k.client, op, k.id, opts...)
+	if err != nil {
+		setColumnError(values, err)
+		return
+	}
+	for r := range b.Run(ctx, slices.Values(cipherTexts)) {
+		// The errors of ctx are not the values' own: they are left
+		// encrypted, to be decrypted again.
+		if contextError(r.Err) {
+			continue
+		}
+		v := values[r.Index]
+		v.mu.Lock()
+		v.plainText, v.decrypted, v.err = r.Output, r.Err == nil, r.Err
+		v.mu.Unlock()
+	}
+}
+
+func contextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// columnValue is the state of an EncryptedString or TransformedString,
+// shared by its copies.
+type columnValue struct {
+	mu         sync.Mutex
+	batch      *ColumnBatch
+	transform  bool
+	keyID      string
+	version    int
+	tweak      string
+	cipherText string
+	plainText  string
+	decrypted  bool
+	err        error
+}
+
+// result reports whether the value is decrypted or its decryption failed for
+// good, and the error if it did.
+func (v *columnValue) result() (bool, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.decrypted {
+		return true, nil
+	}
+	if v.err != nil && !retryable(v.err) {
+		return true, v.err
+	}
+	return false, v.err
+}
+
+func (v *columnValue) decrypt(ctx context.Context) (string, error) {
+	done, err := v.result()
+	if err != nil && done {
+		return "", err
+	}
+	if !done {
+		if err := v.batch.flush(ctx, v); err != nil {
+			return "", err
+		}
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.plainText, nil
+}
+
+// value encrypts the value with the current column key if it is not encrypted
+// yet, or if it is encrypted with another key or an older version.
+func (v *columnValue) value() (driver.Value, error) {
+	ctx := context.Background()
+	k, err := lookupColumnKey("")
+	if err != nil {
+		return nil, err
+	}
+
+	v.mu.Lock()
+	encrypted, keyID, version := v.cipherText != "", v.keyID, v.version
+	v.mu.Unlock()
+
+	if encrypted && keyID == k.id {
+		// Rotations are detected on a best effort basis: the value is stored
+		// as is if the current version is unknown.
+		latest, err := k.latestVersion(ctx)
+		if err != nil || version >= latest {
+			return v.encode(), nil
+		}
+	}
+
+	plainText, err := v.decrypt(ctx)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := k.encrypt(ctx, v.transform, plainText)
+	if err != nil {
+		return nil, err
+	}
+
+	v.mu.Lock()
+	v.keyID, v.version, v.tweak, v.cipherText = enc.keyID, enc.version, enc.tweak, enc.cipherText
+	v.mu.Unlock()
+	return v.encode(), nil
+}
+
+func (v *columnValue) encode() string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	version := strconv.Itoa(v.version)
+	if v.transform {
+		return strings.Join([]string{transformedColumnPrefix, v.keyID, version, v.tweak, v.cipherText}, ":")
+	}
+	return strings.Join([]string{encryptedColumnPrefix, v.keyID, version, v.cipherText}, ":")
+}
+
+// scanColumn parses a stored value and queues it for decryption in batch, or
+// alone if batch is nil.
+func scanColumn(src any, transform bool, batch *ColumnBatch) (*columnValue, error) {
+	var s string
+	switch src := src.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		s = src
+	case []byte:
+		s = string(src)
+	default:
+		return nil, fmt.Errorf("vault: cannot scan %T into an encrypted column", src)
+	}
+
+	prefix, n := encryptedColumnPrefix, 4
+	if transform {
+		prefix, n = transformedColumnPrefix, 5
+	}
+	parts := strings.SplitN(s, ":", n)
+	if len(parts) != n || parts[0] != prefix {
+		return nil, errors.New("vault: invalid encrypted column value")
+	}
+	version, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, errors.New("vault: invalid encrypted column value")
+	}
+
+	if _, err := lookupColumnKey(parts[1]); err != nil {
+		return nil, err
+	}
+	if batch == nil {
+		batch = NewColumnBatch()
+	}
+	v := &columnValue{batch: batch, transform: transform, keyID: parts[1], version: version, cipherText: parts[n-1]}
+	if transform {
+		v.tweak = parts[3]
+	}
+	batch.enqueue(v)
+	return v, nil
+}
+
+// EncryptedString is a string column encrypted with Vault. It implements
+// driver.Valuer and sql.Scanner: values are encrypted with the key registered
+// with RegisterColumnKey when written, and decrypted when read with
+// PlainText. The stored value records the key ID and version.
+//
+// Values scanned from the rows of a query through a ColumnBatch are decrypted
+// together, by the first call to PlainText on any of them. Values encrypted with an older version of the key,
+// or with another registered key, are encrypted again with the current one
+// when written, so that rotated keys are phased out as rows are updated.
+//
+// The zero value is NULL.
+type EncryptedString struct {
+	v *columnValue
+}
+
+// NewEncryptedString returns a value to be encrypted when written.
+func NewEncryptedString(plainText string) EncryptedString {
+	return EncryptedString{v: &columnValue{plainText: plainText, decrypted: true}}
+}
+
+// Valid reports whether the value is not NULL.
+func (s EncryptedString) Valid() bool {
+	return s.v != nil
+}
+
+// PlainText returns the decrypted value, or "" if the value is NULL.
+func (s EncryptedString) PlainText(ctx context.Context) (string, error) {
+	if s.v == nil {
+		return "", nil
+	}
+	return s.v.decrypt(ctx)
+}
+
+// KeyVersion returns the ID and version of the key the value is encrypted
+// with, or zero values if it is not encrypted yet.
+func (s EncryptedString) KeyVersion() (string, int) {
+	if s.v == nil {
+		return "", 0
+	}
+	s.v.mu.Lock()
+	defer s.v.mu.Unlock()
+	return s.v.keyID, s.v.version
+}
+
+// Value implements driver.Valuer. Vault is called with a background context.
+func (s EncryptedString) Value() (driver.Value, error) {
+	if s.v == nil {
+		return nil, nil
+	}
+	return s.v.value()
+}
+
+// Scan implements sql.Scanner. The value is decrypted alone, unless scanned
+// through a ColumnBatch.
+func (s *EncryptedString) Scan(src any) error {
+	v, err := scanColumn(src, false, nil)
+	if err != nil {
+		return err
+	}
+	s.v = v
+	return nil
+}
+
+// TransformedString is a string column encrypted with Vault format preserving
+// encryption. It behaves like EncryptedString, and the stored value also
+// records the tweak.
+//
+// The stored value is not format preserving: only its cipher text has the
+// length and alphabet of the plain text, and it is prefixed with the key ID,
+// version and tweak. Columns must be sized and constrained for the stored
+// value, e.g. not CHAR(16) for a card number.
+//
+// The zero value is NULL.
+type TransformedString struct {
+	v *columnValue
+}
+
+// NewTransformedString returns a value to be encrypted when written.
+func NewTransformedString(plainText string) TransformedString {
+	return TransformedString{v: &columnValue{transform: true, plainText: plainText, decrypted: true}}
+}
+
+// Valid reports whether the value is not NULL.
+func (s TransformedString) Valid() bool {
+	return s.v != nil
+}
+
+// PlainText returns the decrypted value, or "" if the value is NULL.
+func (s TransformedString) PlainText(ctx context.Context) (string, error) {
+	if s.v == nil {
+		return "", nil
+	}
+	return s.v.decrypt(ctx)
+}
+
+// KeyVersion returns the ID and version of the key the value is encrypted
+// with, or zero values if it is not encrypted yet.
+func (s TransformedString) KeyVersion() (string, int) {
+	if s.v == nil {
+		return "", 0
+	}
+	s.v.mu.Lock()
+	defer s.v.mu.Unlock()
+	return s.v.keyID, s.v.version
+}
+
+// Value implements driver.Valuer. Vault is called with a background context.
+func (s TransformedString) Value() (driver.Value, error) {
+	if s.v == nil {
+		return nil, nil
+	}
+	return s.v.value()
+}
+
+// Scan implements sql.Scanner. The value is decrypted alone, unless scanned
+// through a ColumnBatch.
+func (s *TransformedString) Scan(src any) error {
+	v, err := scanColumn(src, true, nil)
+	if err != nil {
+		return err
+	}
+	s.v = v
+	return nil
+}
@@ -0,0 +1,232 @@
+//go:build unit
+
+package vault_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeatesting"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+// columnVault fakes the structured endpoints. Cipher texts are
+// "<version>x<plain text>", reversed for transforms.
+type columnVault struct {
+	mu       sync.Mutex
+	latest   int
+	encrypts int
+	decrypts [][]any
+	tweaks   []string
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+func setupColumnVault(t *testing.T, keyID string, opts ...vault.ColumnKeyOption) (*columnVault, func()) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	f := &columnVault{latest: 1}
+
+	mux.HandleFunc("/v2/get", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		fmt.Fprintf(w, `{"request_id": "some-id", "status": "Success", "result": {"id": %q, "type": "symmetric_key", "item_versions": [{"version": %d, "state": "active"}]}, "summary": "ok"}`, keyID, f.latest)
+	})
+	handle := func(path string, transform, decrypt bool) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			var input struct {
+				StructuredData struct {
+					Items []string `json:"items"`
+				} `json:"structured_data"`
+				Version *int    `json:"version"`
+				Tweak   *string `json:"tweak"`
+			}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+			version := f.latest
+			if input.Version != nil {
+				version = *input.Version
+			}
+			tweak := "generated"
+			if input.Tweak != nil {
+				tweak = *input.Tweak
+			}
+			prefix := fmt.Sprintf("%dx", version)
+
+			items := make([]any, len(input.StructuredData.Items))
+			for i, item := range input.StructuredData.Items {
+				if decrypt {
+					if transform {
+						item = reverse(item)
+					}
+					assert.True(t, strings.HasPrefix(item, prefix), "%s is not encrypted with version %d", item, version)
+					items[i] = strings.TrimPrefix(item, prefix)
+				} else {
+					item = prefix + item
+					if transform {
+						item = reverse(item)
+					}
+					items[i] = item
+				}
+			}
+			if decrypt {
+				f.decrypts = append(f.decrypts, items)
+				f.tweaks = append(f.tweaks, tweak)
+			} else {
+				f.encrypts++
+			}
+			b, _ := json.Marshal(map[string]any{"id": keyID, "version": version, "tweak": tweak, "structured_data": map[string]any{"items": items}})
+			fmt.Fprintf(w, `{"request_id": "some-id", "status": "Success", "result": %s, "summary": "ok"}`, b)
+		})
+	}
+	handle("/v2/encrypt_structured", false, false)
+	handle("/v2/decrypt_structured", false, true)
+	handle("/v2/encrypt_transform_structured", true, false)
+	handle("/v2/decrypt_transform_structured", true, true)
+
+	assert.NoError(t, vault.RegisterColumnKey(vault.New(pangeatesting.TestConfig(url)), keyID, opts...))
+	return f, teardown
+}
+
+func TestEncryptedString(t *testing.T) {
+	f, teardown := setupColumnVault(t, "pvi_column")
+	defer teardown()
+	ctx := context.Background()
+
+	stored, err := vault.NewEncryptedString("123-45-6789").Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "pvc1:pvi_column:1:1x123-45-6789", stored)
+
+	// The rows of a batch are decrypted together on first read, without
+	// the values of other batches.
+	batch, other := vault.NewColumnBatch(), vault.NewColumnBatch()
+	var unread vault.EncryptedString
+	assert.NoError(t, other.EncryptedString(&unread).Scan("pvc1:pvi_column:1:1xunread"))
+	rows := make([]vault.EncryptedString, 3)
+	for i := range rows {
+		assert.NoError(t, batch.EncryptedString(&rows[i]).Scan([]byte(fmt.Sprintf("pvc1:pvi_column:1:1xrow%d", i))))
+	}
+	for i, row := range rows {
+		plainText, err := row.PlainText(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("row%d", i), plainText)
+	}
+	assert.Equal(t, [][]any{{"row0", "row1", "row2"}}, f.decrypts)
+
+	// Values scanned on their own are decrypted alone.
+	var single vault.EncryptedString
+	assert.NoError(t, single.Scan("pvc1:pvi_column:1:1xsingle"))
+	plainText, err := single.PlainText(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "single", plainText)
+	assert.Equal(t, []any{"single"}, f.decrypts[len(f.decrypts)-1])
+
+	// Unchanged values are stored as they are.
+	stored, err = rows[0].Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "pvc1:pvi_column:1:1xrow0", stored)
+	assert.Equal(t, 1, f.encrypts)
+
+	var null vault.EncryptedString
+	assert.NoError(t, null.Scan(nil))
+	assert.False(t, null.Valid())
+	stored, err = null.Value()
+	assert.NoError(t, err)
+	assert.Nil(t, stored)
+}
+
+func TestEncryptedString_Rotation(t *testing.T) {
+	f, teardown := setupColumnVault(t, "pvi_rotated")
+	defer teardown()
+	f.latest = 2
+
+	var old, current vault.EncryptedString
+	assert.NoError(t, old.Scan("pvc1:pvi_rotated:1:1xold"))
+	assert.NoError(t, current.Scan("pvc1:pvi_rotated:2:2xcurrent"))
+
+	// Values encrypted with an older version are encrypted again when written.
+	stored, err := old.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "pvc1:pvi_rotated:2:2xold", stored)
+	id, version := old.KeyVersion()
+	assert.Equal(t, "pvi_rotated", id)
+	assert.Equal(t, 2, version)
+
+	stored, err = current.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "pvc1:pvi_rotated:2:2xcurrent", stored)
+	assert.Equal(t, 1, f.encrypts)
+
+	// Both versions were decrypted, in separate batches.
+	plainText, err := current.PlainText(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "current", plainText)
+	assert.ElementsMatch(t, [][]any{{"old"}, {"current"}}, f.decrypts)
+}
+
+func TestTransformedString(t *testing.T) {
+	f, teardown := setupColumnVault(t, "pvi_transform", vault.WithColumnAlphabet(vault.TAnumeric))
+	defer teardown()
+
+	stored, err := vault.NewTransformedString("4111").Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "pvt1:pvi_transform:1:generated:1114x1", stored)
+
+	var s vault.TransformedString
+	assert.NoError(t, s.Scan(stored))
+	plainText, err := s.PlainText(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "4111", plainText)
+	assert.Equal(t, []string{"generated"}, f.tweaks)
+
+	// An EncryptedString cannot be scanned as a TransformedString.
+	assert.Error(t, s.Scan("pvc1:pvi_transform:1:1x4111"))
+}
+
+func TestEncryptedString_Errors(t *testing.T) {
+	_, teardown := setupColumnVault(t, "pvi_errors")
+	defer teardown()
+
+	var s vault.EncryptedString
+	assert.ErrorContains(t, s.Scan("pvc1:pvi_unknown:1:1xvalue"), "not registered")
+	assert.Error(t, s.Scan("plain text"))
+	assert.Error(t, s.Scan("pvc1:pvi_errors:one:1xvalue"))
+	assert.Error(t, s.Scan(42))
+}
+
+func TestEncryptedString_CanceledContext(t *testing.T) {
+	f, teardown := setupColumnVault(t, "pvi_canceled")
+	defer teardown()
+
+	batch := vault.NewColumnBatch()
+	var a, b vault.EncryptedString
+	assert.NoError(t, batch.EncryptedString(&a).Scan("pvc1:pvi_canceled:1:1xa"))
+	assert.NoError(t, batch.EncryptedString(&b).Scan("pvc1:pvi_canceled:1:1xb"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := a.PlainText(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// Neither the canceled value nor the other values of the batch are
+	// failed for good.
+	plainText, err := a.PlainText(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "a", plainText)
+	plainText, err = b.PlainText(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "b", plainText)
+	assert.ElementsMatch(t, []any{"a", "b"}, f.decrypts[len(f.decrypts)-1])
+}
@@ -276,7 +276,7 @@ func NewFilterList() *FilterList {
 		destroyedAt:  pangea.NewFilterRange[string]("destroyed_at", &filter),
 		expiration:   pangea.NewFilterRange[string]("expiration", &filter),
 		lastRotated:  pangea.NewFilterRange[string]("last_rotated", &filter),
-		nextRotation: pangea.NewFilterRange[string]("last_rotation", &filter),
+		nextRotation: pangea.NewFilterRange[string]("next_rotation", &filter),
 	}
 }
 
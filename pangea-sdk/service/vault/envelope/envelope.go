@@ -0,0 +1,425 @@
+// Package envelope implements envelope encryption with Vault-managed key
+// encryption keys.
+//
+// Data is encrypted locally with a random AES-256-GCM data key, in chunks so
+// that streams of any size can be encrypted and decrypted with bounded memory.
+// The data key is wrapped with vault.Encrypt under a Vault symmetric key, and
+// stored with the key ID and version in a header preceding the chunks. Only
+// the data key is sent to Vault.
+//
+// Each chunk is sealed with a nonce made of a random prefix, the chunk index
+// and a flag marking the last chunk, so that reordered, duplicated or
+// truncated chunks are detected. The fields of the header that never change,
+// i.e. all but the wrapped data key and its version, are the additional data
+// of every chunk, so that they cannot be modified either. Swapping the wrapped
+// data key fails as it unwraps to another data key.
+package envelope
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/vault"
+)
+
+const (
+	magic            = "PVE1"
+	algorithm        = "AES-GCM-256"
+	keySize          = 32
+	noncePrefixSize  = 7
+	defaultChunkSize = 64 * 1024
+	maxChunkSize     = 16 * 1024 * 1024
+	maxHeaderSize    = 64 * 1024
+)
+
+var (
+	ErrInvalidFormat = errors.New("envelope: invalid format")
+	ErrAuthFailed    = errors.New("envelope: message authentication failed")
+)
+
+// Header describes an encrypted stream.
+type Header struct {
+	// The ID of the Vault key wrapping the data key.
+	KeyID string `json:"key_id"`
+
+	// The version of the Vault key wrapping the data key.
+	KeyVersion int `json:"key_version"`
+
+	// The algorithm of the data key.
+	Algorithm string `json:"algorithm"`
+
+	// The data key, as encrypted by Vault.
+	WrappedKey string `json:"wrapped_key"`
+
+	// The size of the plaintext of each chunk but the last.
+	ChunkSize int `json:"chunk_size"`
+
+	// The random prefix of the chunk nonces.
+	NoncePrefix []byte `json:"nonce_prefix"`
+}
+
+type options struct {
+	chunkSize int
+}
+
+type Option func(*options) error
+
+// WithChunkSize sets the size of the plaintext of each chunk. Defaults to 64
+// KiB.
+func WithChunkSize(size int) Option {
+	return func(o *options) error {
+		if size <= 0 || size > maxChunkSize {
+			return fmt.Errorf("envelope: chunk size must be between 1 and %v", maxChunkSize)
+		}
+		o.chunkSize = size
+		return nil
+	}
+}
+
+// ReadHeader reads the header of an encrypted stream, leaving r at the first
+// chunk.
+func ReadHeader(r io.Reader) (*Header, error) {
+	prefix := make([]byte, len(magic)+4)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, ErrInvalidFormat
+	}
+	if string(prefix[:len(magic)]) != magic {
+		return nil, ErrInvalidFormat
+	}
+	size := binary.BigEndian.Uint32(prefix[len(magic):])
+	if size > maxHeaderSize {
+		return nil, ErrInvalidFormat
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, ErrInvalidFormat
+	}
+
+	var h Header
+	if err := json.Unmarshal(b, &h); err != nil {
+		return nil, ErrInvalidFormat
+	}
+	if h.Algorithm != algorithm || h.ChunkSize <= 0 || h.ChunkSize > maxChunkSize || len(h.NoncePrefix) != noncePrefixSize {
+		return nil, ErrInvalidFormat
+	}
+	return &h, nil
+}
+
+func writeHeader(w io.Writer, h *Header) error {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	prefix := make([]byte, len(magic)+4)
+	copy(prefix, magic)
+	binary.BigEndian.PutUint32(prefix[len(magic):], uint32(len(b)))
+	if _, err := w.Write(prefix); err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// aad returns the additional data of the chunks: the format and the fields of
+// h kept by Rewrap.
+func (h *Header) aad() []byte {
+	b := []byte(magic)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(h.KeyID)))
+	b = append(b, h.KeyID...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(h.Algorithm)))
+	b = append(b, h.Algorithm...)
+	b = binary.BigEndian.AppendUint32(b, uint32(h.ChunkSize))
+	return append(b, h.NoncePrefix...)
+}
+
+func wrapKey(ctx context.Context, client vault.Client, keyID string, key []byte) (string, int, error) {
+	resp, err := client.Encrypt(ctx, &vault.EncryptRequest{
+		ID:        keyID,
+		PlainText: base64.StdEncoding.EncodeToString(key),
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return resp.Result.CipherText, resp.Result.Version, nil
+}
+
+func unwrapKey(ctx context.Context, client vault.Client, h *Header) ([]byte, error) {
+	resp, err := client.Decrypt(ctx, &vault.DecryptRequest{
+		ID:         h.KeyID,
+		CipherText: h.WrappedKey,
+		Version:    pangea.Int(h.KeyVersion),
+	})
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(resp.Result.PlainText)
+	if err != nil || len(key) != keySize {
+		return nil, errors.New("envelope: invalid data key")
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(prefix []byte, index uint32, last bool) []byte {
+	nonce := make([]byte, noncePrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], index)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+type writer struct {
+	dst    io.Writer
+	aead   cipher.AEAD
+	header *Header
+	aad    []byte
+	buf    []byte
+	index  uint32
+	closed bool
+}
+
+// NewWriter returns a writer encrypting to dst under the Vault key keyID. The
+// header is written immediately, and the last chunk on Close, which must be
+// called.
+//
+// @example
+//
+//	w, err := envelope.NewWriter(ctx, vaultcli, "pvi_...", f)
+//	if err != nil {
+//		return err
+//	}
+//	if _, err := io.Copy(w, src); err != nil {
+//		return err
+//	}
+//	err = w.Close()
+func NewWriter(ctx context.Context, client vault.Client, keyID string, dst io.Writer, opts ...Option) (io.WriteCloser, error) {
+	o := options{chunkSize: defaultChunkSize}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, noncePrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, version, err := wrapKey(ctx, client, keyID, key)
+	if err != nil {
+		return nil, err
+	}
+	h := &Header{
+		KeyID:       keyID,
+		KeyVersion:  version,
+		Algorithm:   algorithm,
+		WrappedKey:  wrapped,
+		ChunkSize:   o.chunkSize,
+		NoncePrefix: prefix,
+	}
+	if err := writeHeader(dst, h); err != nil {
+		return nil, err
+	}
+
+	return &writer{
+		dst:    dst,
+		aead:   aead,
+		header: h,
+		aad:    h.aad(),
+		buf:    make([]byte, 0, o.chunkSize),
+	}, nil
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("envelope: write to closed writer")
+	}
+	n := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data arrives, as the last chunk
+		// is sealed differently.
+		if len(w.buf) == w.header.ChunkSize {
+			if err := w.seal(false); err != nil {
+				return n, err
+			}
+		}
+		c := copy(w.buf[len(w.buf):w.header.ChunkSize], p)
+		w.buf = w.buf[:len(w.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.seal(true)
+}
+
+func (w *writer) seal(last bool) error {
+	if w.index == ^uint32(0) {
+		return errors.New("envelope: too many chunks")
+	}
+	out := w.aead.Seal(nil, chunkNonce(w.header.NoncePrefix, w.index, last), w.buf, w.aad)
+	w.index++
+	w.buf = w.buf[:0]
+	_, err := w.dst.Write(out)
+	return err
+}
+
+type reader struct {
+	src    *bufio.Reader
+	aead   cipher.AEAD
+	header *Header
+	aad    []byte
+	chunk  []byte
+	plain  []byte
+	index  uint32
+	done   bool
+	err    error
+}
+
+// NewReader returns a reader decrypting src, unwrapping its data key through
+// client. It returns ErrAuthFailed if the data was modified.
+func NewReader(ctx context.Context, client vault.Client, src io.Reader) (io.Reader, error) {
+	h, err := ReadHeader(src)
+	if err != nil {
+		return nil, err
+	}
+	key, err := unwrapKey(ctx, client, h)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	sealedSize := h.ChunkSize + aead.Overhead()
+	return &reader{
+		src:    bufio.NewReaderSize(src, sealedSize+1),
+		aead:   aead,
+		header: h,
+		aad:    h.aad(),
+		chunk:  make([]byte, sealedSize),
+	}, nil
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.open()
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// open reads and opens the next chunk.
+func (r *reader) open() error {
+	n, err := io.ReadFull(r.src, r.chunk)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	last := n < len(r.chunk)
+	if !last {
+		if _, err := r.src.Peek(1); err == io.EOF {
+			last = true
+		}
+	}
+
+	plain, err := r.aead.Open(r.chunk[:0], chunkNonce(r.header.NoncePrefix, r.index, last), r.chunk[:n], r.aad)
+	if err != nil {
+		return ErrAuthFailed
+	}
+	r.index++
+	r.plain = plain
+	r.done = last
+	return nil
+}
+
+// Encrypt encrypts src to dst under the Vault key keyID.
+func Encrypt(ctx context.Context, client vault.Client, keyID string, dst io.Writer, src io.Reader, opts ...Option) error {
+	w, err := NewWriter(ctx, client, keyID, dst, opts...)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// Decrypt decrypts src to dst. Data written to dst is only authenticated once
+// Decrypt returns without error.
+func Decrypt(ctx context.Context, client vault.Client, dst io.Writer, src io.Reader) error {
+	r, err := NewReader(ctx, client, src)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, r)
+	return err
+}
+
+// Rewrap copies src to dst with its data key wrapped under the current
+// version of its Vault key, e.g. after KeyRotate. The chunks are copied as is.
+// It returns the new header.
+func Rewrap(ctx context.Context, client vault.Client, dst io.Writer, src io.Reader) (*Header, error) {
+	h, err := ReadHeader(src)
+	if err != nil {
+		return nil, err
+	}
+	key, err := unwrapKey(ctx, client, h)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, version, err := wrapKey(ctx, client, h.KeyID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	rewrapped := *h
+	rewrapped.WrappedKey = wrapped
+	rewrapped.KeyVersion = version
+	if err := writeHeader(dst, &rewrapped); err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		return nil, err
+	}
+	return &rewrapped, nil
+}
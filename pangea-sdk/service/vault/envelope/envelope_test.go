@@ -0,0 +1,130 @@
+//go:build unit
+
+package envelope_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeatesting"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/vault"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/vault/envelope"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupVault mocks Vault wrapping data keys with the current key version.
+func setupVault(t *testing.T) (vault.Client, *atomic.Int32, func()) {
+	mux, url, teardown := pangeatesting.SetupServer()
+
+	var version atomic.Int32
+	version.Store(1)
+	mux.HandleFunc("/v2/encrypt", func(w http.ResponseWriter, r *http.Request) {
+		var input vault.EncryptRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+		v := version.Load()
+		fmt.Fprintf(w, `{"request_id": "some-id", "status": "Success", "result": {"id": %q, "version": %v, "algorithm": "AES-GCM-256", "cipher_text": "v%v:%v"}, "summary": "ok"}`, input.ID, v, v, input.PlainText)
+	})
+	mux.HandleFunc("/v2/decrypt", func(w http.ResponseWriter, r *http.Request) {
+		var input vault.DecryptRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+		prefix := fmt.Sprintf("v%v:", *input.Version)
+		assert.True(t, strings.HasPrefix(input.CipherText, prefix))
+		fmt.Fprintf(w, `{"request_id": "some-id", "status": "Success", "result": {"id": %q, "version": %v, "algorithm": "AES-GCM-256", "plain_text": %q}, "summary": "ok"}`, input.ID, *input.Version, strings.TrimPrefix(input.CipherText, prefix))
+	})
+
+	return vault.New(pangeatesting.TestConfig(url)), &version, teardown
+}
+
+// splitHeader splits an encrypted stream into its header and chunks.
+func splitHeader(t *testing.T, b []byte) (*envelope.Header, []byte) {
+	h, err := envelope.ReadHeader(bytes.NewReader(b))
+	assert.NoError(t, err)
+	return h, b[8+binary.BigEndian.Uint32(b[4:8]):]
+}
+
+func encodeHeader(h *envelope.Header) []byte {
+	b, _ := json.Marshal(h)
+	return append(binary.BigEndian.AppendUint32([]byte("PVE1"), uint32(len(b))), b...)
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	client, _, teardown := setupVault(t)
+	defer teardown()
+	ctx := context.Background()
+
+	for _, size := range []int{0, 1, 15, 16, 17, 48, 1000} {
+		plain := make([]byte, size)
+		rand.Read(plain) //nolint:errcheck
+
+		var sealed bytes.Buffer
+		assert.NoError(t, envelope.Encrypt(ctx, client, "pvi_123", &sealed, bytes.NewReader(plain), envelope.WithChunkSize(16)))
+
+		h, err := envelope.ReadHeader(bytes.NewReader(sealed.Bytes()))
+		assert.NoError(t, err)
+		assert.Equal(t, "pvi_123", h.KeyID)
+		assert.Equal(t, 1, h.KeyVersion)
+		assert.Equal(t, 16, h.ChunkSize)
+
+		var opened bytes.Buffer
+		assert.NoError(t, envelope.Decrypt(ctx, client, &opened, bytes.NewReader(sealed.Bytes())), size)
+		assert.Equal(t, plain, opened.Bytes(), size)
+	}
+}
+
+func TestDecrypt_Tampered(t *testing.T) {
+	client, _, teardown := setupVault(t)
+	defer teardown()
+	ctx := context.Background()
+
+	var sealed bytes.Buffer
+	assert.NoError(t, envelope.Encrypt(ctx, client, "pvi_123", &sealed, strings.NewReader(strings.Repeat("a", 40)), envelope.WithChunkSize(16)))
+	b := sealed.Bytes()
+
+	flipped := bytes.Clone(b)
+	flipped[len(flipped)-1] ^= 1
+	assert.ErrorIs(t, envelope.Decrypt(ctx, client, &bytes.Buffer{}, bytes.NewReader(flipped)), envelope.ErrAuthFailed)
+
+	// Dropping the last chunk is detected.
+	truncated := b[:len(b)-(40-32+16)]
+	assert.ErrorIs(t, envelope.Decrypt(ctx, client, &bytes.Buffer{}, bytes.NewReader(truncated)), envelope.ErrAuthFailed)
+
+	assert.ErrorIs(t, envelope.Decrypt(ctx, client, &bytes.Buffer{}, strings.NewReader("garbage")), envelope.ErrInvalidFormat)
+
+	// The header is bound to the chunks, even if the data key still unwraps.
+	h, chunks := splitHeader(t, b)
+	h.KeyID = "pvi_456"
+	swapped := append(encodeHeader(h), chunks...)
+	assert.ErrorIs(t, envelope.Decrypt(ctx, client, &bytes.Buffer{}, bytes.NewReader(swapped)), envelope.ErrAuthFailed)
+}
+
+func TestRewrap(t *testing.T) {
+	client, version, teardown := setupVault(t)
+	defer teardown()
+	ctx := context.Background()
+
+	var sealed bytes.Buffer
+	assert.NoError(t, envelope.Encrypt(ctx, client, "pvi_123", &sealed, strings.NewReader("hello world")))
+
+	version.Store(2)
+	var rewrapped bytes.Buffer
+	h, err := envelope.Rewrap(ctx, client, &rewrapped, bytes.NewReader(sealed.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, h.KeyVersion)
+
+	// The payload is unchanged.
+	_, oldChunks := splitHeader(t, sealed.Bytes())
+	_, newChunks := splitHeader(t, rewrapped.Bytes())
+	assert.Equal(t, oldChunks, newChunks)
+
+	var opened bytes.Buffer
+	assert.NoError(t, envelope.Decrypt(ctx, client, &opened, &rewrapped))
+	assert.Equal(t, "hello world", opened.String())
+}
@@ -0,0 +1,283 @@
+package vault
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ExportDecryptOptions holds what is needed to decrypt an encrypted export.
+type ExportDecryptOptions struct {
+	// The private key of the AsymmetricPublicKey of the ExportRequest. Required
+	// for the asymmetric and kem encryption types.
+	PrivateKey *rsa.PrivateKey
+
+	// The KEMPassword of the ExportRequest. Required for the kem encryption
+	// type.
+	KEMPassword string
+}
+
+// ExportedKey is the decrypted key material of an export.
+type ExportedKey struct {
+	ID        string
+	Version   int
+	Type      string
+	Algorithm string
+
+	// The private key of an asymmetric key, an *ecdsa.PrivateKey, an
+	// *rsa.PrivateKey or an ed25519.PrivateKey. Nil if the algorithm is not
+	// supported by Go, e.g. ES256K or post-quantum algorithms, in which case
+	// only PrivateKeyPEM is set.
+	PrivateKey crypto.PrivateKey
+
+	// The private key of an asymmetric key, as exported.
+	PrivateKeyPEM []byte
+
+	// The public key of an asymmetric key, if supported by Go.
+	PublicKey crypto.PublicKey
+
+	// The key material of a symmetric key.
+	Key []byte
+}
+
+// ExportDecrypt decrypts and parses the key material of an export, whatever
+// its encryption type.
+//
+// @example
+//
+//	_, rsaPrivKey, err := rsa.GenerateKeyPair(4096)
+//	rsaPubKeyPEM, err := rsa.EncodePEMPublicKey(&rsaPrivKey.PublicKey)
+//
+//	alg := vault.EEArsa4096_no_padding_kem
+//	exported, err := vaultcli.Export(ctx, &vault.ExportRequest{
+//		ID:                  "pvi_...",
+//		AsymmetricPublicKey: pangea.String(string(rsaPubKeyPEM)),
+//		AsymmetricAlgorithm: &alg,
+//		KEMPassword:         pangea.String(password),
+//	})
+//
+//	key, err := vault.ExportDecrypt(*exported.Result, vault.ExportDecryptOptions{
+//		PrivateKey:  rsaPrivKey,
+//		KEMPassword: password,
+//	})
+//	pkcs8, err := key.PKCS8PEM()
+func ExportDecrypt(r ExportResult, opts ExportDecryptOptions) (*ExportedKey, error) {
+	k := &ExportedKey{
+		ID:        r.ID,
+		Version:   r.Version,
+		Type:      r.Type,
+		Algorithm: r.Algorithm,
+	}
+
+	if r.PrivateKey != nil {
+		pemKey, err := decryptExportField(&r, *r.PrivateKey, opts)
+		if err != nil {
+			return nil, err
+		}
+		k.PrivateKeyPEM = pemKey
+		k.PrivateKey, err = parsePrivateKeyPEM(pemKey)
+		if err != nil {
+			return nil, err
+		}
+		if signer, ok := k.PrivateKey.(crypto.Signer); ok {
+			k.PublicKey = signer.Public()
+		}
+	}
+	if k.PublicKey == nil && r.PublicKey != nil {
+		// Public keys are not encrypted.
+		k.PublicKey, _ = parsePublicKeyPEM(*r.PublicKey)
+	}
+
+	if r.Key != nil {
+		encoded, err := decryptExportField(&r, *r.Key, opts)
+		if err != nil {
+			return nil, err
+		}
+		k.Key, err = base64.StdEncoding.DecodeString(string(encoded))
+		if err != nil {
+			return nil, errors.New("vault: invalid exported key encoding")
+		}
+	}
+
+	if k.PrivateKeyPEM == nil && k.Key == nil {
+		return nil, errors.New("vault: no key material in export")
+	}
+	return k, nil
+}
+
+// decryptExportField decrypts an exported field according to the encryption
+// type of the export.
+func decryptExportField(r *ExportResult, field string, opts ExportDecryptOptions) ([]byte, error) {
+	switch ExportEncryptionType(r.EncryptionType) {
+	case "", "none":
+		return []byte(field), nil
+	case EETasymmetric:
+		if opts.PrivateKey == nil {
+			return nil, errors.New("vault: a private key is required to decrypt the export")
+		}
+		if r.AsymmetricAlgorithm != string(EEArsa4096_oaep_sha512) {
+			return nil, fmt.Errorf("vault: unsupported export algorithm %q", r.AsymmetricAlgorithm)
+		}
+		cipher, err := base64.StdEncoding.DecodeString(field)
+		if err != nil {
+			return nil, errors.New("vault: invalid exported key encoding")
+		}
+		return rsa.DecryptOAEP(crypto.SHA512.New(), nil, opts.PrivateKey, cipher, nil)
+	case EETkem:
+		if opts.PrivateKey == nil {
+			return nil, errors.New("vault: a private key is required to decrypt the export")
+		}
+		single := *r
+		single.PrivateKey, single.Key = &field, nil
+		input, err := NewKEMDecryptInput(single, opts.KEMPassword, *opts.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		return KEMDecrypt(*input)
+	}
+	return nil, fmt.Errorf("vault: unsupported export encryption type %q", r.EncryptionType)
+}
+
+// parsePrivateKeyPEM parses a PKCS #8, PKCS #1, SEC 1 or OpenSSH private key.
+// It returns a nil key for valid PEM blocks of unsupported key types.
+func parsePrivateKeyPEM(b []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("vault: invalid private key PEM")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := ssh.ParseRawPrivateKey(b); err == nil {
+		if k, ok := key.(*ed25519.PrivateKey); ok {
+			return *k, nil
+		}
+		return key, nil
+	}
+	return nil, nil
+}
+
+// PKCS8PEM serializes the private key of an asymmetric key to a PKCS #8 PEM
+// block.
+func (k *ExportedKey) PKCS8PEM() ([]byte, error) {
+	if k.PrivateKey == nil {
+		return nil, errors.New("vault: no supported private key to serialize")
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(k.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// exportedJWK is a private JSON Web Key, as defined in RFC 7517 and RFC 7518.
+type exportedJWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	D   string `json:"d,omitempty"`
+	P   string `json:"p,omitempty"`
+	Q   string `json:"q,omitempty"`
+	DP  string `json:"dp,omitempty"`
+	DQ  string `json:"dq,omitempty"`
+	QI  string `json:"qi,omitempty"`
+	K   string `json:"k,omitempty"`
+}
+
+// MarshalJWK serializes the key to a private JSON Web Key, with the kid
+// "<id>:<version>" as used by Vault.
+func (k *ExportedKey) MarshalJWK() ([]byte, error) {
+	jwk := exportedJWK{
+		Kid: fmt.Sprintf("%s:%d", k.ID, k.Version),
+		Alg: jwkAlgorithm(k.Algorithm),
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	switch key := k.PrivateKey.(type) {
+	case *ecdsa.PrivateKey:
+		ecdh, err := key.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		point := ecdh.PublicKey().Bytes()
+		jwk.Kty = "EC"
+		jwk.Crv = key.Curve.Params().Name
+		jwk.X = b64(point[1 : 1+size])
+		jwk.Y = b64(point[1+size:])
+		jwk.D = b64(ecdh.Bytes())
+	case *rsa.PrivateKey:
+		if len(key.Primes) != 2 {
+			return nil, errors.New("vault: multi-prime RSA keys are not supported")
+		}
+		key.Precompute()
+		jwk.Kty = "RSA"
+		jwk.N = b64(key.N.Bytes())
+		jwk.E = b64(big.NewInt(int64(key.E)).Bytes())
+		jwk.D = b64(key.D.Bytes())
+		jwk.P = b64(key.Primes[0].Bytes())
+		jwk.Q = b64(key.Primes[1].Bytes())
+		jwk.DP = b64(key.Precomputed.Dp.Bytes())
+		jwk.DQ = b64(key.Precomputed.Dq.Bytes())
+		jwk.QI = b64(key.Precomputed.Qinv.Bytes())
+	case ed25519.PrivateKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = b64(key.Public().(ed25519.PublicKey))
+		jwk.D = b64(key.Seed())
+	case nil:
+		if k.Key == nil {
+			return nil, errors.New("vault: no supported key to serialize")
+		}
+		jwk.Kty = "oct"
+		jwk.K = b64(k.Key)
+	default:
+		return nil, fmt.Errorf("vault: unsupported key type %T", k.PrivateKey)
+	}
+	return json.Marshal(jwk)
+}
+
+// jwkAlgorithm returns the JWA name of a Vault algorithm, or an empty string
+// if it has none.
+func jwkAlgorithm(algorithm string) string {
+	switch {
+	case algorithm == string(AAed25519):
+		return "EdDSA"
+	case algorithm == string(AAes256), algorithm == string(AAes384), algorithm == string(AAes512),
+		algorithm == string(SYAhs256), algorithm == string(SYAhs384), algorithm == string(SYAhs512):
+		return algorithm
+	case algorithm == string(AArsa2048_pkcs1v15_sha256):
+		return "RS256"
+	case strings.HasPrefix(algorithm, "RSA-PSS-"):
+		return "PS" + strings.TrimPrefix(algorithm[strings.LastIndex(algorithm, "-")+1:], "SHA")
+	case strings.HasPrefix(algorithm, "RSA-OAEP-") && strings.HasSuffix(algorithm, "-SHA1"):
+		return "RSA-OAEP"
+	case strings.HasPrefix(algorithm, "RSA-OAEP-") && strings.HasSuffix(algorithm, "-SHA256"):
+		return "RSA-OAEP-256"
+	case algorithm == string(SYAaes256_gcm):
+		return "A256GCM"
+	}
+	return ""
+}
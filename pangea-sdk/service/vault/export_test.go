@@ -0,0 +1,161 @@
+//go:build unit
+
+package vault_test
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/jose"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/vault"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// exportResults encrypts field with each export encryption type, as Vault
+// does.
+func exportResults(t *testing.T, wrapping *rsa.PrivateKey, password string, field string, symmetric bool) map[string]vault.ExportResult {
+	results := map[string]vault.ExportResult{}
+	set := func(r vault.ExportResult, value string) vault.ExportResult {
+		if symmetric {
+			r.Key = pangea.String(value)
+		} else {
+			r.PrivateKey = pangea.String(value)
+		}
+		return r
+	}
+	base := vault.ExportResult{ID: "pvi_123", Version: 2}
+
+	none := base
+	none.EncryptionType = "none"
+	results["none"] = set(none, field)
+
+	// Larger fields, e.g. RSA private keys, can only be exported with KEM.
+	if ct, err := rsa.EncryptOAEP(sha512.New(), rand.Reader, &wrapping.PublicKey, []byte(field), nil); err == nil {
+		asym := base
+		asym.EncryptionType = "asymmetric"
+		asym.AsymmetricAlgorithm = string(vault.EEArsa4096_oaep_sha512)
+		results["asymmetric"] = set(asym, base64.StdEncoding.EncodeToString(ct))
+	}
+
+	salt := make([]byte, 64)
+	rand.Read(salt) //nolint:errcheck
+	salt[0] |= 1
+	key := pbkdf2.Key([]byte(password), salt, 1000, 32, sha512.New)
+	block, _ := aes.NewCipher(key)
+	gcm, _ := cipher.NewGCM(block)
+	nonce := make([]byte, gcm.NonceSize())
+	rand.Read(nonce) //nolint:errcheck
+
+	kem := base
+	kem.EncryptionType = "kem"
+	kem.AsymmetricAlgorithm = string(vault.EEArsa4096_no_padding_kem)
+	kem.SymmetricAlgorithm = string(vault.SYAaes256_gcm)
+	kem.KDF = "pbkdf2"
+	kem.HashAlgorithm = "sha512"
+	kem.IterationCount = 1000
+	kem.EncryptedSalt = base64.StdEncoding.EncodeToString(internal.RSAEncryptNoPadding(wrapping.PublicKey, salt))
+	results["kem"] = set(kem, base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(field), nil)))
+
+	return results
+}
+
+// Vault exports are wrapped with 4096-bit RSA keys.
+var exportWrappingKey, _ = rsa.GenerateKey(rand.Reader, 4096)
+
+func TestExportDecrypt(t *testing.T) {
+	opts := vault.ExportDecryptOptions{PrivateKey: exportWrappingKey, KEMPassword: "password"}
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecDER, _ := x509.MarshalECPrivateKey(ecKey)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	edDER, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	for _, tc := range []struct {
+		algorithm string
+		pem       string
+		key       crypto.PrivateKey
+	}{
+		{"ES256", string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER})), ecKey},
+		{"ED25519", string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edDER})), edKey},
+		{"RSA-PSS-2048-SHA256", string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})), rsaKey},
+	} {
+		for encryption, r := range exportResults(t, exportWrappingKey, "password", tc.pem, false) {
+			r.Algorithm = tc.algorithm
+			k, err := vault.ExportDecrypt(r, opts)
+			if !assert.NoError(t, err, "%s %s", tc.algorithm, encryption) {
+				continue
+			}
+			assert.True(t, k.PrivateKey.(interface{ Equal(crypto.PrivateKey) bool }).Equal(tc.key), "%s %s", tc.algorithm, encryption)
+			assert.Equal(t, tc.pem, string(k.PrivateKeyPEM))
+
+			pkcs8, err := k.PKCS8PEM()
+			assert.NoError(t, err)
+			block, _ := pem.Decode(pkcs8)
+			assert.Equal(t, "PRIVATE KEY", block.Type)
+			parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			assert.NoError(t, err)
+			assert.True(t, parsed.(interface{ Equal(crypto.PrivateKey) bool }).Equal(tc.key))
+
+			// The public part of the JWK is usable by JWK consumers.
+			b, err := k.MarshalJWK()
+			assert.NoError(t, err)
+			var jwk jose.JWK
+			assert.NoError(t, json.Unmarshal(b, &jwk))
+			pub, err := jwk.PublicKey()
+			assert.NoError(t, err)
+			assert.True(t, pub.(interface{ Equal(crypto.PublicKey) bool }).Equal(k.PublicKey), tc.algorithm)
+		}
+	}
+
+	// RSA JWKs are complete private keys.
+	r := exportResults(t, exportWrappingKey, "password", string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})), false)["none"]
+	k, _ := vault.ExportDecrypt(r, opts)
+	b, _ := k.MarshalJWK()
+	var jwk map[string]string
+	assert.NoError(t, json.Unmarshal(b, &jwk))
+	assert.Equal(t, "pvi_123:2", jwk["kid"])
+	for _, field := range []string{"n", "e", "d", "p", "q", "dp", "dq", "qi"} {
+		assert.NotEmpty(t, jwk[field], field)
+	}
+}
+
+func TestExportDecrypt_Symmetric(t *testing.T) {
+	material := make([]byte, 32)
+	rand.Read(material) //nolint:errcheck
+
+	for encryption, r := range exportResults(t, exportWrappingKey, "password", base64.StdEncoding.EncodeToString(material), true) {
+		r.Algorithm = string(vault.SYAaes256_gcm)
+		k, err := vault.ExportDecrypt(r, vault.ExportDecryptOptions{PrivateKey: exportWrappingKey, KEMPassword: "password"})
+		assert.NoError(t, err, encryption)
+		assert.Equal(t, material, k.Key, encryption)
+		assert.Nil(t, k.PrivateKey)
+
+		_, err = k.PKCS8PEM()
+		assert.Error(t, err)
+		b, err := k.MarshalJWK()
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"kty": "oct", "kid": "pvi_123:2", "alg": "A256GCM", "k": "`+base64.RawURLEncoding.EncodeToString(material)+`"}`, string(b))
+	}
+
+	results := exportResults(t, exportWrappingKey, "password", base64.StdEncoding.EncodeToString(material), true)
+	_, err := vault.ExportDecrypt(results["asymmetric"], vault.ExportDecryptOptions{})
+	assert.Error(t, err)
+	_, err = vault.ExportDecrypt(results["kem"], vault.ExportDecryptOptions{PrivateKey: exportWrappingKey, KEMPassword: "wrong"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,239 @@
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+)
+
+// fpeTweakSize is the size of FF3-1 tweaks, 56 bits.
+const fpeTweakSize = 7
+
+// Chars returns the characters of the alphabet, in the order of their value
+// as FF3-1 digits. The order follows the documentation of the alphabets, e.g.
+// a-z, A-Z, 0-9 for TAalphanumeric, and is only confirmed against Vault by the
+// vectors recorded in testdata/fpe_vault_vectors.json.
+func (a TransformAlphabet) Chars() (string, error) {
+	const (
+		lower   = "abcdefghijklmnopqrstuvwxyz"
+		upper   = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+		numbers = "0123456789"
+	)
+	switch a {
+	case TAalphalower:
+		return lower, nil
+	case TAalphaupper:
+		return upper, nil
+	case TAnumeric:
+		return numbers, nil
+	case TAalphanumericlower:
+		return lower + numbers, nil
+	case TAalphanumericupper:
+		return upper + numbers, nil
+	case TAalphanumeric:
+		return lower + upper + numbers, nil
+	}
+	return "", fmt.Errorf("vault: unsupported alphabet %q", a)
+}
+
+// FPE implements the FF3-1 format-preserving encryption of Vault transforms
+// locally, with a key exported from Vault. Values encrypted by FPE can be
+// decrypted by DecryptTransform and vice versa, given the same alphabet and
+// tweak.
+type FPE struct {
+	block    cipher.Block
+	alphabet []rune
+	index    map[rune]int
+	radix    *big.Int
+	minLen   int
+	maxLen   int
+}
+
+// NewFPE returns an FF3-1 cipher over alphabet, with an AES key of 128, 192
+// or 256 bits.
+//
+// @example
+//
+//	exported, err := vaultcli.Export(ctx, &vault.ExportRequest{ID: "pvi_..."})
+//	key, err := vault.ExportDecrypt(*exported.Result, vault.ExportDecryptOptions{})
+//
+//	fpe, err := vault.NewFPE(key.Key, vault.TAnumeric)
+//	cipherText, err := fpe.Encrypt("4111111111111111", tweak)
+func NewFPE(key []byte, alphabet TransformAlphabet) (*FPE, error) {
+	chars, err := alphabet.Chars()
+	if err != nil {
+		return nil, err
+	}
+
+	// FF3 uses the key with its bytes reversed.
+	block, err := aes.NewCipher(reversed(key))
+	if err != nil {
+		return nil, fmt.Errorf("vault: invalid FPE key: %w", err)
+	}
+
+	f := &FPE{
+		block:    block,
+		alphabet: []rune(chars),
+		index:    map[rune]int{},
+		radix:    big.NewInt(int64(len(chars))),
+	}
+	for i, c := range f.alphabet {
+		f.index[c] = i
+	}
+
+	// radix^minLen >= 1,000,000 and radix^(maxLen/2) <= 2^96.
+	limit := new(big.Int).Lsh(big.NewInt(1), 96)
+	million := big.NewInt(1_000_000)
+	p := big.NewInt(1)
+	for k := 1; ; k++ {
+		p.Mul(p, f.radix)
+		if f.minLen == 0 && p.Cmp(million) >= 0 {
+			f.minLen = max(k, 2)
+		}
+		if p.Cmp(limit) > 0 {
+			f.maxLen = 2 * (k - 1)
+			break
+		}
+	}
+	return f, nil
+}
+
+// NewFPEFromExport returns an FF3-1 cipher with a decrypted export of a Vault
+// FPE key.
+func NewFPEFromExport(key *ExportedKey, alphabet TransformAlphabet) (*FPE, error) {
+	switch SymmetricAlgorithm(key.Algorithm) {
+	case SYAaes_ff3_1_128, SYAaes_ff3_1_256:
+	default:
+		return nil, fmt.Errorf("vault: %q is not an FPE algorithm", key.Algorithm)
+	}
+	return NewFPE(key.Key, alphabet)
+}
+
+// NewFPETweak returns a random tweak, encoded as Vault tweaks.
+func NewFPETweak() (string, error) {
+	t := make([]byte, fpeTweakSize)
+	if _, err := rand.Read(t); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(t), nil
+}
+
+// Encrypt encrypts plainText with a base64 encoded 56-bit tweak, as returned
+// by EncryptTransform.
+func (f *FPE) Encrypt(plainText string, tweak string) (string, error) {
+	return f.transform(plainText, tweak, true)
+}
+
+// Decrypt decrypts cipherText with a base64 encoded 56-bit tweak.
+func (f *FPE) Decrypt(cipherText string, tweak string) (string, error) {
+	return f.transform(cipherText, tweak, false)
+}
+
+func (f *FPE) transform(text string, tweak string, encrypt bool) (string, error) {
+	t, err := base64.StdEncoding.DecodeString(tweak)
+	if err != nil || len(t) != fpeTweakSize {
+		return "", errors.New("vault: FPE tweaks must be 56 bits, base64 encoded")
+	}
+
+	// Characters outside of the alphabet, e.g. separators, are kept in place
+	// and only the others are encrypted.
+	runes := []rune(text)
+	var x, pos []int
+	for i, c := range runes {
+		if d, ok := f.index[c]; ok {
+			x = append(x, d)
+			pos = append(pos, i)
+		}
+	}
+	if len(x) < f.minLen || len(x) > f.maxLen {
+		return "", fmt.Errorf("vault: FPE values must have between %v and %v characters of the alphabet", f.minLen, f.maxLen)
+	}
+
+	// FF3-1 splits the tweak in two 28-bit halves.
+	tl := [4]byte{t[0], t[1], t[2], t[3] & 0xf0}
+	tr := [4]byte{t[4], t[5], t[6], (t[3] & 0x0f) << 4}
+	y := f.ff3(x, tl, tr, encrypt)
+
+	for i, d := range y {
+		runes[pos[i]] = f.alphabet[d]
+	}
+	return string(runes), nil
+}
+
+// ff3 runs the 8 Feistel rounds of FF3 over the digits x, as specified in
+// NIST SP 800-38G.
+func (f *FPE) ff3(x []int, tl, tr [4]byte, encrypt bool) []int {
+	n := len(x)
+	u := (n + 1) / 2
+	v := n - u
+	a, b := slices.Clone(x[:u]), slices.Clone(x[u:])
+
+	for r := 0; r < 8; r++ {
+		i := r
+		if !encrypt {
+			i = 7 - r
+		}
+		m, w := u, tr
+		if i%2 == 1 {
+			m, w = v, tl
+		}
+
+		src := b
+		if !encrypt {
+			src = a
+		}
+		var p [16]byte
+		copy(p[:4], w[:])
+		p[3] ^= byte(i)
+		f.num(src).FillBytes(p[4:])
+
+		slices.Reverse(p[:])
+		var s [16]byte
+		f.block.Encrypt(s[:], p[:])
+		slices.Reverse(s[:])
+		y := new(big.Int).SetBytes(s[:])
+
+		mod := new(big.Int).Exp(f.radix, big.NewInt(int64(m)), nil)
+		if encrypt {
+			c := new(big.Int).Add(f.num(a), y)
+			a, b = b, f.str(c.Mod(c, mod), m)
+		} else {
+			c := new(big.Int).Sub(f.num(b), y)
+			b, a = a, f.str(c.Mod(c, mod), m)
+		}
+	}
+	return append(a, b...)
+}
+
+// num returns the number whose digits, least significant first, are x.
+func (f *FPE) num(x []int) *big.Int {
+	n := new(big.Int)
+	for i := len(x) - 1; i >= 0; i-- {
+		n.Mul(n, f.radix)
+		n.Add(n, big.NewInt(int64(x[i])))
+	}
+	return n
+}
+
+// str returns the m digits of c, least significant first.
+func (f *FPE) str(c *big.Int, m int) []int {
+	x := make([]int, m)
+	c = new(big.Int).Set(c)
+	d := new(big.Int)
+	for i := range x {
+		c.DivMod(c, f.radix, d)
+		x[i] = int(d.Int64())
+	}
+	return x
+}
+
+func reversed(b []byte) []byte {
+	r := slices.Clone(b)
+	slices.Reverse(r)
+	return r
+}
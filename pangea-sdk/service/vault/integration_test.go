@@ -5,9 +5,12 @@ package vault_test
 import (
 	"context"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"math/rand"
+	"os"
 	"reflect"
 	"runtime"
 	"testing"
@@ -1357,6 +1360,96 @@ func Test_Integration_EncryptTransform(t *testing.T) {
 	assert.Equal(t, plainText, decryptedResponse.Result.PlainText)
 }
 
+var recordFPE = flag.Bool("record-fpe", false, "record the values encrypted by Vault in testdata/fpe_vault_vectors.json")
+
+func Test_Integration_FPE(t *testing.T) {
+	plainText := "123-4567-8901"
+	tweak := "MTIzMTIzMT=="
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancelFn()
+
+	client := vault.New(pangeatesting.IntegrationConfig(t, testingEnvironment))
+
+	rGen, err := client.SymmetricGenerate(
+		ctx,
+		&vault.SymmetricGenerateRequest{
+			CommonGenerateRequest: vault.CommonGenerateRequest{
+				Name: GetName("Test_Integration_FPE"),
+			},
+			Algorithm:  vault.SYAaes_ff3_1_256,
+			Purpose:    vault.KPfpe,
+			Exportable: pangea.Bool(true),
+		},
+	)
+	assert.NoError(t, err)
+	key := rGen.Result.ID
+
+	exported, err := client.Export(ctx, &vault.ExportRequest{ID: key})
+	assert.NoError(t, err)
+	k, err := vault.ExportDecrypt(*exported.Result, vault.ExportDecryptOptions{})
+	assert.NoError(t, err)
+
+	var vectors []map[string]string
+	for _, alphabet := range []vault.TransformAlphabet{vault.TAalphalower, vault.TAalphaupper, vault.TAnumeric, vault.TAalphanumericlower, vault.TAalphanumericupper, vault.TAalphanumeric} {
+		fpe, err := vault.NewFPEFromExport(k, alphabet)
+		assert.NoError(t, err)
+
+		// Every character of the alphabet, so that their order is checked,
+		// in halves if longer than FF3-1 allows.
+		chars, err := alphabet.Chars()
+		assert.NoError(t, err)
+		plainTexts := []string{chars}
+		if len(chars) > 32 {
+			plainTexts = []string{chars[:len(chars)/2], chars[len(chars)/2:]}
+		}
+		if alphabet == vault.TAnumeric || alphabet == vault.TAalphanumeric {
+			plainTexts = append(plainTexts, plainText)
+		}
+		for _, plainText := range plainTexts {
+
+			// Encrypted by Vault, decrypted locally.
+			encrypted, err := client.EncryptTransform(ctx, &vault.EncryptTransformRequest{
+				ID:        key,
+				PlainText: plainText,
+				Tweak:     &tweak,
+				Alphabet:  alphabet,
+			})
+			assert.NoError(t, err)
+			local, err := fpe.Encrypt(plainText, tweak)
+			assert.NoError(t, err)
+			assert.Equal(t, encrypted.Result.CipherText, local, alphabet)
+			decrypted, err := fpe.Decrypt(encrypted.Result.CipherText, tweak)
+			assert.NoError(t, err)
+			assert.Equal(t, plainText, decrypted)
+
+			// Encrypted locally, decrypted by Vault.
+			decryptedResponse, err := client.DecryptTransform(ctx, &vault.DecryptTransformRequest{
+				ID:         key,
+				CipherText: local,
+				Tweak:      tweak,
+				Alphabet:   alphabet,
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, plainText, decryptedResponse.Result.PlainText)
+
+			vectors = append(vectors, map[string]string{
+				"alphabet":    string(alphabet),
+				"key":         hex.EncodeToString(k.Key),
+				"tweak":       tweak,
+				"plain_text":  plainText,
+				"cipher_text": encrypted.Result.CipherText,
+			})
+		}
+	}
+
+	if *recordFPE && !t.Failed() {
+		b, err := json.MarshalIndent(vectors, "", "\t")
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile("testdata/fpe_vault_vectors.json", append(b, '\n'), 0o644))
+	}
+}
+
 func Test_Integration_ExportGenerateAsymmetric(t *testing.T) {
 	ctx, cancelFn := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancelFn()
@@ -1,6 +1,11 @@
 package vault
 
-import "github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+import (
+	"crypto"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/jose"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+)
 
 type JWT struct {
 	Alg string  `json:"alg"`
@@ -15,6 +20,19 @@ type JWT struct {
 	E   *string `json:"e,omitempty"`
 }
 
+// PublicKey decodes the public key of the JWK, an *ecdsa.PublicKey, an
+// *rsa.PublicKey or an ed25519.PublicKey.
+func (k JWT) PublicKey() (crypto.PublicKey, error) {
+	return jose.JWK{
+		Kty: k.Kty,
+		Crv: pangea.StringValue(k.Crv),
+		X:   pangea.StringValue(k.X),
+		Y:   pangea.StringValue(k.Y),
+		N:   pangea.StringValue(k.N),
+		E:   pangea.StringValue(k.E),
+	}.PublicKey()
+}
+
 type JWKGetRequest struct {
 	// Base request has ConfigID for multi-config projects
 	pangea.BaseRequest
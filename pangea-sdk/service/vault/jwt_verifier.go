@@ -0,0 +1,353 @@
+package vault
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/jose"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+)
+
+var (
+	ErrJWTMalformed        = jose.ErrMalformed
+	ErrJWTInvalidSignature = jose.ErrInvalidSignature
+	ErrJWTUnsupportedAlg   = jose.ErrUnsupportedAlg
+	ErrJWTExpired          = jose.ErrExpired
+	ErrJWTNotYetValid      = jose.ErrNotYetValid
+	ErrJWTInvalidIssuer    = jose.ErrInvalidIssuer
+	ErrJWTInvalidAudience  = jose.ErrInvalidAudience
+
+	// ErrJWTUnknownKey is returned when the key of a token cannot be resolved
+	// and the remote fallback is disabled.
+	ErrJWTUnknownKey = errors.New("vault: unknown JWT key")
+)
+
+// JWTClaims are the claims of a verified token.
+type JWTClaims struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ExpiresAt time.Time // Zero if the token has no exp claim.
+	NotBefore time.Time // Zero if the token has no nbf claim.
+	IssuedAt  time.Time // Zero if the token has no iat claim.
+	ID        string
+
+	// All the claims of the token.
+	Raw map[string]any
+
+	// Whether the signature was verified locally, rather than by JWTVerify.
+	VerifiedLocally bool
+}
+
+type JWTVerifierOption func(*JWTVerifier) error
+
+// WithJWTIssuer requires tokens to be issued by iss.
+func WithJWTIssuer(iss string) JWTVerifierOption {
+	return func(v *JWTVerifier) error {
+		v.expected.Issuer = iss
+		return nil
+	}
+}
+
+// WithJWTAudience requires tokens to be intended for one of aud.
+func WithJWTAudience(aud ...string) JWTVerifierOption {
+	return func(v *JWTVerifier) error {
+		v.expected.Audience = aud
+		return nil
+	}
+}
+
+// WithJWTLeeway sets the clock skew tolerated when validating the exp and nbf
+// claims. Defaults to 1 minute.
+func WithJWTLeeway(d time.Duration) JWTVerifierOption {
+	return func(v *JWTVerifier) error {
+		if d < 0 {
+			return errors.New("vault: negative JWT leeway")
+		}
+		v.expected.Leeway = d
+		return nil
+	}
+}
+
+// WithJWTKeyIDs sets the Vault items whose keys are fetched when a token's
+// kid is not a Vault item ID.
+func WithJWTKeyIDs(ids ...string) JWTVerifierOption {
+	return func(v *JWTVerifier) error {
+		v.itemIDs = ids
+		return nil
+	}
+}
+
+// WithJWTRefreshInterval sets the minimum time between two fetches of the
+// keys of an item, and the time key IDs that could not be resolved are
+// remembered, which bounds the calls made for tokens with unknown kids.
+// Defaults to 1 minute.
+func WithJWTRefreshInterval(d time.Duration) JWTVerifierOption {
+	return func(v *JWTVerifier) error {
+		v.refreshInterval = d
+		return nil
+	}
+}
+
+// WithoutJWTRemoteFallback disables verifying with JWTVerify the tokens whose
+// key cannot be resolved locally.
+func WithoutJWTRemoteFallback() JWTVerifierOption {
+	return func(v *JWTVerifier) error {
+		v.remoteFallback = false
+		return nil
+	}
+}
+
+type cachedJWK struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// maxJWTTracked bounds the items refreshed and the unknown key IDs remembered
+// within a refresh interval, and so the JWKGet calls made for tokens with
+// forged kids.
+const maxJWTTracked = 1024
+
+// recentSet records keys for a duration, holding at most maxJWTTracked of
+// them.
+type recentSet map[string]time.Time
+
+// contains reports whether key was added less than d ago.
+func (s recentSet) contains(key string, d time.Duration) bool {
+	t, ok := s[key]
+	return ok && time.Since(t) < d
+}
+
+// add records key, dropping the keys added d ago or more if the set is full.
+// It returns false if the set is still full.
+func (s recentSet) add(key string, d time.Duration) bool {
+	if len(s) >= maxJWTTracked {
+		for k, t := range s {
+			if time.Since(t) >= d {
+				delete(s, k)
+			}
+		}
+		if len(s) >= maxJWTTracked {
+			return false
+		}
+	}
+	s[key] = time.Now()
+	return true
+}
+
+// JWTVerifier verifies Vault-signed tokens locally, with the public keys of
+// JWKGet cached by key ID and version.
+type JWTVerifier struct {
+	client          Client
+	itemIDs         []string
+	expected        jose.Expected
+	refreshInterval time.Duration
+	remoteFallback  bool
+
+	mu        sync.RWMutex
+	keys      map[string]cachedJWK
+	refreshed recentSet // Item IDs.
+	unknown   recentSet // Key IDs.
+}
+
+// NewJWTVerifier creates a verifier fetching keys through client.
+//
+// @example
+//
+//	verifier, err := vault.NewJWTVerifier(vaultcli,
+//		vault.WithJWTIssuer("https://issuer.example.com"),
+//		vault.WithJWTAudience("my-api"),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//
+//	claims, err := verifier.Verify(ctx, jws)
+func NewJWTVerifier(client Client, opts ...JWTVerifierOption) (*JWTVerifier, error) {
+	if client == nil {
+		return nil, errors.New("vault: nil client")
+	}
+	v := &JWTVerifier{
+		client:          client,
+		expected:        jose.Expected{Leeway: time.Minute},
+		refreshInterval: time.Minute,
+		remoteFallback:  true,
+		keys:            map[string]cachedJWK{},
+		refreshed:       recentSet{},
+		unknown:         recentSet{},
+	}
+	for _, opt := range opts {
+		if err := opt(v); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// Verify verifies the signature and the claims of a token.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*JWTClaims, error) {
+	jws, err := jose.Parse(token)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := v.resolve(ctx, jws.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	local := key != nil
+	if local {
+		if key.alg != "" && key.alg != jws.Header.Alg {
+			return nil, ErrJWTUnsupportedAlg
+		}
+		if err := jws.Verify(key.key); err != nil {
+			return nil, err
+		}
+	} else {
+		resp, err := v.client.JWTVerify(ctx, &JWTVerifyRequest{JWS: token})
+		if err != nil {
+			return nil, err
+		}
+		if !resp.Result.ValidSignature {
+			return nil, ErrJWTInvalidSignature
+		}
+	}
+
+	claims, registered, err := parseJWTClaims(jws.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if err := registered.Validate(v.expected); err != nil {
+		return nil, err
+	}
+	claims.VerifiedLocally = local
+	return claims, nil
+}
+
+// resolve returns the key of the token, or nil if it must be verified
+// remotely.
+func (v *JWTVerifier) resolve(ctx context.Context, h jose.Header) (*cachedJWK, error) {
+	if !jose.Asymmetric(h.Alg) || h.Kid == "" {
+		return v.unresolved()
+	}
+
+	if key, ok := v.cached(h.Kid); ok {
+		return key, nil
+	}
+
+	v.mu.RLock()
+	unknown := v.unknown.contains(h.Kid, v.refreshInterval)
+	v.mu.RUnlock()
+	if unknown {
+		return v.unresolved()
+	}
+
+	for _, id := range v.itemIDsOf(h.Kid) {
+		if err := v.refresh(ctx, id); err != nil {
+			return nil, err
+		}
+		if key, ok := v.cached(h.Kid); ok {
+			return key, nil
+		}
+	}
+
+	v.mu.Lock()
+	v.unknown.add(h.Kid, v.refreshInterval)
+	v.mu.Unlock()
+	return v.unresolved()
+}
+
+func (v *JWTVerifier) unresolved() (*cachedJWK, error) {
+	if !v.remoteFallback {
+		return nil, ErrJWTUnknownKey
+	}
+	return nil, nil
+}
+
+func (v *JWTVerifier) cached(kid string) (*cachedJWK, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	key, ok := v.keys[kid]
+	return &key, ok
+}
+
+// itemIDsOf returns the IDs of the items that may hold the key kid. Vault key
+// IDs are either the item ID or the item ID and version separated by a colon.
+func (v *JWTVerifier) itemIDsOf(kid string) []string {
+	ids := []string{}
+	if id, _, _ := strings.Cut(kid, ":"); strings.HasPrefix(id, "pvi_") {
+		ids = append(ids, id)
+	}
+	return append(ids, v.itemIDs...)
+}
+
+// refresh fetches all the keys of an item into the cache, unless they were
+// fetched less than the refresh interval ago or too many items were.
+func (v *JWTVerifier) refresh(ctx context.Context, id string) error {
+	v.mu.Lock()
+	if v.refreshed.contains(id, v.refreshInterval) || !v.refreshed.add(id, v.refreshInterval) {
+		v.mu.Unlock()
+		return nil
+	}
+	v.mu.Unlock()
+
+	resp, err := v.client.JWKGet(ctx, &JWKGetRequest{ID: id, Version: pangea.String("all")})
+	if err != nil {
+		var apiErr *pangea.APIError
+		if errors.As(err, &apiErr) {
+			// The item does not exist or is not a JWT key.
+			return nil
+		}
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, jwk := range resp.Result.Keys {
+		if jwk.Kid == nil {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		v.keys[*jwk.Kid] = cachedJWK{alg: jwk.Alg, key: key}
+	}
+	return nil
+}
+
+func parseJWTClaims(payload []byte) (*JWTClaims, *jose.Claims, error) {
+	raw := map[string]any{}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, nil, fmt.Errorf("%w: invalid claims", ErrJWTMalformed)
+	}
+	registered := &jose.Claims{}
+	if err := json.Unmarshal(payload, registered); err != nil {
+		return nil, nil, fmt.Errorf("%w: invalid claims", ErrJWTMalformed)
+	}
+
+	claims := &JWTClaims{
+		Issuer:   registered.Issuer,
+		Subject:  registered.Subject,
+		Audience: registered.Audience,
+		ID:       registered.ID,
+		Raw:      raw,
+	}
+	if registered.ExpiresAt != nil {
+		claims.ExpiresAt = registered.ExpiresAt.Time
+	}
+	if registered.NotBefore != nil {
+		claims.NotBefore = registered.NotBefore.Time
+	}
+	if registered.IssuedAt != nil {
+		claims.IssuedAt = registered.IssuedAt.Time
+	}
+	return claims, registered, nil
+}
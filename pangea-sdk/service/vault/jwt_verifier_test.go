@@ -0,0 +1,198 @@
+//go:build unit
+
+package vault_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeatesting"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signJWT(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := b64(header) + "." + b64(payload)
+
+	var sig []byte
+	var err error
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256([]byte(input))
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest[:])
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(input))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(input))
+	}
+	assert.NoError(t, err)
+	return input + "." + b64(sig)
+}
+
+func TestJWTVerifier(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	ecPub, _ := ecKey.PublicKey.Bytes()
+	jwks := []map[string]string{
+		{"alg": "ES256", "kid": "pvi_ec:1", "kty": "EC", "crv": "P-256", "x": b64(ecPub[1:33]), "y": b64(ecPub[33:])},
+		{"alg": "RS256", "kid": "pvi_rsa:1", "kty": "RSA", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"alg": "EdDSA", "kid": "pvi_ed:1", "kty": "OKP", "crv": "Ed25519", "x": b64(edPub)},
+	}
+
+	mux, url, teardown := pangeatesting.SetupServer()
+	defer teardown()
+
+	var jwkGets, jwtVerifies atomic.Int32
+	mux.HandleFunc("/v2/jwk/get", func(w http.ResponseWriter, r *http.Request) {
+		jwkGets.Add(1)
+		var input vault.JWKGetRequest
+		json.NewDecoder(r.Body).Decode(&input) //nolint:errcheck
+		keys := []map[string]string{}
+		assert.Equal(t, "all", *input.Version)
+		for _, k := range jwks {
+			if strings.HasPrefix(k["kid"], input.ID+":") {
+				keys = append(keys, k)
+			}
+		}
+		b, _ := json.Marshal(keys)
+		fmt.Fprintf(w, `{"request_id": "some-id", "status": "Success", "result": {"keys": %s}, "summary": "ok"}`, b)
+	})
+	mux.HandleFunc("/v2/jwt/verify", func(w http.ResponseWriter, r *http.Request) {
+		jwtVerifies.Add(1)
+		fmt.Fprint(w, `{"request_id": "some-id", "status": "Success", "result": {"valid_signature": true}, "summary": "ok"}`)
+	})
+
+	client := vault.New(pangeatesting.TestConfig(url))
+	verifier, err := vault.NewJWTVerifier(client, vault.WithJWTIssuer("iss"), vault.WithJWTAudience("api"))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	valid := map[string]any{"iss": "iss", "aud": []string{"other", "api"}, "sub": "user", "exp": time.Now().Add(time.Hour).Unix()}
+
+	for _, tc := range []struct {
+		alg, kid string
+		key      crypto.Signer
+	}{
+		{"ES256", "pvi_ec:1", ecKey},
+		{"RS256", "pvi_rsa:1", rsaKey},
+		{"EdDSA", "pvi_ed:1", edKey},
+	} {
+		claims, err := verifier.Verify(ctx, signJWT(t, tc.alg, tc.kid, tc.key, valid))
+		assert.NoError(t, err, tc.alg)
+		assert.Equal(t, "user", claims.Subject)
+		assert.Equal(t, []string{"other", "api"}, claims.Audience)
+		assert.True(t, claims.VerifiedLocally)
+	}
+	assert.Equal(t, int32(3), jwkGets.Load())
+
+	// Keys are cached.
+	_, err = verifier.Verify(ctx, signJWT(t, "ES256", "pvi_ec:1", ecKey, valid))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), jwkGets.Load())
+
+	// Signed by another key.
+	_, err = verifier.Verify(ctx, signJWT(t, "ES256", "pvi_ec:1", rsaKey, valid))
+	assert.Error(t, err)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, err = verifier.Verify(ctx, signJWT(t, "ES256", "pvi_ec:1", otherKey, valid))
+	assert.ErrorIs(t, err, vault.ErrJWTInvalidSignature)
+
+	expired := map[string]any{"iss": "iss", "aud": "api", "exp": time.Now().Add(-2 * time.Minute).Unix()}
+	_, err = verifier.Verify(ctx, signJWT(t, "ES256", "pvi_ec:1", ecKey, expired))
+	assert.ErrorIs(t, err, vault.ErrJWTExpired)
+
+	// Within the clock skew tolerance.
+	expired["exp"] = time.Now().Add(-30 * time.Second).Unix()
+	_, err = verifier.Verify(ctx, signJWT(t, "ES256", "pvi_ec:1", ecKey, expired))
+	assert.NoError(t, err)
+
+	notBefore := map[string]any{"iss": "iss", "aud": "api", "nbf": time.Now().Add(time.Hour).Unix()}
+	_, err = verifier.Verify(ctx, signJWT(t, "ES256", "pvi_ec:1", ecKey, notBefore))
+	assert.ErrorIs(t, err, vault.ErrJWTNotYetValid)
+
+	_, err = verifier.Verify(ctx, signJWT(t, "ES256", "pvi_ec:1", ecKey, map[string]any{"iss": "other", "aud": "api"}))
+	assert.ErrorIs(t, err, vault.ErrJWTInvalidIssuer)
+
+	_, err = verifier.Verify(ctx, signJWT(t, "ES256", "pvi_ec:1", ecKey, map[string]any{"iss": "iss", "aud": "other"}))
+	assert.ErrorIs(t, err, vault.ErrJWTInvalidAudience)
+
+	// Unknown keys are verified remotely, with refreshes bounded per item:
+	// pvi_ec was fetched with all its versions less than a minute ago.
+	claims, err := verifier.Verify(ctx, signJWT(t, "ES256", "pvi_ec:2", ecKey, valid))
+	assert.NoError(t, err)
+	assert.False(t, claims.VerifiedLocally)
+	_, err = verifier.Verify(ctx, signJWT(t, "ES256", "pvi_ec:3", ecKey, valid))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), jwkGets.Load())
+	assert.Equal(t, int32(2), jwtVerifies.Load())
+	_, err = verifier.Verify(ctx, signJWT(t, "ES256", "pvi_unknown", ecKey, valid))
+	assert.NoError(t, err)
+	_, err = verifier.Verify(ctx, signJWT(t, "ES256", "pvi_unknown", ecKey, valid))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(4), jwkGets.Load())
+
+	strict, _ := vault.NewJWTVerifier(client, vault.WithoutJWTRemoteFallback())
+	_, err = strict.Verify(ctx, signJWT(t, "ES256", "pvi_ec:2", ecKey, valid))
+	assert.ErrorIs(t, err, vault.ErrJWTUnknownKey)
+
+	_, err = verifier.Verify(ctx, "not.a.token")
+	assert.ErrorIs(t, err, vault.ErrJWTMalformed)
+}
+
+func TestJWTVerifier_ForgedKeyIDs(t *testing.T) {
+	mux, url, teardown := pangeatesting.SetupServer()
+	defer teardown()
+
+	var jwkGets atomic.Int32
+	mux.HandleFunc("/v2/jwk/get", func(w http.ResponseWriter, r *http.Request) {
+		jwkGets.Add(1)
+		fmt.Fprint(w, `{"request_id": "some-id", "status": "Success", "result": {"keys": []}, "summary": "ok"}`)
+	})
+
+	verifier, err := vault.NewJWTVerifier(vault.New(pangeatesting.TestConfig(url)), vault.WithoutJWTRemoteFallback())
+	assert.NoError(t, err)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ctx := context.Background()
+
+	// Versions of the same item are fetched at once.
+	for i := range 100 {
+		_, err = verifier.Verify(ctx, signJWT(t, "ES256", fmt.Sprintf("pvi_forged:%d", i), key, nil))
+		assert.ErrorIs(t, err, vault.ErrJWTUnknownKey)
+	}
+	assert.Equal(t, int32(1), jwkGets.Load())
+
+	// The items fetched within the refresh interval are bounded.
+	for i := range 1100 {
+		_, err = verifier.Verify(ctx, signJWT(t, "ES256", fmt.Sprintf("pvi_%d", i), key, nil))
+		assert.ErrorIs(t, err, vault.ErrJWTUnknownKey)
+	}
+	assert.Equal(t, int32(1024), jwkGets.Load())
+}
@@ -0,0 +1,572 @@
+// Package provision reconciles Vault items with a declarative spec.
+//
+// Items are identified by their folder and name. Diff compares a spec with the
+// items returned by vault.List, and Reconcile creates the missing items and
+// updates the drifted ones, so that applying the same spec again is a no-op.
+// Fields left empty in the spec are not managed. The type, algorithm and
+// purpose of existing items cannot be changed, and differences in them are
+// reported as conflicts.
+package provision
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/vault"
+)
+
+// ErrConflict is returned by Reconcile when existing items conflict with the
+// spec. Nothing is applied.
+var ErrConflict = errors.New("provision: items conflict with the spec")
+
+// Spec is the desired state of a set of Vault items.
+type Spec struct {
+	Items []ItemSpec `json:"items"`
+}
+
+// ItemSpec is the desired state of a Vault item.
+type ItemSpec struct {
+	// The type of the item: a folder, a secret or a key.
+	Type vault.ItemType `json:"type"`
+
+	// The name of the item, unique in its folder.
+	Name string `json:"name"`
+
+	// The folder of the item. Defaults to the root folder.
+	Folder string `json:"folder,omitempty"`
+
+	// The algorithm and purpose of a key, only used on creation.
+	Algorithm  string           `json:"algorithm,omitempty"`
+	Purpose    vault.KeyPurpose `json:"purpose,omitempty"`
+	Exportable *bool            `json:"exportable,omitempty"`
+
+	Metadata            vault.Metadata         `json:"metadata,omitempty"`
+	Tags                vault.Tags             `json:"tags,omitempty"`
+	RotationFrequency   string                 `json:"rotation_frequency,omitempty"`
+	RotationState       vault.ItemVersionState `json:"rotation_state,omitempty"`
+	RotationGracePeriod string                 `json:"rotation_grace_period,omitempty"`
+
+	// The time at which the item is disabled, in RFC 3339 format.
+	Expiration string `json:"expiration,omitempty"`
+
+	// Whether the item is enabled.
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// The state of the current version of the item.
+	State vault.ItemVersionState `json:"state,omitempty"`
+
+	// The value of a secret, only used on creation.
+	Secret string `json:"secret,omitempty"`
+}
+
+// Path returns the folder and the name of the item.
+func (s *ItemSpec) Path() string {
+	return itemPath(s.Folder, s.Name)
+}
+
+func cleanFolder(folder string) string {
+	return "/" + strings.Trim(folder, "/")
+}
+
+func itemPath(folder, name string) string {
+	return strings.TrimSuffix(cleanFolder(folder), "/") + "/" + name
+}
+
+func (s *ItemSpec) validate() error {
+	if s.Name == "" || strings.Contains(s.Name, "/") {
+		return fmt.Errorf("provision: invalid name %q", s.Name)
+	}
+	switch s.Type {
+	case vault.ITfolder, vault.ITsecret:
+	case vault.ITsymmetricKey, vault.ITasymmetricKey:
+		if s.Algorithm == "" || s.Purpose == "" {
+			return fmt.Errorf("provision: %s: keys require an algorithm and a purpose", s.Path())
+		}
+	default:
+		return fmt.Errorf("provision: %s: unsupported item type %q", s.Path(), s.Type)
+	}
+	if s.Expiration != "" {
+		if _, err := time.Parse(time.RFC3339Nano, s.Expiration); err != nil {
+			return fmt.Errorf("provision: %s: invalid expiration: %w", s.Path(), err)
+		}
+	}
+	return nil
+}
+
+type Action string
+
+const (
+	ActionCreate      Action = "create"
+	ActionUpdate      Action = "update"
+	ActionStateChange Action = "state_change"
+	ActionConflict    Action = "conflict"
+)
+
+// Drift is a field of an item differing from the spec.
+type Drift struct {
+	Field   string
+	Current string
+	Desired string
+}
+
+// Operation reconciles an item with its spec.
+type Operation struct {
+	Action Action
+	Spec   ItemSpec
+
+	// The ID of the item, set on creation.
+	ID string
+
+	// The fields differing from the spec. Empty for creations.
+	Drift []Drift
+
+	// Whether the operation was applied.
+	Applied bool
+}
+
+func (o *Operation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s %s", o.Action, o.Spec.Type, o.Spec.Path())
+	for _, d := range o.Drift {
+		fmt.Fprintf(&b, "\n  %s: %q -> %q", d.Field, d.Current, d.Desired)
+	}
+	return b.String()
+}
+
+// Plan is the set of operations reconciling Vault with a spec, folders first.
+type Plan struct {
+	Operations []*Operation
+}
+
+// HasChanges reports whether Vault differs from the spec.
+func (p *Plan) HasChanges() bool {
+	return len(p.Operations) > 0
+}
+
+// Conflicts returns the operations that cannot be applied.
+func (p *Plan) Conflicts() []*Operation {
+	conflicts := []*Operation{}
+	for _, op := range p.Operations {
+		if op.Action == ActionConflict {
+			conflicts = append(conflicts, op)
+		}
+	}
+	return conflicts
+}
+
+func (p *Plan) String() string {
+	ops := make([]string, len(p.Operations))
+	for i, op := range p.Operations {
+		ops[i] = op.String()
+	}
+	return strings.Join(ops, "\n")
+}
+
+type options struct {
+	dryRun bool
+}
+
+type Option func(*options) error
+
+// WithDryRun makes Reconcile return the plan without applying it.
+func WithDryRun() Option {
+	return func(o *options) error {
+		o.dryRun = true
+		return nil
+	}
+}
+
+// Diff compares the items of spec with the items in Vault.
+func Diff(ctx context.Context, client vault.Client, spec *Spec) (*Plan, error) {
+	specs, err := sortedSpecs(spec)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := listItems(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{Operations: []*Operation{}}
+	for _, s := range specs {
+		item, ok := existing[s.Path()]
+		if !ok {
+			plan.Operations = append(plan.Operations, &Operation{Action: ActionCreate, Spec: s})
+			continue
+		}
+
+		if conflicts := immutableDrift(&s, item); len(conflicts) > 0 {
+			plan.Operations = append(plan.Operations, &Operation{Action: ActionConflict, Spec: s, ID: item.ID, Drift: conflicts})
+			continue
+		}
+		if drift := mutableDrift(&s, item); len(drift) > 0 {
+			plan.Operations = append(plan.Operations, &Operation{Action: ActionUpdate, Spec: s, ID: item.ID, Drift: drift})
+		}
+		if s.State != "" {
+			drift, err := stateDrift(ctx, client, &s, item.ID)
+			if err != nil {
+				return nil, err
+			}
+			if drift != nil {
+				plan.Operations = append(plan.Operations, &Operation{Action: ActionStateChange, Spec: s, ID: item.ID, Drift: []Drift{*drift}})
+			}
+		}
+	}
+	return plan, nil
+}
+
+// Reconcile applies the operations of the plan reconciling Vault with spec,
+// and returns it. Operations are applied in order and Reconcile stops at the
+// first error, which can be retried by reconciling again.
+//
+// @example
+//
+//	spec := &provision.Spec{Items: []provision.ItemSpec{
+//		{Type: vault.ITfolder, Name: "payments"},
+//		{
+//			Type:              vault.ITsymmetricKey,
+//			Name:              "card-numbers",
+//			Folder:            "/payments",
+//			Algorithm:         string(vault.SYAaes256_gcm),
+//			Purpose:           vault.KPencryption,
+//			RotationFrequency: "90d",
+//		},
+//	}}
+//
+//	plan, err := provision.Reconcile(ctx, vaultcli, spec, provision.WithDryRun())
+//	if err != nil {
+//		return err
+//	}
+//	fmt.Println(plan)
+func Reconcile(ctx context.Context, client vault.Client, spec *Spec, opts ...Option) (*Plan, error) {
+	o := options{}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+
+	plan, err := Diff(ctx, client, spec)
+	if err != nil {
+		return nil, err
+	}
+	if o.dryRun {
+		return plan, nil
+	}
+	if len(plan.Conflicts()) > 0 {
+		return plan, ErrConflict
+	}
+
+	for _, op := range plan.Operations {
+		if err := apply(ctx, client, op); err != nil {
+			return plan, fmt.Errorf("provision: %s %s: %w", op.Action, op.Spec.Path(), err)
+		}
+		op.Applied = true
+	}
+	return plan, nil
+}
+
+// sortedSpecs validates the items of spec and orders them so that folders are
+// created before their content.
+func sortedSpecs(spec *Spec) ([]ItemSpec, error) {
+	seen := map[string]bool{}
+	specs := slices.Clone(spec.Items)
+	for _, s := range specs {
+		if err := s.validate(); err != nil {
+			return nil, err
+		}
+		if seen[s.Path()] {
+			return nil, fmt.Errorf("provision: duplicate item %s", s.Path())
+		}
+		seen[s.Path()] = true
+	}
+
+	depth := func(s *ItemSpec) int {
+		if s.Type != vault.ITfolder {
+			return 1 << 30
+		}
+		return strings.Count(s.Path(), "/")
+	}
+	slices.SortStableFunc(specs, func(a, b ItemSpec) int {
+		return depth(&a) - depth(&b)
+	})
+	return specs, nil
+}
+
+func listItems(ctx context.Context, client vault.Client) (map[string]*vault.ItemData, error) {
+	items := map[string]*vault.ItemData{}
+	last := ""
+	for {
+		resp, err := client.List(ctx, &vault.ListRequest{Last: last, Size: 1000})
+		if err != nil {
+			return nil, err
+		}
+		for i := range resp.Result.Items {
+			item := &resp.Result.Items[i].ItemData
+			items[itemPath(item.Folder, item.Name)] = item
+		}
+		if resp.Result.Last == "" || len(resp.Result.Items) == 0 {
+			return items, nil
+		}
+		last = resp.Result.Last
+	}
+}
+
+func immutableDrift(s *ItemSpec, item *vault.ItemData) []Drift {
+	drift := []Drift{}
+	if string(s.Type) != item.Type {
+		drift = append(drift, Drift{"type", item.Type, string(s.Type)})
+	}
+	if s.Algorithm != "" && s.Algorithm != item.Algorithm {
+		drift = append(drift, Drift{"algorithm", item.Algorithm, s.Algorithm})
+	}
+	if s.Purpose != "" && string(s.Purpose) != item.Purpose {
+		drift = append(drift, Drift{"purpose", item.Purpose, string(s.Purpose)})
+	}
+	return drift
+}
+
+func mutableDrift(s *ItemSpec, item *vault.ItemData) []Drift {
+	drift := []Drift{}
+	if len(s.Metadata) > 0 && !maps.Equal(s.Metadata, item.Metadata) {
+		drift = append(drift, Drift{"metadata", formatMetadata(item.Metadata), formatMetadata(s.Metadata)})
+	}
+	if len(s.Tags) > 0 && !sameTags(s.Tags, item.Tags) {
+		drift = append(drift, Drift{"tags", strings.Join(item.Tags, ","), strings.Join(s.Tags, ",")})
+	}
+	if s.RotationFrequency != "" && s.RotationFrequency != item.RotationFrequency {
+		drift = append(drift, Drift{"rotation_frequency", item.RotationFrequency, s.RotationFrequency})
+	}
+	if s.RotationState != "" && string(s.RotationState) != item.RotationState {
+		drift = append(drift, Drift{"rotation_state", item.RotationState, string(s.RotationState)})
+	}
+	if s.RotationGracePeriod != "" && s.RotationGracePeriod != item.RotationGracePeriod {
+		drift = append(drift, Drift{"rotation_grace_period", item.RotationGracePeriod, s.RotationGracePeriod})
+	}
+	if s.Expiration != "" && !sameTime(s.Expiration, item.DisabledAt) {
+		drift = append(drift, Drift{"expiration", item.DisabledAt, s.Expiration})
+	}
+	if s.Enabled != nil && *s.Enabled != item.Enabled {
+		drift = append(drift, Drift{"enabled", fmt.Sprint(item.Enabled), fmt.Sprint(*s.Enabled)})
+	}
+	return drift
+}
+
+// stateDrift compares the state of the current version of an item with the
+// spec. List does not return all the versions, so the item is fetched.
+func stateDrift(ctx context.Context, client vault.Client, s *ItemSpec, id string) (*Drift, error) {
+	resp, err := client.Get(ctx, &vault.GetRequest{ID: id})
+	if err != nil {
+		return nil, err
+	}
+	current := currentVersion(resp.Result.ItemVersions)
+	if current == nil || current.State == string(s.State) {
+		return nil, nil
+	}
+	return &Drift{"state", current.State, string(s.State)}, nil
+}
+
+func currentVersion(versions []vault.ItemVersionData) *vault.ItemVersionData {
+	var current *vault.ItemVersionData
+	for i := range versions {
+		if current == nil || versions[i].Version > current.Version {
+			current = &versions[i]
+		}
+	}
+	return current
+}
+
+func formatMetadata(m vault.Metadata) string {
+	keys := slices.Sorted(maps.Keys(m))
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + m[k]
+	}
+	return strings.Join(pairs, ",")
+}
+
+func sameTags(a, b vault.Tags) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
+
+func sameTime(a, b string) bool {
+	ta, err := time.Parse(time.RFC3339Nano, a)
+	if err != nil {
+		return a == b
+	}
+	tb, err := time.Parse(time.RFC3339Nano, b)
+	if err != nil {
+		return false
+	}
+	return ta.Equal(tb)
+}
+
+func apply(ctx context.Context, client vault.Client, op *Operation) error {
+	switch op.Action {
+	case ActionCreate:
+		id, err := create(ctx, client, &op.Spec)
+		if err != nil {
+			return err
+		}
+		op.ID = id
+		return initialize(ctx, client, &op.Spec, id)
+	case ActionUpdate:
+		_, err := client.Update(ctx, updateRequest(&op.Spec, op.ID, op.Drift))
+		return err
+	case ActionStateChange:
+		return changeState(ctx, client, op.ID, op.Spec.State)
+	}
+	return fmt.Errorf("unexpected action %q", op.Action)
+}
+
+func create(ctx context.Context, client vault.Client, s *ItemSpec) (string, error) {
+	folder := ""
+	if s.Folder != "" {
+		folder = cleanFolder(s.Folder)
+	}
+	common := vault.CommonGenerateRequest{
+		Type:              s.Type,
+		Name:              s.Name,
+		Folder:            folder,
+		Metadata:          s.Metadata,
+		Tags:              s.Tags,
+		RotationFrequency: s.RotationFrequency,
+		RotationState:     string(s.RotationState),
+		DisabledAt:        s.Expiration,
+	}
+
+	switch s.Type {
+	case vault.ITfolder:
+		resp, err := client.FolderCreate(ctx, &vault.FolderCreateRequest{
+			Name:                s.Name,
+			Folder:              folder,
+			Metadata:            s.Metadata,
+			Tags:                s.Tags,
+			RotationFrequency:   s.RotationFrequency,
+			RotationState:       s.RotationState,
+			RotationGracePeriod: s.RotationGracePeriod,
+		})
+		if err != nil {
+			return "", err
+		}
+		return resp.Result.ID, nil
+	case vault.ITsecret:
+		if s.Secret == "" {
+			return "", errors.New("secrets require a value to be created")
+		}
+		resp, err := client.SecretStore(ctx, &vault.SecretStoreRequest{
+			CommonStoreRequest: vault.CommonStoreRequest{
+				Type:              s.Type,
+				Name:              s.Name,
+				Folder:            folder,
+				Metadata:          s.Metadata,
+				Tags:              s.Tags,
+				RotationFrequency: s.RotationFrequency,
+				RotationState:     s.RotationState,
+				DisabledAt:        s.Expiration,
+			},
+			Secret:              s.Secret,
+			RotationGracePeriod: s.RotationGracePeriod,
+		})
+		if err != nil {
+			return "", err
+		}
+		return resp.Result.ID, nil
+	case vault.ITsymmetricKey:
+		resp, err := client.SymmetricGenerate(ctx, &vault.SymmetricGenerateRequest{
+			CommonGenerateRequest: common,
+			Algorithm:             vault.SymmetricAlgorithm(s.Algorithm),
+			Purpose:               s.Purpose,
+			Exportable:            s.Exportable,
+		})
+		if err != nil {
+			return "", err
+		}
+		return resp.Result.ID, nil
+	case vault.ITasymmetricKey:
+		resp, err := client.AsymmetricGenerate(ctx, &vault.AsymmetricGenerateRequest{
+			CommonGenerateRequest: common,
+			Algorithm:             vault.AsymmetricAlgorithm(s.Algorithm),
+			Purpose:               s.Purpose,
+			Exportable:            s.Exportable,
+		})
+		if err != nil {
+			return "", err
+		}
+		return resp.Result.ID, nil
+	}
+	return "", fmt.Errorf("unsupported item type %q", s.Type)
+}
+
+// initialize applies the fields of a new item that cannot be set on creation.
+func initialize(ctx context.Context, client vault.Client, s *ItemSpec, id string) error {
+	input := &vault.UpdateRequest{ID: id}
+	update := false
+	if s.Enabled != nil && !*s.Enabled {
+		input.Enabled = s.Enabled
+		update = true
+	}
+	// Keys are generated without a grace period.
+	if s.RotationGracePeriod != "" && (s.Type == vault.ITsymmetricKey || s.Type == vault.ITasymmetricKey) {
+		input.RotationGracePeriod = s.RotationGracePeriod
+		update = true
+	}
+	if update {
+		if _, err := client.Update(ctx, input); err != nil {
+			return err
+		}
+	}
+	if s.State != "" && s.State != vault.IVSactive {
+		return changeState(ctx, client, id, s.State)
+	}
+	return nil
+}
+
+func updateRequest(s *ItemSpec, id string, drift []Drift) *vault.UpdateRequest {
+	input := &vault.UpdateRequest{ID: id}
+	for _, d := range drift {
+		switch d.Field {
+		case "metadata":
+			input.Metadata = s.Metadata
+		case "tags":
+			input.Tags = s.Tags
+		case "rotation_frequency":
+			input.RotationFrequency = s.RotationFrequency
+		case "rotation_state":
+			input.RotationState = s.RotationState
+		case "rotation_grace_period":
+			input.RotationGracePeriod = s.RotationGracePeriod
+		case "expiration":
+			input.DisabledAt = s.Expiration
+		case "enabled":
+			input.Enabled = pangea.Bool(*s.Enabled)
+		}
+	}
+	return input
+}
+
+func changeState(ctx context.Context, client vault.Client, id string, state vault.ItemVersionState) error {
+	resp, err := client.Get(ctx, &vault.GetRequest{ID: id})
+	if err != nil {
+		return err
+	}
+	current := currentVersion(resp.Result.ItemVersions)
+	if current == nil {
+		return errors.New("item has no versions")
+	}
+	_, err = client.StateChange(ctx, &vault.StateChangeRequest{
+		ID:      id,
+		State:   state,
+		Version: pangea.Int(current.Version),
+	})
+	return err
+}
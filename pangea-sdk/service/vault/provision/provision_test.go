@@ -0,0 +1,97 @@
+//go:build unit
+
+package provision_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeatesting"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/vault"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/vault/provision"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcile(t *testing.T) {
+	f, teardown := pangeatesting.NewFakeVault(t)
+	defer teardown()
+	f.ListPageSize = 2
+	client := f.Client()
+	ctx := context.Background()
+
+	spec := &provision.Spec{Items: []provision.ItemSpec{
+		{
+			Type:                vault.ITsymmetricKey,
+			Name:                "card-numbers",
+			Folder:              "/payments/cards",
+			Algorithm:           string(vault.SYAaes256_gcm),
+			Purpose:             vault.KPencryption,
+			RotationFrequency:   "90d",
+			RotationGracePeriod: "1d",
+			Tags:                vault.Tags{"pci"},
+		},
+		{Type: vault.ITfolder, Name: "cards", Folder: "payments"},
+		{Type: vault.ITfolder, Name: "payments"},
+		{Type: vault.ITsecret, Name: "db-password", Folder: "/payments", Secret: "hunter2", Metadata: vault.Metadata{"owner": "payments"}},
+		{Type: vault.ITasymmetricKey, Name: "legacy", Algorithm: string(vault.AAed25519), Purpose: vault.KPsigning, Enabled: pangea.Bool(false), State: vault.IVSsuspended},
+	}}
+
+	plan, err := provision.Reconcile(ctx, client, spec, provision.WithDryRun())
+	assert.NoError(t, err)
+	assert.Len(t, plan.Operations, 5)
+	assert.Equal(t, "/payments", plan.Operations[0].Spec.Path())
+	assert.Equal(t, "/payments/cards", plan.Operations[1].Spec.Path())
+	for _, op := range plan.Operations {
+		assert.Equal(t, provision.ActionCreate, op.Action)
+		assert.False(t, op.Applied)
+	}
+	assert.Equal(t, []string{"v2/list"}, f.Paths())
+
+	plan, err = provision.Reconcile(ctx, client, spec)
+	assert.NoError(t, err)
+	for _, op := range plan.Operations {
+		assert.True(t, op.Applied)
+		assert.NotEmpty(t, op.ID)
+	}
+	assert.Len(t, f.Items, 5)
+	assert.Equal(t, "/payments/cards", f.Items[2].Folder)
+	assert.False(t, f.Items[4].Enabled)
+	assert.Equal(t, "suspended", f.Items[4].ItemVersions[0].State)
+	// Keys are generated without a grace period, which is applied after.
+	assert.Equal(t, "1d", f.Items[2].RotationGracePeriod)
+
+	// Reconciling again is a no-op.
+	plan, err = provision.Diff(ctx, client, spec)
+	assert.NoError(t, err)
+	assert.False(t, plan.HasChanges(), plan.String())
+
+	// Drift is detected and corrected.
+	f.Items[2].Tags = vault.Tags{"other"}
+	f.Items[2].RotationFrequency = "30d"
+	f.Items[4].ItemVersions[0].State = "active"
+	plan, err = provision.Diff(ctx, client, spec)
+	assert.NoError(t, err)
+	assert.Len(t, plan.Operations, 2)
+	assert.Equal(t, provision.ActionUpdate, plan.Operations[0].Action)
+	assert.Equal(t, []provision.Drift{{"tags", "other", "pci"}, {"rotation_frequency", "30d", "90d"}}, plan.Operations[0].Drift)
+	assert.Equal(t, provision.ActionStateChange, plan.Operations[1].Action)
+
+	_, err = provision.Reconcile(ctx, client, spec)
+	assert.NoError(t, err)
+	plan, _ = provision.Diff(ctx, client, spec)
+	assert.False(t, plan.HasChanges(), plan.String())
+
+	// Immutable fields conflict.
+	spec.Items[0].Algorithm = string(vault.SYAaes128_cbc)
+	calls := len(f.Requests)
+	plan, err = provision.Reconcile(ctx, client, spec)
+	assert.ErrorIs(t, err, provision.ErrConflict)
+	assert.Len(t, plan.Conflicts(), 1)
+	assert.Equal(t, []string{"v2/list", "v2/list", "v2/list", "v2/get"}, f.Paths()[calls:])
+
+	_, err = provision.Diff(ctx, client, &provision.Spec{Items: []provision.ItemSpec{{Type: vault.ITsymmetricKey, Name: "key"}}})
+	assert.Error(t, err)
+	_, err = provision.Diff(ctx, client, &provision.Spec{Items: []provision.ItemSpec{{Type: vault.ITfolder, Name: "a"}, {Type: vault.ITfolder, Name: "a", Folder: "/"}}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,112 @@
+package rotation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Checkpoint is the progress of a Controller: the rotations that are being
+// done or whose hooks have not succeeded yet.
+type Checkpoint struct {
+	Items map[string]*ItemCheckpoint `json:"items"`
+}
+
+// ItemCheckpoint is the progress of the rotation of an item.
+type ItemCheckpoint struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+
+	// The current version before the rotation.
+	OldVersion int `json:"old_version"`
+
+	// The current version after the rotation, 0 until the rotation succeeds.
+	NewVersion int `json:"new_version,omitempty"`
+
+	RotatedAt time.Time `json:"rotated_at,omitzero"`
+
+	// The error of the last attempt, if any.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// CheckpointStore persists the progress of a Controller.
+type CheckpointStore interface {
+	// Load returns the last saved checkpoint, or nil if there is none.
+	Load(ctx context.Context) (*Checkpoint, error)
+
+	// Save replaces the saved checkpoint.
+	Save(ctx context.Context, cp *Checkpoint) error
+}
+
+type memoryStore struct {
+	cp *Checkpoint
+}
+
+func (s *memoryStore) Load(ctx context.Context) (*Checkpoint, error) {
+	return s.cp, nil
+}
+
+func (s *memoryStore) Save(ctx context.Context, cp *Checkpoint) error {
+	s.cp = cp
+	return nil
+}
+
+// FileStore saves checkpoints to a JSON file, replaced atomically.
+type FileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileStore returns a store saving checkpoints to path.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+func (s *FileStore) Load(ctx context.Context) (*Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+func (s *FileStore) Save(ctx context.Context, cp *Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
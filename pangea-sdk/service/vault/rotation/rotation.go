@@ -0,0 +1,429 @@
+// Package rotation rotates Vault items when they are due and drives the
+// re-encryption of data protected by their previous versions.
+//
+// A Controller scans vault.List for keys and secrets whose next rotation is
+// past, rotates them and calls the hooks of the application, which can then
+// move data to the new version, e.g. with Rotation.Reencrypt. Its progress is
+// saved to a CheckpointStore before and after every rotation, so that a
+// controller restarted after a failure neither rotates an item twice nor
+// forgets to run the hooks of a rotation.
+package rotation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/vault"
+)
+
+const listPageSize = 1000
+
+// Rotation is the rotation of an item, passed to the hooks.
+type Rotation struct {
+	// The item, as returned by the rotation.
+	Item vault.ItemData
+
+	// The current version before the rotation, and after it.
+	OldVersion int
+	NewVersion int
+
+	client vault.Client
+}
+
+// Reencrypt decrypts cipherText with the old version of a symmetric or
+// asymmetric encryption key and encrypts the plain text with the new version.
+// The old version must still be usable for decryption, i.e. the rotation state
+// must be deactivated or suspended.
+func (r *Rotation) Reencrypt(ctx context.Context, cipherText string) (string, error) {
+	dec, err := r.client.Decrypt(ctx, &vault.DecryptRequest{
+		ID:         r.Item.ID,
+		CipherText: cipherText,
+		Version:    pangea.Int(r.OldVersion),
+	})
+	if err != nil {
+		return "", err
+	}
+	enc, err := r.client.Encrypt(ctx, &vault.EncryptRequest{
+		ID:        r.Item.ID,
+		PlainText: dec.Result.PlainText,
+		Version:   pangea.Int(r.NewVersion),
+	})
+	if err != nil {
+		return "", err
+	}
+	return enc.Result.CipherText, nil
+}
+
+// Hook is called after the rotation of an item. Rotations whose hooks fail
+// are retried, i.e. their hooks are called again, on the next run.
+type Hook func(ctx context.Context, r *Rotation) error
+
+// SecretGenerator returns the new value of a secret being rotated.
+type SecretGenerator func(ctx context.Context, item *vault.ItemData) (string, error)
+
+// Controller rotates due Vault items.
+type Controller struct {
+	client         vault.Client
+	filter         pangea.Filter
+	rotationState  vault.ItemVersionState
+	gracePeriod    string
+	hooks          []Hook
+	generateSecret SecretGenerator
+	store          CheckpointStore
+	onError        func(error)
+	now            func() time.Time
+
+	mu sync.Mutex
+}
+
+type Option func(*Controller) error
+
+// WithFilter restricts the items managed by the controller, e.g. to a folder.
+func WithFilter(filter *vault.FilterList) Option {
+	return func(c *Controller) error {
+		c.filter = filter.Filter()
+		return nil
+	}
+}
+
+// WithRotationState sets the state of the previous version of rotated items.
+// Defaults to the rotation state of each item.
+func WithRotationState(state vault.ItemVersionState) Option {
+	return func(c *Controller) error {
+		c.rotationState = state
+		return nil
+	}
+}
+
+// WithGracePeriod sets the grace period of the previous version of rotated
+// secrets, e.g. "7d". Defaults to the grace period of each secret.
+func WithGracePeriod(period string) Option {
+	return func(c *Controller) error {
+		c.gracePeriod = period
+		return nil
+	}
+}
+
+// WithHook adds a hook called after every rotation. Hooks are called in the
+// order they were added, and stop at the first error.
+func WithHook(hook Hook) Option {
+	return func(c *Controller) error {
+		c.hooks = append(c.hooks, hook)
+		return nil
+	}
+}
+
+// WithSecretGenerator sets the generator of the new values of secrets. Without
+// it, secrets are not rotated.
+func WithSecretGenerator(generate SecretGenerator) Option {
+	return func(c *Controller) error {
+		c.generateSecret = generate
+		return nil
+	}
+}
+
+// WithCheckpointStore sets where progress is saved. Defaults to memory, i.e.
+// progress is lost when the process exits.
+func WithCheckpointStore(store CheckpointStore) Option {
+	return func(c *Controller) error {
+		if store == nil {
+			return errors.New("rotation: nil checkpoint store")
+		}
+		c.store = store
+		return nil
+	}
+}
+
+// WithOnError sets a function called with the errors of Run, including the
+// errors of single items.
+func WithOnError(fn func(error)) Option {
+	return func(c *Controller) error {
+		c.onError = fn
+		return nil
+	}
+}
+
+// New returns a Controller rotating the items of client.
+//
+// @example
+//
+//	store := rotation.NewFileStore("/var/lib/app/rotation.json")
+//	controller, err := rotation.New(vaultcli,
+//		rotation.WithCheckpointStore(store),
+//		rotation.WithRotationState(vault.IVSdeactivated),
+//		rotation.WithHook(func(ctx context.Context, r *rotation.Rotation) error {
+//			return reencryptRecords(ctx, r.Item.ID, r.Reencrypt)
+//		}),
+//	)
+//
+//	go controller.Run(ctx, time.Hour)
+func New(client vault.Client, opts ...Option) (*Controller, error) {
+	c := &Controller{
+		client:  client,
+		store:   &memoryStore{},
+		onError: func(error) {},
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Report is the outcome of a run.
+type Report struct {
+	// Rotations whose hooks all succeeded, including the ones resumed from a
+	// checkpoint.
+	Rotated []*Rotation
+
+	// Due items that were not rotated, e.g. secrets without a
+	// SecretGenerator, by ID.
+	Skipped map[string]string
+
+	// The errors of items, by ID. They are retried on the next run.
+	Errors map[string]error
+}
+
+// Run rotates the due items every interval until ctx is done. Errors are
+// passed to the WithOnError function.
+func (c *Controller) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report, err := c.RunOnce(ctx)
+		if err != nil {
+			c.onError(err)
+		}
+		if report != nil {
+			for _, id := range slices.Sorted(maps.Keys(report.Errors)) {
+				c.onError(fmt.Errorf("rotation: %s: %w", id, report.Errors[id]))
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// RunOnce resumes the rotations of the checkpoint, then rotates the items due
+// now. It returns an error if the items cannot be listed or the checkpoint
+// cannot be loaded or saved; the errors of single items are in the report.
+func (c *Controller) RunOnce(ctx context.Context) (*Report, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cp, err := c.store.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("rotation: loading checkpoint: %w", err)
+	}
+	if cp == nil {
+		cp = &Checkpoint{}
+	}
+	if cp.Items == nil {
+		cp.Items = map[string]*ItemCheckpoint{}
+	}
+
+	report := &Report{Skipped: map[string]string{}, Errors: map[string]error{}}
+
+	for _, id := range slices.Sorted(maps.Keys(cp.Items)) {
+		if err := c.resume(ctx, cp, cp.Items[id], report); err != nil {
+			return report, err
+		}
+	}
+
+	due, err := c.dueItems(ctx)
+	if err != nil {
+		return report, err
+	}
+	for _, item := range due {
+		if _, ok := cp.Items[item.ID]; ok {
+			continue
+		}
+		if item.Type == string(vault.ITsecret) && c.generateSecret == nil {
+			report.Skipped[item.ID] = "no secret generator"
+			continue
+		}
+		ic := &ItemCheckpoint{ID: item.ID, Type: item.Type, OldVersion: latestVersion(item)}
+		cp.Items[item.ID] = ic
+		if err := c.save(ctx, cp); err != nil {
+			return report, err
+		}
+		if err := c.rotate(ctx, cp, ic, item, report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// resume completes a rotation of the checkpoint.
+func (c *Controller) resume(ctx context.Context, cp *Checkpoint, ic *ItemCheckpoint, report *Report) error {
+	resp, err := c.client.Get(ctx, &vault.GetRequest{ID: ic.ID})
+	if err != nil {
+		report.Errors[ic.ID] = err
+		return nil
+	}
+	item := &resp.Result.ItemData
+	if ic.NewVersion == 0 && latestVersion(item) > ic.OldVersion {
+		// Rotated before the checkpoint could be saved.
+		ic.NewVersion = latestVersion(item)
+		ic.RotatedAt = c.now()
+		if err := c.save(ctx, cp); err != nil {
+			return err
+		}
+	}
+	if ic.NewVersion == 0 {
+		return c.rotate(ctx, cp, ic, item, report)
+	}
+	return c.runHooks(ctx, cp, ic, item, report)
+}
+
+// rotate rotates an item saved to the checkpoint, then runs the hooks.
+func (c *Controller) rotate(ctx context.Context, cp *Checkpoint, ic *ItemCheckpoint, item *vault.ItemData, report *Report) error {
+	rotated, err := c.rotateItem(ctx, item)
+	if err != nil {
+		report.Errors[ic.ID] = err
+		ic.LastError = err.Error()
+		return c.save(ctx, cp)
+	}
+
+	ic.NewVersion = latestVersion(rotated)
+	ic.RotatedAt = c.now()
+	ic.LastError = ""
+	if err := c.save(ctx, cp); err != nil {
+		return err
+	}
+	return c.runHooks(ctx, cp, ic, rotated, report)
+}
+
+// runHooks runs the hooks of a rotation and removes it from the checkpoint
+// once they all succeed.
+func (c *Controller) runHooks(ctx context.Context, cp *Checkpoint, ic *ItemCheckpoint, item *vault.ItemData, report *Report) error {
+	r := &Rotation{
+		Item:       *item,
+		OldVersion: ic.OldVersion,
+		NewVersion: ic.NewVersion,
+		client:     c.client,
+	}
+	for _, hook := range c.hooks {
+		if err := hook(ctx, r); err != nil {
+			report.Errors[ic.ID] = err
+			ic.LastError = err.Error()
+			return c.save(ctx, cp)
+		}
+	}
+	delete(cp.Items, ic.ID)
+	report.Rotated = append(report.Rotated, r)
+	return c.save(ctx, cp)
+}
+
+func (c *Controller) rotateItem(ctx context.Context, item *vault.ItemData) (*vault.ItemData, error) {
+	state := c.rotationState
+	if state == "" {
+		state = vault.ItemVersionState(item.RotationState)
+	}
+	common := vault.CommonRotateRequest{ID: item.ID, RotationState: state}
+
+	switch vault.ItemType(item.Type) {
+	case vault.ITsecret:
+		if c.generateSecret == nil {
+			return nil, errors.New("rotation: no secret generator")
+		}
+		secret, err := c.generateSecret(ctx, item)
+		if err != nil {
+			return nil, err
+		}
+		grace := c.gracePeriod
+		if grace == "" {
+			grace = item.RotationGracePeriod
+		}
+		resp, err := c.client.SecretRotate(ctx, &vault.SecretRotateRequest{
+			CommonRotateRequest: common,
+			RotationGracePeriod: grace,
+			Secret:              secret,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &resp.Result.ItemData, nil
+	case vault.ITsymmetricKey, vault.ITasymmetricKey:
+		resp, err := c.client.KeyRotate(ctx, &vault.KeyRotateRequest{CommonRotateRequest: common})
+		if err != nil {
+			return nil, err
+		}
+		return &resp.Result.ItemData, nil
+	}
+	return nil, fmt.Errorf("rotation: unsupported item type %q", item.Type)
+}
+
+// dueItems lists the enabled keys and secrets whose next rotation is past.
+func (c *Controller) dueItems(ctx context.Context) ([]*vault.ItemData, error) {
+	now := c.now()
+	filter := maps.Clone(c.filter)
+	if filter == nil {
+		filter = pangea.Filter{}
+	}
+	filter["next_rotation__lte"] = now.UTC().Format(time.RFC3339)
+
+	var items []*vault.ItemData
+	last := ""
+	for {
+		resp, err := c.client.List(ctx, &vault.ListRequest{
+			Filter:  filter,
+			Last:    last,
+			Size:    listPageSize,
+			Order:   vault.IOasc,
+			OrderBy: vault.IOBnextRotation,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("rotation: listing items: %w", err)
+		}
+		for i := range resp.Result.Items {
+			item := &resp.Result.Items[i].ItemData
+			if due(item, now) {
+				items = append(items, item)
+			}
+		}
+		if resp.Result.Last == "" || len(resp.Result.Items) == 0 {
+			return items, nil
+		}
+		last = resp.Result.Last
+	}
+}
+
+func due(item *vault.ItemData, now time.Time) bool {
+	switch vault.ItemType(item.Type) {
+	case vault.ITsecret, vault.ITsymmetricKey, vault.ITasymmetricKey:
+	default:
+		return false
+	}
+	if !item.Enabled || item.NextRotation == "" {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339Nano, item.NextRotation)
+	return err == nil && !t.After(now)
+}
+
+func latestVersion(item *vault.ItemData) int {
+	v := item.NumVersions
+	for _, iv := range item.ItemVersions {
+		v = max(v, iv.Version)
+	}
+	return v
+}
+
+func (c *Controller) save(ctx context.Context, cp *Checkpoint) error {
+	if err := c.store.Save(ctx, cp); err != nil {
+		return fmt.Errorf("rotation: saving checkpoint: %w", err)
+	}
+	return nil
+}
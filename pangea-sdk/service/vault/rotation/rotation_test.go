@@ -0,0 +1,220 @@
+//go:build unit
+
+package rotation_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeatesting"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/vault"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/vault/rotation"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	past   = time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	future = time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+)
+
+// setupFakeVault serves items, with ciphertexts of the form "v<version>:<plain
+// text>".
+func setupFakeVault(t *testing.T, items ...*vault.ItemData) (vault.Client, *pangeatesting.FakeVault, func()) {
+	f, teardown := pangeatesting.NewFakeVault(t, items...)
+
+	rotate := func(body []byte) (any, error) {
+		var input vault.CommonRotateRequest
+		json.Unmarshal(body, &input) //nolint:errcheck
+		item := f.Find(input.ID)
+		if item.Metadata["fail"] == "rotate" {
+			return nil, errors.New("cannot rotate")
+		}
+		item.NextRotation = future
+		return f.Rotate(body)
+	}
+	f.Handle("v2/key/rotate", rotate)
+	f.Handle("v2/secret/rotate", rotate)
+	f.Handle("v2/decrypt", func(body []byte) (any, error) {
+		var input vault.DecryptRequest
+		json.Unmarshal(body, &input) //nolint:errcheck
+		prefix := fmt.Sprintf("v%d:", *input.Version)
+		if !strings.HasPrefix(input.CipherText, prefix) {
+			return nil, errors.New("wrong version")
+		}
+		return vault.DecryptResult{ID: input.ID, PlainText: strings.TrimPrefix(input.CipherText, prefix)}, nil
+	})
+	f.Handle("v2/encrypt", func(body []byte) (any, error) {
+		var input vault.EncryptRequest
+		json.Unmarshal(body, &input) //nolint:errcheck
+		return vault.EncryptResult{ID: input.ID, CipherText: fmt.Sprintf("v%d:%s", *input.Version, input.PlainText)}, nil
+	})
+
+	return f.Client(), f, teardown
+}
+
+// rotates returns the bodies of the rotate requests.
+func rotates(f *pangeatesting.FakeVault) []json.RawMessage {
+	return f.Bodies("v2/key/rotate", "v2/secret/rotate")
+}
+
+func key(id string, nextRotation string) *vault.ItemData {
+	return &vault.ItemData{
+		ID:            id,
+		Type:          string(vault.ITsymmetricKey),
+		Enabled:       true,
+		NumVersions:   1,
+		NextRotation:  nextRotation,
+		RotationState: string(vault.IVSsuspended),
+		Metadata:      vault.Metadata{},
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	secret := key("pvi_secret", past)
+	secret.Type = string(vault.ITsecret)
+	folder := key("pvi_folder", past)
+	folder.Type = string(vault.ITfolder)
+	disabled := key("pvi_disabled", past)
+	disabled.Enabled = false
+
+	client, f, teardown := setupFakeVault(t, key("pvi_due", past), key("pvi_later", future), secret, folder, disabled)
+	defer teardown()
+
+	data := base64.StdEncoding.EncodeToString([]byte("data"))
+	reencrypted := map[string]string{}
+	c, err := rotation.New(client,
+		rotation.WithRotationState(vault.IVSdeactivated),
+		rotation.WithGracePeriod("7d"),
+		rotation.WithSecretGenerator(func(ctx context.Context, item *vault.ItemData) (string, error) {
+			return "new-" + item.ID, nil
+		}),
+		rotation.WithHook(func(ctx context.Context, r *rotation.Rotation) error {
+			if r.Item.Type != string(vault.ITsymmetricKey) {
+				return nil
+			}
+			ct, err := r.Reencrypt(ctx, "v1:"+data)
+			reencrypted[r.Item.ID] = ct
+			return err
+		}),
+	)
+	assert.NoError(t, err)
+
+	report, err := c.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, report.Errors)
+	assert.Len(t, report.Rotated, 2)
+	for _, r := range report.Rotated {
+		assert.Equal(t, 1, r.OldVersion)
+		assert.Equal(t, 2, r.NewVersion)
+	}
+	assert.Equal(t, map[string]string{"pvi_due": "v2:" + data}, reencrypted)
+	var list vault.ListRequest
+	assert.NoError(t, json.Unmarshal(f.Bodies("v2/list")[0], &list))
+	assert.Less(t, past, list.Filter["next_rotation__lte"].(string))
+
+	assert.Len(t, rotates(f), 2)
+	for _, body := range rotates(f) {
+		var input vault.SecretRotateRequest
+		assert.NoError(t, json.Unmarshal(body, &input))
+		assert.Equal(t, vault.IVSdeactivated, input.RotationState)
+		if input.ID == "pvi_secret" {
+			assert.Equal(t, "7d", input.RotationGracePeriod)
+			assert.Equal(t, "new-pvi_secret", input.Secret)
+		}
+	}
+
+	// Nothing is due anymore.
+	report, err = c.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, report.Rotated)
+	assert.Len(t, rotates(f), 2)
+}
+
+func TestRunOnce_SkipsSecrets(t *testing.T) {
+	secret := key("pvi_secret", past)
+	secret.Type = string(vault.ITsecret)
+	client, f, teardown := setupFakeVault(t, secret)
+	defer teardown()
+
+	c, _ := rotation.New(client)
+	report, err := c.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Contains(t, report.Skipped, "pvi_secret")
+	assert.Empty(t, rotates(f))
+}
+
+func TestRunOnce_Resume(t *testing.T) {
+	failing := key("pvi_failing", past)
+	failing.Metadata["fail"] = "rotate"
+	client, f, teardown := setupFakeVault(t, key("pvi_due", past), failing)
+	defer teardown()
+
+	store := rotation.NewFileStore(filepath.Join(t.TempDir(), "checkpoint.json"))
+	hookErr := errors.New("database unavailable")
+	var hooked []string
+	hook := func(ctx context.Context, r *rotation.Rotation) error {
+		hooked = append(hooked, r.Item.ID)
+		return hookErr
+	}
+
+	c, _ := rotation.New(client, rotation.WithCheckpointStore(store), rotation.WithHook(hook))
+	report, err := c.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, report.Rotated)
+	assert.ErrorIs(t, report.Errors["pvi_due"], hookErr)
+	assert.Error(t, report.Errors["pvi_failing"])
+
+	cp, err := store.Load(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, cp.Items["pvi_due"].NewVersion)
+	assert.Equal(t, "database unavailable", cp.Items["pvi_due"].LastError)
+	assert.Equal(t, 0, cp.Items["pvi_failing"].NewVersion)
+
+	// A new controller resumes the hooks without rotating again, and retries
+	// the failed rotation.
+	hookErr = nil
+	delete(failing.Metadata, "fail")
+	c, _ = rotation.New(client, rotation.WithCheckpointStore(store), rotation.WithHook(hook))
+	report, err = c.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, report.Errors)
+	assert.Len(t, report.Rotated, 2)
+	assert.Equal(t, []string{"pvi_due", "pvi_due", "pvi_failing"}, hooked)
+	assert.Equal(t, 2, f.Find("pvi_due").NumVersions)
+	assert.Equal(t, 2, f.Find("pvi_failing").NumVersions)
+
+	cp, _ = store.Load(context.Background())
+	assert.Empty(t, cp.Items)
+}
+
+func TestRunOnce_ResumeRotated(t *testing.T) {
+	// Rotated by a controller that stopped before saving the new version.
+	rotated := key("pvi_rotated", future)
+	rotated.NumVersions = 2
+	client, f, teardown := setupFakeVault(t, rotated)
+	defer teardown()
+
+	store := rotation.NewFileStore(filepath.Join(t.TempDir(), "checkpoint.json"))
+	assert.NoError(t, store.Save(context.Background(), &rotation.Checkpoint{Items: map[string]*rotation.ItemCheckpoint{
+		"pvi_rotated": {ID: "pvi_rotated", Type: rotated.Type, OldVersion: 1},
+	}}))
+
+	var got *rotation.Rotation
+	c, _ := rotation.New(client, rotation.WithCheckpointStore(store), rotation.WithHook(func(ctx context.Context, r *rotation.Rotation) error {
+		got = r
+		return nil
+	}))
+	report, err := c.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, report.Rotated, 1)
+	assert.Empty(t, rotates(f))
+	assert.Equal(t, 1, got.OldVersion)
+	assert.Equal(t, 2, got.NewVersion)
+}
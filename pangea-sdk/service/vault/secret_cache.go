@@ -0,0 +1,458 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+)
+
+// ErrSecretCacheClosed is returned by a closed SecretCache.
+var ErrSecretCacheClosed = errors.New("vault: secret cache closed")
+
+// minSecretTTL bounds the TTLs derived from items, so that secrets whose
+// rotation or expiry is imminent are not refetched continuously.
+const minSecretTTL = time.Second
+
+// CachedSecret is a secret version served by a SecretCache.
+type CachedSecret struct {
+	ID      string
+	Version int
+	Secret  string
+
+	// The item, as returned by Get.
+	Item ItemData
+
+	FetchedAt time.Time
+	ExpiresAt time.Time
+
+	// Whether the secret expired and is served because it could not be
+	// refreshed.
+	Stale bool
+}
+
+type SecretCacheOption func(*SecretCache) error
+
+// WithSecretCacheTTL sets the maximum time a secret is cached, shortened to
+// its next rotation or expiry. Defaults to 5 minutes.
+func WithSecretCacheTTL(d time.Duration) SecretCacheOption {
+	return func(c *SecretCache) error {
+		if d <= 0 {
+			return errors.New("vault: secret cache TTL must be positive")
+		}
+		c.ttl = d
+		return nil
+	}
+}
+
+// WithSecretCacheRefreshAhead sets how long before expiry secrets are
+// refreshed in the background. Defaults to 30 seconds, or a quarter of the
+// TTL if shorter.
+func WithSecretCacheRefreshAhead(d time.Duration) SecretCacheOption {
+	return func(c *SecretCache) error {
+		if d < 0 {
+			return errors.New("vault: negative secret cache refresh ahead")
+		}
+		c.refreshAhead = d
+		return nil
+	}
+}
+
+// WithSecretCacheMaxStale sets how long past expiry a secret is served when it
+// cannot be refreshed, e.g. during a Vault outage. Defaults to 5 minutes.
+func WithSecretCacheMaxStale(d time.Duration) SecretCacheOption {
+	return func(c *SecretCache) error {
+		if d < 0 {
+			return errors.New("vault: negative secret cache max stale")
+		}
+		c.maxStale = d
+		return nil
+	}
+}
+
+// WithSecretCacheRetryInterval sets the time between two background refreshes
+// of a secret after a failure, or while its rotation is overdue. Defaults to
+// 10 seconds.
+func WithSecretCacheRetryInterval(d time.Duration) SecretCacheOption {
+	return func(c *SecretCache) error {
+		if d <= 0 {
+			return errors.New("vault: secret cache retry interval must be positive")
+		}
+		c.retryInterval = d
+		return nil
+	}
+}
+
+// WithSecretCacheOnError sets a function called with the errors of background
+// refreshes.
+func WithSecretCacheOnError(fn func(id string, err error)) SecretCacheOption {
+	return func(c *SecretCache) error {
+		c.onError = fn
+		return nil
+	}
+}
+
+type secretEntry struct {
+	secret      *CachedSecret
+	refreshAt   time.Time
+	subscribers map[int]func(old, new *CachedSecret)
+}
+
+type secretFetch struct {
+	done   chan struct{}
+	secret *CachedSecret
+	err    error
+}
+
+// SecretCache caches the current versions of Vault secrets. Secrets are
+// fetched with Get on first use and refreshed in the background before they
+// expire, so that rotations are picked up without blocking readers.
+type SecretCache struct {
+	client        Client
+	ttl           time.Duration
+	refreshAhead  time.Duration
+	maxStale      time.Duration
+	retryInterval time.Duration
+	onError       func(id string, err error)
+
+	mu       sync.Mutex
+	entries  map[string]*secretEntry
+	inflight map[string]*secretFetch
+	nextSub  int
+	closed   bool
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewSecretCache creates a cache fetching secrets through client. Close must
+// be called to stop the background refreshes.
+//
+// @example
+//
+//	cache, err := vault.NewSecretCache(vaultcli)
+//	if err != nil {
+//		return err
+//	}
+//	defer cache.Close()
+//
+//	password, err := cache.Secret(ctx, "pvi_...")
+//
+//	unsubscribe, err := cache.Subscribe(ctx, "pvi_...", func(old, new *vault.CachedSecret) {
+//		reconnect(new.Secret)
+//	})
+func NewSecretCache(client Client, opts ...SecretCacheOption) (*SecretCache, error) {
+	if client == nil {
+		return nil, errors.New("vault: nil client")
+	}
+	c := &SecretCache{
+		client:        client,
+		ttl:           5 * time.Minute,
+		refreshAhead:  -1,
+		maxStale:      5 * time.Minute,
+		retryInterval: 10 * time.Second,
+		entries:       map[string]*secretEntry{},
+		inflight:      map[string]*secretFetch{},
+		wake:          make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	if c.refreshAhead < 0 {
+		c.refreshAhead = min(30*time.Second, c.ttl/4)
+	}
+
+	go c.run()
+	return c, nil
+}
+
+// Get returns the current version of the secret id, fetching it if it is not
+// cached or expired. If it cannot be fetched, an expired version is returned
+// with Stale set for up to the max stale duration.
+func (c *SecretCache) Get(ctx context.Context, id string) (*CachedSecret, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrSecretCacheClosed
+	}
+	e := c.entries[id]
+	if e != nil && time.Now().Before(e.secret.ExpiresAt) {
+		s := *e.secret
+		c.mu.Unlock()
+		return &s, nil
+	}
+	c.mu.Unlock()
+
+	s, err := c.refresh(ctx, id)
+	if err == nil {
+		return s, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e := c.entries[id]; e != nil && time.Now().Before(e.secret.ExpiresAt.Add(c.maxStale)) {
+		stale := *e.secret
+		stale.Stale = true
+		return &stale, nil
+	}
+	return nil, err
+}
+
+// Secret returns the value of the current version of the secret id.
+func (c *SecretCache) Secret(ctx context.Context, id string) (string, error) {
+	s, err := c.Get(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return s.Secret, nil
+}
+
+// Rotate rotates a secret with SecretRotate and caches its new version.
+func (c *SecretCache) Rotate(ctx context.Context, input *SecretRotateRequest) (*CachedSecret, error) {
+	if _, err := c.client.SecretRotate(ctx, input); err != nil {
+		return nil, err
+	}
+	return c.refresh(ctx, input.ID)
+}
+
+// Invalidate evicts the secret id, which is fetched again on next use.
+// Subscribers are kept.
+func (c *SecretCache) Invalidate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e := c.entries[id]; e != nil {
+		if len(e.subscribers) == 0 {
+			delete(c.entries, id)
+		} else {
+			e.secret.ExpiresAt = time.Time{}
+			e.refreshAt = time.Now()
+			c.signal()
+		}
+	}
+}
+
+// Subscribe registers fn to be called when the version or the value of the
+// secret id changes, and fetches it if needed so that changes are tracked
+// from then on. It returns a function unregistering fn.
+func (c *SecretCache) Subscribe(ctx context.Context, id string, fn func(old, new *CachedSecret)) (func(), error) {
+	if _, err := c.Get(ctx, id); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entries[id]
+	if e == nil {
+		return nil, errors.New("vault: secret " + id + " was invalidated")
+	}
+	if e.subscribers == nil {
+		e.subscribers = map[int]func(old, new *CachedSecret){}
+	}
+	sub := c.nextSub
+	c.nextSub++
+	e.subscribers[sub] = fn
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if e := c.entries[id]; e != nil {
+			delete(e.subscribers, sub)
+		}
+	}, nil
+}
+
+// Close stops the background refreshes.
+func (c *SecretCache) Close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	close(c.stop)
+	<-c.done
+}
+
+// refresh fetches the secret id, deduplicating concurrent fetches, and
+// notifies the subscribers if it changed.
+func (c *SecretCache) refresh(ctx context.Context, id string) (*CachedSecret, error) {
+	c.mu.Lock()
+	if f := c.inflight[id]; f != nil {
+		c.mu.Unlock()
+		select {
+		case <-f.done:
+			return f.secret, f.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	f := &secretFetch{done: make(chan struct{})}
+	c.inflight[id] = f
+	c.mu.Unlock()
+
+	f.secret, f.err = c.fetch(ctx, id)
+
+	c.mu.Lock()
+	delete(c.inflight, id)
+	close(f.done)
+	if f.err != nil {
+		if e := c.entries[id]; e != nil {
+			e.refreshAt = time.Now().Add(c.retryInterval)
+		}
+		c.mu.Unlock()
+		return nil, f.err
+	}
+
+	e := c.entries[id]
+	var old *CachedSecret
+	var subscribers []func(old, new *CachedSecret)
+	if e == nil {
+		e = &secretEntry{}
+		c.entries[id] = e
+	} else {
+		old = e.secret
+		if old.Version != f.secret.Version || old.Secret != f.secret.Secret {
+			for _, fn := range e.subscribers {
+				subscribers = append(subscribers, fn)
+			}
+		}
+	}
+	e.secret = f.secret
+	e.refreshAt = c.refreshTime(f.secret)
+	c.signal()
+	c.mu.Unlock()
+
+	for _, fn := range subscribers {
+		s := *f.secret
+		fn(old, &s)
+	}
+	s := *f.secret
+	return &s, nil
+}
+
+func (c *SecretCache) fetch(ctx context.Context, id string) (*CachedSecret, error) {
+	resp, err := c.client.Get(ctx, &GetRequest{ID: id})
+	if err != nil {
+		return nil, err
+	}
+	item := resp.Result.ItemData
+	iv := selectVersion(item.ItemVersions, 0)
+	if iv == nil {
+		return nil, errors.New("vault: no active version of secret " + id)
+	}
+
+	now := time.Now()
+	return &CachedSecret{
+		ID:        id,
+		Version:   iv.Version,
+		Secret:    pangea.StringValue(iv.Secret),
+		Item:      item,
+		FetchedAt: now,
+		ExpiresAt: now.Add(c.secretTTL(now, &item, iv)),
+	}, nil
+}
+
+// secretTTL returns the cache TTL, shortened to the next rotation or expiry of
+// the secret. Overdue rotations are polled at the retry interval.
+func (c *SecretCache) secretTTL(now time.Time, item *ItemData, iv *ItemVersionData) time.Duration {
+	ttl := c.ttl
+	deadlines := []string{item.NextRotation, item.DisabledAt, pangea.StringValue(iv.DestroyedAt)}
+	for i, s := range deadlines {
+		if s == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			continue
+		}
+		d := t.Sub(now)
+		if d <= 0 && i == 0 {
+			d = c.retryInterval
+		}
+		if d > 0 && d < ttl {
+			ttl = d
+		}
+	}
+	return max(ttl, min(minSecretTTL, c.ttl))
+}
+
+// refreshTime returns when a secret is refreshed in the background. Secrets
+// cached for less than the refresh ahead duration, e.g. while their rotation
+// is overdue, are refreshed after the retry interval at the earliest.
+func (c *SecretCache) refreshTime(s *CachedSecret) time.Time {
+	t := s.ExpiresAt.Add(-c.refreshAhead)
+	if earliest := s.FetchedAt.Add(min(c.retryInterval, s.ExpiresAt.Sub(s.FetchedAt))); t.Before(earliest) {
+		return earliest
+	}
+	return t
+}
+
+// signal wakes the background refresher up to reschedule. c.mu must be held.
+func (c *SecretCache) signal() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run refreshes the cached secrets in the background as they become due.
+func (c *SecretCache) run() {
+	defer close(c.done)
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		due, next := c.due()
+		for _, id := range due {
+			ctx, cancel := context.WithTimeout(context.Background(), c.retryInterval)
+			_, err := c.refresh(ctx, id)
+			cancel()
+			if err != nil && c.onError != nil {
+				c.onError(id, err)
+			}
+		}
+
+		// The refreshed secrets are rescheduled by refresh: loop without
+		// waiting, but still give Close a chance to stop the loop.
+		wait := time.Until(next)
+		if len(due) > 0 {
+			wait = 0
+		}
+		timer.Reset(wait)
+		select {
+		case <-c.stop:
+			return
+		case <-c.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// due returns the secrets to refresh now, and when the next one is due.
+func (c *SecretCache) due() ([]string, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	next := now.Add(time.Hour)
+	due := []string{}
+	for id, e := range c.entries {
+		if _, ok := c.inflight[id]; ok {
+			continue
+		}
+		if !e.refreshAt.After(now) {
+			due = append(due, id)
+		} else if e.refreshAt.Before(next) {
+			next = e.refreshAt
+		}
+	}
+	return due, next
+}
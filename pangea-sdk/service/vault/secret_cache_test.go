@@ -0,0 +1,185 @@
+//go:build unit
+
+package vault_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeatesting"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockSecrets struct {
+	version      atomic.Int32
+	gets         atomic.Int32
+	down         atomic.Bool
+	nextRotation atomic.Value
+}
+
+func setupSecretVault(t *testing.T) (vault.Client, *mockSecrets, func()) {
+	mux, url, teardown := pangeatesting.SetupServer()
+
+	m := &mockSecrets{}
+	m.version.Store(1)
+	m.nextRotation.Store("")
+	mux.HandleFunc("/v2/get", func(w http.ResponseWriter, r *http.Request) {
+		m.gets.Add(1)
+		if m.down.Load() {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"request_id": "some-id", "status": "ValidationError", "result": null, "summary": "unavailable"}`)
+			return
+		}
+		v := m.version.Load()
+		fmt.Fprintf(w, `{"request_id": "some-id", "status": "Success", "result": {"id": "pvi_db", "type": "secret", "num_versions": %v, "next_rotation": %q, "item_versions": [{"version": %v, "state": "active", "secret": "password%v"}]}, "summary": "ok"}`, v, m.nextRotation.Load(), v, v)
+	})
+	mux.HandleFunc("/v2/secret/rotate", func(w http.ResponseWriter, r *http.Request) {
+		v := m.version.Add(1)
+		fmt.Fprintf(w, `{"request_id": "some-id", "status": "Success", "result": {"id": "pvi_db", "type": "secret", "num_versions": %v}, "summary": "ok"}`, v)
+	})
+
+	return vault.New(pangeatesting.TestConfig(url)), m, teardown
+}
+
+func TestSecretCache(t *testing.T) {
+	client, m, teardown := setupSecretVault(t)
+	defer teardown()
+	ctx := context.Background()
+
+	cache, err := vault.NewSecretCache(client, vault.WithSecretCacheTTL(time.Hour))
+	assert.NoError(t, err)
+	defer cache.Close()
+
+	secret, err := cache.Secret(ctx, "pvi_db")
+	assert.NoError(t, err)
+	assert.Equal(t, "password1", secret)
+	secret, _ = cache.Secret(ctx, "pvi_db")
+	assert.Equal(t, "password1", secret)
+	assert.Equal(t, int32(1), m.gets.Load())
+
+	changes := make(chan [2]int, 1)
+	unsubscribe, err := cache.Subscribe(ctx, "pvi_db", func(old, new *vault.CachedSecret) {
+		changes <- [2]int{old.Version, new.Version}
+	})
+	assert.NoError(t, err)
+
+	s, err := cache.Rotate(ctx, &vault.SecretRotateRequest{CommonRotateRequest: vault.CommonRotateRequest{ID: "pvi_db"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, s.Version)
+	assert.Equal(t, "password2", s.Secret)
+	assert.Equal(t, [2]int{1, 2}, <-changes)
+
+	secret, _ = cache.Secret(ctx, "pvi_db")
+	assert.Equal(t, "password2", secret)
+
+	unsubscribe()
+	cache.Invalidate("pvi_db")
+	m.version.Store(3)
+	secret, _ = cache.Secret(ctx, "pvi_db")
+	assert.Equal(t, "password3", secret)
+	assert.Empty(t, changes)
+}
+
+func TestSecretCache_BackgroundRefresh(t *testing.T) {
+	client, m, teardown := setupSecretVault(t)
+	defer teardown()
+	ctx := context.Background()
+
+	// The TTL is shortened to the next rotation.
+	m.nextRotation.Store(time.Now().Add(2 * time.Second).UTC().Format(time.RFC3339Nano))
+	cache, err := vault.NewSecretCache(client, vault.WithSecretCacheRefreshAhead(time.Second), vault.WithSecretCacheRetryInterval(100*time.Millisecond))
+	assert.NoError(t, err)
+	defer cache.Close()
+
+	s, err := cache.Get(ctx, "pvi_db")
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(2*time.Second), s.ExpiresAt, 500*time.Millisecond)
+
+	changes := make(chan *vault.CachedSecret, 1)
+	_, err = cache.Subscribe(ctx, "pvi_db", func(old, new *vault.CachedSecret) {
+		changes <- new
+	})
+	assert.NoError(t, err)
+
+	m.version.Store(2)
+	m.nextRotation.Store(time.Now().Add(time.Hour).UTC().Format(time.RFC3339Nano))
+	select {
+	case s := <-changes:
+		assert.Equal(t, "password2", s.Secret)
+	case <-time.After(3 * time.Second):
+		t.Fatal("secret not refreshed")
+	}
+}
+
+func TestSecretCache_Stale(t *testing.T) {
+	client, m, teardown := setupSecretVault(t)
+	defer teardown()
+	ctx := context.Background()
+
+	cache, err := vault.NewSecretCache(client,
+		vault.WithSecretCacheTTL(100*time.Millisecond),
+		vault.WithSecretCacheMaxStale(300*time.Millisecond),
+		vault.WithSecretCacheRetryInterval(time.Hour),
+	)
+	assert.NoError(t, err)
+	defer cache.Close()
+
+	_, err = cache.Get(ctx, "pvi_db")
+	assert.NoError(t, err)
+
+	m.down.Store(true)
+	time.Sleep(150 * time.Millisecond)
+	s, err := cache.Get(ctx, "pvi_db")
+	assert.NoError(t, err)
+	assert.True(t, s.Stale)
+	assert.Equal(t, "password1", s.Secret)
+
+	time.Sleep(300 * time.Millisecond)
+	_, err = cache.Get(ctx, "pvi_db")
+	assert.Error(t, err)
+
+	m.down.Store(false)
+	s, err = cache.Get(ctx, "pvi_db")
+	assert.NoError(t, err)
+	assert.False(t, s.Stale)
+
+	cache.Close()
+	_, err = cache.Get(ctx, "pvi_db")
+	assert.ErrorIs(t, err, vault.ErrSecretCacheClosed)
+}
+
+func TestSecretCache_FailingRefresh(t *testing.T) {
+	client, m, teardown := setupSecretVault(t)
+	defer teardown()
+
+	// The rotation is overdue, then Vault becomes unavailable.
+	m.nextRotation.Store(time.Now().Add(-time.Minute).UTC().Format(time.RFC3339Nano))
+	cache, err := vault.NewSecretCache(client, vault.WithSecretCacheRetryInterval(50*time.Millisecond))
+	assert.NoError(t, err)
+
+	_, err = cache.Get(context.Background(), "pvi_db")
+	assert.NoError(t, err)
+
+	// Overdue rotations and failed refreshes are polled at the retry interval.
+	time.Sleep(500 * time.Millisecond)
+	assert.Less(t, m.gets.Load(), int32(20))
+	m.down.Store(true)
+	time.Sleep(500 * time.Millisecond)
+	assert.Less(t, m.gets.Load(), int32(40))
+
+	closed := make(chan struct{})
+	go func() {
+		cache.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not return")
+	}
+}
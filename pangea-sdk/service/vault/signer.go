@@ -0,0 +1,424 @@
+package vault
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/signer"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/pangea"
+)
+
+// ErrPrehashedDigest is returned by Signer.Sign for keys whose algorithm
+// hashes the message, as Vault signs messages rather than digests. Such keys
+// sign through SignMessage, which crypto.SignMessage and x509.CreateCertificate
+// use when available.
+var ErrPrehashedDigest = errors.New("vault: key signs messages, not digests; use SignMessage")
+
+type keyOptions struct {
+	version int
+}
+
+type KeyOption func(*keyOptions) error
+
+// WithKeyVersion pins the key version used by a Signer, a Decrypter or a
+// verifier. Defaults to the latest active version.
+func WithKeyVersion(version int) KeyOption {
+	return func(o *keyOptions) error {
+		if version <= 0 {
+			return errors.New("vault: key version must be positive")
+		}
+		o.version = version
+		return nil
+	}
+}
+
+// remoteKey is a Vault asymmetric key version and its public key.
+type remoteKey struct {
+	client    Client
+	id        string
+	version   int
+	algorithm string
+	public    crypto.PublicKey
+}
+
+func fetchRemoteKey(ctx context.Context, client Client, keyID string, opts []KeyOption) (*remoteKey, error) {
+	item, iv, err := fetchKeyVersion(ctx, client, keyID, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &remoteKey{
+		client:    client,
+		id:        keyID,
+		version:   iv.Version,
+		algorithm: item.Algorithm,
+	}
+	if iv.PublicKey != nil {
+		k.public, err = parsePublicKeyPEM(string(*iv.PublicKey))
+	} else {
+		k.public, err = fetchJWKPublicKey(ctx, client, keyID, iv.Version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// fetchKeyVersion returns a key and its version selected by opts.
+func fetchKeyVersion(ctx context.Context, client Client, keyID string, opts []KeyOption) (*ItemData, *ItemVersionData, error) {
+	if client == nil {
+		return nil, nil, errors.New("vault: nil client")
+	}
+	o := keyOptions{}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	input := &GetRequest{ID: keyID}
+	if o.version > 0 {
+		input.Version = strconv.Itoa(o.version)
+	}
+	resp, err := client.Get(ctx, input)
+	if err != nil {
+		return nil, nil, err
+	}
+	item := &resp.Result.ItemData
+
+	iv := selectVersion(item.ItemVersions, o.version)
+	if iv == nil {
+		return nil, nil, fmt.Errorf("vault: no usable version of key %s", keyID)
+	}
+	return item, iv, nil
+}
+
+// selectVersion returns the requested version or, if version is zero, the
+// latest active version.
+func selectVersion(versions []ItemVersionData, version int) *ItemVersionData {
+	var selected *ItemVersionData
+	for i := range versions {
+		v := &versions[i]
+		if version > 0 {
+			if v.Version == version {
+				return v
+			}
+			continue
+		}
+		if v.State == string(IVSactive) && (selected == nil || v.Version > selected.Version) {
+			selected = v
+		}
+	}
+	return selected
+}
+
+func parsePublicKeyPEM(s string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("vault: invalid public key PEM")
+	}
+	// "RSA PUBLIC KEY" blocks may hold PKIX keys, e.g. from
+	// rsa.EncodePEMPublicKey.
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err == nil {
+		return key, nil
+	}
+	if rsaKey, rsaErr := x509.ParsePKCS1PublicKey(block.Bytes); rsaErr == nil {
+		return rsaKey, nil
+	}
+	return nil, fmt.Errorf("vault: unsupported public key: %w", err)
+}
+
+func fetchJWKPublicKey(ctx context.Context, client Client, keyID string, version int) (crypto.PublicKey, error) {
+	resp, err := client.JWKGet(ctx, &JWKGetRequest{ID: keyID, Version: pangea.String(strconv.Itoa(version))})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Result.Keys) == 0 {
+		return nil, fmt.Errorf("vault: no public key for key %s", keyID)
+	}
+	return resp.Result.Keys[0].PublicKey()
+}
+
+// Signer is a crypto.Signer backed by a Vault asymmetric signing key. The
+// private key never leaves Vault.
+//
+// Vault hashes the messages it signs and does not sign digests, so Sign only
+// accepts unhashed messages, i.e. with Ed25519 keys, and returns
+// ErrPrehashedDigest for ECDSA and RSA keys. These keys sign through
+// SignMessage, implementing crypto.MessageSigner, which x509.CreateCertificate
+// and crypto/tls (TLS 1.2 and later) use, provided they request the hash and
+// padding of the key algorithm. Callers handing over digests, e.g.
+// golang.org/x/crypto/ssh and TLS 1.0 and 1.1, require Ed25519 keys.
+type Signer struct {
+	key  *remoteKey
+	hash crypto.Hash
+	pss  bool
+}
+
+var _ crypto.MessageSigner = (*Signer)(nil)
+
+// NewSigner returns a signer for the Vault key keyID, fetching its public key
+// with Get, or JWKGet for keys without a PEM public key.
+//
+// @example
+//
+//	signer, err := vault.NewSigner(ctx, vaultcli, "pvi_...")
+//	if err != nil {
+//		return err
+//	}
+//
+//	template.SignatureAlgorithm = signer.SignatureAlgorithm()
+//	der, err := x509.CreateCertificate(rand.Reader, template, template, signer.Public(), signer)
+func NewSigner(ctx context.Context, client Client, keyID string, opts ...KeyOption) (*Signer, error) {
+	k, err := fetchRemoteKey(ctx, client, keyID, opts)
+	if err != nil {
+		return nil, err
+	}
+	hash, pss, err := signingScheme(k.algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	switch k.public.(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey, *rsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("vault: unsupported public key type %T", k.public)
+	}
+	return &Signer{key: k, hash: hash, pss: pss}, nil
+}
+
+// signingScheme returns the hash and the RSA padding of a signing algorithm.
+func signingScheme(algorithm string) (crypto.Hash, bool, error) {
+	switch AsymmetricAlgorithm(algorithm) {
+	case AAed25519:
+		return 0, false, nil
+	case AAes256:
+		return crypto.SHA256, false, nil
+	case AAes384:
+		return crypto.SHA384, false, nil
+	case AAes512:
+		return crypto.SHA512, false, nil
+	case AArsa2048_pkcs1v15_sha256:
+		return crypto.SHA256, false, nil
+	case AArsa2048_pss_sha256, AArsa3072_pss_sha256, AArsa4096_pss_sha256:
+		return crypto.SHA256, true, nil
+	case AArsa4096_pss_sha512:
+		return crypto.SHA512, true, nil
+	}
+	return 0, false, fmt.Errorf("vault: unsupported signing algorithm %q", algorithm)
+}
+
+// Public returns the public key of the signing key version.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.key.public
+}
+
+// Version returns the signing key version.
+func (s *Signer) Version() int {
+	return s.key.version
+}
+
+// SignatureAlgorithm returns the x509 signature algorithm of the key, to set
+// in certificate templates as RSA keys otherwise default to PKCS #1 v1.5.
+func (s *Signer) SignatureAlgorithm() x509.SignatureAlgorithm {
+	switch s.key.public.(type) {
+	case ed25519.PublicKey:
+		return x509.PureEd25519
+	case *ecdsa.PublicKey:
+		switch s.hash {
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512
+		}
+	case *rsa.PublicKey:
+		switch {
+		case s.pss && s.hash == crypto.SHA256:
+			return x509.SHA256WithRSAPSS
+		case s.pss && s.hash == crypto.SHA512:
+			return x509.SHA512WithRSAPSS
+		case s.hash == crypto.SHA256:
+			return x509.SHA256WithRSA
+		}
+	}
+	return x509.UnknownSignatureAlgorithm
+}
+
+// Sign signs an unhashed message with an Ed25519 key. For other keys, it
+// returns ErrPrehashedDigest.
+func (s *Signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if s.hash != 0 {
+		return nil, ErrPrehashedDigest
+	}
+	return s.SignMessage(rand, digest, opts)
+}
+
+// SignMessage signs msg, which Vault hashes with the hash of the key
+// algorithm. opts must match the algorithm.
+func (s *Signer) SignMessage(rand io.Reader, msg []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.SignMessageContext(context.Background(), msg, opts)
+}
+
+// SignMessageContext is like SignMessage, with a context for the Vault call.
+func (s *Signer) SignMessageContext(ctx context.Context, msg []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if err := s.checkOpts(opts); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.key.client.Sign(ctx, &SignRequest{
+		ID:      s.key.id,
+		Version: pangea.Int(s.key.version),
+		Message: base64.StdEncoding.EncodeToString(msg),
+	})
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(resp.Result.Signature)
+	if err != nil {
+		return nil, errors.New("vault: invalid signature encoding")
+	}
+
+	if k, ok := s.key.public.(*ecdsa.PublicKey); ok {
+		return signer.ECDSASignatureASN1(k, sig)
+	}
+	return sig, nil
+}
+
+func (s *Signer) checkOpts(opts crypto.SignerOpts) error {
+	var hash crypto.Hash
+	if opts != nil {
+		hash = opts.HashFunc()
+	}
+	if hash != s.hash {
+		return fmt.Errorf("vault: algorithm %s does not sign with hash %v", s.key.algorithm, hash)
+	}
+
+	pssOpts, isPSS := opts.(*rsa.PSSOptions)
+	if _, isRSA := s.key.public.(*rsa.PublicKey); isRSA && isPSS != s.pss {
+		return fmt.Errorf("vault: algorithm %s does not match the requested RSA padding", s.key.algorithm)
+	}
+	if isPSS && pssOpts.SaltLength != rsa.PSSSaltLengthAuto && pssOpts.SaltLength != rsa.PSSSaltLengthEqualsHash && pssOpts.SaltLength != hash.Size() {
+		return errors.New("vault: PSS signatures use a salt as long as the hash")
+	}
+	if edOpts, ok := opts.(*ed25519.Options); ok && edOpts.Context != "" {
+		return errors.New("vault: Ed25519 contexts are not supported")
+	}
+	return nil
+}
+
+// Decrypter is a crypto.Decrypter backed by a Vault RSA-OAEP encryption key.
+// The private key never leaves Vault.
+type Decrypter struct {
+	key  *remoteKey
+	hash crypto.Hash
+}
+
+var _ crypto.Decrypter = (*Decrypter)(nil)
+
+// NewDecrypter returns a decrypter for the Vault RSA-OAEP key keyID, fetching
+// its public key with Get.
+//
+// @example
+//
+//	decrypter, err := vault.NewDecrypter(ctx, vaultcli, "pvi_...")
+//	if err != nil {
+//		return err
+//	}
+//
+//	ct, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, decrypter.Public().(*rsa.PublicKey), secret, nil)
+//	pt, err := decrypter.Decrypt(nil, ct, &rsa.OAEPOptions{Hash: crypto.SHA256})
+func NewDecrypter(ctx context.Context, client Client, keyID string, opts ...KeyOption) (*Decrypter, error) {
+	k, err := fetchRemoteKey(ctx, client, keyID, opts)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := oaepHash(k.algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := k.public.(*rsa.PublicKey); !ok {
+		return nil, fmt.Errorf("vault: unsupported public key type %T", k.public)
+	}
+	return &Decrypter{key: k, hash: hash}, nil
+}
+
+// oaepHash returns the hash of an RSA-OAEP algorithm, e.g.
+// RSA-OAEP-2048-SHA256.
+func oaepHash(algorithm string) (crypto.Hash, error) {
+	if strings.HasPrefix(algorithm, "RSA-OAEP-") {
+		switch algorithm[strings.LastIndex(algorithm, "-")+1:] {
+		case "SHA1":
+			return crypto.SHA1, nil
+		case "SHA256":
+			return crypto.SHA256, nil
+		case "SHA512":
+			return crypto.SHA512, nil
+		}
+	}
+	return 0, fmt.Errorf("vault: unsupported decryption algorithm %q", algorithm)
+}
+
+// Public returns the public key of the decryption key version.
+func (d *Decrypter) Public() crypto.PublicKey {
+	return d.key.public
+}
+
+// Version returns the decryption key version.
+func (d *Decrypter) Version() int {
+	return d.key.version
+}
+
+// Hash returns the OAEP hash of the key algorithm.
+func (d *Decrypter) Hash() crypto.Hash {
+	return d.hash
+}
+
+// Decrypt decrypts msg. opts may be nil or *rsa.OAEPOptions matching the key
+// algorithm, without a label.
+func (d *Decrypter) Decrypt(rand io.Reader, msg []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	return d.DecryptContext(context.Background(), msg, opts)
+}
+
+// DecryptContext is like Decrypt, with a context for the Vault call.
+func (d *Decrypter) DecryptContext(ctx context.Context, msg []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	switch o := opts.(type) {
+	case nil:
+	case *rsa.OAEPOptions:
+		if o.Hash != d.hash || (o.MGFHash != 0 && o.MGFHash != d.hash) {
+			return nil, fmt.Errorf("vault: algorithm %s does not use hash %v", d.key.algorithm, o.Hash)
+		}
+		if len(o.Label) > 0 {
+			return nil, errors.New("vault: OAEP labels are not supported")
+		}
+	default:
+		return nil, fmt.Errorf("vault: unsupported decrypter options %T", opts)
+	}
+
+	resp, err := d.key.client.Decrypt(ctx, &DecryptRequest{
+		ID:         d.key.id,
+		CipherText: base64.StdEncoding.EncodeToString(msg),
+		Version:    pangea.Int(d.key.version),
+	})
+	if err != nil {
+		return nil, err
+	}
+	plain, err := base64.StdEncoding.DecodeString(resp.Result.PlainText)
+	if err != nil {
+		return nil, errors.New("vault: invalid plaintext encoding")
+	}
+	return plain, nil
+}
@@ -0,0 +1,163 @@
+//go:build unit
+
+package vault_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/pangeatesting"
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/service/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockKey struct {
+	algorithm string
+	key       crypto.Signer
+}
+
+// setupSigningVault mocks Vault signing and decrypting with local keys, the
+// messages being hashed as Vault does.
+func setupSigningVault(t *testing.T, keys map[string]mockKey) (vault.Client, func()) {
+	mux, url, teardown := pangeatesting.SetupServer()
+
+	mux.HandleFunc("/v2/get", func(w http.ResponseWriter, r *http.Request) {
+		var input vault.GetRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+		k := keys[input.ID]
+		der, _ := x509.MarshalPKIXPublicKey(k.key.Public())
+		pub := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+		fmt.Fprintf(w, `{"request_id": "some-id", "status": "Success", "result": {"id": %q, "type": "asymmetric_key", "algorithm": %q, "item_versions": [{"version": 1, "state": "deactivated"}, {"version": 2, "state": "active", "public_key": %q}]}, "summary": "ok"}`, input.ID, k.algorithm, pub)
+	})
+	mux.HandleFunc("/v2/sign", func(w http.ResponseWriter, r *http.Request) {
+		var input vault.SignRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+		assert.Equal(t, 2, *input.Version)
+		msg, _ := base64.StdEncoding.DecodeString(input.Message)
+
+		var sig []byte
+		var err error
+		switch k := keys[input.ID].key.(type) {
+		case ed25519.PrivateKey:
+			sig = ed25519.Sign(k, msg)
+		case *ecdsa.PrivateKey:
+			digest := sha256.Sum256(msg)
+			sig, err = ecdsa.SignASN1(rand.Reader, k, digest[:])
+		case *rsa.PrivateKey:
+			digest := sha256.Sum256(msg)
+			sig, err = rsa.SignPSS(rand.Reader, k, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		assert.NoError(t, err)
+		fmt.Fprintf(w, `{"request_id": "some-id", "status": "Success", "result": {"id": %q, "version": 2, "algorithm": %q, "signature": %q}, "summary": "ok"}`, input.ID, keys[input.ID].algorithm, base64.StdEncoding.EncodeToString(sig))
+	})
+	mux.HandleFunc("/v2/decrypt", func(w http.ResponseWriter, r *http.Request) {
+		var input vault.DecryptRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+		ct, _ := base64.StdEncoding.DecodeString(input.CipherText)
+		pt, err := rsa.DecryptOAEP(sha256.New(), nil, keys[input.ID].key.(*rsa.PrivateKey), ct, nil)
+		assert.NoError(t, err)
+		fmt.Fprintf(w, `{"request_id": "some-id", "status": "Success", "result": {"id": %q, "version": 2, "algorithm": %q, "plain_text": %q}, "summary": "ok"}`, input.ID, keys[input.ID].algorithm, base64.StdEncoding.EncodeToString(pt))
+	})
+
+	return vault.New(pangeatesting.TestConfig(url)), teardown
+}
+
+func TestSigner(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	client, teardown := setupSigningVault(t, map[string]mockKey{
+		"pvi_ec":  {"ES256", ecKey},
+		"pvi_rsa": {"RSA-PSS-2048-SHA256", rsaKey},
+		"pvi_ed":  {"ED25519", edKey},
+	})
+	defer teardown()
+	ctx := context.Background()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	for _, id := range []string{"pvi_ec", "pvi_rsa", "pvi_ed"} {
+		signer, err := vault.NewSigner(ctx, client, id)
+		assert.NoError(t, err, id)
+		assert.Equal(t, 2, signer.Version())
+		template.SignatureAlgorithm = signer.SignatureAlgorithm()
+
+		der, err := x509.CreateCertificate(rand.Reader, template, template, signer.Public(), signer)
+		assert.NoError(t, err, id)
+		cert, err := x509.ParseCertificate(der)
+		if assert.NoError(t, err, id) {
+			assert.NoError(t, cert.CheckSignatureFrom(cert), id)
+		}
+	}
+
+	// Digests cannot be signed with keys hashing the message.
+	signer, _ := vault.NewSigner(ctx, client, "pvi_ec")
+	digest := sha256.Sum256([]byte("message"))
+	_, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	assert.ErrorIs(t, err, vault.ErrPrehashedDigest)
+	_, err = signer.SignMessage(rand.Reader, []byte("message"), crypto.SHA384)
+	assert.Error(t, err)
+
+	sig, err := crypto.SignMessage(signer, rand.Reader, []byte("message"), crypto.SHA256)
+	assert.NoError(t, err)
+	assert.True(t, ecdsa.VerifyASN1(&ecKey.PublicKey, digest[:], sig))
+
+	edSigner, _ := vault.NewSigner(ctx, client, "pvi_ed")
+	sig, err = edSigner.Sign(rand.Reader, []byte("message"), crypto.Hash(0))
+	assert.NoError(t, err)
+	assert.True(t, ed25519.Verify(edKey.Public().(ed25519.PublicKey), []byte("message"), sig))
+
+	_, err = vault.NewDecrypter(ctx, client, "pvi_ec")
+	assert.Error(t, err)
+}
+
+func TestDecrypter(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	client, teardown := setupSigningVault(t, map[string]mockKey{
+		"pvi_rsa": {"RSA-OAEP-2048-SHA256", rsaKey},
+	})
+	defer teardown()
+
+	decrypter, err := vault.NewDecrypter(context.Background(), client, "pvi_rsa")
+	assert.NoError(t, err)
+	assert.Equal(t, crypto.SHA256, decrypter.Hash())
+
+	ct, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, decrypter.Public().(*rsa.PublicKey), []byte("secret"), nil)
+	assert.NoError(t, err)
+	pt, err := decrypter.Decrypt(nil, ct, &rsa.OAEPOptions{Hash: crypto.SHA256})
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", string(pt))
+
+	_, err = decrypter.Decrypt(nil, ct, &rsa.OAEPOptions{Hash: crypto.SHA1})
+	assert.Error(t, err)
+	_, err = decrypter.Decrypt(nil, ct, &rsa.PKCS1v15DecryptOptions{})
+	assert.Error(t, err)
+
+	_, err = vault.NewSigner(context.Background(), client, "pvi_rsa")
+	assert.Error(t, err)
+}
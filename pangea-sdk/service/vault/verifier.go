@@ -0,0 +1,61 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pangeacyber/pangea-go/pangea-sdk/v5/internal/signer"
+)
+
+// ErrUnsupportedAlgorithm is returned when no verifier is registered for the
+// algorithm of a key.
+var ErrUnsupportedAlgorithm = signer.ErrUnsupportedAlgorithm
+
+// SignatureVerifier verifies the signatures of messages made by a key version.
+type SignatureVerifier interface {
+	Verify(msg, sig []byte) (bool, error)
+}
+
+// VerifierFactory returns a verifier for a public key, in the raw encoding of
+// its algorithm, i.e. the subjectPublicKey of its PKIX encoding.
+type VerifierFactory func(publicKey []byte) (SignatureVerifier, error)
+
+// RegisterVerifier registers the verifier of an algorithm, replacing any
+// previous one. Verifiers are registered by default for the Ed25519, ECDSA
+// and RSA signing algorithms, for Falcon-1024 and the SPHINCS+ algorithms of
+// the post-quantum beta, and for the hybrid Ed25519-Dilithium2 and
+// Ed448-Dilithium3 algorithms, whose signatures are verified component by
+// component.
+func RegisterVerifier(algorithm AsymmetricAlgorithm, factory VerifierFactory) {
+	signer.RegisterVerifier(string(algorithm), func(publicKey []byte) (signer.Verifier, error) {
+		return factory(publicKey)
+	})
+}
+
+// NewVerifier returns a verifier for a public key of algorithm, in PEM format
+// as returned by Get.
+func NewVerifier(algorithm AsymmetricAlgorithm, publicKeyPEM string) (SignatureVerifier, error) {
+	return signer.NewVerifier(string(algorithm), publicKeyPEM)
+}
+
+// NewItemVerifier returns a verifier for the Vault key keyID, with its public
+// key from Get.
+//
+// @example
+//
+//	verifier, err := vault.NewItemVerifier(ctx, vaultcli, "pvi_...", vault.WithKeyVersion(2))
+//	if err != nil {
+//		return err
+//	}
+//
+//	ok, err := verifier.Verify(artifact, signature)
+func NewItemVerifier(ctx context.Context, client Client, keyID string, opts ...KeyOption) (SignatureVerifier, error) {
+	item, iv, err := fetchKeyVersion(ctx, client, keyID, opts)
+	if err != nil {
+		return nil, err
+	}
+	if iv.PublicKey == nil {
+		return nil, fmt.Errorf("vault: no public key for key %s", keyID)
+	}
+	return NewVerifier(AsymmetricAlgorithm(item.Algorithm), string(*iv.PublicKey))
+}